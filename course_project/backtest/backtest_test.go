@@ -0,0 +1,102 @@
+package backtest_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/backtest"
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
+	"github.com/stretchr/testify/assert"
+)
+
+type loggerTest struct{}
+
+func (loggerTest *loggerTest) Printf(format string, args ...interface{}) {}
+
+func TestLoadTickers(t *testing.T) {
+	jsonTickers, err := backtest.LoadTickers("testdata/tickers.jsonl")
+	assert.Nil(t, err)
+
+	csvTickers, err := backtest.LoadTickers("testdata/tickers.csv")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 12, len(jsonTickers))
+	assert.Equal(t, len(jsonTickers), len(csvTickers))
+	for i := range jsonTickers {
+		assert.Equal(t, jsonTickers[i].Symbol, csvTickers[i].Symbol)
+		assert.Equal(t, jsonTickers[i].Ask, csvTickers[i].Ask)
+		assert.Equal(t, jsonTickers[i].Bid, csvTickers[i].Bid)
+	}
+
+	_, err = backtest.ReadTickersJSONL(strings.NewReader(`{"product_id":"PI_XBTUSD","bid":1}`))
+	assert.NotNil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	tickers, err := backtest.LoadTickers("testdata/tickers.jsonl")
+	assert.Nil(t, err)
+
+	runner := backtest.NewRunner(tickers, backtest.NewExchange(1000, 0.0005), 1)
+	algorithm := services.NewAlgorithm(runner, strategies.NewDefaultRegistry(), runner, nil, nil, nil, &loggerTest{})
+
+	report, err := runner.Run(algorithm)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(report.Trades))
+	assert.Equal(t, domain.OrderSideBuy, report.Trades[0].OrderInfo.Side)
+	assert.Equal(t, 100.0, report.Trades[0].OrderInfo.Price)
+	assert.Equal(t, domain.OrderSideSell, report.Trades[1].OrderInfo.Side)
+	assert.Equal(t, 100.3, report.Trades[1].OrderInfo.Price)
+	assert.Equal(t, "2021-11-25T16:00:11.000Z", report.Trades[1].OrderInfo.Timestamp)
+
+	assert.Equal(t, 1, report.RoundTrips)
+	assert.Equal(t, 1.0, report.WinRate())
+	assert.InDelta(t, 0.10015, report.Fees, 1e-9)
+	assert.InDelta(t, 0.19985, report.RealizedPnL, 1e-9)
+	assert.InDelta(t, 1.0, report.MaxDrawdown, 1e-9)
+
+	var output bytes.Buffer
+	assert.Nil(t, report.Print(&output))
+	assert.Contains(t, output.String(), "Win rate:      100.00%")
+}
+
+func TestRunProtectiveStop(t *testing.T) {
+	tickers := []domain.Ticker{
+		{Symbol: "test", Time: 1000, Ask: 100, Bid: 99},
+		{Symbol: "test", Time: 2000, Ask: 100, Bid: 99},
+		// Stop at 95 closes the position
+		{Symbol: "test", Time: 3000, Ask: 94, Bid: 93},
+		// Strategy starts over and enters again
+		{Symbol: "test", Time: 4000, Ask: 94, Bid: 93},
+		{Symbol: "test", Time: 5000, Ask: 94, Bid: 93},
+		{Symbol: "test", Time: 6000, Ask: 96, Bid: 95.5},
+	}
+
+	registry := strategies.NewDefaultRegistry()
+	assert.Nil(t, registry.Select(domain.StrategyConfig{Name: strategies.TakeProfitName, Params: map[string]float64{"ratio": 0.01, "stop_loss": 0.05}}))
+
+	exchange := backtest.NewExchange(1000, 0)
+	runner := backtest.NewRunner(tickers, exchange, 1)
+	algorithm := services.NewAlgorithm(runner, registry, runner, nil, nil, exchange, &loggerTest{})
+
+	report, err := runner.Run(algorithm)
+	assert.Nil(t, err)
+
+	sides := []domain.OrderSide{}
+	prices := []float64{}
+	for _, trade := range report.Trades {
+		sides = append(sides, trade.OrderInfo.Side)
+		prices = append(prices, trade.OrderInfo.Price)
+	}
+	assert.Equal(t, []domain.OrderSide{domain.OrderSideBuy, domain.OrderSideSell, domain.OrderSideBuy, domain.OrderSideSell}, sides)
+	assert.Equal(t, []float64{100, 93, 94, 95.5}, prices)
+	assert.True(t, report.Trades[3].OrderInfo.ReduceOnly)
+
+	assert.Equal(t, 2, report.RoundTrips)
+	assert.Equal(t, 0.5, report.WinRate())
+	assert.InDelta(t, -5.5, report.RealizedPnL, 1e-9)
+	assert.Empty(t, exchange.GetState().Positions)
+}
@@ -0,0 +1,158 @@
+package backtest
+
+import (
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+)
+
+type Trade struct {
+	OrderInfo   domain.OrderInfo
+	RealizedPnL float64
+}
+
+// Exchange fills orders by the paper exchange and collects backtest statistics
+type Exchange struct {
+	paperExchange *services.PaperExchange
+	midPrices     map[string]float64
+	positions     map[string]*domain.Position
+	entryFees     map[string]float64
+	trades        []Trade
+	roundTrips    int
+	wins          int
+	realizedPnL   float64
+	fees          float64
+	peakEquity    float64
+	maxDrawdown   float64
+}
+
+// Fee rate is a part of the order notional paid on every fill, e.g. 0.0005
+func NewExchange(initialBalance float64, feeRate float64) *Exchange {
+	return &Exchange{
+		paperExchange: services.NewPaperExchange(initialBalance, feeRate),
+		midPrices:     make(map[string]float64),
+		positions:     make(map[string]*domain.Position),
+		entryFees:     make(map[string]float64),
+	}
+}
+
+// Set market prices used by the next orders, fill crossed resting orders and update equity curve.
+// Fills of the resting orders are returned, e.g. of the protective stops
+func (exchange *Exchange) UpdateTicker(ticker domain.Ticker) []domain.Fill {
+	exchange.paperExchange.UpdateTicker(ticker)
+	exchange.midPrices[ticker.Symbol] = ticker.Mid()
+
+	// Events of the ticker are already in the channel buffer
+	fills := []domain.Fill{}
+	accountEvents := exchange.paperExchange.GetAccountEventChannel()
+	for len(accountEvents) > 0 {
+		accountEvent := <-accountEvents
+		for _, fill := range accountEvent.Fills {
+			exchange.record(&domain.OrderInfo{
+				OrderID:     fill.OrderID,
+				ExecutionID: fill.FillID,
+				Status:      domain.OrderStatusFilled,
+				Symbol:      fill.Symbol,
+				Side:        fill.Side,
+				Price:       fill.Price,
+				Amount:      uint64(fill.Quantity),
+				Quantity:    uint64(fill.Quantity),
+				Fee:         fill.Fee,
+				Timestamp:   fill.Timestamp,
+			})
+			fills = append(fills, fill)
+		}
+	}
+
+	exchange.updateDrawdown()
+	return fills
+}
+
+// Market order of the given size
+func (exchange *Exchange) Order(ticker string, side domain.OrderSide, size uint64) (*domain.OrderInfo, error) {
+	return exchange.SendOrder(domain.NewMarketOrderRequest(ticker, side, size))
+}
+
+// Orders which are not executed right away rest until a ticker crosses their price
+func (exchange *Exchange) SendOrder(orderRequest domain.OrderRequest) (*domain.OrderInfo, error) {
+	orderInfo, err := exchange.paperExchange.SendOrder(orderRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if orderInfo.Status == domain.OrderStatusFilled {
+		exchange.record(orderInfo)
+		exchange.updateDrawdown()
+	}
+
+	return orderInfo, nil
+}
+
+func (exchange *Exchange) CancelOrder(orderID string) error {
+	return exchange.paperExchange.CancelOrder(orderID)
+}
+
+// Positions held now, so the strategies started over resume from them
+func (exchange *Exchange) GetState() domain.RiskState {
+	return domain.RiskState{Positions: exchange.paperExchange.GetPositions()}
+}
+
+func (exchange *Exchange) record(orderInfo *domain.OrderInfo) {
+	position, ok := exchange.positions[orderInfo.Symbol]
+	if !ok {
+		position = &domain.Position{Symbol: orderInfo.Symbol}
+		exchange.positions[orderInfo.Symbol] = position
+	}
+
+	previousQuantity := position.Quantity
+	realized := position.Fill(orderInfo.Side, float64(orderInfo.Amount), orderInfo.Price)
+
+	if previousQuantity != 0 && previousQuantity*position.Quantity <= 0 {
+		// Position is closed, the round trip result includes both entry and exit fees
+		roundTripPnL := realized - orderInfo.Fee - exchange.entryFees[orderInfo.Symbol]
+		exchange.roundTrips++
+		if roundTripPnL > 0 {
+			exchange.wins++
+		}
+		exchange.entryFees[orderInfo.Symbol] = 0
+	} else {
+		exchange.entryFees[orderInfo.Symbol] += orderInfo.Fee
+	}
+
+	exchange.realizedPnL += realized
+	exchange.fees += orderInfo.Fee
+
+	exchange.trades = append(exchange.trades, Trade{OrderInfo: *orderInfo, RealizedPnL: realized})
+}
+
+// Current equity: realized profit minus fees plus unrealized profit marked at mid price
+func (exchange *Exchange) Equity() float64 {
+	equity := exchange.realizedPnL - exchange.fees
+
+	for symbol, position := range exchange.positions {
+		equity += position.UnrealizedPnL(exchange.midPrices[symbol])
+	}
+
+	return equity
+}
+
+func (exchange *Exchange) Report() *Report {
+	return &Report{
+		Trades:      exchange.trades,
+		RoundTrips:  exchange.roundTrips,
+		Wins:        exchange.wins,
+		RealizedPnL: exchange.realizedPnL - exchange.fees,
+		Fees:        exchange.fees,
+		MaxDrawdown: exchange.maxDrawdown,
+	}
+}
+
+func (exchange *Exchange) updateDrawdown() {
+	equity := exchange.Equity()
+
+	if equity > exchange.peakEquity {
+		exchange.peakEquity = equity
+	}
+	if drawdown := exchange.peakEquity - equity; drawdown > exchange.maxDrawdown {
+		exchange.maxDrawdown = drawdown
+	}
+}
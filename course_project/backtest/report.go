@@ -0,0 +1,45 @@
+package backtest
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+type Report struct {
+	Trades     []Trade
+	RoundTrips int
+	Wins       int
+	// Realized profit after fees
+	RealizedPnL float64
+	Fees        float64
+	MaxDrawdown float64
+}
+
+// Part of the round trips closed with profit after fees
+func (report *Report) WinRate() float64 {
+	if report.RoundTrips == 0 {
+		return 0
+	}
+	return float64(report.Wins) / float64(report.RoundTrips)
+}
+
+func (report *Report) Print(writer io.Writer) error {
+	tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tableWriter, "TIME\tSYMBOL\tSIDE\tPRICE\tFEE\tREALIZED")
+	for _, trade := range report.Trades {
+		fmt.Fprintf(tableWriter, "%s\t%s\t%s\t%.2f\t%.4f\t%.4f\n",
+			trade.OrderInfo.Timestamp, trade.OrderInfo.Symbol, trade.OrderInfo.Side, trade.OrderInfo.Price, trade.OrderInfo.Fee, trade.RealizedPnL)
+	}
+	fmt.Fprintln(tableWriter)
+
+	fmt.Fprintf(tableWriter, "Trades:\t%d\n", len(report.Trades))
+	fmt.Fprintf(tableWriter, "Round trips:\t%d\n", report.RoundTrips)
+	fmt.Fprintf(tableWriter, "Win rate:\t%.2f%%\n", report.WinRate()*100)
+	fmt.Fprintf(tableWriter, "Realized PnL:\t%.4f\n", report.RealizedPnL)
+	fmt.Fprintf(tableWriter, "Fees:\t%.4f\n", report.Fees)
+	fmt.Fprintf(tableWriter, "Max drawdown:\t%.4f\n", report.MaxDrawdown)
+
+	return tableWriter.Flush()
+}
@@ -0,0 +1,128 @@
+package backtest
+
+import (
+	"errors"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type algorithmService interface {
+	GetDecisionChannel() <-chan domain.Decision
+	ResetStrategy(symbol string)
+}
+
+// Runner replays recorded tickers through an algorithm and executes its decisions on the simulated exchange.
+// Runner is the websocket client for the algorithm, tickers are sent one by one
+// and the next ticker is sent only after the decision for the previous one is executed.
+// Runner is also the instrument service, every instrument of the recorded tickers is traded.
+// Orders are sent like the trade bot does, with the planned protective stops
+type Runner struct {
+	tickers       []domain.Ticker
+	tickerChannel chan domain.Ticker
+	exchange      *Exchange
+	orderSize     uint64
+	// Order ids of the protective stops by symbol
+	protectiveStops map[string]string
+}
+
+func NewRunner(tickers []domain.Ticker, exchange *Exchange, orderSize uint64) *Runner {
+	return &Runner{
+		tickers:         tickers,
+		tickerChannel:   make(chan domain.Ticker),
+		exchange:        exchange,
+		orderSize:       orderSize,
+		protectiveStops: make(map[string]string),
+	}
+}
+
+func (runner *Runner) GetInstrument(symbol string) (domain.InstrumentConfig, bool) {
+	return domain.InstrumentConfig{Symbol: symbol, OrderSize: runner.orderSize, Enabled: true}, true
+}
+
+func (runner *Runner) GetTickerChannel() <-chan domain.Ticker {
+	return runner.tickerChannel
+}
+
+func (runner *Runner) Run(algorithmService algorithmService) (*Report, error) {
+	decisionChannel := algorithmService.GetDecisionChannel()
+
+	defer func() {
+		close(runner.tickerChannel)
+		for range decisionChannel {
+			// Wait for the algorithm to stop
+		}
+	}()
+
+	for _, ticker := range runner.tickers {
+		// Strategy of the position closed by the protective stop starts over, like in the trade bot
+		for _, fill := range runner.exchange.UpdateTicker(ticker) {
+			if stopOrderID, ok := runner.protectiveStops[fill.Symbol]; ok && stopOrderID == fill.OrderID {
+				delete(runner.protectiveStops, fill.Symbol)
+				algorithmService.ResetStrategy(fill.Symbol)
+			}
+		}
+		runner.tickerChannel <- ticker
+
+		decision, ok := <-decisionChannel
+		if !ok {
+			return nil, errors.New("algorithm stopped before the end of the tickers")
+		}
+
+		if decision.Action == domain.ActionBuy || decision.Action == domain.ActionSell {
+			if err := runner.execute(decision); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return runner.exchange.Report(), nil
+}
+
+func (runner *Runner) execute(decision domain.Decision) error {
+	side := domain.OrderSideBuy
+	if decision.Action == domain.ActionSell {
+		side = domain.OrderSideSell
+	}
+
+	orderRequest := domain.NewMarketOrderRequest(decision.Symbol, side, runner.orderSize)
+	if decision.Plan.Size != 0 {
+		orderRequest.Size = decision.Plan.Size
+	}
+	orderRequest.ReduceOnly = decision.Plan.ReduceOnly
+
+	// The new order changes the position, so the stop protecting the old one is not needed
+	if stopOrderID, ok := runner.protectiveStops[decision.Symbol]; ok {
+		if err := runner.exchange.CancelOrder(stopOrderID); err != nil {
+			return err
+		}
+		delete(runner.protectiveStops, decision.Symbol)
+	}
+
+	orderInfo, err := runner.exchange.SendOrder(orderRequest)
+	if err != nil {
+		return err
+	}
+
+	if decision.Plan.StopPrice == 0 || orderInfo.Amount == 0 {
+		return nil
+	}
+
+	stopSide := domain.OrderSideSell
+	if side == domain.OrderSideSell {
+		stopSide = domain.OrderSideBuy
+	}
+	stopInfo, err := runner.exchange.SendOrder(domain.OrderRequest{
+		Symbol:     decision.Symbol,
+		Side:       stopSide,
+		OrderType:  domain.OrderTypeStop,
+		Size:       orderInfo.Amount,
+		StopPrice:  decision.Plan.StopPrice,
+		ReduceOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	runner.protectiveStops[decision.Symbol] = stopInfo.OrderID
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package backtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Load recorded tickers from a .jsonl file with one websocket ticker message per line
+// or from a .csv file with a header row, columns are named after the ticker message fields
+func LoadTickers(path string) ([]domain.Ticker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".json":
+		return ReadTickersJSONL(file)
+	case ".csv":
+		return ReadTickersCSV(file)
+	default:
+		return nil, fmt.Errorf("unsupported tickers file format %q", filepath.Ext(path))
+	}
+}
+
+func ReadTickersJSONL(reader io.Reader) ([]domain.Ticker, error) {
+	var tickers []domain.Ticker
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var ticker domain.Ticker
+		if err := json.Unmarshal(scanner.Bytes(), &ticker); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := ticker.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		tickers = append(tickers, ticker)
+	}
+
+	return tickers, scanner.Err()
+}
+
+func ReadTickersCSV(reader io.Reader) ([]domain.Ticker, error) {
+	csvReader := csv.NewReader(reader)
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var tickers []domain.Ticker
+
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		// Columns are decoded the same way as the fields of the json message
+		message := make(map[string]interface{})
+		for i, column := range header {
+			if number, err := strconv.ParseFloat(record[i], 64); err == nil {
+				message[column] = number
+			} else if boolean, err := strconv.ParseBool(record[i]); err == nil {
+				message[column] = boolean
+			} else {
+				message[column] = record[i]
+			}
+		}
+
+		var ticker domain.Ticker
+		bytes, _ := json.Marshal(message)
+		if err := json.Unmarshal(bytes, &ticker); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := ticker.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		tickers = append(tickers, ticker)
+	}
+
+	return tickers, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/legendiguess/kraken-trade-bot/backtest"
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	tickersPath := flag.String("tickers", "", "recorded tickers, .jsonl or .csv file")
+	strategyName := flag.String("strategy", strategies.TakeProfitName, "strategy name")
+	strategyParams := flag.String("params", "{}", "strategy params in json, e.g. {\"ratio\": 0.001}")
+	feeRate := flag.Float64("fee", services.PaperExchangeFeeRate, "fee rate paid on every fill")
+	initialBalance := flag.Float64("balance", 1000000, "initial balance of the simulated account")
+	orderSize := flag.Uint64("size", 1, "number of contracts in every order")
+	flag.Parse()
+
+	logger := log.New()
+
+	if *tickersPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := domain.StrategyConfig{Name: *strategyName}
+	if err := json.Unmarshal([]byte(*strategyParams), &config.Params); err != nil {
+		logger.Fatalf("Can't parse strategy params: %v", err)
+	}
+
+	registry := strategies.NewDefaultRegistry()
+	if err := registry.Select(config); err != nil {
+		logger.Fatalf("Can't select strategy: %v", err)
+	}
+
+	tickers, err := backtest.LoadTickers(*tickersPath)
+	if err != nil {
+		logger.Fatalf("Can't load tickers: %v", err)
+	}
+
+	exchange := backtest.NewExchange(*initialBalance, *feeRate)
+	runner := backtest.NewRunner(tickers, exchange, *orderSize)
+	algorithm := services.NewAlgorithm(runner, registry, runner, nil, nil, exchange, logger)
+
+	report, err := runner.Run(algorithm)
+	if err != nil {
+		logger.Fatalf("Backtest failed: %v", err)
+	}
+
+	if err := report.Print(os.Stdout); err != nil {
+		logger.Fatalf("%v", err)
+	}
+}
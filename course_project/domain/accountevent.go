@@ -0,0 +1,69 @@
+package domain
+
+type AccountEventType string
+
+const (
+	AccountEventFills       = AccountEventType("fills")
+	AccountEventOpenOrders  = AccountEventType("open_orders")
+	AccountEventOrderClosed = AccountEventType("order_closed")
+	AccountEventPositions   = AccountEventType("positions")
+	AccountEventBalances    = AccountEventType("balances")
+)
+
+// Reason of AccountEventOrderClosed for completely executed orders
+const OrderClosedFullFill = "full_fill"
+
+// AccountEvent is an update of the private account feeds, only the fields of its type are set
+type AccountEvent struct {
+	Type AccountEventType
+	// Snapshot events contain the whole state sent after subscription
+	Snapshot bool
+
+	Fills      []Fill
+	OpenOrders []OpenOrder
+
+	// Closed order
+	OrderID       string
+	ClientOrderID string
+	Reason        string
+
+	Positions      []Position
+	MarginAccounts []MarginAccount
+}
+
+type Fill struct {
+	FillID        string
+	OrderID       string
+	ClientOrderID string
+	Symbol        string
+	Side          OrderSide
+	Price         float64
+	Quantity      float64
+	Fee           float64
+	FillType      string
+	Timestamp     string
+}
+
+type OpenOrder struct {
+	OrderID       string
+	ClientOrderID string
+	Symbol        string
+	Side          OrderSide
+	Type          string
+	Quantity      float64
+	Filled        float64
+	LimitPrice    float64
+	StopPrice     float64
+	ReduceOnly    bool
+	Timestamp     string
+}
+
+type MarginAccount struct {
+	Name              string  `json:"name"`
+	Balance           float64 `json:"balance"`
+	PortfolioValue    float64 `json:"portfolio_value"`
+	AvailableMargin   float64 `json:"available_margin"`
+	InitialMargin     float64 `json:"initial_margin"`
+	MaintenanceMargin float64 `json:"maintenance_margin"`
+	PnL               float64 `json:"pnl"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+type APIRole string
+
+const (
+	// Only GET requests are allowed
+	APIRoleReadOnly = APIRole("read_only")
+	// All requests are allowed, including the key management
+	APIRoleOperator = APIRole("operator")
+)
+
+// APIKey grants access to the REST API, only the SHA-256 hash of the key is stored.
+// Requests made with a key that has a signing secret must be signed with HMAC-SHA256
+type APIKey struct {
+	ID            uint    `json:"-" gorm:"primaryKey"`
+	Name          string  `json:"name" gorm:"uniqueIndex"`
+	KeyHash       string  `json:"-" gorm:"uniqueIndex"`
+	Role          APIRole `json:"role"`
+	SigningSecret string  `json:"-"`
+	Created       string  `json:"created"`
+}
+
+// NewAPIKey is the answer to the key creation, the key and the secret are shown only once
+type NewAPIKey struct {
+	Name          string  `json:"name"`
+	Role          APIRole `json:"role"`
+	Key           string  `json:"key"`
+	SigningSecret string  `json:"signing_secret,omitempty"`
+}
@@ -0,0 +1,11 @@
+package domain
+
+// BlockedOrder is an order rejected by the risk engine before it was sent to the exchange
+type BlockedOrder struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Symbol    string    `json:"symbol"`
+	Side      OrderSide `json:"side"`
+	Size      uint64    `json:"size"`
+	Reason    string    `json:"reason"`
+	Timestamp string    `json:"timestamp"`
+}
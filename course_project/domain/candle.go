@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type CandlePeriod string
+
+const (
+	CandlePeriod1m  = CandlePeriod("1m")
+	CandlePeriod5m  = CandlePeriod("5m")
+	CandlePeriod15m = CandlePeriod("15m")
+	CandlePeriod1h  = CandlePeriod("1h")
+)
+
+// Supported periods from the shortest one
+var CandlePeriods = []CandlePeriod{CandlePeriod1m, CandlePeriod5m, CandlePeriod15m, CandlePeriod1h}
+
+var candlePeriodDurations = map[CandlePeriod]time.Duration{
+	CandlePeriod1m:  time.Minute,
+	CandlePeriod5m:  5 * time.Minute,
+	CandlePeriod15m: 15 * time.Minute,
+	CandlePeriod1h:  time.Hour,
+}
+
+// Parse comma separated periods, e.g. "1m,5m"
+func ParseCandlePeriods(periods string) ([]CandlePeriod, error) {
+	var candlePeriods []CandlePeriod
+	for _, period := range strings.Split(periods, ",") {
+		candlePeriod := CandlePeriod(strings.TrimSpace(period))
+		if _, ok := candlePeriodDurations[candlePeriod]; !ok {
+			return nil, fmt.Errorf("unknown candle period %q, supported periods are %v", candlePeriod, CandlePeriods)
+		}
+		candlePeriods = append(candlePeriods, candlePeriod)
+	}
+	return candlePeriods, nil
+}
+
+// Zero for unknown periods
+func (candlePeriod CandlePeriod) Duration() time.Duration {
+	return candlePeriodDurations[candlePeriod]
+}
+
+// Start of the period containing the time, periods are aligned to the unix epoch in UTC
+func (candlePeriod CandlePeriod) Start(at time.Time) time.Time {
+	return at.UTC().Truncate(candlePeriod.Duration())
+}
+
+// Candle is an OHLCV bar of a symbol, volume is counted only from the trades
+type Candle struct {
+	ID     uint         `json:"-" gorm:"primaryKey"`
+	Symbol string       `json:"symbol" gorm:"index:idx_candle_series"`
+	Period CandlePeriod `json:"period" gorm:"index:idx_candle_series"`
+	Start  time.Time    `json:"start" gorm:"index:idx_candle_series"`
+	Open   float64      `json:"open"`
+	High   float64      `json:"high"`
+	Low    float64      `json:"low"`
+	Close  float64      `json:"close"`
+	Volume float64      `json:"volume"`
+	Trades int          `json:"trades"`
+}
+
+// Create candle opened by the price
+func NewCandle(symbol string, period CandlePeriod, start time.Time, price float64) Candle {
+	return Candle{Symbol: symbol, Period: period, Start: start, Open: price, High: price, Low: price, Close: price}
+}
+
+// Add price of a ticker (zero size) or a trade
+func (candle *Candle) Update(price float64, size float64) {
+	candle.High = math.Max(candle.High, price)
+	candle.Low = math.Min(candle.Low, price)
+	candle.Close = price
+	if size > 0 {
+		candle.Volume += size
+		candle.Trades++
+	}
+}
@@ -0,0 +1,37 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCandlePeriods(t *testing.T) {
+	periods, err := domain.ParseCandlePeriods("1m, 15m")
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.CandlePeriod{domain.CandlePeriod1m, domain.CandlePeriod15m}, periods)
+
+	_, err = domain.ParseCandlePeriods("1m,2m")
+	assert.NotNil(t, err)
+}
+
+func TestCandle(t *testing.T) {
+	at := time.Date(2021, 11, 25, 19, 51, 11, 0, time.FixedZone("MSK", 3*60*60))
+	assert.Equal(t, time.Date(2021, 11, 25, 16, 51, 0, 0, time.UTC), domain.CandlePeriod1m.Start(at))
+	assert.Equal(t, time.Date(2021, 11, 25, 16, 45, 0, 0, time.UTC), domain.CandlePeriod15m.Start(at))
+	assert.Equal(t, time.Date(2021, 11, 25, 16, 0, 0, 0, time.UTC), domain.CandlePeriod1h.Start(at))
+
+	candle := domain.NewCandle("test", domain.CandlePeriod1m, domain.CandlePeriod1m.Start(at), 100)
+	candle.Update(105, 2)
+	candle.Update(95, 0)
+	candle.Update(99, 1)
+
+	assert.Equal(t, 100.0, candle.Open)
+	assert.Equal(t, 105.0, candle.High)
+	assert.Equal(t, 95.0, candle.Low)
+	assert.Equal(t, 99.0, candle.Close)
+	assert.Equal(t, 3.0, candle.Volume)
+	assert.Equal(t, 2, candle.Trades)
+}
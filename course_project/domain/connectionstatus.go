@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+type ConnectionState string
+
+const (
+	ConnectionStateConnecting   = ConnectionState("connecting")
+	ConnectionStateConnected    = ConnectionState("connected")
+	ConnectionStateReconnecting = ConnectionState("reconnecting")
+	ConnectionStateClosed       = ConnectionState("closed")
+)
+
+type ConnectionStatus struct {
+	State ConnectionState `json:"state"`
+	// Time of the last state change
+	Since      time.Time `json:"since"`
+	Reconnects int       `json:"reconnects"`
+	// Ticker messages skipped because they can't be decoded or have no prices
+	MalformedTickers int `json:"malformed_tickers"`
+	// Ticker messages missed according to their sequence numbers, skipped malformed tickers are counted too
+	SequenceGaps int `json:"sequence_gaps"`
+	// Order books requested again because a book update was missed
+	BookResyncs int `json:"book_resyncs"`
+	// Active subscriptions by feed
+	Subscriptions map[string][]string `json:"subscriptions"`
+}
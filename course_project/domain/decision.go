@@ -0,0 +1,17 @@
+package domain
+
+// Decision is an action made by the strategy of the instrument
+type Decision struct {
+	Symbol string
+	Action Action
+	Plan   OrderPlan
+}
+
+// OrderPlan holds optional order details chosen by the strategy
+type OrderPlan struct {
+	// Zero size means the order size of the instrument
+	Size       uint64
+	ReduceOnly bool
+	// Reduce only stop order with this price is placed after the order is executed, zero means no stop
+	StopPrice float64
+}
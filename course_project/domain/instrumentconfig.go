@@ -1,5 +1,14 @@
 package domain
 
 type InstrumentConfig struct {
-	Symbol string
+	Symbol string `json:"symbol" gorm:"primaryKey"`
+	// Number of contracts in every order
+	OrderSize uint64 `json:"order_size"`
+	// Disabled instrument is not traded, but its config is kept
+	Enabled bool `json:"enabled"`
+}
+
+// Config used for the fields missing in the REST request
+func NewInstrumentConfig(symbol string) InstrumentConfig {
+	return InstrumentConfig{Symbol: symbol, OrderSize: 1, Enabled: true}
 }
@@ -0,0 +1,13 @@
+package domain
+
+type Language string
+
+const (
+	LanguageRussian = Language("ru")
+	LanguageEnglish = Language("en")
+)
+
+const (
+	DefaultLanguage = LanguageRussian
+	DefaultTimezone = "Europe/Moscow"
+)
@@ -0,0 +1,56 @@
+package domain
+
+// Instrument is a contract listed on the exchange
+type Instrument struct {
+	Symbol       string  `json:"symbol"`
+	Type         string  `json:"type"`
+	Underlying   string  `json:"underlying"`
+	Tradeable    bool    `json:"tradeable"`
+	TickSize     float64 `json:"tick_size"`
+	ContractSize float64 `json:"contract_size"`
+	// Empty for perpetual contracts
+	LastTradingTime string `json:"last_trading_time"`
+	Tag             string `json:"tag"`
+}
+
+// MarketTicker is a market summary returned by the tickers endpoint
+type MarketTicker struct {
+	Symbol       string  `json:"symbol"`
+	Bid          float64 `json:"bid"`
+	BidSize      float64 `json:"bid_size"`
+	Ask          float64 `json:"ask"`
+	AskSize      float64 `json:"ask_size"`
+	Last         float64 `json:"last"`
+	LastSize     float64 `json:"last_size"`
+	LastTime     string  `json:"last_time"`
+	Open24h      float64 `json:"open_24h"`
+	Volume24h    float64 `json:"volume_24h"`
+	OpenInterest float64 `json:"open_interest"`
+	MarkPrice    float64 `json:"mark_price"`
+	Suspended    bool    `json:"suspended"`
+	Tag          string  `json:"tag"`
+}
+
+type PriceLevel struct {
+	Price float64 `json:"price"`
+	Size  float64 `json:"size"`
+}
+
+// OrderBookSnapshot holds bids sorted from the best (highest) price and asks from the best (lowest) price
+type OrderBookSnapshot struct {
+	Symbol string       `json:"symbol"`
+	Bids   []PriceLevel `json:"bids"`
+	Asks   []PriceLevel `json:"asks"`
+}
+
+// MarketTrade is a public trade from the history endpoint, side is the side of the taker
+type MarketTrade struct {
+	TradeID uint64    `json:"trade_id"`
+	UID     string    `json:"uid"`
+	Symbol  string    `json:"symbol"`
+	Side    OrderSide `json:"side"`
+	Price   float64   `json:"price"`
+	Size    float64   `json:"size"`
+	Type    string    `json:"type"`
+	Time    string    `json:"time"`
+}
@@ -0,0 +1,75 @@
+package domain
+
+import "strings"
+
+type NotificationChannel string
+
+const (
+	NotificationChannelTelegram = NotificationChannel("telegram")
+	NotificationChannelWebhook  = NotificationChannel("webhook")
+	NotificationChannelEmail    = NotificationChannel("email")
+)
+
+type NotificationKind string
+
+const (
+	NotificationKindOrder          = NotificationKind("order")
+	NotificationKindBlockedOrder   = NotificationKind("blocked_order")
+	NotificationKindReconciliation = NotificationKind("reconciliation")
+	NotificationKindError          = NotificationKind("error")
+	NotificationKindDailySummary   = NotificationKind("daily_summary")
+)
+
+// NotificationCategory groups the kinds the subscribers can turn on and off
+type NotificationCategory string
+
+const (
+	NotificationCategoryFills   = NotificationCategory("fills")
+	NotificationCategoryRisk    = NotificationCategory("risk")
+	NotificationCategoryErrors  = NotificationCategory("errors")
+	NotificationCategorySummary = NotificationCategory("summary")
+)
+
+var NotificationCategories = []NotificationCategory{NotificationCategoryFills, NotificationCategoryRisk, NotificationCategoryErrors, NotificationCategorySummary}
+
+// Notification is sent to the subscribers, only the field of the kind is set
+type Notification struct {
+	Kind           NotificationKind `json:"kind"`
+	OrderInfo      *OrderInfo       `json:"order_info,omitempty"`
+	BlockedOrder   *BlockedOrder    `json:"blocked_order,omitempty"`
+	Reconciliation *Reconciliation  `json:"reconciliation,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	Summary        *PnLReport       `json:"summary,omitempty"`
+}
+
+func (notification Notification) Category() NotificationCategory {
+	switch notification.Kind {
+	case NotificationKindOrder:
+		return NotificationCategoryFills
+	case NotificationKindBlockedOrder:
+		return NotificationCategoryRisk
+	case NotificationKindDailySummary:
+		return NotificationCategorySummary
+	}
+	return NotificationCategoryErrors
+}
+
+// Channels of the comma separated list, e.g. "telegram,email"
+func ParseNotificationChannels(channels string) []NotificationChannel {
+	result := []NotificationChannel{}
+	for _, channel := range splitList(channels) {
+		result = append(result, NotificationChannel(channel))
+	}
+	return result
+}
+
+// Trimmed non-empty items of the comma separated list
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"math"
+	"sort"
+)
+
+// OrderBook is the local copy of the order book kept up to date by the book feed
+type OrderBook struct {
+	OrderBookSnapshot
+	Sequence uint64 `json:"seq"`
+	// Time of the last update in milliseconds
+	Time int64 `json:"timestamp"`
+}
+
+// Copy has its own levels, so it can be read while the original is updated
+func (orderBook *OrderBook) Copy() OrderBook {
+	copied := *orderBook
+	copied.Bids = append([]PriceLevel(nil), orderBook.Bids...)
+	copied.Asks = append([]PriceLevel(nil), orderBook.Asks...)
+	return copied
+}
+
+// Set the size of the price level on the bid (buy) or ask (sell) side, zero size removes the level
+func (orderBookSnapshot *OrderBookSnapshot) Update(side OrderSide, price float64, size float64) {
+	levels := &orderBookSnapshot.Asks
+	better := func(a, b float64) bool { return a < b }
+	if side == OrderSideBuy {
+		levels = &orderBookSnapshot.Bids
+		better = func(a, b float64) bool { return a > b }
+	}
+
+	index := sort.Search(len(*levels), func(i int) bool {
+		return !better((*levels)[i].Price, price)
+	})
+	found := index < len(*levels) && (*levels)[index].Price == price
+
+	switch {
+	case size <= 0 && found:
+		*levels = append((*levels)[:index], (*levels)[index+1:]...)
+	case size <= 0:
+	case found:
+		(*levels)[index].Size = size
+	default:
+		*levels = append(*levels, PriceLevel{})
+		copy((*levels)[index+1:], (*levels)[index:])
+		(*levels)[index] = PriceLevel{Price: price, Size: size}
+	}
+}
+
+// Mid price of the best bid and ask, false if a side is empty
+func (orderBookSnapshot *OrderBookSnapshot) Mid() (float64, bool) {
+	if len(orderBookSnapshot.Bids) == 0 || len(orderBookSnapshot.Asks) == 0 {
+		return 0, false
+	}
+	return (orderBookSnapshot.Bids[0].Price + orderBookSnapshot.Asks[0].Price) / 2, true
+}
+
+// Total size of the best bid levels, all levels are counted if levels is not positive
+func (orderBookSnapshot *OrderBookSnapshot) BidDepth(levels int) float64 {
+	return depth(orderBookSnapshot.Bids, levels)
+}
+
+// Total size of the best ask levels, all levels are counted if levels is not positive
+func (orderBookSnapshot *OrderBookSnapshot) AskDepth(levels int) float64 {
+	return depth(orderBookSnapshot.Asks, levels)
+}
+
+// Imbalance of the best levels from -1 (only asks) to 1 (only bids), zero for an empty book
+func (orderBookSnapshot *OrderBookSnapshot) Imbalance(levels int) float64 {
+	bids := orderBookSnapshot.BidDepth(levels)
+	asks := orderBookSnapshot.AskDepth(levels)
+	if bids+asks == 0 {
+		return 0
+	}
+	return (bids - asks) / (bids + asks)
+}
+
+// Average price of a market order walking the book, buy orders take the asks and sell orders the bids.
+// False if the book is not deep enough to fill the size
+func (orderBookSnapshot *OrderBookSnapshot) AveragePrice(side OrderSide, size float64) (float64, bool) {
+	levels := orderBookSnapshot.Asks
+	if side == OrderSideSell {
+		levels = orderBookSnapshot.Bids
+	}
+	if size <= 0 || len(levels) == 0 {
+		return 0, false
+	}
+
+	remaining := size
+	cost := 0.0
+	for _, level := range levels {
+		filled := math.Min(remaining, level.Size)
+		cost += filled * level.Price
+		remaining -= filled
+		if remaining <= 0 {
+			return cost / size, true
+		}
+	}
+	return 0, false
+}
+
+// Estimated slippage of a market order as a fraction of the mid price, so half of the spread is included.
+// Positive value is the cost of the order, false if the book is not deep enough
+func (orderBookSnapshot *OrderBookSnapshot) Slippage(side OrderSide, size float64) (float64, bool) {
+	mid, ok := orderBookSnapshot.Mid()
+	if !ok {
+		return 0, false
+	}
+	price, ok := orderBookSnapshot.AveragePrice(side, size)
+	if !ok {
+		return 0, false
+	}
+
+	if side == OrderSideSell {
+		return (mid - price) / mid, true
+	}
+	return (price - mid) / mid, true
+}
+
+func depth(levels []PriceLevel, count int) float64 {
+	if count <= 0 || count > len(levels) {
+		count = len(levels)
+	}
+
+	total := 0.0
+	for _, level := range levels[:count] {
+		total += level.Size
+	}
+	return total
+}
@@ -0,0 +1,60 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOrderBook() domain.OrderBookSnapshot {
+	orderBook := domain.OrderBookSnapshot{Symbol: "test"}
+	orderBook.Update(domain.OrderSideBuy, 98, 3)
+	orderBook.Update(domain.OrderSideBuy, 99, 1)
+	orderBook.Update(domain.OrderSideSell, 102, 4)
+	orderBook.Update(domain.OrderSideSell, 101, 2)
+	return orderBook
+}
+
+func TestOrderBookUpdate(t *testing.T) {
+	orderBook := newTestOrderBook()
+	assert.Equal(t, []domain.PriceLevel{{Price: 99, Size: 1}, {Price: 98, Size: 3}}, orderBook.Bids)
+	assert.Equal(t, []domain.PriceLevel{{Price: 101, Size: 2}, {Price: 102, Size: 4}}, orderBook.Asks)
+
+	orderBook.Update(domain.OrderSideBuy, 98.5, 2)
+	orderBook.Update(domain.OrderSideBuy, 99, 0)
+	orderBook.Update(domain.OrderSideSell, 102, 5)
+	// Removing a missing level changes nothing
+	orderBook.Update(domain.OrderSideSell, 110, 0)
+
+	assert.Equal(t, []domain.PriceLevel{{Price: 98.5, Size: 2}, {Price: 98, Size: 3}}, orderBook.Bids)
+	assert.Equal(t, []domain.PriceLevel{{Price: 101, Size: 2}, {Price: 102, Size: 5}}, orderBook.Asks)
+}
+
+func TestOrderBookQueries(t *testing.T) {
+	orderBook := newTestOrderBook()
+
+	mid, ok := orderBook.Mid()
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 100.0, mid)
+
+	assert.Equal(t, 1.0, orderBook.BidDepth(1))
+	assert.Equal(t, 4.0, orderBook.BidDepth(0))
+	assert.Equal(t, 6.0, orderBook.AskDepth(10))
+	assert.Equal(t, -1.0/3, orderBook.Imbalance(1))
+	assert.Equal(t, -0.2, orderBook.Imbalance(0))
+
+	price, ok := orderBook.AveragePrice(domain.OrderSideBuy, 4)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 101.5, price)
+
+	slippage, ok := orderBook.Slippage(domain.OrderSideSell, 2)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 0.015, slippage)
+
+	_, ok = orderBook.AveragePrice(domain.OrderSideSell, 5)
+	assert.Equal(t, false, ok)
+	_, ok = (&domain.OrderBookSnapshot{}).Slippage(domain.OrderSideBuy, 1)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 0.0, (&domain.OrderBookSnapshot{}).Imbalance(0))
+}
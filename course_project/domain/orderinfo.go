@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type OrderSide string
 
 const (
@@ -7,15 +9,54 @@ const (
 	OrderSideSell = OrderSide("sell")
 )
 
+type OrderStatus string
+
+const (
+	// Order is executed completely or partially, Amount is the executed size
+	OrderStatusFilled = OrderStatus("filled")
+	// Order rests in the order book or waits for its stop price
+	OrderStatusPlaced = OrderStatus("placed")
+	// Placed order is cancelled before it was executed completely
+	OrderStatusCancelled = OrderStatus("cancelled")
+)
+
 type OrderInfo struct {
+	// Increases with every saved order, used as the pagination cursor
+	ID          uint   `json:"id" gorm:"primaryKey"`
 	OrderID     string `json:"order_id"`
-	ExecutionID string `json:"executionId"`
-	Price       float64
-	Amount      uint64
-	Type        string
-	Symbol      string
-	Side        OrderSide
-	Quantity    uint64
-	LimitPrice  float64
-	Timestamp   string
+	ExecutionID string `json:"execution_id"`
+	// Comma separated IDs of the other executions returned when the order was sent,
+	// the fills feed delivers them too and they must not be counted again
+	LaterExecutionIDs string      `json:"later_execution_ids"`
+	ClientOrderID     string      `json:"client_order_id"`
+	Status            OrderStatus `json:"status"`
+	Price             float64     `json:"price"`
+	Amount            uint64      `json:"amount"`
+	Type              string      `json:"type"`
+	Symbol            string      `json:"symbol"`
+	Side              OrderSide   `json:"side"`
+	Quantity          uint64      `json:"quantity"`
+	LimitPrice        float64     `json:"limit_price"`
+	StopPrice         float64     `json:"stop_price"`
+	ReduceOnly        bool        `json:"reduce_only"`
+	Fee               float64     `json:"fee"`
+	Timestamp         string      `json:"timestamp"`
+}
+
+// OrderFilter selects saved orders from the newest one, zero fields are not checked.
+// Symbol is compared case insensitively, From is inclusive and To is exclusive
+type OrderFilter struct {
+	Symbol string
+	Side   OrderSide
+	From   time.Time
+	To     time.Time
+	// Only orders saved before the order with this ID
+	Cursor uint
+	Limit  int
+}
+
+// OrderPage is a page of orders from the newest one, NextCursor is empty on the last page
+type OrderPage struct {
+	Orders     []OrderInfo `json:"orders"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
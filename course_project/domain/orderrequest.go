@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+type OrderType string
+
+const (
+	OrderTypeMarket     = OrderType("mkt")
+	OrderTypeLimit      = OrderType("lmt")
+	OrderTypeStop       = OrderType("stp")
+	OrderTypeTakeProfit = OrderType("take_profit")
+	OrderTypeIOC        = OrderType("ioc")
+	OrderTypePost       = OrderType("post")
+)
+
+// OrderRequest holds all parameters of the sendorder request
+type OrderRequest struct {
+	Symbol    string
+	Side      OrderSide
+	OrderType OrderType
+	Size      uint64
+	// Required for lmt, ioc and post orders, for stp and take_profit it is the worst fill price
+	LimitPrice float64
+	// Trigger price of stp and take_profit orders
+	StopPrice     float64
+	ReduceOnly    bool
+	ClientOrderID string
+}
+
+// Market order of the given size
+func NewMarketOrderRequest(symbol string, side OrderSide, size uint64) OrderRequest {
+	return OrderRequest{Symbol: symbol, Side: side, OrderType: OrderTypeMarket, Size: size}
+}
+
+// Check that the request has all parameters required by its order type
+func (orderRequest *OrderRequest) Validate() error {
+	if orderRequest.Symbol == "" {
+		return errors.New("symbol is required")
+	}
+	if orderRequest.Side != OrderSideBuy && orderRequest.Side != OrderSideSell {
+		return fmt.Errorf("unknown order side %q", orderRequest.Side)
+	}
+	if orderRequest.Size == 0 {
+		return errors.New("size must be positive")
+	}
+	if orderRequest.LimitPrice < 0 || orderRequest.StopPrice < 0 {
+		return errors.New("prices must not be negative")
+	}
+
+	switch orderRequest.OrderType {
+	case OrderTypeMarket:
+		if orderRequest.LimitPrice != 0 || orderRequest.StopPrice != 0 {
+			return errors.New("market order can't have limit or stop price")
+		}
+	case OrderTypeLimit, OrderTypeIOC, OrderTypePost:
+		if orderRequest.LimitPrice == 0 {
+			return fmt.Errorf("%s order requires limit price", orderRequest.OrderType)
+		}
+		if orderRequest.StopPrice != 0 {
+			return fmt.Errorf("%s order can't have stop price", orderRequest.OrderType)
+		}
+	case OrderTypeStop, OrderTypeTakeProfit:
+		if orderRequest.StopPrice == 0 {
+			return fmt.Errorf("%s order requires stop price", orderRequest.OrderType)
+		}
+	default:
+		return fmt.Errorf("unknown order type %q", orderRequest.OrderType)
+	}
+
+	return nil
+}
+
+// OrderEdit changes a resting order found by OrderID or ClientOrderID, zero fields are left unchanged
+type OrderEdit struct {
+	OrderID       string
+	ClientOrderID string
+	Size          uint64
+	LimitPrice    float64
+	StopPrice     float64
+}
+
+func (orderEdit *OrderEdit) Validate() error {
+	if orderEdit.OrderID == "" && orderEdit.ClientOrderID == "" {
+		return errors.New("order id or client order id is required")
+	}
+	if orderEdit.LimitPrice < 0 || orderEdit.StopPrice < 0 {
+		return errors.New("prices must not be negative")
+	}
+	if orderEdit.Size == 0 && orderEdit.LimitPrice == 0 && orderEdit.StopPrice == 0 {
+		return errors.New("nothing to edit")
+	}
+	return nil
+}
+
+// BatchInstruction is a single instruction of the batchorder request, exactly one of the fields is set
+type BatchInstruction struct {
+	Send          *OrderRequest
+	Edit          *OrderEdit
+	CancelOrderID string
+}
+
+// BatchResult is the outcome of the batch instruction with the same index
+type BatchResult struct {
+	OrderID string
+	// Exchange status, e.g. "placed", "edited", "cancelled" or the failure reason
+	Status string
+	// Reason of the rejected order, empty if the instruction succeeded
+	RejectReason string
+}
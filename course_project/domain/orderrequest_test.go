@@ -0,0 +1,44 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderRequestValidate(t *testing.T) {
+	valid := []domain.OrderRequest{
+		domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 1),
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeLimit, Size: 2, LimitPrice: 100},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypePost, Size: 2, LimitPrice: 100, ClientOrderID: "id"},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 1, StopPrice: 90, ReduceOnly: true},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeTakeProfit, Size: 1, StopPrice: 110, LimitPrice: 109},
+	}
+	for _, orderRequest := range valid {
+		assert.Nil(t, orderRequest.Validate(), orderRequest)
+	}
+
+	invalid := []domain.OrderRequest{
+		{Side: domain.OrderSideBuy, OrderType: domain.OrderTypeMarket, Size: 1},
+		{Symbol: "pi_xbtusd", Side: "hold", OrderType: domain.OrderTypeMarket, Size: 1},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeMarket},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeMarket, Size: 1, LimitPrice: 100},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeIOC, Size: 1},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeLimit, Size: 1, LimitPrice: 100, StopPrice: 90},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeStop, Size: 1},
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: "trailing", Size: 1},
+	}
+	for _, orderRequest := range invalid {
+		assert.NotNil(t, orderRequest.Validate(), orderRequest)
+	}
+}
+
+func TestOrderEditValidate(t *testing.T) {
+	assert.Nil(t, (&domain.OrderEdit{OrderID: "id", Size: 2}).Validate())
+	assert.Nil(t, (&domain.OrderEdit{ClientOrderID: "entry", StopPrice: 90}).Validate())
+
+	assert.NotNil(t, (&domain.OrderEdit{Size: 2}).Validate())
+	assert.NotNil(t, (&domain.OrderEdit{OrderID: "id"}).Validate())
+	assert.NotNil(t, (&domain.OrderEdit{OrderID: "id", LimitPrice: -1}).Validate())
+}
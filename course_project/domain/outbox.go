@@ -0,0 +1,28 @@
+package domain
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending = OutboxStatus("pending")
+	// Not delivered after all attempts or the recipient can't get messages anymore
+	OutboxStatusParked = OutboxStatus("parked")
+)
+
+// Times of the outbox have fixed width, so they can be compared as strings
+const OutboxTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// OutboxMessage is a notification waiting for the delivery through one channel of the subscriber,
+// delivered messages are deleted
+type OutboxMessage struct {
+	ID      uint                `json:"id" gorm:"primaryKey"`
+	ChatID  int64               `json:"chat_id" gorm:"index"`
+	Channel NotificationChannel `json:"channel"`
+	// JSON of the Notification
+	Notification string       `json:"notification"`
+	Status       OutboxStatus `json:"status" gorm:"index"`
+	Attempts     int          `json:"attempts"`
+	// The message is not delivered before this time
+	NextAttempt string `json:"next_attempt"`
+	LastError   string `json:"last_error"`
+	Created     string `json:"created"`
+}
@@ -0,0 +1,206 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// RoundTrip is a position from opening until it is closed back to zero or flipped to the other side,
+// Side is the side of the opening order, so buy means a long position
+type RoundTrip struct {
+	Symbol string    `json:"symbol"`
+	Side   OrderSide `json:"side"`
+	// Total opened quantity
+	Quantity    float64 `json:"quantity"`
+	EntryPrice  float64 `json:"entry_price"`
+	ExitPrice   float64 `json:"exit_price"`
+	RealizedPnL float64 `json:"realized_pnl"`
+	Fees        float64 `json:"fees"`
+	// Realized profit minus fees
+	NetPnL float64 `json:"net_pnl"`
+	Opened string  `json:"opened"`
+	Closed string  `json:"closed"`
+}
+
+// InstrumentPnL is the result of all fills of a single instrument, unrealized profit and exposure
+// are calculated at the mark price and are zero while the mark price is unknown
+type InstrumentPnL struct {
+	Symbol            string  `json:"symbol"`
+	Position          float64 `json:"position"`
+	AverageEntryPrice float64 `json:"average_entry_price"`
+	MarkPrice         float64 `json:"mark_price"`
+	RealizedPnL       float64 `json:"realized_pnl"`
+	UnrealizedPnL     float64 `json:"unrealized_pnl"`
+	Fees              float64 `json:"fees"`
+	// Realized and unrealized profit minus fees
+	NetPnL     float64 `json:"net_pnl"`
+	Exposure   float64 `json:"exposure"`
+	Fills      int     `json:"fills"`
+	RoundTrips int     `json:"round_trips"`
+}
+
+// PnLReport holds instruments sorted by symbol, closed round trips in the order they were closed and the totals
+type PnLReport struct {
+	Instruments   []InstrumentPnL `json:"instruments"`
+	RoundTrips    []RoundTrip     `json:"round_trips"`
+	RealizedPnL   float64         `json:"realized_pnl"`
+	UnrealizedPnL float64         `json:"unrealized_pnl"`
+	Fees          float64         `json:"fees"`
+	NetPnL        float64         `json:"net_pnl"`
+	Exposure      float64         `json:"exposure"`
+}
+
+type roundTripBuilder struct {
+	roundTrip RoundTrip
+	entryCost float64
+	exitCost  float64
+	exitSize  float64
+}
+
+// Calculate profit of the executed parts of the orders sorted by time, mark prices are keyed by upper case symbol.
+// Symbols are compared case insensitively and reported in upper case
+func NewPnLReport(orderInfos []OrderInfo, markPrices map[string]float64) PnLReport {
+	report := PnLReport{Instruments: []InstrumentPnL{}, RoundTrips: []RoundTrip{}}
+
+	positions := make(map[string]*Position)
+	instruments := make(map[string]*InstrumentPnL)
+	openRoundTrips := make(map[string]*roundTripBuilder)
+
+	for _, orderInfo := range orderInfos {
+		if orderInfo.Amount == 0 {
+			continue
+		}
+
+		symbol := strings.ToUpper(orderInfo.Symbol)
+		position, ok := positions[symbol]
+		if !ok {
+			position = &Position{Symbol: symbol}
+			positions[symbol] = position
+			instruments[symbol] = &InstrumentPnL{Symbol: symbol}
+		}
+		instrument := instruments[symbol]
+
+		size := float64(orderInfo.Amount)
+		closedSize := 0.0
+		if (position.Quantity > 0 && orderInfo.Side == OrderSideSell) || (position.Quantity < 0 && orderInfo.Side == OrderSideBuy) {
+			closedSize = size
+			if closedSize > abs(position.Quantity) {
+				closedSize = abs(position.Quantity)
+			}
+		}
+
+		realized := position.Fill(orderInfo.Side, size, orderInfo.Price)
+		instrument.RealizedPnL += realized
+		instrument.Fees += orderInfo.Fee
+		instrument.Fills++
+
+		// Fee of the fill closing one round trip and opening another one is shared by the size
+		if closedSize > 0 {
+			builder := openRoundTrips[symbol]
+			builder.roundTrip.RealizedPnL += realized
+			builder.roundTrip.Fees += orderInfo.Fee * closedSize / size
+			builder.exitCost += orderInfo.Price * closedSize
+			builder.exitSize += closedSize
+
+			if position.Quantity == 0 || closedSize < size {
+				roundTrip := builder.roundTrip
+				roundTrip.EntryPrice = builder.entryCost / roundTrip.Quantity
+				roundTrip.ExitPrice = builder.exitCost / builder.exitSize
+				roundTrip.NetPnL = roundTrip.RealizedPnL - roundTrip.Fees
+				roundTrip.Closed = orderInfo.Timestamp
+
+				report.RoundTrips = append(report.RoundTrips, roundTrip)
+				instrument.RoundTrips++
+				delete(openRoundTrips, symbol)
+			}
+		}
+
+		if openedSize := size - closedSize; openedSize > 0 {
+			builder, ok := openRoundTrips[symbol]
+			if !ok {
+				builder = &roundTripBuilder{roundTrip: RoundTrip{Symbol: symbol, Side: orderInfo.Side, Opened: orderInfo.Timestamp}}
+				openRoundTrips[symbol] = builder
+			}
+			builder.roundTrip.Quantity += openedSize
+			builder.roundTrip.Fees += orderInfo.Fee * openedSize / size
+			builder.entryCost += orderInfo.Price * openedSize
+		}
+	}
+
+	for symbol, instrument := range instruments {
+		position := positions[symbol]
+		instrument.Position = position.Quantity
+		instrument.AverageEntryPrice = position.AverageEntryPrice
+
+		if markPrice, ok := markPrices[symbol]; ok {
+			instrument.MarkPrice = markPrice
+			instrument.UnrealizedPnL = position.UnrealizedPnL(markPrice)
+			instrument.Exposure = abs(position.Quantity) * markPrice
+		}
+		instrument.NetPnL = instrument.RealizedPnL + instrument.UnrealizedPnL - instrument.Fees
+
+		report.Instruments = append(report.Instruments, *instrument)
+		report.RealizedPnL += instrument.RealizedPnL
+		report.UnrealizedPnL += instrument.UnrealizedPnL
+		report.Fees += instrument.Fees
+		report.NetPnL += instrument.NetPnL
+		report.Exposure += instrument.Exposure
+	}
+	sort.Slice(report.Instruments, func(i, j int) bool {
+		return report.Instruments[i].Symbol < report.Instruments[j].Symbol
+	})
+
+	return report
+}
+
+// Profit of the period from the inclusive time to the exclusive one: realized profit, fees and fills of the fills
+// made in the period and the round trips closed in it. Unrealized profit and exposure are of the positions held at the end
+// of the period, orders whose timestamps can't be parsed are not counted
+func NewPnLPeriodReport(orderInfos []OrderInfo, markPrices map[string]float64, from time.Time, to time.Time) PnLReport {
+	before := []OrderInfo{}
+	until := []OrderInfo{}
+	for _, orderInfo := range orderInfos {
+		timestamp, err := time.Parse(time.RFC3339, orderInfo.Timestamp)
+		if err != nil || !timestamp.Before(to) {
+			continue
+		}
+		until = append(until, orderInfo)
+		if timestamp.Before(from) {
+			before = append(before, orderInfo)
+		}
+	}
+
+	start := NewPnLReport(before, nil)
+	end := NewPnLReport(until, markPrices)
+
+	startInstruments := make(map[string]InstrumentPnL, len(start.Instruments))
+	for _, instrument := range start.Instruments {
+		startInstruments[instrument.Symbol] = instrument
+	}
+
+	// Round trips closed before the period are the first ones, the orders are the same until then
+	report := PnLReport{Instruments: []InstrumentPnL{}, RoundTrips: append([]RoundTrip{}, end.RoundTrips[len(start.RoundTrips):]...)}
+	for _, instrument := range end.Instruments {
+		startInstrument := startInstruments[instrument.Symbol]
+		instrument.RealizedPnL -= startInstrument.RealizedPnL
+		instrument.Fees -= startInstrument.Fees
+		instrument.Fills -= startInstrument.Fills
+		instrument.RoundTrips -= startInstrument.RoundTrips
+		instrument.NetPnL = instrument.RealizedPnL + instrument.UnrealizedPnL - instrument.Fees
+
+		// Instruments closed before the period have nothing to report
+		if instrument.Fills == 0 && instrument.Position == 0 {
+			continue
+		}
+
+		report.Instruments = append(report.Instruments, instrument)
+		report.RealizedPnL += instrument.RealizedPnL
+		report.UnrealizedPnL += instrument.UnrealizedPnL
+		report.Fees += instrument.Fees
+		report.NetPnL += instrument.NetPnL
+		report.Exposure += instrument.Exposure
+	}
+
+	return report
+}
@@ -0,0 +1,103 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPnLReport(t *testing.T) {
+	orderInfos := []domain.OrderInfo{
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Amount: 2, Price: 100, Fee: 0.2, Timestamp: "t1"},
+		{Symbol: "pi_ethusd", Side: domain.OrderSideBuy, Amount: 1, Price: 10, Timestamp: "t2"},
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Amount: 2, Price: 110, Fee: 0.2, Timestamp: "t3"},
+		// Placed order is not executed yet
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Status: domain.OrderStatusPlaced, Quantity: 5, LimitPrice: 130, Timestamp: "t4"},
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Amount: 3, Price: 120, Fee: 0.3, Timestamp: "t5"},
+		{Symbol: "PI_ETHUSD", Side: domain.OrderSideSell, Amount: 1, Price: 12, Timestamp: "t6"},
+		// Closes the long position and opens a short one
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Amount: 3, Price: 100, Fee: 0.3, Timestamp: "t7"},
+	}
+
+	report := domain.NewPnLReport(orderInfos, map[string]float64{"PI_XBTUSD": 90})
+
+	if assert.Len(t, report.RoundTrips, 2) {
+		ethereum := report.RoundTrips[0]
+		assert.Equal(t, domain.RoundTrip{Symbol: "PI_ETHUSD", Side: domain.OrderSideBuy, Quantity: 1, EntryPrice: 10, ExitPrice: 12, RealizedPnL: 2, NetPnL: 2, Opened: "t2", Closed: "t6"}, ethereum)
+
+		bitcoin := report.RoundTrips[1]
+		assert.Equal(t, domain.OrderSideBuy, bitcoin.Side)
+		assert.Equal(t, 4.0, bitcoin.Quantity)
+		assert.Equal(t, 105.0, bitcoin.EntryPrice)
+		assert.Equal(t, 115.0, bitcoin.ExitPrice)
+		assert.Equal(t, 40.0, bitcoin.RealizedPnL)
+		assert.InDelta(t, 0.8, bitcoin.Fees, 1e-9)
+		assert.InDelta(t, 39.2, bitcoin.NetPnL, 1e-9)
+		assert.Equal(t, "t1", bitcoin.Opened)
+		assert.Equal(t, "t7", bitcoin.Closed)
+	}
+
+	if assert.Len(t, report.Instruments, 2) {
+		bitcoin := report.Instruments[1]
+		assert.Equal(t, "PI_XBTUSD", bitcoin.Symbol)
+		assert.Equal(t, -2.0, bitcoin.Position)
+		assert.Equal(t, 100.0, bitcoin.AverageEntryPrice)
+		assert.Equal(t, 90.0, bitcoin.MarkPrice)
+		assert.Equal(t, 40.0, bitcoin.RealizedPnL)
+		assert.Equal(t, 20.0, bitcoin.UnrealizedPnL)
+		assert.InDelta(t, 1.0, bitcoin.Fees, 1e-9)
+		assert.InDelta(t, 59.0, bitcoin.NetPnL, 1e-9)
+		assert.Equal(t, 180.0, bitcoin.Exposure)
+		assert.Equal(t, 4, bitcoin.Fills)
+		assert.Equal(t, 1, bitcoin.RoundTrips)
+
+		// Mark price of a closed position is not needed
+		assert.Equal(t, domain.InstrumentPnL{Symbol: "PI_ETHUSD", RealizedPnL: 2, NetPnL: 2, Fills: 2, RoundTrips: 1}, report.Instruments[0])
+	}
+
+	assert.Equal(t, 42.0, report.RealizedPnL)
+	assert.Equal(t, 20.0, report.UnrealizedPnL)
+	assert.InDelta(t, 1.0, report.Fees, 1e-9)
+	assert.InDelta(t, 61.0, report.NetPnL, 1e-9)
+	assert.Equal(t, 180.0, report.Exposure)
+
+	assert.Equal(t, domain.PnLReport{Instruments: []domain.InstrumentPnL{}, RoundTrips: []domain.RoundTrip{}}, domain.NewPnLReport(nil, nil))
+}
+
+func TestPnLPeriodReport(t *testing.T) {
+	orderInfos := []domain.OrderInfo{
+		// Closed before the period
+		{Symbol: "PI_ETHUSD", Side: domain.OrderSideBuy, Amount: 1, Price: 10, Fee: 0.1, Timestamp: "2021-12-01T10:00:00.000Z"},
+		{Symbol: "PI_ETHUSD", Side: domain.OrderSideSell, Amount: 1, Price: 12, Fee: 0.1, Timestamp: "2021-12-01T11:00:00.000Z"},
+		// Opened before the period and closed in it
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Amount: 2, Price: 100, Fee: 0.2, Timestamp: "2021-12-01T12:00:00.000Z"},
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Amount: 2, Price: 110, Fee: 0.2, Timestamp: "2021-12-02T01:00:00.000Z"},
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Amount: 1, Price: 105, Fee: 0.1, Timestamp: "2021-12-02T02:00:00Z"},
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Amount: 1, Price: 200, Timestamp: "unknown"},
+		// After the period
+		{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Amount: 1, Price: 120, Timestamp: "2021-12-03T00:00:00.000Z"},
+	}
+
+	from := time.Date(2021, 12, 2, 0, 0, 0, 0, time.UTC)
+	report := domain.NewPnLPeriodReport(orderInfos, map[string]float64{"PI_XBTUSD": 107}, from, from.AddDate(0, 0, 1))
+
+	if assert.Len(t, report.RoundTrips, 1) {
+		assert.Equal(t, "2021-12-01T12:00:00.000Z", report.RoundTrips[0].Opened)
+		assert.Equal(t, 20.0, report.RoundTrips[0].RealizedPnL)
+	}
+	if assert.Len(t, report.Instruments, 1) {
+		bitcoin := report.Instruments[0]
+		assert.Equal(t, 1.0, bitcoin.Position)
+		assert.Equal(t, 2, bitcoin.Fills)
+		assert.Equal(t, 1, bitcoin.RoundTrips)
+		assert.InDelta(t, 0.3, bitcoin.Fees, 1e-9)
+	}
+	assert.Equal(t, 20.0, report.RealizedPnL)
+	assert.Equal(t, 2.0, report.UnrealizedPnL)
+	assert.InDelta(t, 0.3, report.Fees, 1e-9)
+	assert.InDelta(t, 21.7, report.NetPnL, 1e-9)
+
+	assert.Equal(t, domain.PnLReport{Instruments: []domain.InstrumentPnL{}, RoundTrips: []domain.RoundTrip{}}, domain.NewPnLPeriodReport(nil, nil, from, from))
+}
@@ -0,0 +1,61 @@
+package domain
+
+// Position is a net position in a single instrument, negative quantity means short position
+type Position struct {
+	Symbol            string  `json:"symbol"`
+	Quantity          float64 `json:"quantity"`
+	AverageEntryPrice float64 `json:"average_entry_price"`
+}
+
+// Apply fill to the position and return realized profit of the closed part
+func (position *Position) Fill(side OrderSide, quantity float64, price float64) float64 {
+	signedQuantity := quantity
+	if side == OrderSideSell {
+		signedQuantity = -quantity
+	}
+
+	realized := 0.0
+
+	// Fill closes (part of) the position
+	if position.Quantity*signedQuantity < 0 {
+		closedQuantity := quantity
+		if closedQuantity > abs(position.Quantity) {
+			closedQuantity = abs(position.Quantity)
+		}
+
+		if position.Quantity > 0 {
+			realized = (price - position.AverageEntryPrice) * closedQuantity
+			position.Quantity -= closedQuantity
+			signedQuantity += closedQuantity
+		} else {
+			realized = (position.AverageEntryPrice - price) * closedQuantity
+			position.Quantity += closedQuantity
+			signedQuantity -= closedQuantity
+		}
+
+		if position.Quantity == 0 {
+			position.AverageEntryPrice = 0
+		}
+	}
+
+	// The rest of the fill opens or increases the position
+	if signedQuantity != 0 {
+		newQuantity := position.Quantity + signedQuantity
+		position.AverageEntryPrice = (position.AverageEntryPrice*abs(position.Quantity) + price*abs(signedQuantity)) / abs(newQuantity)
+		position.Quantity = newQuantity
+	}
+
+	return realized
+}
+
+// Profit of the position if it was closed by the given price
+func (position *Position) UnrealizedPnL(price float64) float64 {
+	return (price - position.AverageEntryPrice) * position.Quantity
+}
+
+func abs(value float64) float64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,32 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositionFill(t *testing.T) {
+	position := domain.Position{Symbol: "test"}
+
+	assert.Equal(t, 0.0, position.Fill(domain.OrderSideBuy, 1, 100))
+	assert.Equal(t, 0.0, position.Fill(domain.OrderSideBuy, 1, 110))
+	assert.Equal(t, 2.0, position.Quantity)
+	assert.Equal(t, 105.0, position.AverageEntryPrice)
+	assert.Equal(t, 10.0, position.UnrealizedPnL(110))
+
+	assert.Equal(t, 15.0, position.Fill(domain.OrderSideSell, 1, 120))
+	assert.Equal(t, 1.0, position.Quantity)
+	assert.Equal(t, 105.0, position.AverageEntryPrice)
+
+	// Position flips to short
+	assert.Equal(t, -5.0, position.Fill(domain.OrderSideSell, 3, 100))
+	assert.Equal(t, -2.0, position.Quantity)
+	assert.Equal(t, 100.0, position.AverageEntryPrice)
+	assert.Equal(t, 20.0, position.UnrealizedPnL(90))
+
+	assert.Equal(t, 20.0, position.Fill(domain.OrderSideBuy, 2, 90))
+	assert.Equal(t, 0.0, position.Quantity)
+	assert.Equal(t, 0.0, position.AverageEntryPrice)
+}
@@ -0,0 +1,10 @@
+package domain
+
+// Reconciliation is the state of the account on the exchange compared with the stored orders
+type Reconciliation struct {
+	Positions      []Position      `json:"positions"`
+	OpenOrders     []OpenOrder     `json:"open_orders"`
+	MarginAccounts []MarginAccount `json:"margin_accounts"`
+	// Human readable differences between the exchange and the storage
+	Mismatches []string `json:"mismatches"`
+}
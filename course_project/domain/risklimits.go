@@ -0,0 +1,20 @@
+package domain
+
+// RiskLimits are checked before every order, zero value of a limit means that it is not enforced
+type RiskLimits struct {
+	ID                 uint    `json:"-" gorm:"primaryKey"`
+	MaxPosition        float64 `json:"max_position"`
+	MaxNotional        float64 `json:"max_notional"`
+	MaxOrdersPerMinute int     `json:"max_orders_per_minute"`
+	MaxDailyLoss       float64 `json:"max_daily_loss"`
+	MaxSlippage        float64 `json:"max_slippage"`
+	KillSwitch         bool    `json:"kill_switch"`
+}
+
+// RiskState is the data the limits are checked against
+type RiskState struct {
+	Positions         []Position `json:"positions"`
+	OrdersLastMinute  int        `json:"orders_last_minute"`
+	DailyRealizedPnL  float64    `json:"daily_realized_pnl"`
+	DailyLossExceeded bool       `json:"daily_loss_exceeded"`
+}
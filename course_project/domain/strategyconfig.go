@@ -0,0 +1,6 @@
+package domain
+
+type StrategyConfig struct {
+	Name   string             `json:"name"`
+	Params map[string]float64 `json:"params"`
+}
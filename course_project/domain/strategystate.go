@@ -0,0 +1,10 @@
+package domain
+
+// StrategyState describes the strategy instance trading a single instrument
+type StrategyState struct {
+	Symbol string `json:"symbol"`
+	// Tickers given to the strategy since it was created
+	Tickers int `json:"tickers"`
+	// Reported by the strategies implementing strategies.Reporter, nil otherwise
+	State map[string]interface{} `json:"state"`
+}
@@ -1,15 +1,78 @@
 package domain
 
-type Ticker map[string]interface{}
+import (
+	"errors"
+	"fmt"
+	"math"
+)
 
-func (ticker *Ticker) GetAsk() float64 {
-	return (*ticker)["ask"].(float64)
+// Ticker is a message of the websocket ticker feed, missing and null fields are zero
+type Ticker struct {
+	Symbol string `json:"product_id"`
+	// Unix time in milliseconds
+	Time int64 `json:"time"`
+	// Number of the message in the subscription, grows by one
+	Sequence uint64 `json:"seq"`
+
+	Bid     float64 `json:"bid"`
+	BidSize float64 `json:"bid_size"`
+	Ask     float64 `json:"ask"`
+	AskSize float64 `json:"ask_size"`
+
+	Last float64 `json:"last"`
+	// Change of the last price in the last 24 hours, in percents
+	Change      float64 `json:"change"`
+	Volume      float64 `json:"volume"`
+	VolumeQuote float64 `json:"volumeQuote"`
+
+	Index        float64 `json:"index"`
+	Premium      float64 `json:"premium"`
+	MarkPrice    float64 `json:"markPrice"`
+	OpenInterest float64 `json:"openInterest"`
+
+	FundingRate                   float64 `json:"funding_rate"`
+	FundingRatePrediction         float64 `json:"funding_rate_prediction"`
+	RelativeFundingRate           float64 `json:"relative_funding_rate"`
+	RelativeFundingRatePrediction float64 `json:"relative_funding_rate_prediction"`
+	// Unix time in milliseconds
+	NextFundingRateTime int64 `json:"next_funding_rate_time"`
+
+	Tag      string `json:"tag"`
+	Pair     string `json:"pair"`
+	Leverage string `json:"leverage"`
+	// Days to maturity, zero for perpetual contracts
+	DaysToMaturity int `json:"dtm"`
+	// Unix time in milliseconds, zero for perpetual contracts
+	MaturityTime int64 `json:"maturityTime"`
+	Suspended    bool  `json:"suspended"`
+	PostOnly     bool  `json:"post_only"`
 }
 
-func (ticker *Ticker) GetBid() float64 {
-	return (*ticker)["bid"].(float64)
+// Mid price between the best bid and ask
+func (ticker *Ticker) Mid() float64 {
+	return (ticker.Bid + ticker.Ask) / 2
+}
+
+// Check that the ticker can be traded on: it has a symbol and positive finite prices
+func (ticker *Ticker) Validate() error {
+	if ticker.Symbol == "" {
+		return errors.New("ticker has no product_id")
+	}
+
+	if !validPrice(ticker.Bid) {
+		return fmt.Errorf("ticker %s has no bid", ticker.Symbol)
+	}
+	if !validPrice(ticker.Ask) {
+		return fmt.Errorf("ticker %s has no ask", ticker.Symbol)
+	}
+
+	if ticker.BidSize < 0 || ticker.AskSize < 0 {
+		return fmt.Errorf("ticker %s has negative size", ticker.Symbol)
+	}
+
+	return nil
 }
 
-func (ticker *Ticker) GetSymbol() string {
-	return (*ticker)["product_id"].(string)
+func validPrice(price float64) bool {
+	return price > 0 && !math.IsInf(price, 0)
 }
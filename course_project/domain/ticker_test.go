@@ -0,0 +1,67 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTickerDecode(t *testing.T) {
+	message := `{"time":1612270825253,"feed":"ticker","product_id":"PI_XBTUSD","bid":34832.5,"ask":34847.5,"bid_size":42864,"ask_size":2300,"volume":262306237,"dtm":0,"leverage":"50x","index":34803.45,"premium":0.1,"last":34852,"change":2.995109121267192,"funding_rate":3.891007752e-9,"funding_rate_prediction":4.2233756e-9,"suspended":false,"tag":"perpetual","pair":"XBT:USD","openInterest":107706940,"markPrice":34840.425,"maturityTime":0,"relative_funding_rate":0.000135046879166667,"relative_funding_rate_prediction":0.000146960125,"next_funding_rate_time":1612281600000,"volumeQuote":262306237,"post_only":false,"seq":42}`
+
+	var ticker domain.Ticker
+	assert.Nil(t, json.Unmarshal([]byte(message), &ticker))
+	assert.Equal(t, domain.Ticker{
+		Symbol:                        "PI_XBTUSD",
+		Time:                          1612270825253,
+		Sequence:                      42,
+		Bid:                           34832.5,
+		BidSize:                       42864,
+		Ask:                           34847.5,
+		AskSize:                       2300,
+		Last:                          34852,
+		Change:                        2.995109121267192,
+		Volume:                        262306237,
+		VolumeQuote:                   262306237,
+		Index:                         34803.45,
+		Premium:                       0.1,
+		MarkPrice:                     34840.425,
+		OpenInterest:                  107706940,
+		FundingRate:                   3.891007752e-9,
+		FundingRatePrediction:         4.2233756e-9,
+		RelativeFundingRate:           0.000135046879166667,
+		RelativeFundingRatePrediction: 0.000146960125,
+		NextFundingRateTime:           1612281600000,
+		Tag:                           "perpetual",
+		Pair:                          "XBT:USD",
+		Leverage:                      "50x",
+	}, ticker)
+	assert.Nil(t, ticker.Validate())
+	assert.Equal(t, 34840.0, ticker.Mid())
+
+	// Null fields are zero
+	ticker = domain.Ticker{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"product_id":"PI_XBTUSD","bid":null,"ask":34847.5}`), &ticker))
+	assert.EqualError(t, ticker.Validate(), "ticker PI_XBTUSD has no bid")
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"product_id":"PI_XBTUSD","bid":"34832.5","ask":34847.5}`), &ticker))
+}
+
+func TestTickerValidate(t *testing.T) {
+	assert.Nil(t, (&domain.Ticker{Symbol: "test", Bid: 99, Ask: 101}).Validate())
+
+	invalid := []domain.Ticker{
+		{Bid: 99, Ask: 101},
+		{Symbol: "test", Ask: 101},
+		{Symbol: "test", Bid: 99, Ask: -1},
+		{Symbol: "test", Bid: math.NaN(), Ask: 101},
+		{Symbol: "test", Bid: 99, Ask: math.Inf(1)},
+		{Symbol: "test", Bid: 99, Ask: 101, BidSize: -1},
+	}
+	for _, ticker := range invalid {
+		assert.NotNil(t, ticker.Validate(), ticker)
+	}
+}
@@ -0,0 +1,10 @@
+package domain
+
+type TradingMode string
+
+const (
+	// Orders are sent to the exchange
+	TradingModeLive = TradingMode("live")
+	// Orders are filled by the paper exchange using live market data
+	TradingModePaper = TradingMode("paper")
+)
@@ -0,0 +1,25 @@
+package domain
+
+type TradingState string
+
+const (
+	// Orders are sent for the decisions of the strategies
+	TradingStateRunning = TradingState("running")
+	// Market data is received and strategies decide, but orders are not sent
+	TradingStatePaused = TradingState("paused")
+	// Open positions are being closed with market orders, then trading stops
+	TradingStateFlattening = TradingState("flattening")
+	// Positions are closed and orders are not sent until trading is started again
+	TradingStateStopped = TradingState("stopped")
+)
+
+// TradingTransition is a record of the audit trail, Source is where the change came from
+// (api, telegram or bot) and Actor is who made it there
+type TradingTransition struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	From      TradingState `json:"from"`
+	To        TradingState `json:"to"`
+	Source    string       `json:"source"`
+	Actor     string       `json:"actor"`
+	Timestamp string       `json:"timestamp"`
+}
@@ -1,5 +1,152 @@
 package domain
 
+import (
+	"strings"
+	"time"
+)
+
+// User is a subscriber added from the telegram chat, notifications are sent to the chosen channels
 type User struct {
 	ChatID int64 `json:"chat_id"`
+	// Comma separated notification channels, empty means telegram only
+	Channels   string `json:"channels"`
+	Email      string `json:"email"`
+	WebhookURL string `json:"webhook_url"`
+	// Language of the notifications, empty means DefaultLanguage
+	Language Language `json:"language"`
+	// IANA time zone name, empty means DefaultTimezone
+	Timezone string `json:"timezone"`
+
+	// Filters, empty lists mean everything is sent.
+	// Instruments and sides are comma separated, the minimum notional is size multiplied by price of the fill
+	Instruments string  `json:"instruments"`
+	Sides       string  `json:"sides"`
+	MinNotional float64 `json:"min_notional"`
+	Categories  string  `json:"categories"`
+	// Hours of the user time zone when only errors are sent, the same hours mean quiet hours are off.
+	// 23 and 7 means from 23:00 to 07:00
+	QuietFrom int `json:"quiet_from"`
+	QuietTo   int `json:"quiet_to"`
+
+	// Comma separated channels whose delivery failed all attempts, nothing is sent there until the channel is set again
+	ParkedChannels string `json:"parked_channels"`
+}
+
+func (user User) GetLanguage() Language {
+	if user.Language == "" {
+		return DefaultLanguage
+	}
+	return user.Language
+}
+
+func (user User) GetTimezone() string {
+	if user.Timezone == "" {
+		return DefaultTimezone
+	}
+	return user.Timezone
+}
+
+func (user User) GetChannels() []NotificationChannel {
+	if strings.TrimSpace(user.Channels) == "" {
+		return []NotificationChannel{NotificationChannelTelegram}
+	}
+	return ParseNotificationChannels(user.Channels)
+}
+
+func (user User) IsParked(channel NotificationChannel) bool {
+	for _, parked := range splitList(user.ParkedChannels) {
+		if parked == string(channel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (user *User) ParkChannel(channel NotificationChannel) {
+	if !user.IsParked(channel) {
+		user.ParkedChannels = strings.Join(append(splitList(user.ParkedChannels), string(channel)), ",")
+	}
+}
+
+func (user *User) UnparkChannel(channel NotificationChannel) {
+	channels := []string{}
+	for _, parked := range splitList(user.ParkedChannels) {
+		if parked != string(channel) {
+			channels = append(channels, parked)
+		}
+	}
+	user.ParkedChannels = strings.Join(channels, ",")
+}
+
+// Location of the user time zone, UTC if the zone is unknown
+func (user User) GetLocation() *time.Location {
+	location, err := time.LoadLocation(user.GetTimezone())
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Check the notification against the filters of the user, errors are sent in the quiet hours too
+func (user User) Wants(notification Notification, now time.Time) bool {
+	category := notification.Category()
+	if !containsItem(user.Categories, string(category)) {
+		return false
+	}
+	if category != NotificationCategoryErrors && user.IsQuiet(now) {
+		return false
+	}
+
+	var symbol string
+	var side OrderSide
+	switch notification.Kind {
+	case NotificationKindOrder:
+		orderInfo := notification.OrderInfo
+		size := orderInfo.Amount
+		if size == 0 {
+			size = orderInfo.Quantity
+		}
+		if float64(size)*orderInfo.Price < user.MinNotional {
+			return false
+		}
+		symbol, side = orderInfo.Symbol, orderInfo.Side
+	case NotificationKindBlockedOrder:
+		symbol, side = notification.BlockedOrder.Symbol, notification.BlockedOrder.Side
+	default:
+		return true
+	}
+
+	return containsItem(strings.ToUpper(user.Instruments), strings.ToUpper(symbol)) && containsItem(user.Sides, string(side))
+}
+
+func (user User) IsQuiet(now time.Time) bool {
+	if user.QuietFrom == user.QuietTo {
+		return false
+	}
+
+	hour := now.In(user.GetLocation()).Hour()
+	if user.QuietFrom < user.QuietTo {
+		return hour >= user.QuietFrom && hour < user.QuietTo
+	}
+	// Quiet hours over midnight
+	return hour >= user.QuietFrom || hour < user.QuietTo
+}
+
+// True if the comma separated list is empty or has the item
+func containsItem(list string, item string) bool {
+	items := splitList(list)
+	if len(items) == 0 {
+		return true
+	}
+	for _, next := range items {
+		if next == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Admin is a telegram chat allowed to run the privileged bot commands
+type Admin struct {
+	ChatID int64 `json:"chat_id" gorm:"primaryKey;autoIncrement:false"`
 }
@@ -0,0 +1,69 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserWants(t *testing.T) {
+	noon := time.Date(2021, 12, 1, 12, 0, 0, 0, time.UTC)
+	order := domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &domain.OrderInfo{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, Amount: 2, Price: 100}}
+	placed := domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &domain.OrderInfo{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Quantity: 3, Price: 100}}
+	blocked := domain.Notification{Kind: domain.NotificationKindBlockedOrder, BlockedOrder: &domain.BlockedOrder{Symbol: "PI_ETHUSD", Side: domain.OrderSideSell}}
+	failure := domain.Notification{Kind: domain.NotificationKindError, Error: "test"}
+	summary := domain.Notification{Kind: domain.NotificationKindDailySummary, Summary: &domain.PnLReport{}}
+
+	everything := domain.User{ChatID: 1}
+	for _, notification := range []domain.Notification{order, blocked, failure, summary} {
+		assert.Equal(t, true, everything.Wants(notification, noon))
+	}
+
+	filtered := domain.User{ChatID: 1, Instruments: "PI_XBTUSD", Sides: "buy", MinNotional: 250, Categories: "fills,errors"}
+	assert.Equal(t, false, filtered.Wants(order, noon))
+	assert.Equal(t, true, filtered.Wants(placed, noon))
+	assert.Equal(t, false, filtered.Wants(blocked, noon))
+	assert.Equal(t, true, filtered.Wants(failure, noon))
+	assert.Equal(t, false, filtered.Wants(summary, noon))
+
+	filtered = domain.User{ChatID: 1, Sides: "sell", Instruments: "PI_ETHUSD,PI_XBTUSD"}
+	assert.Equal(t, false, filtered.Wants(order, noon))
+	assert.Equal(t, true, filtered.Wants(blocked, noon))
+}
+
+func TestUserQuietHours(t *testing.T) {
+	failure := domain.Notification{Kind: domain.NotificationKindError, Error: "test"}
+	order := domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &domain.OrderInfo{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy}}
+
+	// 23:00-07:00 in Moscow is 20:00-04:00 UTC
+	user := domain.User{ChatID: 1, QuietFrom: 23, QuietTo: 7}
+	assert.Equal(t, true, user.IsQuiet(time.Date(2021, 12, 1, 21, 0, 0, 0, time.UTC)))
+	assert.Equal(t, true, user.IsQuiet(time.Date(2021, 12, 1, 3, 59, 0, 0, time.UTC)))
+	assert.Equal(t, false, user.IsQuiet(time.Date(2021, 12, 1, 4, 0, 0, 0, time.UTC)))
+	assert.Equal(t, false, user.Wants(order, time.Date(2021, 12, 1, 21, 0, 0, 0, time.UTC)))
+	assert.Equal(t, true, user.Wants(failure, time.Date(2021, 12, 1, 21, 0, 0, 0, time.UTC)))
+
+	user = domain.User{ChatID: 1, Timezone: "UTC", QuietFrom: 9, QuietTo: 18}
+	assert.Equal(t, true, user.IsQuiet(time.Date(2021, 12, 1, 9, 0, 0, 0, time.UTC)))
+	assert.Equal(t, false, user.IsQuiet(time.Date(2021, 12, 1, 18, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, false, domain.User{ChatID: 1}.IsQuiet(time.Now()))
+}
+
+func TestUserParkedChannels(t *testing.T) {
+	user := domain.User{ChatID: 1}
+	assert.Equal(t, false, user.IsParked(domain.NotificationChannelWebhook))
+
+	user.ParkChannel(domain.NotificationChannelWebhook)
+	user.ParkChannel(domain.NotificationChannelEmail)
+	user.ParkChannel(domain.NotificationChannelWebhook)
+	assert.Equal(t, "webhook,email", user.ParkedChannels)
+	assert.Equal(t, true, user.IsParked(domain.NotificationChannelWebhook))
+	assert.Equal(t, false, user.IsParked(domain.NotificationChannelTelegram))
+
+	user.UnparkChannel(domain.NotificationChannelWebhook)
+	assert.Equal(t, "email", user.ParkedChannels)
+	assert.Equal(t, false, user.IsParked(domain.NotificationChannelWebhook))
+}
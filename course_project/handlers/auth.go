@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const (
+	apiKeyHeader    = "X-API-Key"
+	timestampHeader = "X-Timestamp"
+	nonceHeader     = "X-Nonce"
+	signatureHeader = "X-Signature"
+	// Signed requests with the timestamp further from now are rejected, nonces are remembered for twice this time
+	signatureWindow = 30 * time.Second
+)
+
+type apiKeyService interface {
+	Authenticate(key string) (domain.APIKey, bool)
+	CreateKey(name string, role domain.APIRole, signed bool) (domain.NewAPIKey, error)
+	GetKeys() []domain.APIKey
+	DeleteKey(name string) bool
+}
+
+type apiKeyContextKey struct{}
+
+// Check the API key of the request, read-only role allows only the read-only routes.
+// Requests of the keys with a signing secret must also have a valid signature
+func (server *Server) authenticate(role domain.APIRole) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := server.apiKeyService.Authenticate(r.Header.Get(apiKeyHeader))
+			if !ok {
+				server.logger.Printf("Authentication failed for %s %s from %s: unknown API key", r.Method, r.URL.Path, r.RemoteAddr)
+				writeError(w, http.StatusUnauthorized, "valid "+apiKeyHeader+" header is required")
+				return
+			}
+
+			if apiKey.SigningSecret != "" {
+				if err := server.checkSignature(r, apiKey); err != nil {
+					server.logger.Printf("Authentication failed for %s %s from %s with key %q: %v", r.Method, r.URL.Path, r.RemoteAddr, apiKey.Name, err)
+					writeError(w, http.StatusUnauthorized, err.Error())
+					return
+				}
+			}
+
+			if role == domain.APIRoleOperator && apiKey.Role != domain.APIRoleOperator {
+				server.logger.Printf("Access denied for %s %s from %s with key %q", r.Method, r.URL.Path, r.RemoteAddr, apiKey.Name)
+				writeError(w, http.StatusForbidden, "operator role is required")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, apiKey.Name)))
+		})
+	}
+}
+
+// Signature is the hex HMAC-SHA256 of "timestamp\nnonce\nmethod\nrequest uri\nbody" with the signing secret,
+// timestamp is in unix milliseconds and every nonce can be used once
+func (server *Server) checkSignature(r *http.Request, apiKey domain.APIKey) error {
+	timestamp := r.Header.Get(timestampHeader)
+	nonce := r.Header.Get(nonceHeader)
+	signature, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if timestamp == "" || nonce == "" || err != nil || len(signature) == 0 {
+		return errors.New(timestampHeader + ", " + nonceHeader + " and " + signatureHeader + " headers are required")
+	}
+
+	milliseconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("wrong timestamp")
+	}
+	now := time.Now()
+	signedAt := time.Unix(0, milliseconds*int64(time.Millisecond))
+	if signedAt.Before(now.Add(-signatureWindow)) || signedAt.After(now.Add(signatureWindow)) {
+		return errors.New("request is expired")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errors.New("can't read body")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, []byte(apiKey.SigningSecret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n"))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("wrong signature")
+	}
+
+	if !server.useNonce(apiKey.Name+"\n"+nonce, now) {
+		return errors.New("nonce is already used")
+	}
+	return nil
+}
+
+// False if the nonce was used within the window, expired nonces are forgotten
+func (server *Server) useNonce(nonce string, now time.Time) bool {
+	server.nonceMutex.Lock()
+	defer server.nonceMutex.Unlock()
+
+	for usedNonce, usedAt := range server.nonces {
+		if now.Sub(usedAt) > 2*signatureWindow {
+			delete(server.nonces, usedNonce)
+		}
+	}
+
+	if _, ok := server.nonces[nonce]; ok {
+		return false
+	}
+	server.nonces[nonce] = now
+	return true
+}
+
+// Name of the key the request is authenticated with
+func apiKeyName(r *http.Request) string {
+	name, _ := r.Context().Value(apiKeyContextKey{}).(string)
+	return name
+}
+
+type apiKeyAnswer struct {
+	Name    string         `json:"name"`
+	Role    domain.APIRole `json:"role"`
+	Signed  bool           `json:"signed"`
+	Created string         `json:"created"`
+}
+
+func (server *Server) apiKeysList(w http.ResponseWriter, r *http.Request) {
+	answer := []apiKeyAnswer{}
+	for _, apiKey := range server.apiKeyService.GetKeys() {
+		answer = append(answer, apiKeyAnswer{Name: apiKey.Name, Role: apiKey.Role, Signed: apiKey.SigningSecret != "", Created: apiKey.Created})
+	}
+
+	writeJSON(w, http.StatusOK, answer)
+}
+
+type apiKeyRequest struct {
+	Name   string         `json:"name"`
+	Role   domain.APIRole `json:"role"`
+	Signed bool           `json:"signed"`
+}
+
+// The generated key and signing secret are shown only in this answer
+func (server *Server) apiKeyAdd(w http.ResponseWriter, r *http.Request) {
+	var request apiKeyRequest
+	if !readBody(w, r, &request) {
+		return
+	}
+
+	newAPIKey, err := server.apiKeyService.CreateKey(request.Name, request.Role, request.Signed)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newAPIKey)
+}
+
+func (server *Server) apiKeyDelete(w http.ResponseWriter, r *http.Request) {
+	if !server.apiKeyService.DeleteKey(chi.URLParam(r, "name")) {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
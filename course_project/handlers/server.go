@@ -2,83 +2,548 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/legendiguess/kraken-trade-bot/domain"
 )
 
+const (
+	defaultCandlesLimit = 100
+	defaultOrdersLimit  = 50
+	maxOrdersLimit      = 500
+	// Transitions of the audit trail returned with the trading state
+	tradingTransitionsLimit = 20
+	tradingSource           = "api"
+)
+
 type instrumentService interface {
 	SaveInstrument(newInstrument domain.InstrumentConfig)
-	GetInstrument() (domain.InstrumentConfig, bool)
+	DeleteInstrument(symbol string) bool
+	GetInstrument(symbol string) (domain.InstrumentConfig, bool)
+	GetInstruments() []domain.InstrumentConfig
+	GetEnabledSymbols() []string
+	SwitchInstrument(symbol string) domain.InstrumentConfig
 }
 
 type websocketClientService interface {
-	SubscribeToTicker(productIDs []string)
-	UnsubscribeFromTicker(productIDs []string)
+	SetMarketSubscription(productIDs []string)
+	GetConnectionStatus() domain.ConnectionStatus
+}
+
+type strategyService interface {
+	Names() []string
+	Select(config domain.StrategyConfig) error
+	GetStrategyConfig() domain.StrategyConfig
+}
+
+type riskService interface {
+	GetLimits() domain.RiskLimits
+	SetLimits(limits domain.RiskLimits)
+	GetState() domain.RiskState
+}
+
+type candleService interface {
+	GetPeriods() []domain.CandlePeriod
+	GetCandles(symbol string, period domain.CandlePeriod, count int) []domain.Candle
+}
+
+type orderService interface {
+	GetOrderPage(filter domain.OrderFilter) domain.OrderPage
+}
+
+type pnlService interface {
+	GetReport() domain.PnLReport
+	GetInstrumentPnL(symbol string) (domain.InstrumentPnL, bool)
+}
+
+type strategyStateService interface {
+	GetStrategyStates() []domain.StrategyState
+}
+
+type tradingControlService interface {
+	GetState() domain.TradingState
+	Start(source string, actor string) error
+	Pause(source string, actor string) error
+	Flatten(source string, actor string) error
+	GetTransitions(limit int) []domain.TradingTransition
 }
 
 type serverLogger interface {
 	Panic(args ...interface{})
+	Printf(format string, args ...interface{})
 }
 
 type Server struct {
 	instrumentService instrumentService
 	websocketClient   websocketClientService
+	strategyService   strategyService
+	riskService       riskService
+	candleService     candleService
+	orderService      orderService
+	pnlService        pnlService
+	strategyStates    strategyStateService
+	tradingControl    tradingControlService
+	apiKeyService     apiKeyService
 	logger            serverLogger
+	address           string
+
+	nonceMutex sync.Mutex
+	// Time of use of the signature nonces by key name and nonce
+	nonces map[string]time.Time
 }
 
-func NewServer(instrumentService instrumentService, websocketClient websocketClientService, serverLogger serverLogger) *Server {
+// ServerDependencies are the services used by the server handlers
+type ServerDependencies struct {
+	Instruments     instrumentService
+	WebsocketClient websocketClientService
+	Strategies      strategyService
+	Risk            riskService
+	Candles         candleService
+	Orders          orderService
+	PnL             pnlService
+	StrategyStates  strategyStateService
+	TradingControl  tradingControlService
+	APIKeys         apiKeyService
+	Logger          serverLogger
+}
+
+// Create server listening on the address, e.g. ":5000"
+func NewServer(address string, dependencies ServerDependencies) *Server {
 	server := Server{
-		instrumentService: instrumentService,
-		websocketClient:   websocketClient,
-		logger:            serverLogger,
+		instrumentService: dependencies.Instruments,
+		websocketClient:   dependencies.WebsocketClient,
+		strategyService:   dependencies.Strategies,
+		riskService:       dependencies.Risk,
+		candleService:     dependencies.Candles,
+		orderService:      dependencies.Orders,
+		pnlService:        dependencies.PnL,
+		strategyStates:    dependencies.StrategyStates,
+		tradingControl:    dependencies.TradingControl,
+		apiKeyService:     dependencies.APIKeys,
+		logger:            dependencies.Logger,
+		nonces:            make(map[string]time.Time),
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		server.logger.Panic(err)
+		return &server
 	}
+	server.address = listener.Addr().String()
 
 	go func() {
-		server.logger.Panic(http.ListenAndServe(":5000", server.Routes()))
+		server.logger.Panic(http.Serve(listener, server.Routes()))
 	}()
 
-	instrument, ok := instrumentService.GetInstrument()
-	if ok {
-		server.websocketClient.SubscribeToTicker([]string{instrument.Symbol})
-	}
+	server.websocketClient.SetMarketSubscription(server.instrumentService.GetEnabledSymbols())
 
 	return &server
 }
 
+// Actual listening address, useful when the port was chosen by the system
+func (server *Server) Address() string {
+	return server.address
+}
+
 func (server *Server) Routes() chi.Router {
 	root := chi.NewRouter()
 
 	root.Use(middleware.Logger)
-	root.Put("/instrument", server.instrumentUpdate)
+	root.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
+	})
+	root.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+	root.Group(func(router chi.Router) {
+		router.Use(server.authenticate(domain.APIRoleReadOnly))
 
-	root.Mount("/", root)
+		router.Get("/instruments", server.instrumentsList)
+		router.Get("/instruments/{symbol}", server.instrumentGet)
+		router.Get("/status", server.connectionStatus)
+		router.Get("/strategies", server.strategiesList)
+		router.Get("/strategy", server.strategyStatus)
+		router.Get("/risk", server.riskStatus)
+		router.Get("/candles/{symbol}", server.candlesList)
+		router.Get("/orders", server.ordersList)
+		router.Get("/pnl", server.pnlReport)
+		router.Get("/pnl/{symbol}", server.pnlInstrument)
+		router.Get("/positions", server.positionsList)
+		router.Get("/positions/{symbol}", server.positionGet)
+		router.Get("/trading", server.tradingStatus)
+	})
+
+	root.Group(func(router chi.Router) {
+		router.Use(server.authenticate(domain.APIRoleOperator))
+
+		router.Put("/instrument", server.instrumentSwitch)
+		router.Post("/instruments", server.instrumentAdd)
+		router.Put("/instruments/{symbol}", server.instrumentUpdate)
+		router.Delete("/instruments/{symbol}", server.instrumentDelete)
+		router.Put("/strategy", server.strategyUpdate)
+		router.Put("/risk", server.riskUpdate)
+		router.Post("/trading/start", server.tradingChange(server.tradingControl.Start))
+		router.Post("/trading/pause", server.tradingChange(server.tradingControl.Pause))
+		router.Post("/trading/stop", server.tradingChange(server.tradingControl.Flatten))
+		router.Get("/keys", server.apiKeysList)
+		router.Post("/keys", server.apiKeyAdd)
+		router.Delete("/keys/{name}", server.apiKeyDelete)
+	})
 
 	return root
 }
 
+func (server *Server) instrumentsList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, server.instrumentService.GetInstruments())
+}
+
+func (server *Server) instrumentGet(w http.ResponseWriter, r *http.Request) {
+	instrumentConfig, ok := server.instrumentService.GetInstrument(chi.URLParam(r, "symbol"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "instrument not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, instrumentConfig)
+}
+
+func (server *Server) instrumentAdd(w http.ResponseWriter, r *http.Request) {
+	instrumentConfig := domain.NewInstrumentConfig("")
+	if !readBody(w, r, &instrumentConfig) {
+		return
+	}
+
+	if instrumentConfig.Symbol == "" || instrumentConfig.OrderSize == 0 {
+		writeError(w, http.StatusBadRequest, "symbol and positive order_size are required")
+		return
+	}
+
+	if _, ok := server.instrumentService.GetInstrument(instrumentConfig.Symbol); ok {
+		writeError(w, http.StatusConflict, "instrument already exists")
+		return
+	}
+
+	server.instrumentService.SaveInstrument(instrumentConfig)
+	server.websocketClient.SetMarketSubscription(server.instrumentService.GetEnabledSymbols())
+
+	w.WriteHeader(http.StatusCreated)
+}
+
 func (server *Server) instrumentUpdate(w http.ResponseWriter, r *http.Request) {
-	d, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	symbol := chi.URLParam(r, "symbol")
+
+	instrumentConfig, ok := server.instrumentService.GetInstrument(symbol)
+	if !ok {
+		instrumentConfig = domain.NewInstrumentConfig(symbol)
+	}
+	if !readBody(w, r, &instrumentConfig) {
+		return
+	}
+	instrumentConfig.Symbol = symbol
+
+	if instrumentConfig.OrderSize == 0 {
+		writeError(w, http.StatusBadRequest, "order_size must be positive")
 		return
 	}
-	defer r.Body.Close()
 
+	server.instrumentService.SaveInstrument(instrumentConfig)
+	server.websocketClient.SetMarketSubscription(server.instrumentService.GetEnabledSymbols())
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Old single instrument endpoint, the instrument becomes the only enabled one.
+// The order size is changed only if it is present in the body
+func (server *Server) instrumentSwitch(w http.ResponseWriter, r *http.Request) {
 	var instrumentConfig domain.InstrumentConfig
-	err = json.Unmarshal(d, &instrumentConfig)
+	if !readBody(w, r, &instrumentConfig) {
+		return
+	}
+
+	if instrumentConfig.Symbol == "" {
+		writeError(w, http.StatusBadRequest, "symbol is required")
+		return
+	}
+
+	switched := server.instrumentService.SwitchInstrument(instrumentConfig.Symbol)
+	if instrumentConfig.OrderSize != 0 && instrumentConfig.OrderSize != switched.OrderSize {
+		switched.OrderSize = instrumentConfig.OrderSize
+		server.instrumentService.SaveInstrument(switched)
+	}
+	server.websocketClient.SetMarketSubscription(server.instrumentService.GetEnabledSymbols())
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (server *Server) instrumentDelete(w http.ResponseWriter, r *http.Request) {
+	if !server.instrumentService.DeleteInstrument(chi.URLParam(r, "symbol")) {
+		writeError(w, http.StatusNotFound, "instrument not found")
+		return
+	}
+
+	server.websocketClient.SetMarketSubscription(server.instrumentService.GetEnabledSymbols())
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (server *Server) connectionStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, server.websocketClient.GetConnectionStatus())
+}
+
+type strategiesAnswer struct {
+	Available []string              `json:"available"`
+	Active    domain.StrategyConfig `json:"active"`
+}
+
+func (server *Server) strategiesList(w http.ResponseWriter, r *http.Request) {
+	answer := strategiesAnswer{
+		Available: server.strategyService.Names(),
+		Active:    server.strategyService.GetStrategyConfig(),
+	}
+
+	writeJSON(w, http.StatusOK, answer)
+}
+
+type strategyAnswer struct {
+	Active      domain.StrategyConfig  `json:"active"`
+	Instruments []domain.StrategyState `json:"instruments"`
+}
+
+func (server *Server) strategyStatus(w http.ResponseWriter, r *http.Request) {
+	answer := strategyAnswer{
+		Active:      server.strategyService.GetStrategyConfig(),
+		Instruments: server.strategyStates.GetStrategyStates(),
+	}
+
+	writeJSON(w, http.StatusOK, answer)
+}
+
+func (server *Server) strategyUpdate(w http.ResponseWriter, r *http.Request) {
+	var strategyConfig domain.StrategyConfig
+	if !readBody(w, r, &strategyConfig) {
+		return
+	}
+
+	err := server.strategyService.Select(strategyConfig)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	oldInstrument, _ := server.instrumentService.GetInstrument()
-	server.websocketClient.UnsubscribeFromTicker([]string{oldInstrument.Symbol})
-	server.instrumentService.SaveInstrument(instrumentConfig)
-	server.websocketClient.SubscribeToTicker([]string{instrumentConfig.Symbol})
+	w.WriteHeader(http.StatusOK)
+}
+
+type riskAnswer struct {
+	Limits domain.RiskLimits `json:"limits"`
+	State  domain.RiskState  `json:"state"`
+}
+
+func (server *Server) riskStatus(w http.ResponseWriter, r *http.Request) {
+	answer := riskAnswer{
+		Limits: server.riskService.GetLimits(),
+		State:  server.riskService.GetState(),
+	}
+
+	writeJSON(w, http.StatusOK, answer)
+}
+
+// Only the limits present in the body are changed
+func (server *Server) riskUpdate(w http.ResponseWriter, r *http.Request) {
+	limits := server.riskService.GetLimits()
+	if !readBody(w, r, &limits) {
+		return
+	}
+
+	if limits.MaxPosition < 0 || limits.MaxNotional < 0 || limits.MaxOrdersPerMinute < 0 || limits.MaxDailyLoss < 0 || limits.MaxSlippage < 0 {
+		writeError(w, http.StatusBadRequest, "limits must not be negative")
+		return
+	}
+
+	server.riskService.SetLimits(limits)
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// Closed candles of the period from the oldest one, 1m period and 100 candles by default
+func (server *Server) candlesList(w http.ResponseWriter, r *http.Request) {
+	period := domain.CandlePeriod1m
+	if value := r.URL.Query().Get("period"); value != "" {
+		period = domain.CandlePeriod(value)
+	}
+
+	supported := false
+	for _, candlePeriod := range server.candleService.GetPeriods() {
+		supported = supported || candlePeriod == period
+	}
+	if !supported {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("period must be one of %v", server.candleService.GetPeriods()))
+		return
+	}
+
+	limit := defaultCandlesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, server.candleService.GetCandles(chi.URLParam(r, "symbol"), period, limit))
+}
+
+// Orders from the newest one filtered by symbol, side and RFC3339 time range [from, to),
+// next page is requested with the cursor returned in the previous page
+func (server *Server) ordersList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := domain.OrderFilter{Symbol: query.Get("symbol"), Limit: defaultOrdersLimit}
+
+	if side := domain.OrderSide(query.Get("side")); side != "" {
+		if side != domain.OrderSideBuy && side != domain.OrderSideSell {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("side must be %s or %s", domain.OrderSideBuy, domain.OrderSideSell))
+			return
+		}
+		filter.Side = side
+	}
+
+	for name, value := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if query.Get(name) == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, query.Get(name))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, name+" must be an RFC3339 time")
+			return
+		}
+		*value = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxOrdersLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be a number from 1 to %d", maxOrdersLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := strconv.ParseUint(value, 10, 0)
+		if err != nil || cursor == 0 {
+			writeError(w, http.StatusBadRequest, "wrong cursor")
+			return
+		}
+		filter.Cursor = uint(cursor)
+	}
+
+	writeJSON(w, http.StatusOK, server.orderService.GetOrderPage(filter))
+}
+
+func (server *Server) pnlReport(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, server.pnlService.GetReport())
+}
+
+func (server *Server) pnlInstrument(w http.ResponseWriter, r *http.Request) {
+	instrument, ok := server.pnlService.GetInstrumentPnL(chi.URLParam(r, "symbol"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "instrument has no fills")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, instrument)
+}
+
+// Open positions known to the risk engine
+func (server *Server) positionsList(w http.ResponseWriter, r *http.Request) {
+	positions := []domain.Position{}
+	for _, position := range server.riskService.GetState().Positions {
+		if position.Quantity != 0 {
+			positions = append(positions, position)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, positions)
+}
+
+// Position with zero quantity is returned if nothing is held
+func (server *Server) positionGet(w http.ResponseWriter, r *http.Request) {
+	symbol := chi.URLParam(r, "symbol")
+
+	position := domain.Position{Symbol: strings.ToUpper(symbol)}
+	for _, heldPosition := range server.riskService.GetState().Positions {
+		if strings.EqualFold(heldPosition.Symbol, symbol) {
+			position = heldPosition
+		}
+	}
+
+	writeJSON(w, http.StatusOK, position)
+}
+
+type tradingAnswer struct {
+	State       domain.TradingState        `json:"state"`
+	Transitions []domain.TradingTransition `json:"transitions"`
+}
+
+// Trading state and the last changes from the newest one
+func (server *Server) tradingStatus(w http.ResponseWriter, r *http.Request) {
+	answer := tradingAnswer{
+		State:       server.tradingControl.GetState(),
+		Transitions: server.tradingControl.GetTransitions(tradingTransitionsLimit),
+	}
+
+	writeJSON(w, http.StatusOK, answer)
+}
+
+// Change the trading state and answer with the new one, the name of the API key is saved as the actor
+func (server *Server) tradingChange(change func(source string, actor string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := change(tradingSource, apiKeyName(r)); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		server.tradingStatus(w, r)
+	}
+}
+
+type errorAnswer struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorAnswer{Error: message})
+}
+
+// Decode json body into value, on failure the error status is written and false is returned
+func readBody(w http.ResponseWriter, r *http.Request, value interface{}) bool {
+	d, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "can't read body")
+		return false
+	}
+	defer r.Body.Close()
+
+	err = json.Unmarshal(d, value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "wrong json: "+err.Error())
+		return false
+	}
+
+	return true
+}
@@ -2,48 +2,686 @@ package handlers_test
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/legendiguess/kraken-trade-bot/domain"
 	"github.com/legendiguess/kraken-trade-bot/handlers"
 	"github.com/stretchr/testify/assert"
 )
 
-type instrumentServiceTest struct{}
+type instrumentServiceTest struct {
+	instruments []domain.InstrumentConfig
+}
 
 func (instrumentServiceTest *instrumentServiceTest) SaveInstrument(newInstrument domain.InstrumentConfig) {
+	instrumentServiceTest.DeleteInstrument(newInstrument.Symbol)
+	instrumentServiceTest.instruments = append(instrumentServiceTest.instruments, newInstrument)
+}
+
+func (instrumentServiceTest *instrumentServiceTest) DeleteInstrument(symbol string) bool {
+	for i, instrument := range instrumentServiceTest.instruments {
+		if instrument.Symbol == symbol {
+			instrumentServiceTest.instruments = append(instrumentServiceTest.instruments[:i], instrumentServiceTest.instruments[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (instrumentServiceTest *instrumentServiceTest) GetInstrument(symbol string) (domain.InstrumentConfig, bool) {
+	for _, instrument := range instrumentServiceTest.instruments {
+		if instrument.Symbol == symbol {
+			return instrument, true
+		}
+	}
+	return domain.InstrumentConfig{}, false
+}
+
+func (instrumentServiceTest *instrumentServiceTest) GetInstruments() []domain.InstrumentConfig {
+	return instrumentServiceTest.instruments
+}
+
+func (instrumentServiceTest *instrumentServiceTest) GetEnabledSymbols() []string {
+	symbols := []string{}
+	for _, instrument := range instrumentServiceTest.instruments {
+		if instrument.Enabled {
+			symbols = append(symbols, instrument.Symbol)
+		}
+	}
+	return symbols
+}
+
+func (instrumentServiceTest *instrumentServiceTest) SwitchInstrument(symbol string) domain.InstrumentConfig {
+	for i := range instrumentServiceTest.instruments {
+		instrumentServiceTest.instruments[i].Enabled = false
+	}
+
+	instrument, ok := instrumentServiceTest.GetInstrument(symbol)
+	if !ok {
+		instrument = domain.NewInstrumentConfig(symbol)
+	}
+	instrument.Enabled = true
+	instrumentServiceTest.SaveInstrument(instrument)
+
+	return instrument
+}
+
+type websocketClientServiceTest struct {
+	productIDs []string
+}
+
+func (websocketClientServiceTest *websocketClientServiceTest) SetMarketSubscription(productIDs []string) {
+	websocketClientServiceTest.productIDs = productIDs
+}
+
+func (websocketClientServiceTest *websocketClientServiceTest) GetConnectionStatus() domain.ConnectionStatus {
+	return domain.ConnectionStatus{State: domain.ConnectionStateReconnecting, Reconnects: 2}
+}
+
+type strategyServiceTest struct {
+	config domain.StrategyConfig
+}
+
+func (strategyServiceTest *strategyServiceTest) Names() []string {
+	return []string{"test"}
+}
 
+func (strategyServiceTest *strategyServiceTest) Select(config domain.StrategyConfig) error {
+	if config.Name != "test" {
+		return errors.New("unknown strategy")
+	}
+	strategyServiceTest.config = config
+	return nil
 }
 
-func (instrumentServiceTest *instrumentServiceTest) GetInstrument() (domain.InstrumentConfig, bool) {
-	return domain.InstrumentConfig{}, true
+func (strategyServiceTest *strategyServiceTest) GetStrategyConfig() domain.StrategyConfig {
+	return strategyServiceTest.config
 }
 
-type websocketClientServiceTest struct{}
+type riskServiceTest struct {
+	limits domain.RiskLimits
+}
+
+func (riskServiceTest *riskServiceTest) GetLimits() domain.RiskLimits {
+	return riskServiceTest.limits
+}
 
-func (websocketClientServiceTest *websocketClientServiceTest) SubscribeToTicker(productIDs []string) {
+func (riskServiceTest *riskServiceTest) SetLimits(limits domain.RiskLimits) {
+	riskServiceTest.limits = limits
 }
 
-func (websocketClientServiceTest *websocketClientServiceTest) UnsubscribeFromTicker(productIDs []string) {
+func (riskServiceTest *riskServiceTest) GetState() domain.RiskState {
+	return domain.RiskState{OrdersLastMinute: 3}
 }
 
 type serverLoggerTest struct{}
 
 func (serverLoggerTest *serverLoggerTest) Panic(args ...interface{}) {}
 
-func TestInstrumentUpdate(t *testing.T) {
-	handlers.NewServer(&instrumentServiceTest{}, &websocketClientServiceTest{}, &serverLoggerTest{})
+func (serverLoggerTest *serverLoggerTest) Printf(format string, args ...interface{}) {}
+
+// Requests are made with the operator key
+func sendRequest(t *testing.T, method string, url string, body string) *http.Response {
+	newRequest, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	newRequest.Header.Set("X-API-Key", operatorKey)
+
+	resp, err := http.DefaultClient.Do(newRequest)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	return resp
+}
+
+// GET request with the operator key
+func get(url string) (*http.Response, error) {
+	newRequest, _ := http.NewRequest("GET", url, nil)
+	newRequest.Header.Set("X-API-Key", operatorKey)
+
+	return http.DefaultClient.Do(newRequest)
+}
+
+func TestInstruments(t *testing.T) {
+	instrumentService := instrumentServiceTest{instruments: []domain.InstrumentConfig{domain.NewInstrumentConfig("stored")}}
+	websocketClient := websocketClientServiceTest{}
+	server := newTestServer(handlers.ServerDependencies{
+		Instruments:     &instrumentService,
+		WebsocketClient: &websocketClient,
+	})
+	serverURL := "http://" + server.Address()
+
+	assert.Equal(t, []string{"stored"}, websocketClient.productIDs)
+
+	resp := sendRequest(t, "POST", serverURL+"/instruments", `{"symbol": "test_symbol"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"stored", "test_symbol"}, websocketClient.productIDs)
+
+	resp = sendRequest(t, "POST", serverURL+"/instruments", `{"symbol": "test_symbol"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = sendRequest(t, "POST", serverURL+"/instruments", `{"order_size": 2}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = sendRequest(t, "PUT", serverURL+"/instruments/stored", `{"order_size": 3, "enabled": false}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"test_symbol"}, websocketClient.productIDs)
+
+	resp, err := get(serverURL + "/instruments")
+	assert.Nil(t, err)
+	var instruments []domain.InstrumentConfig
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&instruments))
+	resp.Body.Close()
+	assert.Equal(t, []domain.InstrumentConfig{
+		domain.NewInstrumentConfig("test_symbol"),
+		{Symbol: "stored", OrderSize: 3, Enabled: false},
+	}, instruments)
 
-	postBody, _ := json.Marshal(domain.InstrumentConfig{Symbol: "test_symbol"})
+	resp = sendRequest(t, "DELETE", serverURL+"/instruments/test_symbol", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{}, websocketClient.productIDs)
+
+	resp = sendRequest(t, "DELETE", serverURL+"/instruments/test_symbol", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
 
-	newRequest, _ := http.NewRequest("PUT", "http://localhost:5000/instrument", bytes.NewBuffer(postBody))
+func TestInstrumentSwitch(t *testing.T) {
+	instrumentService := instrumentServiceTest{instruments: []domain.InstrumentConfig{domain.NewInstrumentConfig("first"), domain.NewInstrumentConfig("second")}}
+	websocketClient := websocketClientServiceTest{}
+	server := newTestServer(handlers.ServerDependencies{
+		Instruments:     &instrumentService,
+		WebsocketClient: &websocketClient,
+	})
+	serverURL := "http://" + server.Address()
 
+	resp := sendRequest(t, "PUT", serverURL+"/instrument", `{"order_size": 2}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = sendRequest(t, "PUT", serverURL+"/instrument", `{"symbol": "second"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"second"}, websocketClient.productIDs)
+
+	// Unknown symbol is added, the order size from the body is kept
+	resp = sendRequest(t, "PUT", serverURL+"/instrument", `{"symbol": "third", "order_size": 5}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"third"}, websocketClient.productIDs)
+	instrument, ok := instrumentService.GetInstrument("third")
+	assert.True(t, ok)
+	assert.Equal(t, domain.InstrumentConfig{Symbol: "third", OrderSize: 5, Enabled: true}, instrument)
+
+	assert.Equal(t, http.StatusForbidden, sendWithKey(t, "PUT", serverURL+"/instrument", readerKey))
+}
+
+func TestStrategyUpdate(t *testing.T) {
+	strategyService := strategyServiceTest{}
+	server := newTestServer(handlers.ServerDependencies{
+		Strategies: &strategyService,
+	})
+	serverURL := "http://" + server.Address()
+
+	config := domain.StrategyConfig{Name: "test", Params: map[string]float64{"ratio": 0.5}}
+	postBody, _ := json.Marshal(config)
+	newRequest, _ := http.NewRequest("PUT", serverURL+"/strategy", bytes.NewBuffer(postBody))
+	newRequest.Header.Set("X-API-Key", operatorKey)
 	resp, err := http.DefaultClient.Do(newRequest)
 	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, config, strategyService.config)
+
+	postBody, _ = json.Marshal(domain.StrategyConfig{Name: "unknown"})
+	newRequest, _ = http.NewRequest("PUT", serverURL+"/strategy", bytes.NewBuffer(postBody))
+	newRequest.Header.Set("X-API-Key", operatorKey)
+	resp, err = http.DefaultClient.Do(newRequest)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = get(serverURL + "/strategies")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	var answer map[string]interface{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&answer))
+	assert.Equal(t, []interface{}{"test"}, answer["available"])
+	assert.Equal(t, "test", answer["active"].(map[string]interface{})["name"])
+}
+
+func TestConnectionStatus(t *testing.T) {
+	server := newTestServer(handlers.ServerDependencies{})
+
+	resp, err := get("http://" + server.Address() + "/status")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	var status domain.ConnectionStatus
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+	assert.Equal(t, domain.ConnectionStateReconnecting, status.State)
+	assert.Equal(t, 2, status.Reconnects)
+}
+
+func TestRisk(t *testing.T) {
+	riskService := riskServiceTest{limits: domain.RiskLimits{MaxPosition: 5}}
+	server := newTestServer(handlers.ServerDependencies{
+		Risk: &riskService,
+	})
+	serverURL := "http://" + server.Address()
+
+	resp := sendRequest(t, "PUT", serverURL+"/risk", `{"max_orders_per_minute": 10, "kill_switch": true}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, domain.RiskLimits{MaxPosition: 5, MaxOrdersPerMinute: 10, KillSwitch: true}, riskService.limits)
+
+	resp = sendRequest(t, "PUT", serverURL+"/risk", `{"max_daily_loss": -1}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err := get(serverURL + "/risk")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	var answer struct {
+		Limits domain.RiskLimits `json:"limits"`
+		State  domain.RiskState  `json:"state"`
+	}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&answer))
+	assert.Equal(t, riskService.limits, answer.Limits)
+	assert.Equal(t, 3, answer.State.OrdersLastMinute)
+}
+
+type candleServiceTest struct{}
+
+func (candleServiceTest *candleServiceTest) GetPeriods() []domain.CandlePeriod {
+	return []domain.CandlePeriod{domain.CandlePeriod1m, domain.CandlePeriod5m}
+}
+
+func (candleServiceTest *candleServiceTest) GetCandles(symbol string, period domain.CandlePeriod, count int) []domain.Candle {
+	candles := []domain.Candle{}
+	for i := 0; i < count && i < 3; i++ {
+		candles = append(candles, domain.Candle{Symbol: symbol, Period: period, Open: float64(i)})
+	}
+	return candles
+}
+
+func TestCandles(t *testing.T) {
+	server := newTestServer(handlers.ServerDependencies{})
+	serverURL := "http://" + server.Address()
+
+	resp, err := get(serverURL + "/candles/PI_XBTUSD?period=5m&limit=2")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	var candles []domain.Candle
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&candles))
+	assert.Equal(t, []domain.Candle{
+		{Symbol: "PI_XBTUSD", Period: domain.CandlePeriod5m, Open: 0},
+		{Symbol: "PI_XBTUSD", Period: domain.CandlePeriod5m, Open: 1},
+	}, candles)
+
+	for _, query := range []string{"?period=1h", "?limit=0", "?limit=many"} {
+		resp, err := get(serverURL + "/candles/PI_XBTUSD" + query)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+type orderServiceTest struct {
+	filter domain.OrderFilter
+}
 
+func (orderServiceTest *orderServiceTest) GetOrderPage(filter domain.OrderFilter) domain.OrderPage {
+	orderServiceTest.filter = filter
+	return domain.OrderPage{Orders: []domain.OrderInfo{{ID: 7, OrderID: "order", Symbol: filter.Symbol}}, NextCursor: "7"}
+}
+
+type pnlServiceTest struct{}
+
+func (pnlServiceTest *pnlServiceTest) GetReport() domain.PnLReport {
+	return domain.PnLReport{Instruments: []domain.InstrumentPnL{{Symbol: "PI_XBTUSD", NetPnL: 5}}, NetPnL: 5}
+}
+
+func (pnlServiceTest *pnlServiceTest) GetInstrumentPnL(symbol string) (domain.InstrumentPnL, bool) {
+	if symbol != "PI_XBTUSD" {
+		return domain.InstrumentPnL{}, false
+	}
+	return domain.InstrumentPnL{Symbol: symbol, NetPnL: 5}, true
+}
+
+type strategyStateServiceTest struct{}
+
+func (strategyStateServiceTest *strategyStateServiceTest) GetStrategyStates() []domain.StrategyState {
+	return []domain.StrategyState{{Symbol: "PI_XBTUSD", Tickers: 3, State: map[string]interface{}{"holding": true}}}
+}
+
+// Decode json answer into value and return the status
+func getJSON(t *testing.T, url string, value interface{}) int {
+	resp, err := get(url)
+	assert.Nil(t, err)
 	defer resp.Body.Close()
 
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(value))
+
+	return resp.StatusCode
+}
+
+func TestOrders(t *testing.T) {
+	orderService := orderServiceTest{}
+	server := newTestServer(handlers.ServerDependencies{
+		Orders: &orderService,
+	})
+	serverURL := "http://" + server.Address()
+
+	var page domain.OrderPage
+	status := getJSON(t, serverURL+"/orders?symbol=PI_XBTUSD&side=buy&from=2021-11-25T19:00:00Z&to=2021-11-26T19:00:00%2B03:00&limit=10&cursor=20", &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "7", page.NextCursor)
+	assert.Equal(t, []domain.OrderInfo{{ID: 7, OrderID: "order", Symbol: "PI_XBTUSD"}}, page.Orders)
+
+	assert.Equal(t, "PI_XBTUSD", orderService.filter.Symbol)
+	assert.Equal(t, domain.OrderSideBuy, orderService.filter.Side)
+	assert.Equal(t, time.Date(2021, 11, 25, 19, 0, 0, 0, time.UTC), orderService.filter.From.UTC())
+	assert.Equal(t, time.Date(2021, 11, 26, 16, 0, 0, 0, time.UTC), orderService.filter.To.UTC())
+	assert.Equal(t, 10, orderService.filter.Limit)
+	assert.Equal(t, uint(20), orderService.filter.Cursor)
+
+	getJSON(t, serverURL+"/orders", &page)
+	assert.Equal(t, domain.OrderFilter{Limit: 50}, orderService.filter)
+
+	for _, query := range []string{"?side=hold", "?from=yesterday", "?limit=0", "?limit=1000", "?cursor=abc"} {
+		var answer map[string]string
+		status := getJSON(t, serverURL+"/orders"+query, &answer)
+		assert.Equal(t, http.StatusBadRequest, status, query)
+		assert.NotEmpty(t, answer["error"], query)
+	}
+}
+
+func TestReadOnlyEndpoints(t *testing.T) {
+	instrumentService := instrumentServiceTest{instruments: []domain.InstrumentConfig{domain.NewInstrumentConfig("PI_XBTUSD")}}
+	server := newTestServer(handlers.ServerDependencies{
+		Instruments: &instrumentService,
+		Strategies:  &strategyServiceTest{config: domain.StrategyConfig{Name: "test"}},
+	})
+	serverURL := "http://" + server.Address()
+
+	var instrument domain.InstrumentConfig
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/instruments/PI_XBTUSD", &instrument))
+	assert.Equal(t, domain.NewInstrumentConfig("PI_XBTUSD"), instrument)
+
+	var report domain.PnLReport
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/pnl", &report))
+	assert.Equal(t, 5.0, report.NetPnL)
+
+	var instrumentPnL domain.InstrumentPnL
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/pnl/PI_XBTUSD", &instrumentPnL))
+	assert.Equal(t, domain.InstrumentPnL{Symbol: "PI_XBTUSD", NetPnL: 5}, instrumentPnL)
+
+	var positions []domain.Position
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/positions", &positions))
+	assert.Equal(t, []domain.Position{}, positions)
+
+	var position domain.Position
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/positions/pi_xbtusd", &position))
+	assert.Equal(t, domain.Position{Symbol: "PI_XBTUSD"}, position)
+
+	var strategy struct {
+		Active      domain.StrategyConfig  `json:"active"`
+		Instruments []domain.StrategyState `json:"instruments"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/strategy", &strategy))
+	assert.Equal(t, "test", strategy.Active.Name)
+	assert.Equal(t, []domain.StrategyState{{Symbol: "PI_XBTUSD", Tickers: 3, State: map[string]interface{}{"holding": true}}}, strategy.Instruments)
+
+	for _, path := range []string{"/instruments/unknown", "/pnl/unknown", "/unknown"} {
+		var answer map[string]string
+		assert.Equal(t, http.StatusNotFound, getJSON(t, serverURL+path, &answer), path)
+		assert.NotEmpty(t, answer["error"], path)
+	}
+}
+
+type tradingControlServiceTest struct {
+	state       domain.TradingState
+	transitions []domain.TradingTransition
+}
+
+func (tradingControlServiceTest *tradingControlServiceTest) GetState() domain.TradingState {
+	return tradingControlServiceTest.state
+}
+
+func (tradingControlServiceTest *tradingControlServiceTest) change(state domain.TradingState, source string, actor string) error {
+	if tradingControlServiceTest.state == state {
+		return errors.New("same state")
+	}
+	tradingControlServiceTest.transitions = append(tradingControlServiceTest.transitions, domain.TradingTransition{From: tradingControlServiceTest.state, To: state, Source: source, Actor: actor})
+	tradingControlServiceTest.state = state
+	return nil
+}
+
+func (tradingControlServiceTest *tradingControlServiceTest) Start(source string, actor string) error {
+	return tradingControlServiceTest.change(domain.TradingStateRunning, source, actor)
+}
+
+func (tradingControlServiceTest *tradingControlServiceTest) Pause(source string, actor string) error {
+	return tradingControlServiceTest.change(domain.TradingStatePaused, source, actor)
+}
+
+func (tradingControlServiceTest *tradingControlServiceTest) Flatten(source string, actor string) error {
+	return tradingControlServiceTest.change(domain.TradingStateFlattening, source, actor)
+}
+
+func (tradingControlServiceTest *tradingControlServiceTest) GetTransitions(limit int) []domain.TradingTransition {
+	return tradingControlServiceTest.transitions
+}
+
+func TestTrading(t *testing.T) {
+	tradingControl := tradingControlServiceTest{state: domain.TradingStateRunning}
+	server := newTestServer(handlers.ServerDependencies{
+		TradingControl: &tradingControl,
+	})
+	serverURL := "http://" + server.Address()
+
+	resp := sendRequest(t, "POST", serverURL+"/trading/pause", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendRequest(t, "POST", serverURL+"/trading/pause", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = sendRequest(t, "POST", serverURL+"/trading/stop", "")
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = sendRequest(t, "GET", serverURL+"/trading/start", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	var answer struct {
+		State       domain.TradingState        `json:"state"`
+		Transitions []domain.TradingTransition `json:"transitions"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/trading", &answer))
+	assert.Equal(t, domain.TradingStateFlattening, answer.State)
+	if assert.Len(t, answer.Transitions, 2) {
+		assert.Equal(t, domain.TradingStatePaused, answer.Transitions[0].To)
+		assert.Equal(t, "api", answer.Transitions[0].Source)
+		assert.Equal(t, "operator", answer.Transitions[0].Actor)
+	}
+}
+
+const (
+	operatorKey = "operator-key"
+	readerKey   = "reader-key"
+	signedKey   = "signed-key"
+)
+
+type apiKeyServiceTest struct {
+	apiKeys map[string]domain.APIKey
+}
+
+func newAPIKeyServiceTest() *apiKeyServiceTest {
+	return &apiKeyServiceTest{apiKeys: map[string]domain.APIKey{
+		operatorKey: {Name: "operator", Role: domain.APIRoleOperator},
+		readerKey:   {Name: "reader", Role: domain.APIRoleReadOnly},
+		signedKey:   {Name: "signed", Role: domain.APIRoleOperator, SigningSecret: "secret"},
+	}}
+}
+
+func (apiKeyServiceTest *apiKeyServiceTest) Authenticate(key string) (domain.APIKey, bool) {
+	apiKey, ok := apiKeyServiceTest.apiKeys[key]
+	return apiKey, ok
+}
+
+func (apiKeyServiceTest *apiKeyServiceTest) CreateKey(name string, role domain.APIRole, signed bool) (domain.NewAPIKey, error) {
+	if role != domain.APIRoleReadOnly && role != domain.APIRoleOperator {
+		return domain.NewAPIKey{}, errors.New("unknown role")
+	}
+	apiKeyServiceTest.apiKeys[name+"-key"] = domain.APIKey{Name: name, Role: role}
+	return domain.NewAPIKey{Name: name, Role: role, Key: name + "-key"}, nil
+}
+
+func (apiKeyServiceTest *apiKeyServiceTest) GetKeys() []domain.APIKey {
+	return []domain.APIKey{apiKeyServiceTest.apiKeys[operatorKey], apiKeyServiceTest.apiKeys[signedKey]}
+}
+
+func (apiKeyServiceTest *apiKeyServiceTest) DeleteKey(name string) bool {
+	for key, apiKey := range apiKeyServiceTest.apiKeys {
+		if apiKey.Name == name {
+			delete(apiKeyServiceTest.apiKeys, key)
+			return true
+		}
+	}
+	return false
+}
+
+// Server on a free port, the services missing in the dependencies are replaced with the test ones
+func newTestServer(dependencies handlers.ServerDependencies) *handlers.Server {
+	if dependencies.Instruments == nil {
+		dependencies.Instruments = &instrumentServiceTest{}
+	}
+	if dependencies.WebsocketClient == nil {
+		dependencies.WebsocketClient = &websocketClientServiceTest{}
+	}
+	if dependencies.Strategies == nil {
+		dependencies.Strategies = &strategyServiceTest{}
+	}
+	if dependencies.Risk == nil {
+		dependencies.Risk = &riskServiceTest{}
+	}
+	if dependencies.Candles == nil {
+		dependencies.Candles = &candleServiceTest{}
+	}
+	if dependencies.Orders == nil {
+		dependencies.Orders = &orderServiceTest{}
+	}
+	if dependencies.PnL == nil {
+		dependencies.PnL = &pnlServiceTest{}
+	}
+	if dependencies.StrategyStates == nil {
+		dependencies.StrategyStates = &strategyStateServiceTest{}
+	}
+	if dependencies.TradingControl == nil {
+		dependencies.TradingControl = &tradingControlServiceTest{state: domain.TradingStateRunning}
+	}
+	if dependencies.APIKeys == nil {
+		dependencies.APIKeys = newAPIKeyServiceTest()
+	}
+	if dependencies.Logger == nil {
+		dependencies.Logger = &serverLoggerTest{}
+	}
+
+	return handlers.NewServer("127.0.0.1:0", dependencies)
+}
+
+func sendWithKey(t *testing.T, method string, url string, key string) int {
+	newRequest, _ := http.NewRequest(method, url, nil)
+	if key != "" {
+		newRequest.Header.Set("X-API-Key", key)
+	}
+
+	resp, err := http.DefaultClient.Do(newRequest)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestAuthentication(t *testing.T) {
+	serverURL := "http://" + newTestServer(handlers.ServerDependencies{}).Address()
+
+	assert.Equal(t, http.StatusUnauthorized, sendWithKey(t, "GET", serverURL+"/instruments", ""))
+	assert.Equal(t, http.StatusUnauthorized, sendWithKey(t, "GET", serverURL+"/instruments", "wrong"))
+	assert.Equal(t, http.StatusOK, sendWithKey(t, "GET", serverURL+"/instruments", readerKey))
+
+	// Read-only key can't change anything or manage keys
+	assert.Equal(t, http.StatusForbidden, sendWithKey(t, "POST", serverURL+"/trading/pause", readerKey))
+	assert.Equal(t, http.StatusForbidden, sendWithKey(t, "GET", serverURL+"/keys", readerKey))
+	assert.Equal(t, http.StatusOK, sendWithKey(t, "POST", serverURL+"/trading/pause", operatorKey))
+}
+
+func TestAPIKeys(t *testing.T) {
+	serverURL := "http://" + newTestServer(handlers.ServerDependencies{}).Address()
+
+	resp, err := http.Post(serverURL+"/keys", "application/json", bytes.NewBufferString(`{"name": "new", "role": "read_only"}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	newRequest, _ := http.NewRequest("POST", serverURL+"/keys", bytes.NewBufferString(`{"name": "new", "role": "read_only"}`))
+	newRequest.Header.Set("X-API-Key", operatorKey)
+	resp, err = http.DefaultClient.Do(newRequest)
+	assert.Nil(t, err)
+	var newAPIKey domain.NewAPIKey
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&newAPIKey))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, http.StatusOK, sendWithKey(t, "GET", serverURL+"/pnl", newAPIKey.Key))
+
+	resp = sendRequest(t, "POST", serverURL+"/keys", `{"name": "admin", "role": "admin"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var apiKeys []map[string]interface{}
+	assert.Equal(t, http.StatusOK, getJSON(t, serverURL+"/keys", &apiKeys))
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "operator", "role": "operator", "signed": false, "created": ""},
+		{"name": "signed", "role": "operator", "signed": true, "created": ""},
+	}, apiKeys)
+
+	assert.Equal(t, http.StatusOK, sendWithKey(t, "DELETE", serverURL+"/keys/new", operatorKey))
+	assert.Equal(t, http.StatusNotFound, sendWithKey(t, "DELETE", serverURL+"/keys/new", operatorKey))
+	assert.Equal(t, http.StatusUnauthorized, sendWithKey(t, "GET", serverURL+"/pnl", newAPIKey.Key))
+}
+
+func sendSigned(t *testing.T, method string, url string, body string, timestamp time.Time, nonce string, secret string) int {
+	newRequest, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	milliseconds := strconv.FormatInt(timestamp.UnixNano()/int64(time.Millisecond), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(milliseconds + "\n" + nonce + "\n" + method + "\n" + newRequest.URL.RequestURI() + "\n" + body))
+
+	newRequest.Header.Set("X-API-Key", signedKey)
+	newRequest.Header.Set("X-Timestamp", milliseconds)
+	newRequest.Header.Set("X-Nonce", nonce)
+	newRequest.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(newRequest)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestSignedRequests(t *testing.T) {
+	serverURL := "http://" + newTestServer(handlers.ServerDependencies{}).Address()
+	now := time.Now()
+
+	assert.Equal(t, http.StatusOK, sendSigned(t, "PUT", serverURL+"/risk?dry=1", `{"max_position": 2}`, now, "1", "secret"))
+
+	// Replayed, expired, unsigned and wrongly signed requests are rejected
+	assert.Equal(t, http.StatusUnauthorized, sendSigned(t, "PUT", serverURL+"/risk?dry=1", `{"max_position": 2}`, now, "1", "secret"))
+	assert.Equal(t, http.StatusUnauthorized, sendSigned(t, "GET", serverURL+"/risk", "", now.Add(-time.Minute), "2", "secret"))
+	assert.Equal(t, http.StatusUnauthorized, sendWithKey(t, "GET", serverURL+"/risk", signedKey))
+	assert.Equal(t, http.StatusUnauthorized, sendSigned(t, "GET", serverURL+"/risk", "", now, "3", "wrong"))
+
+	assert.Equal(t, http.StatusOK, sendSigned(t, "GET", serverURL+"/risk", "", now, "4", "secret"))
 }
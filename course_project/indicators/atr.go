@@ -0,0 +1,47 @@
+package indicators
+
+import "math"
+
+// ATR is the average true range with Wilder's smoothing, the first value is the simple average
+// of the first period true ranges. True range of the first bar is its high minus low
+type ATR struct {
+	period        int
+	count         int
+	previousClose float64
+	value         float64
+}
+
+func NewATR(period int) (*ATR, error) {
+	if err := checkPeriod("ATR", period); err != nil {
+		return nil, err
+	}
+	return &ATR{period: period}, nil
+}
+
+func (atr *ATR) Update(bar Bar) {
+	trueRange := bar.High - bar.Low
+	if atr.count > 0 {
+		trueRange = math.Max(trueRange, math.Max(math.Abs(bar.High-atr.previousClose), math.Abs(bar.Low-atr.previousClose)))
+	}
+	atr.previousClose = bar.Close
+	atr.count++
+
+	period := float64(atr.period)
+	if atr.count <= atr.period {
+		atr.value += trueRange / period
+		return
+	}
+	atr.value = (atr.value*(period-1) + trueRange) / period
+}
+
+// Ready after period bars
+func (atr *ATR) Ready() bool {
+	return atr.count >= atr.period
+}
+
+func (atr *ATR) Value() float64 {
+	if !atr.Ready() {
+		return 0
+	}
+	return atr.value
+}
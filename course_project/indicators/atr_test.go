@@ -0,0 +1,34 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCandles = []domain.Candle{
+	{High: 10, Low: 8, Close: 9, Volume: 2},
+	{High: 11, Low: 9, Close: 10.5, Volume: 1},
+	{High: 12, Low: 10, Close: 11, Volume: 3},
+	{High: 11.5, Low: 9.5, Close: 10},
+	{High: 13, Low: 11, Close: 12.5, Volume: 4},
+}
+
+func TestATR(t *testing.T) {
+	atr, err := indicators.NewATR(3)
+	assert.Nil(t, err)
+
+	values := []float64{}
+	for _, candle := range testCandles {
+		atr.Update(indicators.FromCandle(candle))
+		values = append(values, atr.Value())
+	}
+
+	// True ranges are 2, 2, 2, 2 and 3 because of the gap from the previous close
+	assert.InDeltaSlice(t, []float64{0, 0, 2, 2, 7.0 / 3}, values, 1e-9)
+
+	_, err = indicators.NewATR(0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,57 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+)
+
+type BollingerValue struct {
+	Upper  float64
+	Middle float64
+	Lower  float64
+}
+
+// BollingerBands are the SMA of the close prices and the bands at the given number
+// of population standard deviations from it
+type BollingerBands struct {
+	sma        *SMA
+	deviations float64
+}
+
+// Common period is 20 with 2 deviations
+func NewBollingerBands(period int, deviations float64) (*BollingerBands, error) {
+	if deviations <= 0 {
+		return nil, errors.New("Bollinger bands deviations must be positive")
+	}
+
+	sma, err := NewSMA(period)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BollingerBands{sma: sma, deviations: deviations}, nil
+}
+
+func (bollingerBands *BollingerBands) Update(bar Bar) {
+	bollingerBands.sma.Update(bar)
+}
+
+// Ready after period bars
+func (bollingerBands *BollingerBands) Ready() bool {
+	return bollingerBands.sma.Ready()
+}
+
+func (bollingerBands *BollingerBands) Value() BollingerValue {
+	if !bollingerBands.Ready() {
+		return BollingerValue{}
+	}
+
+	mean := bollingerBands.sma.Value()
+	variance := 0.0
+	for _, value := range bollingerBands.sma.window.values {
+		variance += (value - mean) * (value - mean)
+	}
+	deviation := math.Sqrt(variance/float64(len(bollingerBands.sma.window.values))) * bollingerBands.deviations
+
+	return BollingerValue{Upper: mean + deviation, Middle: mean, Lower: mean - deviation}
+}
@@ -0,0 +1,35 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBollingerBands(t *testing.T) {
+	bollingerBands, err := indicators.NewBollingerBands(10, 2)
+	assert.Nil(t, err)
+
+	for _, price := range testCloses[:9] {
+		bollingerBands.Update(indicators.Price(price))
+	}
+	assert.Equal(t, indicators.BollingerValue{}, bollingerBands.Value())
+
+	bollingerBands.Update(indicators.Price(testCloses[9]))
+	value := bollingerBands.Value()
+	assert.InDelta(t, 22.405054, value.Upper, 1e-6)
+	assert.InDelta(t, 22.221, value.Middle, 1e-6)
+	assert.InDelta(t, 22.036946, value.Lower, 1e-6)
+
+	for _, price := range testCloses[10:] {
+		bollingerBands.Update(indicators.Price(price))
+	}
+	value = bollingerBands.Value()
+	assert.InDelta(t, 24.620390, value.Upper, 1e-6)
+	assert.InDelta(t, 23.21, value.Middle, 1e-6)
+	assert.InDelta(t, 21.799610, value.Lower, 1e-6)
+
+	_, err = indicators.NewBollingerBands(20, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,78 @@
+// Package indicators contains streaming technical indicators. Every indicator is updated
+// with one bar at a time and reports whether its warm-up is over, values read before that are zero
+package indicators
+
+import (
+	"fmt"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Bar is the input of the indicators, a tick is a bar with equal prices
+type Bar struct {
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+type Indicator interface {
+	Update(bar Bar)
+	// False during the warm-up
+	Ready() bool
+}
+
+// Tick of a single price without volume
+func Price(price float64) Bar {
+	return Bar{High: price, Low: price, Close: price}
+}
+
+func FromCandle(candle domain.Candle) Bar {
+	return Bar{High: candle.High, Low: candle.Low, Close: candle.Close, Volume: candle.Volume}
+}
+
+// Last traded price of the ticker or the mid price if there is no last price, tickers have no volume
+func FromTicker(ticker domain.Ticker) Bar {
+	if ticker.Last > 0 {
+		return Price(ticker.Last)
+	}
+	return Price(ticker.Mid())
+}
+
+func FromTrade(trade domain.MarketTrade) Bar {
+	return Bar{High: trade.Price, Low: trade.Price, Close: trade.Price, Volume: trade.Size}
+}
+
+func checkPeriod(name string, period int) error {
+	if period <= 0 {
+		return fmt.Errorf("%s period must be positive, got %d", name, period)
+	}
+	return nil
+}
+
+// Last values in the order they were added
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, size)}
+}
+
+// Add value and return the value pushed out of the full window
+func (window *window) add(value float64) (float64, bool) {
+	removed, full := window.values[window.next], window.full
+	window.values[window.next] = value
+	window.next = (window.next + 1) % len(window.values)
+	if window.next == 0 {
+		window.full = true
+	}
+	return removed, full
+}
+
+// Value by age, 0 is the newest one
+func (window *window) get(age int) float64 {
+	return window.values[(window.next-1-age+2*len(window.values))%len(window.values)]
+}
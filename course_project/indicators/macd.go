@@ -0,0 +1,61 @@
+package indicators
+
+import "fmt"
+
+type MACDValue struct {
+	MACD      float64
+	Signal    float64
+	Histogram float64
+}
+
+// MACD is the difference of the fast and slow EMA of the close prices, the signal line is the EMA of the difference
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+}
+
+// Common periods are 12, 26 and 9
+func NewMACD(fastPeriod int, slowPeriod int, signalPeriod int) (*MACD, error) {
+	if fastPeriod >= slowPeriod {
+		return nil, fmt.Errorf("MACD fast period %d must be shorter than slow period %d", fastPeriod, slowPeriod)
+	}
+
+	fast, err := NewEMA(fastPeriod)
+	if err != nil {
+		return nil, err
+	}
+	slow, err := NewEMA(slowPeriod)
+	if err != nil {
+		return nil, err
+	}
+	signal, err := NewEMA(signalPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MACD{fast: fast, slow: slow, signal: signal}, nil
+}
+
+func (macd *MACD) Update(bar Bar) {
+	macd.fast.add(bar.Close)
+	macd.slow.add(bar.Close)
+	if macd.slow.Ready() {
+		macd.signal.add(macd.fast.Value() - macd.slow.Value())
+	}
+}
+
+// Ready after slow period + signal period - 1 bars
+func (macd *MACD) Ready() bool {
+	return macd.signal.Ready()
+}
+
+func (macd *MACD) Value() MACDValue {
+	if !macd.Ready() {
+		return MACDValue{}
+	}
+
+	value := MACDValue{MACD: macd.fast.Value() - macd.slow.Value(), Signal: macd.signal.Value()}
+	value.Histogram = value.MACD - value.Signal
+	return value
+}
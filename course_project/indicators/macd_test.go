@@ -0,0 +1,32 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMACD(t *testing.T) {
+	macd, err := indicators.NewMACD(3, 6, 4)
+	assert.Nil(t, err)
+
+	for i, price := range testCloses {
+		macd.Update(indicators.Price(price))
+		// Slow EMA needs 6 bars and the signal 4 more differences
+		assert.Equal(t, i >= 8, macd.Ready(), i)
+
+		if i == 8 {
+			assert.InDelta(t, 0.023661, macd.Value().MACD, 1e-6)
+			assert.InDelta(t, 0.016638, macd.Value().Signal, 1e-6)
+		}
+	}
+
+	value := macd.Value()
+	assert.InDelta(t, 0.143850, value.MACD, 1e-6)
+	assert.InDelta(t, 0.226659, value.Signal, 1e-6)
+	assert.InDelta(t, -0.082809, value.Histogram, 1e-6)
+
+	_, err = indicators.NewMACD(26, 12, 9)
+	assert.NotNil(t, err)
+}
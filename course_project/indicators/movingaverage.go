@@ -0,0 +1,118 @@
+package indicators
+
+// SMA is the simple moving average of the close prices
+type SMA struct {
+	window *window
+	sum    float64
+}
+
+func NewSMA(period int) (*SMA, error) {
+	if err := checkPeriod("SMA", period); err != nil {
+		return nil, err
+	}
+	return &SMA{window: newWindow(period)}, nil
+}
+
+func (sma *SMA) Update(bar Bar) {
+	sma.add(bar.Close)
+}
+
+func (sma *SMA) add(value float64) {
+	removed, full := sma.window.add(value)
+	sma.sum += value
+	if full {
+		sma.sum -= removed
+	}
+}
+
+// Ready after period bars
+func (sma *SMA) Ready() bool {
+	return sma.window.full
+}
+
+func (sma *SMA) Value() float64 {
+	if !sma.Ready() {
+		return 0
+	}
+	return sma.sum / float64(len(sma.window.values))
+}
+
+// EMA is the exponential moving average of the close prices with smoothing 2 / (period + 1),
+// it starts from the simple average of the first period bars
+type EMA struct {
+	period int
+	alpha  float64
+	count  int
+	value  float64
+}
+
+func NewEMA(period int) (*EMA, error) {
+	if err := checkPeriod("EMA", period); err != nil {
+		return nil, err
+	}
+	return &EMA{period: period, alpha: 2 / float64(period+1)}, nil
+}
+
+func (ema *EMA) Update(bar Bar) {
+	ema.add(bar.Close)
+}
+
+func (ema *EMA) add(value float64) {
+	ema.count++
+	switch {
+	case ema.count < ema.period:
+		ema.value += value
+	case ema.count == ema.period:
+		ema.value = (ema.value + value) / float64(ema.period)
+	default:
+		ema.value += ema.alpha * (value - ema.value)
+	}
+}
+
+// Ready after period bars
+func (ema *EMA) Ready() bool {
+	return ema.count >= ema.period
+}
+
+func (ema *EMA) Value() float64 {
+	if !ema.Ready() {
+		return 0
+	}
+	return ema.value
+}
+
+// WMA is the linearly weighted moving average of the close prices, the newest price has the weight of period
+type WMA struct {
+	window *window
+}
+
+func NewWMA(period int) (*WMA, error) {
+	if err := checkPeriod("WMA", period); err != nil {
+		return nil, err
+	}
+	return &WMA{window: newWindow(period)}, nil
+}
+
+func (wma *WMA) Update(bar Bar) {
+	wma.window.add(bar.Close)
+}
+
+// Ready after period bars
+func (wma *WMA) Ready() bool {
+	return wma.window.full
+}
+
+func (wma *WMA) Value() float64 {
+	if !wma.Ready() {
+		return 0
+	}
+
+	period := len(wma.window.values)
+	sum, weights := 0.0, 0.0
+	for age := 0; age < period; age++ {
+		weight := float64(period - age)
+		sum += weight * wma.window.get(age)
+		weights += weight
+	}
+	return sum / weights
+}
@@ -0,0 +1,60 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+// Closes of the 10-day EMA example of StockCharts
+var testCloses = []float64{22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29, 22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63}
+
+// Update the indicator with the closes and return the values read after every update
+func updateCloses(indicator indicators.Indicator, closes []float64, value func() float64) []float64 {
+	values := []float64{}
+	for _, price := range closes {
+		indicator.Update(indicators.Price(price))
+		values = append(values, value())
+	}
+	return values
+}
+
+func TestSMA(t *testing.T) {
+	sma, err := indicators.NewSMA(5)
+	assert.Nil(t, err)
+
+	values := updateCloses(sma, testCloses, sma.Value)
+	assert.Equal(t, []float64{0, 0, 0, 0}, values[:4])
+	assert.InDeltaSlice(t, []float64{23.52, 23.788, 23.842}, values[17:], 1e-9)
+	assert.Equal(t, true, sma.Ready())
+
+	_, err = indicators.NewSMA(0)
+	assert.NotNil(t, err)
+}
+
+func TestEMA(t *testing.T) {
+	ema, err := indicators.NewEMA(10)
+	assert.Nil(t, err)
+
+	values := updateCloses(ema, testCloses[:9], ema.Value)
+	assert.Equal(t, false, ema.Ready())
+	assert.Equal(t, 0.0, values[8])
+
+	// Rounded values of the StockCharts example
+	values = updateCloses(ema, testCloses[9:], ema.Value)
+	assert.InDeltaSlice(t, []float64{22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34}, values, 0.005)
+
+	_, err = indicators.NewEMA(-1)
+	assert.NotNil(t, err)
+}
+
+func TestWMA(t *testing.T) {
+	wma, err := indicators.NewWMA(5)
+	assert.Nil(t, err)
+
+	values := updateCloses(wma, testCloses, wma.Value)
+	assert.Equal(t, 0.0, values[3])
+	assert.InDelta(t, (22.27+2*22.19+3*22.08+4*22.17+5*22.18)/15, values[4], 1e-9)
+	assert.InDeltaSlice(t, []float64{23.708667, 23.852, 23.799333}, values[17:], 1e-6)
+}
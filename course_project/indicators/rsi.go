@@ -0,0 +1,63 @@
+package indicators
+
+// RSI is the relative strength index of the close prices with Wilder's smoothing,
+// the first average gain and loss are the simple averages of the first period changes
+type RSI struct {
+	period      int
+	started     bool
+	changes     int
+	previous    float64
+	averageGain float64
+	averageLoss float64
+}
+
+func NewRSI(period int) (*RSI, error) {
+	if err := checkPeriod("RSI", period); err != nil {
+		return nil, err
+	}
+	return &RSI{period: period}, nil
+}
+
+func (rsi *RSI) Update(bar Bar) {
+	if !rsi.started {
+		rsi.started = true
+		rsi.previous = bar.Close
+		return
+	}
+
+	change := bar.Close - rsi.previous
+	rsi.previous = bar.Close
+	rsi.changes++
+
+	gain, loss := 0.0, 0.0
+	if change > 0 {
+		gain = change
+	} else {
+		loss = -change
+	}
+
+	period := float64(rsi.period)
+	if rsi.changes <= rsi.period {
+		rsi.averageGain += gain / period
+		rsi.averageLoss += loss / period
+		return
+	}
+	rsi.averageGain = (rsi.averageGain*(period-1) + gain) / period
+	rsi.averageLoss = (rsi.averageLoss*(period-1) + loss) / period
+}
+
+// Ready after period + 1 bars
+func (rsi *RSI) Ready() bool {
+	return rsi.changes >= rsi.period
+}
+
+// From 0 to 100, 50 if the price did not change
+func (rsi *RSI) Value() float64 {
+	if !rsi.Ready() {
+		return 0
+	}
+	if rsi.averageGain+rsi.averageLoss == 0 {
+		return 50
+	}
+	return 100 * rsi.averageGain / (rsi.averageGain + rsi.averageLoss)
+}
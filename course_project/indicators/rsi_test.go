@@ -0,0 +1,27 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSI(t *testing.T) {
+	rsi, err := indicators.NewRSI(14)
+	assert.Nil(t, err)
+
+	// Closes of the RSI example of StockCharts, values are calculated without rounding as TA-Lib does
+	closes := []float64{44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64}
+	values := updateCloses(rsi, closes, rsi.Value)
+
+	assert.Equal(t, 0.0, values[13])
+	assert.InDeltaSlice(t, []float64{70.4641, 66.2496, 66.4809, 69.3469, 66.2947, 57.9150}, values[14:], 1e-4)
+
+	flat, _ := indicators.NewRSI(2)
+	updateCloses(flat, []float64{10, 10, 10}, flat.Value)
+	assert.Equal(t, 50.0, flat.Value())
+
+	_, err = indicators.NewRSI(0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,64 @@
+package indicators
+
+type StochasticValue struct {
+	K float64
+	D float64
+}
+
+// Stochastic is the position of the close price in the high-low range of the last k period bars as %K
+// from 0 to 100 and the SMA of %K over d period as %D. %K is 50 if the range is empty
+type Stochastic struct {
+	highs *window
+	lows  *window
+	k     float64
+	d     *SMA
+}
+
+// Common periods are 14 and 3
+func NewStochastic(kPeriod int, dPeriod int) (*Stochastic, error) {
+	if err := checkPeriod("stochastic %K", kPeriod); err != nil {
+		return nil, err
+	}
+	d, err := NewSMA(dPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stochastic{highs: newWindow(kPeriod), lows: newWindow(kPeriod), d: d}, nil
+}
+
+func (stochastic *Stochastic) Update(bar Bar) {
+	stochastic.highs.add(bar.High)
+	stochastic.lows.add(bar.Low)
+	if !stochastic.highs.full {
+		return
+	}
+
+	highest, lowest := stochastic.highs.values[0], stochastic.lows.values[0]
+	for i := range stochastic.highs.values {
+		if stochastic.highs.values[i] > highest {
+			highest = stochastic.highs.values[i]
+		}
+		if stochastic.lows.values[i] < lowest {
+			lowest = stochastic.lows.values[i]
+		}
+	}
+
+	stochastic.k = 50
+	if highest > lowest {
+		stochastic.k = 100 * (bar.Close - lowest) / (highest - lowest)
+	}
+	stochastic.d.add(stochastic.k)
+}
+
+// Ready after k period + d period - 1 bars
+func (stochastic *Stochastic) Ready() bool {
+	return stochastic.d.Ready()
+}
+
+func (stochastic *Stochastic) Value() StochasticValue {
+	if !stochastic.Ready() {
+		return StochasticValue{}
+	}
+	return StochasticValue{K: stochastic.k, D: stochastic.d.Value()}
+}
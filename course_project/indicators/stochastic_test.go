@@ -0,0 +1,33 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStochastic(t *testing.T) {
+	stochastic, err := indicators.NewStochastic(3, 2)
+	assert.Nil(t, err)
+
+	values := []indicators.StochasticValue{}
+	for _, candle := range testCandles {
+		stochastic.Update(indicators.FromCandle(candle))
+		values = append(values, stochastic.Value())
+	}
+
+	assert.Equal(t, []indicators.StochasticValue{{}, {}, {}}, values[:3])
+	assert.InDelta(t, 100.0/3, values[3].K, 1e-9)
+	assert.InDelta(t, (75+100.0/3)/2, values[3].D, 1e-9)
+	assert.InDelta(t, 600.0/7, values[4].K, 1e-9)
+	assert.InDelta(t, (100.0/3+600.0/7)/2, values[4].D, 1e-9)
+
+	flat, _ := indicators.NewStochastic(2, 1)
+	flat.Update(indicators.Price(10))
+	flat.Update(indicators.Price(10))
+	assert.Equal(t, indicators.StochasticValue{K: 50, D: 50}, flat.Value())
+
+	_, err = indicators.NewStochastic(14, 0)
+	assert.NotNil(t, err)
+}
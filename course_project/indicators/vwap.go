@@ -0,0 +1,38 @@
+package indicators
+
+// VWAP is the volume weighted average of the typical prices (high + low + close) / 3 since the last reset,
+// bars without volume are ignored, so it needs trades or candles rather than tickers
+type VWAP struct {
+	volume float64
+	cost   float64
+}
+
+func NewVWAP() *VWAP {
+	return &VWAP{}
+}
+
+func (vwap *VWAP) Update(bar Bar) {
+	if bar.Volume <= 0 {
+		return
+	}
+	vwap.volume += bar.Volume
+	vwap.cost += bar.Volume * (bar.High + bar.Low + bar.Close) / 3
+}
+
+// Ready after the first bar with volume
+func (vwap *VWAP) Ready() bool {
+	return vwap.volume > 0
+}
+
+func (vwap *VWAP) Value() float64 {
+	if !vwap.Ready() {
+		return 0
+	}
+	return vwap.cost / vwap.volume
+}
+
+// Start a new session, e.g. at the start of the day
+func (vwap *VWAP) Reset() {
+	vwap.volume = 0
+	vwap.cost = 0
+}
@@ -0,0 +1,27 @@
+package indicators_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVWAP(t *testing.T) {
+	vwap := indicators.NewVWAP()
+
+	// Tickers have no volume
+	vwap.Update(indicators.FromTicker(domain.Ticker{Bid: 9, Ask: 11}))
+	assert.Equal(t, false, vwap.Ready())
+
+	for _, candle := range testCandles {
+		vwap.Update(indicators.FromCandle(candle))
+	}
+	assert.InDelta(t, 10.983333, vwap.Value(), 1e-6)
+
+	vwap.Reset()
+	vwap.Update(indicators.FromTrade(domain.MarketTrade{Price: 100, Size: 1}))
+	vwap.Update(indicators.FromTrade(domain.MarketTrade{Price: 103, Size: 2}))
+	assert.Equal(t, 102.0, vwap.Value())
+}
@@ -0,0 +1,178 @@
+package krakentest
+
+import (
+	"context"
+	"strings"
+)
+
+var privateFeeds = map[string]bool{
+	"fills":                        true,
+	"open_orders":                  true,
+	"open_positions":               true,
+	"account_balances_and_margins": true,
+}
+
+type privateMessage struct {
+	feed    string
+	message map[string]interface{}
+}
+
+// Message is sent to the private feed subscribers by flushPrivateMessages, must be called with locked mutex
+func (server *Server) queuePrivateMessage(feed string, message map[string]interface{}) {
+	server.privateMessages = append(server.privateMessages, privateMessage{feed: feed, message: message})
+}
+
+// Send queued messages outside of the lock, so slow clients don't block the exchange
+func (server *Server) flushPrivateMessages() {
+	server.mutex.Lock()
+	messages := server.privateMessages
+	server.privateMessages = nil
+	connections := server.connectionsList()
+	server.mutex.Unlock()
+
+	for _, message := range messages {
+		for _, connection := range connections {
+			if connection.subscribed(message.feed, "") {
+				connection.send(context.Background(), message.message)
+			}
+		}
+	}
+}
+
+// Snapshot sent right after subscription to the private feed, must be called with locked mutex
+func (server *Server) privateSnapshot(feed string) map[string]interface{} {
+	switch feed {
+	case "fills":
+		fills := []map[string]interface{}{}
+		for _, fill := range server.fills {
+			fills = append(fills, fillMessage(fill))
+		}
+		return map[string]interface{}{"feed": "fills_snapshot", "account": "krakentest", "fills": fills}
+	case "open_orders":
+		orders := []map[string]interface{}{}
+		for _, order := range server.openOrders {
+			orders = append(orders, openOrderMessage(order))
+		}
+		return map[string]interface{}{"feed": "open_orders_snapshot", "account": "krakentest", "orders": orders}
+	case "open_positions":
+		return server.positionsMessage()
+	default:
+		return server.balancesMessage()
+	}
+}
+
+// Add resting order and notify open_orders subscribers, must be called with locked mutex
+func (server *Server) placeOrder(order openOrder) {
+	server.openOrders = append(server.openOrders, order)
+	server.queuePrivateMessage("open_orders", map[string]interface{}{
+		"feed":      "open_orders",
+		"username":  "krakentest",
+		"order":     openOrderMessage(order),
+		"is_cancel": false,
+		"reason":    "new_placed_order_by_user",
+	})
+}
+
+// Notify open_orders subscribers that the order is not open anymore, must be called with locked mutex
+func (server *Server) closeOrder(order openOrder, reason string) {
+	var clientOrderID interface{}
+	if order.ClientOrderID != "" {
+		clientOrderID = order.ClientOrderID
+	}
+
+	server.queuePrivateMessage("open_orders", map[string]interface{}{
+		"feed":       "open_orders",
+		"username":   "krakentest",
+		"order_id":   order.OrderID,
+		"cli_ord_id": clientOrderID,
+		"is_cancel":  true,
+		"reason":     reason,
+	})
+}
+
+// Must be called with locked mutex
+func (server *Server) positionsMessage() map[string]interface{} {
+	positions := []map[string]interface{}{}
+	for _, symbol := range server.positionSymbols() {
+		position := server.positions[symbol]
+		positions = append(positions, map[string]interface{}{
+			"instrument":  symbol,
+			"balance":     position.Quantity,
+			"entry_price": position.AverageEntryPrice,
+		})
+	}
+
+	return map[string]interface{}{"feed": "open_positions", "account": "krakentest", "positions": positions}
+}
+
+// Must be called with locked mutex
+func (server *Server) balancesMessage() map[string]interface{} {
+	unrealized := server.unrealizedPnL()
+
+	return map[string]interface{}{
+		"feed":    "account_balances_and_margins",
+		"account": "krakentest",
+		"margin_accounts": []map[string]interface{}{{
+			"name":    "flex",
+			"balance": server.balance,
+			"pnl":     unrealized,
+			"pv":      server.balance + unrealized,
+			"am":      server.balance + unrealized,
+			"im":      0.0,
+			"mm":      0.0,
+		}},
+	}
+}
+
+func fillMessage(fill fill) map[string]interface{} {
+	var clientOrderID interface{}
+	if fill.ClientOrderID != "" {
+		clientOrderID = fill.ClientOrderID
+	}
+
+	return map[string]interface{}{
+		"instrument": strings.ToUpper(fill.Symbol),
+		"time":       fill.time.UnixNano() / 1e6,
+		"price":      fill.Price,
+		"buy":        fill.Side == "buy",
+		"qty":        fill.Size,
+		"order_id":   fill.OrderID,
+		"cli_ord_id": clientOrderID,
+		"fill_id":    fill.FillID,
+		"fill_type":  fill.FillType,
+		"fee_paid":   0.0,
+	}
+}
+
+func openOrderMessage(order openOrder) map[string]interface{} {
+	var clientOrderID interface{}
+	if order.ClientOrderID != "" {
+		clientOrderID = order.ClientOrderID
+	}
+
+	orderType := "limit"
+	switch order.OrderType {
+	case "stp":
+		orderType = "stop"
+	case "take_profit":
+		orderType = "take_profit"
+	}
+
+	direction := 0
+	if order.Side == "sell" {
+		direction = 1
+	}
+
+	return map[string]interface{}{
+		"instrument":  strings.ToUpper(order.Symbol),
+		"qty":         order.UnfilledSize + order.FilledSize,
+		"filled":      order.FilledSize,
+		"limit_price": order.LimitPrice,
+		"stop_price":  order.StopPrice,
+		"type":        orderType,
+		"order_id":    order.OrderID,
+		"cli_ord_id":  clientOrderID,
+		"direction":   direction,
+		"reduce_only": order.ReduceOnly,
+	}
+}
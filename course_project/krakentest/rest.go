@@ -0,0 +1,701 @@
+package krakentest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+func (server *Server) handleREST(w http.ResponseWriter, r *http.Request) {
+	// Params may be sent in the query string or in the urlencoded body
+	body, _ := io.ReadAll(r.Body)
+	postData := r.URL.RawQuery
+	if len(body) > 0 {
+		postData = string(body)
+	}
+	params, err := url.ParseQuery(postData)
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"result": "error", "error": "invalidArgument", "serverTime": serverTime()})
+		return
+	}
+
+	endpoint := strings.TrimPrefix(r.URL.Path, httpPrefix+"/api/v3/")
+
+	// Public endpoints
+	switch endpoint {
+	case "instruments":
+		server.instruments(w)
+		return
+	case "tickers":
+		server.tickersList(w)
+		return
+	case "orderbook":
+		server.orderBook(w, params)
+		return
+	case "history":
+		server.history(w, params)
+		return
+	}
+
+	if !server.authenticated(r, postData) {
+		writeJSON(w, map[string]interface{}{"result": "error", "error": "authenticationError", "serverTime": serverTime()})
+		return
+	}
+
+	// Private feeds are notified after the request changed the account
+	defer server.flushPrivateMessages()
+
+	switch endpoint {
+	case "sendorder":
+		server.sendOrder(w, params)
+	case "cancelorder":
+		server.cancelOrder(w, params)
+	case "cancelallorders":
+		server.cancelAllOrders(w, params)
+	case "editorder":
+		server.editOrder(w, params)
+	case "batchorder":
+		server.batchOrder(w, params)
+	case "openorders":
+		server.openOrdersList(w)
+	case "openpositions":
+		server.openPositions(w)
+	case "fills":
+		server.fillsList(w)
+	case "accounts":
+		server.accounts(w)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]interface{}{"result": "error", "error": "Not found", "serverTime": serverTime()})
+	}
+}
+
+func (server *Server) instruments(w http.ResponseWriter) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	instruments := []map[string]interface{}{}
+	for _, symbol := range server.symbols() {
+		instruments = append(instruments, map[string]interface{}{
+			"symbol":       strings.ToLower(symbol),
+			"type":         "futures_inverse",
+			"tradeable":    true,
+			"tickSize":     0.5,
+			"contractSize": 1,
+			"tag":          "perpetual",
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"result": "success", "instruments": instruments, "serverTime": serverTime()})
+}
+
+func (server *Server) tickersList(w http.ResponseWriter) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	tickers := []map[string]interface{}{}
+	for _, symbol := range server.symbols() {
+		ticker := server.tickers[symbol]
+		tickers = append(tickers, map[string]interface{}{
+			"symbol":       strings.ToLower(symbol),
+			"bid":          ticker["bid"],
+			"ask":          ticker["ask"],
+			"last":         ticker["last"],
+			"markPrice":    ticker["markPrice"],
+			"vol24h":       ticker["volume"],
+			"openInterest": ticker["openInterest"],
+			"suspended":    false,
+			"tag":          "perpetual",
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"result": "success", "tickers": tickers, "serverTime": serverTime()})
+}
+
+func (server *Server) orderBook(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	symbol := strings.ToUpper(params.Get("symbol"))
+	if _, ok := server.tickers[symbol]; !ok {
+		writeJSON(w, map[string]interface{}{"result": "error", "error": "invalidArgument", "serverTime": serverTime()})
+		return
+	}
+
+	bids, asks := [][2]float64{}, [][2]float64{}
+	if orderBook, ok := server.orderBooks[symbol]; ok {
+		for _, level := range orderBook.Bids {
+			bids = append(bids, [2]float64{level.Price, level.Size})
+		}
+		for _, level := range orderBook.Asks {
+			asks = append(asks, [2]float64{level.Price, level.Size})
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"result":     "success",
+		"orderBook":  map[string]interface{}{"bids": bids, "asks": asks},
+		"serverTime": serverTime(),
+	})
+}
+
+// Fills of the account are the public trades, the newest trade goes first
+func (server *Server) history(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	symbol := strings.ToLower(params.Get("symbol"))
+
+	history := []map[string]interface{}{}
+	for i := len(server.fills) - 1; i >= 0; i-- {
+		fill := server.fills[i]
+		if fill.Symbol != symbol {
+			continue
+		}
+
+		history = append(history, map[string]interface{}{
+			"time":     fill.FillTime,
+			"trade_id": i + 1,
+			"price":    fill.Price,
+			"size":     fill.Size,
+			"side":     fill.Side,
+			"type":     "fill",
+			"uid":      fill.FillID,
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"result": "success", "history": history, "serverTime": serverTime()})
+}
+
+func (server *Server) sendOrder(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	sendStatus, errorName := server.newOrder(params)
+	if errorName != "" {
+		writeJSON(w, map[string]interface{}{"result": "error", "error": errorName, "serverTime": serverTime()})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"result": "success", "sendStatus": sendStatus, "serverTime": serverTime()})
+}
+
+// Place or execute the order, the send status or the error of the whole request is returned, must be called with locked mutex
+func (server *Server) newOrder(params url.Values) (map[string]interface{}, string) {
+	server.sentOrders = append(server.sentOrders, params)
+
+	symbol := strings.ToUpper(params.Get("symbol"))
+	side := params.Get("side")
+	orderType := params.Get("orderType")
+	size, _ := strconv.ParseFloat(params.Get("size"), 64)
+	limitPrice, _ := strconv.ParseFloat(params.Get("limitPrice"), 64)
+	stopPrice, _ := strconv.ParseFloat(params.Get("stopPrice"), 64)
+	reduceOnly := params.Get("reduceOnly") == "true"
+
+	orderID := newID()
+	receivedTime := serverTime()
+
+	order := openOrder{
+		OrderID:       orderID,
+		ClientOrderID: params.Get("cliOrdId"),
+		Symbol:        strings.ToLower(symbol),
+		Side:          side,
+		OrderType:     orderType,
+		LimitPrice:    limitPrice,
+		StopPrice:     stopPrice,
+		UnfilledSize:  size,
+		ReduceOnly:    reduceOnly,
+		ReceivedTime:  receivedTime,
+		Status:        "untouched",
+	}
+
+	answer := func(status string, orderEvents []map[string]interface{}) (map[string]interface{}, string) {
+		sendStatus := map[string]interface{}{"order_id": orderID, "status": status, "receivedTime": receivedTime}
+		if orderEvents != nil {
+			sendStatus["orderEvents"] = orderEvents
+		}
+		return sendStatus, ""
+	}
+
+	reject := func(reason string) (map[string]interface{}, string) {
+		return answer("placed", []map[string]interface{}{{
+			"uid":    orderID,
+			"order":  orderPriorExecution(order),
+			"reason": reason,
+			"type":   "REJECT",
+		}})
+	}
+
+	if (side != "buy" && side != "sell") || size <= 0 {
+		return nil, "invalidArgument"
+	}
+
+	executions := 1
+	if len(server.orderOutcomes) > 0 {
+		outcome := server.orderOutcomes[0]
+		server.orderOutcomes = server.orderOutcomes[1:]
+
+		if outcome.RejectReason != "" {
+			return reject(outcome.RejectReason)
+		}
+
+		if outcome.FilledSize > 0 && outcome.FilledSize < size {
+			size = outcome.FilledSize
+		}
+		if outcome.Executions > 1 {
+			executions = outcome.Executions
+		}
+	}
+
+	ticker, ok := server.tickers[symbol]
+	if !ok {
+		return answer("marketSuspended", nil)
+	}
+
+	marketPrice := marketPrice(ticker, side)
+
+	if orderType == "mkt" || orderType == "ioc" || orderType == "lmt" {
+		if reduceOnly {
+			size = server.reducibleSize(order, size)
+			if size == 0 {
+				return reject("WOULD_NOT_REDUCE_POSITION")
+			}
+		}
+	}
+
+	placed := func() (map[string]interface{}, string) {
+		server.placeOrder(order)
+		return answer("placed", []map[string]interface{}{{
+			"order":           orderPriorExecution(order),
+			"reducedQuantity": nil,
+			"type":            "PLACE",
+		}})
+	}
+
+	switch orderType {
+	case "mkt", "ioc":
+		order.OrderType = "ioc"
+		return answer("placed", server.executeSplit(order, size, marketPrice, executions))
+	case "lmt", "post":
+		marketable := (side == "buy" && limitPrice >= marketPrice) || (side == "sell" && limitPrice <= marketPrice)
+		if marketable && orderType == "post" {
+			return reject("POST_WOULD_EXECUTE")
+		}
+		if marketable {
+			return answer("placed", server.executeSplit(order, size, limitPrice, executions))
+		}
+		return placed()
+	case "stp", "take_profit":
+		if stopPrice <= 0 {
+			return nil, "invalidArgument"
+		}
+		return placed()
+	default:
+		return nil, "invalidArgument"
+	}
+}
+
+// Size of the reduce only order limited by the opposite position, must be called with locked mutex
+func (server *Server) reducibleSize(order openOrder, size float64) float64 {
+	reducible := 0.0
+	if position, ok := server.positions[strings.ToUpper(order.Symbol)]; ok {
+		reducible = position.Quantity
+		if order.Side == "buy" {
+			reducible = -position.Quantity
+		}
+	}
+
+	if reducible <= 0 {
+		return 0
+	}
+	if size > reducible {
+		return reducible
+	}
+	return size
+}
+
+func marketPrice(ticker map[string]interface{}, side string) float64 {
+	price, _ := ticker["ask"].(float64)
+	if side == "sell" {
+		price, _ = ticker["bid"].(float64)
+	}
+	return price
+}
+
+// Fill order by the number of executions of whole contracts, every next execution is one dollar worse.
+// EXECUTION events are returned, must be called with locked mutex
+func (server *Server) executeSplit(order openOrder, size float64, price float64, executions int) []map[string]interface{} {
+	if float64(executions) > size {
+		executions = int(size)
+	}
+	if executions < 1 {
+		executions = 1
+	}
+
+	step := 1.0
+	if order.Side == "sell" {
+		step = -1
+	}
+
+	events := []map[string]interface{}{}
+	executionSize := math.Floor(size / float64(executions))
+	for i := 0; i < executions; i++ {
+		if i == executions-1 {
+			executionSize = size - executionSize*float64(executions-1)
+		}
+		events = append(events, server.execute(order, executionSize, price+step*float64(i)))
+	}
+	return events
+}
+
+// Fill order and return EXECUTION event, must be called with locked mutex
+func (server *Server) execute(order openOrder, size float64, price float64) map[string]interface{} {
+	symbol := strings.ToUpper(order.Symbol)
+
+	position, ok := server.positions[symbol]
+	if !ok {
+		position = &domain.Position{Symbol: symbol}
+		server.positions[symbol] = position
+	}
+	server.balance += position.Fill(domain.OrderSide(order.Side), size, price)
+
+	executionID := newID()
+	newFill := fill{
+		time:          time.Now(),
+		ClientOrderID: order.ClientOrderID,
+		FillID:        executionID,
+		OrderID:       order.OrderID,
+		Symbol:        order.Symbol,
+		Side:          order.Side,
+		Size:          size,
+		Price:         price,
+		FillTime:      serverTime(),
+		FillType:      "taker",
+	}
+	server.fills = append(server.fills, newFill)
+
+	server.queuePrivateMessage("fills", map[string]interface{}{"feed": "fills", "username": "krakentest", "fills": []map[string]interface{}{fillMessage(newFill)}})
+	server.queuePrivateMessage("open_positions", server.positionsMessage())
+	server.queuePrivateMessage("account_balances_and_margins", server.balancesMessage())
+
+	return map[string]interface{}{
+		"executionId":          executionID,
+		"price":                price,
+		"amount":               size,
+		"orderPriorEdit":       nil,
+		"orderPriorExecution":  orderPriorExecution(order),
+		"takerReducedQuantity": nil,
+		"type":                 "EXECUTION",
+	}
+}
+
+func orderPriorExecution(order openOrder) map[string]interface{} {
+	var clientOrderID interface{}
+	if order.ClientOrderID != "" {
+		clientOrderID = order.ClientOrderID
+	}
+
+	return map[string]interface{}{
+		"orderId":             order.OrderID,
+		"cliOrdId":            clientOrderID,
+		"type":                order.OrderType,
+		"symbol":              order.Symbol,
+		"side":                order.Side,
+		"quantity":            order.UnfilledSize + order.FilledSize,
+		"filled":              order.FilledSize,
+		"limitPrice":          order.LimitPrice,
+		"stopPrice":           order.StopPrice,
+		"reduceOnly":          order.ReduceOnly,
+		"timestamp":           order.ReceivedTime,
+		"lastUpdateTimestamp": order.ReceivedTime,
+	}
+}
+
+func (server *Server) cancelOrder(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"result":       "success",
+		"cancelStatus": server.cancelStatus(params.Get("order_id"), params.Get("cliOrdId")),
+		"serverTime":   serverTime(),
+	})
+}
+
+// Cancel the open order found by id or client id, must be called with locked mutex
+func (server *Server) cancelStatus(orderID string, clientOrderID string) map[string]interface{} {
+	status := "notFound"
+
+	if index := server.findOpenOrder(orderID, clientOrderID); index >= 0 {
+		order := server.openOrders[index]
+		orderID = order.OrderID
+		server.openOrders = append(server.openOrders[:index], server.openOrders[index+1:]...)
+		server.closeOrder(order, "cancelled_by_user")
+		status = "cancelled"
+	}
+
+	return map[string]interface{}{"status": status, "order_id": orderID, "receivedTime": serverTime()}
+}
+
+// Index of the open order or -1, must be called with locked mutex
+func (server *Server) findOpenOrder(orderID string, clientOrderID string) int {
+	for i, order := range server.openOrders {
+		if (orderID != "" && order.OrderID == orderID) || (clientOrderID != "" && order.ClientOrderID == clientOrderID) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (server *Server) editOrder(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	editStatus := server.editStatus(params)
+	editStatus["orderId"] = editStatus["order_id"]
+	delete(editStatus, "order_id")
+
+	writeJSON(w, map[string]interface{}{"result": "success", "editStatus": editStatus, "serverTime": serverTime()})
+}
+
+// Change size and prices of the open order, marketable limit orders are executed right away.
+// Must be called with locked mutex
+func (server *Server) editStatus(params url.Values) map[string]interface{} {
+	orderID := params.Get("orderId")
+	if orderID == "" {
+		orderID = params.Get("order_id")
+	}
+
+	index := server.findOpenOrder(orderID, params.Get("cliOrdId"))
+	if index < 0 {
+		return map[string]interface{}{"status": "orderForEditNotFound", "order_id": orderID, "receivedTime": serverTime()}
+	}
+
+	order := server.openOrders[index]
+	edited := order
+
+	if size, err := strconv.ParseFloat(params.Get("size"), 64); err == nil {
+		if size <= edited.FilledSize {
+			return map[string]interface{}{"status": "invalidSize", "order_id": order.OrderID, "receivedTime": serverTime()}
+		}
+		edited.UnfilledSize = size - edited.FilledSize
+	}
+	if limitPrice, err := strconv.ParseFloat(params.Get("limitPrice"), 64); err == nil {
+		edited.LimitPrice = limitPrice
+	}
+	if stopPrice, err := strconv.ParseFloat(params.Get("stopPrice"), 64); err == nil {
+		if edited.OrderType != "stp" && edited.OrderType != "take_profit" {
+			return map[string]interface{}{"status": "orderForEditNotAStop", "order_id": order.OrderID, "receivedTime": serverTime()}
+		}
+		edited.StopPrice = stopPrice
+	}
+
+	server.openOrders[index] = edited
+	server.queuePrivateMessage("open_orders", map[string]interface{}{
+		"feed":      "open_orders",
+		"username":  "krakentest",
+		"order":     openOrderMessage(edited),
+		"is_cancel": false,
+		"reason":    "edited_by_user",
+	})
+	server.executeOpenOrders(strings.ToUpper(edited.Symbol))
+
+	return map[string]interface{}{
+		"status":       "edited",
+		"order_id":     order.OrderID,
+		"receivedTime": serverTime(),
+		"orderEvents": []map[string]interface{}{{
+			"old":             orderPriorExecution(order),
+			"new":             orderPriorExecution(edited),
+			"reducedQuantity": nil,
+			"type":            "EDIT",
+		}},
+	}
+}
+
+func (server *Server) cancelAllOrders(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	symbol := strings.ToLower(params.Get("symbol"))
+	cancelledOrders := []map[string]interface{}{}
+	openOrders := []openOrder{}
+
+	for _, order := range server.openOrders {
+		if symbol == "" || order.Symbol == symbol {
+			cancelledOrders = append(cancelledOrders, map[string]interface{}{"order_id": order.OrderID})
+			server.closeOrder(order, "cancelled_by_user")
+		} else {
+			openOrders = append(openOrders, order)
+		}
+	}
+	server.openOrders = openOrders
+
+	status := "noOrdersToCancel"
+	if len(cancelledOrders) > 0 {
+		status = "cancelled"
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"result":       "success",
+		"cancelStatus": map[string]interface{}{"status": status, "cancelledOrders": cancelledOrders, "receivedTime": serverTime()},
+		"serverTime":   serverTime(),
+	})
+}
+
+type batchOrderRequest struct {
+	BatchOrder []map[string]interface{} `json:"batchOrder"`
+}
+
+// Instructions are applied one by one as separate send, edit and cancel requests
+func (server *Server) batchOrder(w http.ResponseWriter, params url.Values) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	var request batchOrderRequest
+	if err := json.Unmarshal([]byte(params.Get("json")), &request); err != nil || len(request.BatchOrder) == 0 {
+		writeJSON(w, map[string]interface{}{"result": "error", "error": "invalidArgument", "serverTime": serverTime()})
+		return
+	}
+
+	batchStatus := []map[string]interface{}{}
+	for _, instruction := range request.BatchOrder {
+		instructionParams := url.Values{}
+		for name, value := range instruction {
+			instructionParams.Set(name, fmt.Sprint(value))
+		}
+
+		var status map[string]interface{}
+		switch instructionParams.Get("order") {
+		case "send":
+			var errorName string
+			status, errorName = server.newOrder(instructionParams)
+			if errorName != "" {
+				status = map[string]interface{}{"status": errorName}
+			}
+			status["order_tag"] = instructionParams.Get("order_tag")
+		case "edit":
+			status = server.editStatus(instructionParams)
+		case "cancel":
+			status = server.cancelStatus(instructionParams.Get("order_id"), instructionParams.Get("cliOrdId"))
+		default:
+			status = map[string]interface{}{"status": "invalidArgument"}
+		}
+
+		batchStatus = append(batchStatus, status)
+	}
+
+	writeJSON(w, map[string]interface{}{"result": "success", "batchStatus": batchStatus, "serverTime": serverTime()})
+}
+
+func (server *Server) openOrdersList(w http.ResponseWriter) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	writeJSON(w, map[string]interface{}{"result": "success", "openOrders": append([]openOrder{}, server.openOrders...), "serverTime": serverTime()})
+}
+
+func (server *Server) openPositions(w http.ResponseWriter) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	openPositions := []map[string]interface{}{}
+	for _, symbol := range server.positionSymbols() {
+		position := server.positions[symbol]
+
+		side := "long"
+		size := position.Quantity
+		if size < 0 {
+			side = "short"
+			size = -size
+		}
+
+		openPositions = append(openPositions, map[string]interface{}{
+			"side":     side,
+			"symbol":   strings.ToLower(symbol),
+			"price":    position.AverageEntryPrice,
+			"fillTime": serverTime(),
+			"size":     size,
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"result": "success", "openPositions": openPositions, "serverTime": serverTime()})
+}
+
+func (server *Server) fillsList(w http.ResponseWriter) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	writeJSON(w, map[string]interface{}{"result": "success", "fills": append([]fill{}, server.fills...), "serverTime": serverTime()})
+}
+
+func (server *Server) accounts(w http.ResponseWriter) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	unrealized := server.unrealizedPnL()
+
+	writeJSON(w, map[string]interface{}{
+		"result": "success",
+		"accounts": map[string]interface{}{
+			"flex": map[string]interface{}{
+				"type":            "multiCollateralMarginAccount",
+				"currencies":      map[string]interface{}{"USD": map[string]interface{}{"quantity": server.balance, "value": server.balance}},
+				"balanceValue":    server.balance,
+				"portfolioValue":  server.balance + unrealized,
+				"totalUnrealized": unrealized,
+				"availableMargin": server.balance + unrealized,
+			},
+		},
+		"serverTime": serverTime(),
+	})
+}
+
+// Unrealized profit of all positions marked at mid price, must be called with locked mutex
+func (server *Server) unrealizedPnL() float64 {
+	unrealized := 0.0
+	for symbol, position := range server.positions {
+		if ticker, ok := server.tickers[symbol]; ok {
+			bid, _ := ticker["bid"].(float64)
+			ask, _ := ticker["ask"].(float64)
+			unrealized += position.UnrealizedPnL((bid + ask) / 2)
+		}
+	}
+	return unrealized
+}
+
+// Sorted symbols of published tickers, must be called with locked mutex
+func (server *Server) symbols() []string {
+	symbols := make([]string, 0, len(server.tickers))
+	for symbol := range server.tickers {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Sorted symbols of non-zero positions, must be called with locked mutex
+func (server *Server) positionSymbols() []string {
+	symbols := make([]string, 0, len(server.positions))
+	for symbol, position := range server.positions {
+		if position.Quantity != 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
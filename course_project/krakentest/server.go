@@ -0,0 +1,214 @@
+// Package krakentest provides a local stand-in for the Kraken Futures API,
+// it serves the v1 websocket feeds and the /api/v3 REST endpoints used by the bot
+package krakentest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const (
+	// Keys accepted by the server, secret is base64 encoded as the real one
+	PublicKey = "krakentest-public-key"
+	SecretKey = "rttp4AzwRfYEdQ7R7X8Z/04Y4TZPa97pqCypi3xXxAqftygftnI6H9yGV+OcUOOJeFtZkr8mVwbAndU3Kz4Q+eG"
+
+	InitialBalance = 100000.0
+
+	httpPrefix    = "/derivatives"
+	websocketPath = "/ws/v1"
+)
+
+// Order outcome scripted by ScriptOrders
+type OrderOutcome struct {
+	RejectReason string
+	FilledSize   float64
+	// Number of executions the marketable order is split into, one if it is not set
+	Executions int
+}
+
+// Next order is rejected with the given reason
+func Reject(reason string) OrderOutcome {
+	return OrderOutcome{RejectReason: reason}
+}
+
+// Only the given size of the next order is filled, the rest is cancelled
+func PartialFill(filledSize float64) OrderOutcome {
+	return OrderOutcome{FilledSize: filledSize}
+}
+
+// The next order is filled by the given number of executions, every next one is one dollar worse
+func SplitFill(executions int) OrderOutcome {
+	return OrderOutcome{Executions: executions}
+}
+
+type openOrder struct {
+	OrderID       string  `json:"order_id"`
+	ClientOrderID string  `json:"cliOrdId,omitempty"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	OrderType     string  `json:"orderType"`
+	LimitPrice    float64 `json:"limitPrice"`
+	StopPrice     float64 `json:"stopPrice,omitempty"`
+	UnfilledSize  float64 `json:"unfilledSize"`
+	FilledSize    float64 `json:"filledSize"`
+	ReduceOnly    bool    `json:"reduceOnly"`
+	ReceivedTime  string  `json:"receivedTime"`
+	Status        string  `json:"status"`
+}
+
+type fill struct {
+	time time.Time
+
+	FillID        string  `json:"fill_id"`
+	OrderID       string  `json:"order_id"`
+	ClientOrderID string  `json:"cliOrdId,omitempty"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	Size          float64 `json:"size"`
+	Price         float64 `json:"price"`
+	FillTime      string  `json:"fillTime"`
+	FillType      string  `json:"fillType"`
+}
+
+type Server struct {
+	httpServer *httptest.Server
+
+	mutex             sync.Mutex
+	tickers           map[string]map[string]interface{}
+	tickerSequences   map[string]uint64
+	orderBooks        map[string]domain.OrderBookSnapshot
+	bookSequences     map[string]uint64
+	tradeSequence     uint64
+	positions         map[string]*domain.Position
+	balance           float64
+	openOrders        []openOrder
+	fills             []fill
+	sentOrders        []url.Values
+	orderOutcomes     []OrderOutcome
+	connections       map[*connection]struct{}
+	privateMessages   []privateMessage
+	heartbeatInterval time.Duration
+}
+
+func NewServer() *Server {
+	server := Server{
+		tickers:           make(map[string]map[string]interface{}),
+		tickerSequences:   make(map[string]uint64),
+		orderBooks:        make(map[string]domain.OrderBookSnapshot),
+		bookSequences:     make(map[string]uint64),
+		positions:         make(map[string]*domain.Position),
+		balance:           InitialBalance,
+		connections:       make(map[*connection]struct{}),
+		heartbeatInterval: time.Second,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(websocketPath, server.handleWebsocket)
+	mux.HandleFunc(httpPrefix+"/api/v3/", server.handleREST)
+
+	server.httpServer = httptest.NewServer(mux)
+
+	return &server
+}
+
+// Base url of the REST api, use it instead of https://demo-futures.kraken.com/derivatives
+func (server *Server) HTTPUrl() string {
+	return server.httpServer.URL + httpPrefix
+}
+
+func (server *Server) WebsocketURL() string {
+	return "ws" + strings.TrimPrefix(server.httpServer.URL, "http") + websocketPath
+}
+
+func (server *Server) Close() {
+	server.DisconnectWebsockets()
+	server.httpServer.Close()
+}
+
+// Outcomes are applied to the next orders one by one, after that orders are filled completely
+func (server *Server) ScriptOrders(outcomes ...OrderOutcome) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.orderOutcomes = append(server.orderOutcomes, outcomes...)
+}
+
+// Params of all authenticated sendorder requests
+func (server *Server) SentOrders() []url.Values {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]url.Values(nil), server.sentOrders...)
+}
+
+func (server *Server) Position(symbol string) domain.Position {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if position, ok := server.positions[strings.ToUpper(symbol)]; ok {
+		return *position
+	}
+	return domain.Position{Symbol: strings.ToUpper(symbol)}
+}
+
+// Order book returned by the orderbook endpoint and sent as the snapshot of the book feed,
+// the orderbook endpoint requires a published ticker of the symbol
+func (server *Server) SetOrderBook(orderBook domain.OrderBookSnapshot) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.orderBooks[strings.ToUpper(orderBook.Symbol)] = orderBook
+}
+
+func (server *Server) SetHeartbeatInterval(interval time.Duration) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.heartbeatInterval = interval
+}
+
+// Authent is checked the same way as the exchange does: base64(hmac-sha512(sha256(postData + nonce + endpointPath)))
+func (server *Server) authenticated(r *http.Request, postData string) bool {
+	if r.Header.Get("APIKey") != PublicKey {
+		return false
+	}
+
+	endpointPath := strings.TrimPrefix(r.URL.Path, httpPrefix)
+	expected := Sign(postData+r.Header.Get("Nonce")+endpointPath, SecretKey)
+
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("Authent")))
+}
+
+// Sign message the way Kraken signs requests and websocket challenges
+func Sign(message string, secretKey string) string {
+	hashSHA256 := sha256.Sum256([]byte(message))
+
+	decodedSecret, _ := base64.StdEncoding.DecodeString(secretKey)
+
+	h := hmac.New(sha512.New, decodedSecret)
+	h.Write(hashSHA256[:])
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func newID() string {
+	bytes := make([]byte, 16)
+	_, _ = rand.Read(bytes)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:])
+}
+
+func serverTime() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
@@ -0,0 +1,399 @@
+package krakentest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"nhooyr.io/websocket"
+)
+
+type connection struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc
+
+	mutex         sync.Mutex
+	subscriptions map[string]map[string]bool
+	challenges    map[string]bool
+}
+
+type subscribeMessage struct {
+	Event             string   `json:"event"`
+	Feed              string   `json:"feed"`
+	ProductIDs        []string `json:"product_ids"`
+	APIKey            string   `json:"api_key"`
+	OriginalChallenge string   `json:"original_challenge"`
+	SignedChallenge   string   `json:"signed_challenge"`
+}
+
+func (server *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	connection := &connection{conn: conn, cancel: cancel, subscriptions: make(map[string]map[string]bool), challenges: make(map[string]bool)}
+
+	server.mutex.Lock()
+	server.connections[connection] = struct{}{}
+	heartbeatInterval := server.heartbeatInterval
+	server.mutex.Unlock()
+
+	defer func() {
+		server.mutex.Lock()
+		delete(server.connections, connection)
+		server.mutex.Unlock()
+
+		cancel()
+		conn.Close(websocket.StatusNormalClosure, "")
+	}()
+
+	connection.send(ctx, map[string]interface{}{"event": "info", "version": 1})
+
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if connection.subscribed("heartbeat", "") {
+					connection.send(ctx, map[string]interface{}{"feed": "heartbeat", "time": time.Now().UnixNano() / int64(time.Millisecond)})
+				}
+			}
+		}
+	}()
+
+	for {
+		_, bytes, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		var message subscribeMessage
+		if err := json.Unmarshal(bytes, &message); err != nil {
+			connection.send(ctx, map[string]interface{}{"event": "alert", "message": "Json Error"})
+			continue
+		}
+
+		switch message.Event {
+		case "challenge":
+			if message.APIKey != PublicKey {
+				connection.send(ctx, map[string]interface{}{"event": "alert", "message": "Wrong api key"})
+				continue
+			}
+
+			challenge := newID()
+			connection.mutex.Lock()
+			connection.challenges[challenge] = true
+			connection.mutex.Unlock()
+
+			connection.send(ctx, map[string]interface{}{"event": "challenge", "message": challenge})
+		case "subscribe", "unsubscribe":
+			private := privateFeeds[message.Feed]
+			if message.Feed != "ticker" && message.Feed != "book" && message.Feed != "trade" && message.Feed != "heartbeat" && !private {
+				connection.send(ctx, map[string]interface{}{"event": "alert", "message": "Invalid feed"})
+				continue
+			}
+
+			if private && !connection.checkChallenge(message) {
+				connection.send(ctx, map[string]interface{}{"event": "alert", "message": "Signed challenge is invalid"})
+				continue
+			}
+
+			connection.subscribe(message.Feed, message.ProductIDs, message.Event == "subscribe")
+
+			ack := map[string]interface{}{"event": message.Event + "d", "feed": message.Feed}
+			if message.ProductIDs != nil {
+				ack["product_ids"] = message.ProductIDs
+			}
+			connection.send(ctx, ack)
+
+			if private && message.Event == "subscribe" {
+				server.mutex.Lock()
+				snapshot := server.privateSnapshot(message.Feed)
+				server.mutex.Unlock()
+
+				connection.send(ctx, snapshot)
+			}
+
+			if message.Feed == "book" && message.Event == "subscribe" {
+				for _, productID := range message.ProductIDs {
+					server.mutex.Lock()
+					snapshot := server.bookSnapshot(strings.ToUpper(productID))
+					server.mutex.Unlock()
+
+					connection.send(ctx, snapshot)
+				}
+			}
+
+			if message.Feed == "trade" && message.Event == "subscribe" {
+				for _, productID := range message.ProductIDs {
+					connection.send(ctx, map[string]interface{}{"feed": "trade_snapshot", "product_id": strings.ToUpper(productID), "trades": []interface{}{}})
+				}
+			}
+		default:
+			connection.send(ctx, map[string]interface{}{"event": "alert", "message": "Bad request"})
+		}
+	}
+}
+
+// Publish ticker to the subscribed connections, the ticker is also used as the market price for orders.
+// Ticker must have product_id, bid and ask fields, time and seq are added if they are not set
+func (server *Server) PublishTicker(ticker map[string]interface{}) {
+	productID, _ := ticker["product_id"].(string)
+	productID = strings.ToUpper(productID)
+
+	server.mutex.Lock()
+	server.tickerSequences[productID]++
+
+	// Fields of the ticker replace the generated ones, so tests can send gaps and malformed values
+	message := map[string]interface{}{"feed": "ticker", "time": time.Now().UnixNano() / int64(time.Millisecond), "seq": server.tickerSequences[productID]}
+	for key, value := range ticker {
+		message[key] = value
+	}
+	switch sequence := message["seq"].(type) {
+	case int:
+		server.tickerSequences[productID] = uint64(sequence)
+	case float64:
+		server.tickerSequences[productID] = uint64(sequence)
+	}
+
+	server.tickers[productID] = message
+	server.executeOpenOrders(productID)
+	connections := server.connectionsList()
+	server.mutex.Unlock()
+
+	server.flushPrivateMessages()
+
+	for _, connection := range connections {
+		if connection.subscribed("ticker", productID) {
+			connection.send(context.Background(), message)
+		}
+	}
+}
+
+// Change the price level of the order book and publish the update to the subscribed connections,
+// side buy is the bid side and zero size removes the level
+func (server *Server) PublishBookUpdate(productID string, side domain.OrderSide, price float64, size float64) {
+	productID = strings.ToUpper(productID)
+
+	server.mutex.Lock()
+	orderBook := server.orderBooks[productID]
+	orderBook.Symbol = productID
+	orderBook.Update(side, price, size)
+	server.orderBooks[productID] = orderBook
+	server.bookSequences[productID]++
+
+	message := map[string]interface{}{
+		"feed":       "book",
+		"product_id": productID,
+		"side":       side,
+		"seq":        server.bookSequences[productID],
+		"price":      price,
+		"qty":        size,
+		"timestamp":  time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	connections := server.connectionsList()
+	server.mutex.Unlock()
+
+	for _, connection := range connections {
+		if connection.subscribed("book", productID) {
+			connection.send(context.Background(), message)
+		}
+	}
+}
+
+// Publish public trade to the subscribed connections, side is the side of the taker
+func (server *Server) PublishTrade(productID string, side domain.OrderSide, price float64, size float64, at time.Time) {
+	productID = strings.ToUpper(productID)
+
+	server.mutex.Lock()
+	server.tradeSequence++
+	message := map[string]interface{}{
+		"feed":       "trade",
+		"product_id": productID,
+		"uid":        newID(),
+		"side":       side,
+		"type":       "fill",
+		"seq":        server.tradeSequence,
+		"time":       at.UnixNano() / int64(time.Millisecond),
+		"qty":        size,
+		"price":      price,
+	}
+	connections := server.connectionsList()
+	server.mutex.Unlock()
+
+	for _, connection := range connections {
+		if connection.subscribed("trade", productID) {
+			connection.send(context.Background(), message)
+		}
+	}
+}
+
+// Skip sequence numbers of the book updates as if the updates were lost
+func (server *Server) SkipBookUpdates(productID string, count uint64) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.bookSequences[strings.ToUpper(productID)] += count
+}
+
+// Must be called with locked mutex
+func (server *Server) bookSnapshot(productID string) map[string]interface{} {
+	bids, asks := []map[string]float64{}, []map[string]float64{}
+	orderBook := server.orderBooks[productID]
+	for _, level := range orderBook.Bids {
+		bids = append(bids, map[string]float64{"price": level.Price, "qty": level.Size})
+	}
+	for _, level := range orderBook.Asks {
+		asks = append(asks, map[string]float64{"price": level.Price, "qty": level.Size})
+	}
+
+	return map[string]interface{}{
+		"feed":       "book_snapshot",
+		"product_id": productID,
+		"seq":        server.bookSequences[productID],
+		"timestamp":  time.Now().UnixNano() / int64(time.Millisecond),
+		"bids":       bids,
+		"asks":       asks,
+	}
+}
+
+// Check if any connection is subscribed to the feed, productID is ignored for feeds without products
+func (server *Server) Subscribed(feed string, productID string) bool {
+	server.mutex.Lock()
+	connections := server.connectionsList()
+	server.mutex.Unlock()
+
+	for _, connection := range connections {
+		if connection.subscribed(feed, productID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close all websocket connections as if the exchange dropped them
+func (server *Server) DisconnectWebsockets() {
+	server.mutex.Lock()
+	connections := server.connectionsList()
+	server.connections = make(map[*connection]struct{})
+	server.mutex.Unlock()
+
+	for _, connection := range connections {
+		connection.conn.Close(websocket.StatusGoingAway, "")
+		connection.cancel()
+	}
+}
+
+// Fill resting limit orders crossed by the new ticker and triggered stop orders, must be called with locked mutex
+func (server *Server) executeOpenOrders(productID string) {
+	ticker := server.tickers[productID]
+
+	openOrders := []openOrder{}
+	for _, order := range server.openOrders {
+		if !strings.EqualFold(order.Symbol, productID) {
+			openOrders = append(openOrders, order)
+			continue
+		}
+
+		price := marketPrice(ticker, order.Side)
+		fillPrice := 0.0
+
+		switch order.OrderType {
+		case "stp", "take_profit":
+			// Stop buys when the price rises to the stop price, take profit buys when it falls to it
+			rising := order.Side == "buy"
+			if order.OrderType == "take_profit" {
+				rising = !rising
+			}
+			if price > 0 && ((rising && price >= order.StopPrice) || (!rising && price <= order.StopPrice)) {
+				fillPrice = price
+			}
+		default:
+			if price > 0 && ((order.Side == "buy" && price <= order.LimitPrice) || (order.Side == "sell" && price >= order.LimitPrice)) {
+				fillPrice = order.LimitPrice
+			}
+		}
+
+		if fillPrice == 0 {
+			openOrders = append(openOrders, order)
+			continue
+		}
+
+		size := order.UnfilledSize
+		if order.ReduceOnly {
+			size = server.reducibleSize(order, size)
+		}
+		// Reduce only order without position to reduce is cancelled
+		if size > 0 {
+			server.execute(order, size, fillPrice)
+			server.closeOrder(order, "full_fill")
+		} else {
+			server.closeOrder(order, "reduce_only_cancel")
+		}
+	}
+	server.openOrders = openOrders
+}
+
+// Must be called with locked mutex
+func (server *Server) connectionsList() []*connection {
+	connections := make([]*connection, 0, len(server.connections))
+	for connection := range server.connections {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+func (connection *connection) send(ctx context.Context, message interface{}) {
+	bytes, _ := json.Marshal(message)
+	_ = connection.conn.Write(ctx, websocket.MessageText, bytes)
+}
+
+// Challenge must be issued to this connection and signed with the secret key
+func (connection *connection) checkChallenge(message subscribeMessage) bool {
+	connection.mutex.Lock()
+	issued := connection.challenges[message.OriginalChallenge]
+	connection.mutex.Unlock()
+
+	return issued && message.APIKey == PublicKey && message.SignedChallenge == Sign(message.OriginalChallenge, SecretKey)
+}
+
+func (connection *connection) subscribe(feed string, productIDs []string, subscribe bool) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if productIDs == nil {
+		productIDs = []string{""}
+	}
+
+	if _, ok := connection.subscriptions[feed]; !ok {
+		connection.subscriptions[feed] = make(map[string]bool)
+	}
+
+	for _, productID := range productIDs {
+		if subscribe {
+			connection.subscriptions[feed][strings.ToUpper(productID)] = true
+		} else {
+			delete(connection.subscriptions[feed], strings.ToUpper(productID))
+		}
+	}
+}
+
+func (connection *connection) subscribed(feed string, productID string) bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if products, ok := connection.subscriptions[feed]; ok {
+		return products[strings.ToUpper(productID)] || products[""]
+	}
+	return false
+}
@@ -5,37 +5,139 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	// Time zones of the users are available without the system database
+	_ "time/tzdata"
 
+	"github.com/legendiguess/kraken-trade-bot/domain"
 	"github.com/legendiguess/kraken-trade-bot/handlers"
 	"github.com/legendiguess/kraken-trade-bot/services"
 	"github.com/legendiguess/kraken-trade-bot/storage"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
 	log "github.com/sirupsen/logrus"
 )
 
+// Name of the operator key given by API_OPERATOR_KEY
+const environmentAPIKeyName = "environment"
+
+type exchangeService interface {
+	SendOrder(orderRequest domain.OrderRequest) (*domain.OrderInfo, error)
+	CancelOrder(orderID string) error
+}
+
+type accountEventSource interface {
+	GetAccountEventChannel() <-chan domain.AccountEvent
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	logger := log.New()
 	logger.SetLevel(log.DebugLevel)
 
+	run(ctx, logger)
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-done
+
+	cancel()
+}
+
+// Create and start all services, configuration is read from the environment variables
+func run(ctx context.Context, logger *log.Logger) *handlers.Server {
 	credentials := storage.NewCredentialsStorage(logger)
 	storage := storage.New(credentials, logger)
 
 	userService := services.NewUsersService(storage)
-	telegramBot := services.NewTelegramBot(userService, credentials, logger)
+	for _, chatID := range credentials.GetTelegramAdmins() {
+		userService.AddAdmin(chatID)
+	}
+	tradingController := services.NewTradingController(storage)
 
 	instrumentSerivce := services.NewInstrumentService(storage)
 	websocketClient := services.NewWebsocketClient(ctx, credentials, logger)
-	handlers.NewServer(instrumentSerivce, websocketClient, logger)
+	strategyRegistry := strategies.NewDefaultRegistry()
+	riskEngine := services.NewRiskEngine(storage, websocketClient)
+	candleBuilder := services.NewCandleBuilder(websocketClient, storage, credentials.GetCandlePeriods(), logger)
 
-	httpclient := services.NewHTTPClient(credentials)
 	orderInfosService := services.NewOrderInfosService(storage)
-	algorithm := services.NewAlgorithm(websocketClient)
-	services.NewTradeBot(algorithm, instrumentSerivce, httpclient, orderInfosService, userService, telegramBot, logger)
+	pnlService := services.NewPnLService(orderInfosService)
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-done
+	notifiers := []services.Notifier{services.NewWebhookNotifier(false)}
+	if credentials.GetSMTPAddress() != "" {
+		notifiers = append(notifiers, services.NewEmailNotifier(credentials))
+	}
+	channels := []domain.NotificationChannel{domain.NotificationChannelTelegram}
+	for _, notifier := range notifiers {
+		channels = append(channels, notifier.Channel())
+	}
 
-	cancel()
+	telegramCommands := services.NewTelegramCommands(userService, tradingController, instrumentSerivce, websocketClient, pnlService, orderInfosService, channels, logger)
+	telegramBot := services.NewTelegramBot(telegramCommands, credentials, logger)
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, storage, userService, logger, append(notifiers, telegramBot)...)
+	services.NewDailySummary(ctx, pnlService, userService, notificationDispatcher)
+
+	var tickerBroadcaster *services.TickerBroadcaster
+	var exchange exchangeService
+	var accountEvents accountEventSource = websocketClient
+	if credentials.GetTradingMode() == domain.TradingModePaper {
+		paperExchange := services.NewPaperExchange(services.PaperExchangeInitialBalance, services.PaperExchangeFeeRate)
+		tickerBroadcaster = services.NewTickerBroadcaster(websocketClient, paperExchange, riskEngine, candleBuilder, pnlService)
+		exchange = paperExchange
+		accountEvents = paperExchange
+		logger.Printf("Paper trading mode, orders are not sent to the exchange")
+	} else {
+		httpClient := services.NewHTTPClient(credentials)
+		reconcile(httpClient, orderInfosService, riskEngine, notificationDispatcher, logger)
+
+		tickerBroadcaster = services.NewTickerBroadcaster(websocketClient, riskEngine, candleBuilder, pnlService)
+		exchange = httpClient
+		websocketClient.SubscribeToPrivateFeeds()
+	}
+
+	algorithm := services.NewAlgorithm(tickerBroadcaster, strategyRegistry, instrumentSerivce, websocketClient, candleBuilder, riskEngine, logger)
+	services.NewTradeBot(algorithm, accountEvents, instrumentSerivce, riskEngine, tradingController, exchange, orderInfosService, notificationDispatcher, logger)
+
+	apiKeyService := services.NewAPIKeyService(storage)
+	if key := credentials.GetAPIOperatorKey(); key != "" {
+		if err := apiKeyService.AddKey(environmentAPIKeyName, key, domain.APIRoleOperator); err != nil {
+			logger.Panicf("Can't save API_OPERATOR_KEY: %v", err)
+		}
+	}
+
+	return handlers.NewServer(credentials.GetServerAddress(), handlers.ServerDependencies{
+		Instruments:     instrumentSerivce,
+		WebsocketClient: websocketClient,
+		Strategies:      strategyRegistry,
+		Risk:            riskEngine,
+		Candles:         candleBuilder,
+		Orders:          orderInfosService,
+		PnL:             pnlService,
+		StrategyStates:  algorithm,
+		TradingControl:  tradingController,
+		APIKeys:         apiKeyService,
+		Logger:          logger,
+	})
+}
+
+// Compare the account on the exchange with the stored orders before trading starts,
+// mismatches are logged and sent to the subscribers. Positions held on the exchange are given to the risk engine
+func reconcile(httpClient *services.HTTPClient, orderInfosService *services.OrderInfosService, riskEngine *services.RiskEngine, notificationDispatcher *services.NotificationDispatcher, logger *log.Logger) {
+	reconciliation, err := services.Reconcile(httpClient, orderInfosService)
+	if err != nil {
+		logger.Panicf("Can't reconcile with the exchange: %v", err)
+	}
+
+	for _, position := range reconciliation.Positions {
+		logger.Printf("Position %s: %v at %v", position.Symbol, position.Quantity, position.AverageEntryPrice)
+	}
+
+	if len(reconciliation.Mismatches) > 0 {
+		for _, mismatch := range reconciliation.Mismatches {
+			logger.Printf("Reconciliation mismatch: %s", mismatch)
+		}
+		notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindReconciliation, Reconciliation: &reconciliation})
+	}
+
+	riskEngine.SetPositions(reconciliation.Positions)
 }
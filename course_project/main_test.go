@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/krakentest"
+	"github.com/legendiguess/kraken-trade-bot/telegramtest"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// Full wiring of the bot against local stand-ins of Kraken and Telegram,
+// the database is taken from TEST_DATABASE_DSN, memory sqlite database is used by default
+func TestRun(t *testing.T) {
+	databaseDSN := os.Getenv("TEST_DATABASE_DSN")
+	if databaseDSN == "" {
+		databaseDSN = "sqlite::memory:"
+	}
+
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	telegram := telegramtest.NewServer()
+	defer telegram.Close()
+
+	t.Setenv("KRAKEN_API_PUBLIC_KEY", krakentest.PublicKey)
+	t.Setenv("KRAKEN_API_SECRET_KEY", krakentest.SecretKey)
+	t.Setenv("KRAKEN_WEBSOCKET_URL", kraken.WebsocketURL())
+	t.Setenv("KRAKEN_HTTP_URL", kraken.HTTPUrl())
+	t.Setenv("TELEGRAM_BOT_API_TOKEN", "test-token")
+	t.Setenv("TELEGRAM_API_ENDPOINT", telegram.APIEndpoint())
+	t.Setenv("DATABASE_DSN", databaseDSN)
+	t.Setenv("SERVER_ADDRESS", "127.0.0.1:0")
+	t.Setenv("API_OPERATOR_KEY", "test-operator-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := log.New()
+	server := run(ctx, logger)
+
+	// Two different chats are subscribed, each one is found by its own chat ID
+	telegram.SendUserMessage(1, "/start")
+	assert.Eventually(t, func() bool { return len(telegram.Messages()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	telegram.SendUserMessage(2, "/start")
+	assert.Eventually(t, func() bool { return len(telegram.Messages()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{1, 2}, []int64{telegram.Messages()[0].ChatID, telegram.Messages()[1].ChatID})
+
+	newRequest, _ := http.NewRequest("POST", "http://"+server.Address()+"/instruments", bytes.NewBufferString(`{"symbol": "PI_XBTUSD"}`))
+	newRequest.Header.Set("X-API-Key", "test-operator-key")
+	resp, err := http.DefaultClient.Do(newRequest)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_XBTUSD") }, 5*time.Second, 10*time.Millisecond)
+
+	// First ticker initializes the strategy, the second one opens a position
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+
+	assert.Eventually(t, func() bool { return len(kraken.SentOrders()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "buy", kraken.SentOrders()[0].Get("side"))
+	assert.Equal(t, 1.0, kraken.Position("PI_XBTUSD").Quantity)
+
+	// The fill is sent once to every subscribed chat
+	assert.Eventually(t, func() bool { return len(telegram.Messages()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	notified := map[int64]bool{}
+	for _, message := range telegram.Messages()[2:] {
+		assert.Contains(t, message.Text, "59010")
+		notified[message.ChatID] = true
+	}
+	assert.Equal(t, map[int64]bool{1: true, 2: true}, notified)
+}
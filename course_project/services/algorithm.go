@@ -1,62 +1,207 @@
 package services
 
 import (
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
 )
 
-type Algorithm struct {
-	lastAction          domain.Action
-	previousActionPrice float64
-	instrument          domain.InstrumentConfig
-	actionChannel       <-chan domain.Action
-}
-
 type websocketClientService interface {
 	GetTickerChannel() <-chan domain.Ticker
 }
 
-func NewAlgorithm(websocketClientService websocketClientService) *Algorithm {
-	algorithm := Algorithm{}
-	actionChannel := make(chan domain.Action)
+type strategyService interface {
+	NewStrategy() (strategies.Strategy, error)
+	Revision() uint64
+}
+
+type algorithmInstrumentService interface {
+	GetInstrument(symbol string) (domain.InstrumentConfig, bool)
+}
+
+type algorithmPositions interface {
+	GetState() domain.RiskState
+}
+
+type algorithmLogger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Algorithm runs a separate instance of the active strategy for every enabled instrument
+// and publishes its decisions, exactly one decision is published for every received ticker
+type Algorithm struct {
+	strategies       map[string]strategies.Strategy
+	strategyRevision uint64
+	decisionChannel  <-chan domain.Decision
+	orderBooks       strategies.OrderBooks
+	candles          strategies.Candles
+	// Every new strategy resumes from the currently held position of its instrument
+	positions algorithmPositions
+
+	stateMutex sync.Mutex
+	states     map[string]domain.StrategyState
+
+	// Instruments whose strategies start over on the next ticker
+	resetMutex sync.Mutex
+	resets     map[string]bool
+}
+
+// Order books and candles are given to the strategies implementing strategies.BookReader and strategies.CandleReader,
+// nil if there are no books or candles. Positions are the ones held now, nil if positions are not tracked
+func NewAlgorithm(websocketClientService websocketClientService, strategyService strategyService, algorithmInstrumentService algorithmInstrumentService, orderBooks strategies.OrderBooks, candles strategies.Candles, positions algorithmPositions, algorithmLogger algorithmLogger) *Algorithm {
+	algorithm := Algorithm{
+		strategies: make(map[string]strategies.Strategy),
+		orderBooks: orderBooks,
+		candles:    candles,
+		positions:  positions,
+		states:     make(map[string]domain.StrategyState),
+		resets:     make(map[string]bool),
+	}
+	decisionChannel := make(chan domain.Decision)
 
 	go func() {
-		defer close(actionChannel)
+		defer close(decisionChannel)
 		for ticker := range websocketClientService.GetTickerChannel() {
-			action := domain.ActionNothing
-
-			tickerSymbol := ticker.GetSymbol()
-			if algorithm.instrument.Symbol != tickerSymbol {
-				algorithm.instrument.Symbol = tickerSymbol
-				algorithm.lastAction = domain.ActionSell
-				algorithm.previousActionPrice = 0.0
-				actionChannel <- action
-				continue
+			tickerSymbol := ticker.Symbol
+			decision := domain.Decision{Symbol: tickerSymbol, Action: domain.ActionNothing}
+
+			// Strategy states are reset when the active strategy changes
+			if revision := strategyService.Revision(); algorithm.strategyRevision != revision {
+				algorithm.strategyRevision = revision
+				algorithm.strategies = make(map[string]strategies.Strategy)
+				algorithm.resetStates()
 			}
 
-			ask := ticker.GetAsk()
-			bid := ticker.GetBid()
+			if algorithm.takeReset(tickerSymbol) {
+				delete(algorithm.strategies, tickerSymbol)
+				algorithm.deleteState(tickerSymbol)
+			}
 
-			if algorithm.lastAction == domain.ActionSell {
-				algorithm.previousActionPrice = ask
-				action = domain.ActionBuy
-			} else if algorithm.lastAction == domain.ActionBuy {
-				if algorithm.previousActionPrice-bid <= algorithm.previousActionPrice/1000*-1 {
-					algorithm.previousActionPrice = bid
-					action = domain.ActionSell
-				}
+			// State of the disabled instrument is reset
+			instrument, ok := algorithmInstrumentService.GetInstrument(tickerSymbol)
+			if !ok || !instrument.Enabled {
+				delete(algorithm.strategies, tickerSymbol)
+				algorithm.deleteState(tickerSymbol)
+				decisionChannel <- decision
+				continue
 			}
-			if action != domain.ActionNothing {
-				algorithm.lastAction = action
+
+			strategy, ok := algorithm.strategies[tickerSymbol]
+			if !ok {
+				var err error
+				strategy, err = strategyService.NewStrategy()
+				if err != nil {
+					algorithmLogger.Printf("Can't create strategy: %v", err)
+				} else {
+					algorithm.strategies[tickerSymbol] = strategy
+					if bookReader, ok := strategy.(strategies.BookReader); ok && algorithm.orderBooks != nil {
+						bookReader.SetOrderBooks(algorithm.orderBooks)
+					}
+					if candleReader, ok := strategy.(strategies.CandleReader); ok && algorithm.candles != nil {
+						candleReader.SetCandles(algorithm.candles)
+					}
+					algorithm.resume(tickerSymbol, strategy, algorithmLogger)
+					algorithm.updateState(tickerSymbol, strategy, 0)
+				}
+
+				decisionChannel <- decision
+				continue
 			}
 
-			actionChannel <- action
+			decision.Action = strategy.Decide(ticker)
+			if planner, ok := strategy.(strategies.Planner); ok && decision.Action != domain.ActionNothing {
+				decision.Plan = planner.Plan(ticker, decision.Action)
+			}
+			algorithm.updateState(tickerSymbol, strategy, 1)
+			decisionChannel <- decision
 		}
 	}()
 
-	algorithm.actionChannel = actionChannel
+	algorithm.decisionChannel = decisionChannel
 	return &algorithm
 }
 
-func (alogrithm *Algorithm) GetActionChannel() <-chan domain.Action {
-	return alogrithm.actionChannel
+// New strategy of the held instrument continues from the position, e.g. after the start,
+// the change of the active strategy or enabling the instrument again
+func (algorithm *Algorithm) resume(symbol string, strategy strategies.Strategy, algorithmLogger algorithmLogger) {
+	resumer, ok := strategy.(strategies.Resumer)
+	if !ok || algorithm.positions == nil {
+		return
+	}
+
+	for _, position := range algorithm.positions.GetState().Positions {
+		if strings.EqualFold(position.Symbol, symbol) && position.Quantity != 0 {
+			resumer.Resume(position)
+			algorithmLogger.Printf("Strategy for %s is resumed with position %v at %v", symbol, position.Quantity, position.AverageEntryPrice)
+			return
+		}
+	}
+}
+
+// Strategy of the instrument is created again on the next ticker and resumes from the position held then,
+// e.g. after the position is closed by the protective stop behind the strategy's back
+func (algorithm *Algorithm) ResetStrategy(symbol string) {
+	algorithm.resetMutex.Lock()
+	defer algorithm.resetMutex.Unlock()
+
+	algorithm.resets[symbol] = true
+}
+
+func (algorithm *Algorithm) takeReset(symbol string) bool {
+	algorithm.resetMutex.Lock()
+	defer algorithm.resetMutex.Unlock()
+
+	reset := algorithm.resets[symbol]
+	delete(algorithm.resets, symbol)
+	return reset
+}
+
+// States of the running strategies sorted by symbol
+func (algorithm *Algorithm) GetStrategyStates() []domain.StrategyState {
+	algorithm.stateMutex.Lock()
+	defer algorithm.stateMutex.Unlock()
+
+	states := make([]domain.StrategyState, 0, len(algorithm.states))
+	for _, state := range algorithm.states {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Symbol < states[j].Symbol
+	})
+
+	return states
+}
+
+func (algorithm *Algorithm) updateState(symbol string, strategy strategies.Strategy, tickers int) {
+	algorithm.stateMutex.Lock()
+	defer algorithm.stateMutex.Unlock()
+
+	state := algorithm.states[symbol]
+	state.Symbol = symbol
+	state.Tickers += tickers
+	if reporter, ok := strategy.(strategies.Reporter); ok {
+		state.State = reporter.State()
+	}
+	algorithm.states[symbol] = state
+}
+
+func (algorithm *Algorithm) deleteState(symbol string) {
+	algorithm.stateMutex.Lock()
+	defer algorithm.stateMutex.Unlock()
+
+	delete(algorithm.states, symbol)
+}
+
+func (algorithm *Algorithm) resetStates() {
+	algorithm.stateMutex.Lock()
+	defer algorithm.stateMutex.Unlock()
+
+	algorithm.states = make(map[string]domain.StrategyState)
+}
+
+func (alogrithm *Algorithm) GetDecisionChannel() <-chan domain.Decision {
+	return alogrithm.decisionChannel
 }
@@ -1,32 +1,342 @@
 package services_test
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/legendiguess/kraken-trade-bot/domain"
 	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
+	"github.com/stretchr/testify/assert"
 )
 
-type websocketClientServiceTest struct{}
+type websocketClientServiceTest struct {
+	tickers []domain.Ticker
+}
 
 func (websocketClientServiceTest *websocketClientServiceTest) GetTickerChannel() <-chan domain.Ticker {
+	tickerChannel := make(chan domain.Ticker, len(websocketClientServiceTest.tickers))
+
+	for _, ticker := range websocketClientServiceTest.tickers {
+		tickerChannel <- ticker
+	}
+	close(tickerChannel)
+
+	return tickerChannel
+}
+
+type algorithmInstrumentServiceTest struct {
+	mutex       sync.Mutex
+	instruments map[string]domain.InstrumentConfig
+}
+
+func newAlgorithmInstrumentServiceTest(symbols ...string) *algorithmInstrumentServiceTest {
+	instrumentService := algorithmInstrumentServiceTest{instruments: make(map[string]domain.InstrumentConfig)}
+	for _, symbol := range symbols {
+		instrumentService.instruments[symbol] = domain.NewInstrumentConfig(symbol)
+	}
+	return &instrumentService
+}
+
+func (algorithmInstrumentServiceTest *algorithmInstrumentServiceTest) GetInstrument(symbol string) (domain.InstrumentConfig, bool) {
+	algorithmInstrumentServiceTest.mutex.Lock()
+	defer algorithmInstrumentServiceTest.mutex.Unlock()
+
+	instrument, ok := algorithmInstrumentServiceTest.instruments[symbol]
+	return instrument, ok
+}
+
+func (algorithmInstrumentServiceTest *algorithmInstrumentServiceTest) setEnabled(symbol string, enabled bool) {
+	algorithmInstrumentServiceTest.mutex.Lock()
+	defer algorithmInstrumentServiceTest.mutex.Unlock()
+
+	instrument := algorithmInstrumentServiceTest.instruments[symbol]
+	instrument.Enabled = enabled
+	algorithmInstrumentServiceTest.instruments[symbol] = instrument
+}
+
+type loggerTest struct{}
+
+func (loggerTest *loggerTest) Printf(format string, args ...interface{}) {}
+
+func newTestTicker(symbol string, ask float64, bid float64) domain.Ticker {
+	return domain.Ticker{Symbol: symbol, Ask: ask, Bid: bid}
+}
+
+func TestAlgorithm(t *testing.T) {
+	websocketClient := websocketClientServiceTest{tickers: []domain.Ticker{
+		newTestTicker("test", 100.0, 99.0),
+		newTestTicker("test", 100.0, 99.0),
+		newTestTicker("test", 100.5, 100.05),
+		newTestTicker("test", 100.5, 100.2),
+		newTestTicker("test", 100.0, 99.0),
+		newTestTicker("other", 10.0, 9.0),
+		newTestTicker("test", 100.0, 99.0),
+		newTestTicker("other", 10.0, 9.0),
+		newTestTicker("unknown", 10.0, 9.0),
+		newTestTicker("unknown", 10.0, 9.0),
+	}}
+
+	algorithm := services.NewAlgorithm(&websocketClient, strategies.NewDefaultRegistry(), newAlgorithmInstrumentServiceTest("test", "other"), nil, nil, nil, &loggerTest{})
+
+	var decisions []domain.Decision
+	for decision := range algorithm.GetDecisionChannel() {
+		decisions = append(decisions, decision)
+	}
+
+	// Every instrument has its own strategy state, unknown instruments are never traded
+	assert.Equal(t, []domain.Decision{
+		{Symbol: "test", Action: domain.ActionNothing},
+		{Symbol: "test", Action: domain.ActionBuy},
+		{Symbol: "test", Action: domain.ActionNothing},
+		{Symbol: "test", Action: domain.ActionSell},
+		{Symbol: "test", Action: domain.ActionBuy},
+		{Symbol: "other", Action: domain.ActionNothing},
+		{Symbol: "test", Action: domain.ActionNothing},
+		{Symbol: "other", Action: domain.ActionBuy},
+		{Symbol: "unknown", Action: domain.ActionNothing},
+		{Symbol: "unknown", Action: domain.ActionNothing},
+	}, decisions)
+}
+
+func TestAlgorithmStrategySwitch(t *testing.T) {
+	registry := strategies.NewDefaultRegistry()
+
 	tickerChannel := make(chan domain.Ticker)
+	algorithm := services.NewAlgorithm(&channelWebsocketClientTest{tickerChannel: tickerChannel}, registry, newAlgorithmInstrumentServiceTest("test"), nil, nil, nil, &loggerTest{})
+	decisionChannel := algorithm.GetDecisionChannel()
+
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
 
-	ticker := domain.Ticker(make(map[string]interface{}))
+	err := registry.Select(domain.StrategyConfig{Name: strategies.TakeProfitName, Params: map[string]float64{"ratio": 0.01}})
+	assert.Nil(t, err)
 
-	ticker["product_id"] = "test"
-	ticker["ask"] = 100.0
-	ticker["bid"] = 200.0
+	// Strategy is recreated with the new params
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.6, 100.5)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 101.5, 101.0)
+	assert.Equal(t, domain.ActionSell, (<-decisionChannel).Action)
 
-	tickerChannel <- ticker
-	tickerChannel <- ticker
 	close(tickerChannel)
+}
 
-	return tickerChannel
+func TestAlgorithmDisabledInstrument(t *testing.T) {
+	instrumentService := newAlgorithmInstrumentServiceTest("test")
+
+	tickerChannel := make(chan domain.Ticker)
+	algorithm := services.NewAlgorithm(&channelWebsocketClientTest{tickerChannel: tickerChannel}, strategies.NewDefaultRegistry(), instrumentService, nil, nil, nil, &loggerTest{})
+	decisionChannel := algorithm.GetDecisionChannel()
+
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
+
+	instrumentService.setEnabled("test", false)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+
+	// Strategy starts from scratch after the instrument is enabled again
+	instrumentService.setEnabled("test", true)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
+
+	close(tickerChannel)
 }
 
-func TestAlgorithm(t *testing.T) {
-	algorithm := services.NewAlgorithm(&websocketClientServiceTest{})
+type channelWebsocketClientTest struct {
+	tickerChannel chan domain.Ticker
+}
 
-	algorithm.GetActionChannel()
+func (channelWebsocketClientTest *channelWebsocketClientTest) GetTickerChannel() <-chan domain.Ticker {
+	return channelWebsocketClientTest.tickerChannel
+}
+
+type algorithmPositionsTest struct {
+	mutex     sync.Mutex
+	positions []domain.Position
+}
+
+func (algorithmPositionsTest *algorithmPositionsTest) GetState() domain.RiskState {
+	algorithmPositionsTest.mutex.Lock()
+	defer algorithmPositionsTest.mutex.Unlock()
+
+	return domain.RiskState{Positions: append([]domain.Position{}, algorithmPositionsTest.positions...)}
+}
+
+func TestAlgorithmHeldPositions(t *testing.T) {
+	registry := strategies.NewDefaultRegistry()
+	instrumentService := newAlgorithmInstrumentServiceTest("test")
+	positions := algorithmPositionsTest{positions: []domain.Position{{Symbol: "TEST", Quantity: 1, AverageEntryPrice: 100}}}
+
+	tickerChannel := make(chan domain.Ticker)
+	algorithm := services.NewAlgorithm(&channelWebsocketClientTest{tickerChannel: tickerChannel}, registry, instrumentService, nil, nil, &positions, &loggerTest{})
+	decisionChannel := algorithm.GetDecisionChannel()
+
+	// Position is already held, so the strategy waits for the price to sell instead of buying
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.6, 100.5)
+	assert.Equal(t, domain.ActionSell, (<-decisionChannel).Action)
+
+	// The strategy created after the change of the active strategy resumes from the position too
+	assert.Nil(t, registry.Select(domain.StrategyConfig{Name: strategies.TakeProfitName, Params: map[string]float64{"ratio": 0.01}}))
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 101.5, 101.0)
+	assert.Equal(t, domain.ActionSell, (<-decisionChannel).Action)
+
+	// And after the instrument is enabled again
+	instrumentService.setEnabled("test", false)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	instrumentService.setEnabled("test", true)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+
+	// Without the position the new strategy starts flat
+	positions.mutex.Lock()
+	positions.positions = nil
+	positions.mutex.Unlock()
+	instrumentService.setEnabled("test", false)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	instrumentService.setEnabled("test", true)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
+
+	close(tickerChannel)
+}
+
+type algorithmOrderBooksTest struct{}
+
+func (algorithmOrderBooksTest *algorithmOrderBooksTest) GetOrderBook(symbol string) (domain.OrderBook, bool) {
+	return domain.OrderBook{OrderBookSnapshot: domain.OrderBookSnapshot{
+		Symbol: symbol,
+		Bids:   []domain.PriceLevel{{Price: 99, Size: 3}},
+		Asks:   []domain.PriceLevel{{Price: 100, Size: 1}},
+	}}, true
+}
+
+// Buys when the bids outweigh the asks
+type imbalanceStrategyTest struct {
+	orderBooks strategies.OrderBooks
+}
+
+func (imbalanceStrategyTest *imbalanceStrategyTest) SetOrderBooks(orderBooks strategies.OrderBooks) {
+	imbalanceStrategyTest.orderBooks = orderBooks
+}
+
+func (imbalanceStrategyTest *imbalanceStrategyTest) Decide(ticker domain.Ticker) domain.Action {
+	if orderBook, ok := imbalanceStrategyTest.orderBooks.GetOrderBook(ticker.Symbol); ok && orderBook.Imbalance(1) > 0 {
+		return domain.ActionBuy
+	}
+	return domain.ActionNothing
+}
+
+func TestAlgorithmOrderBooks(t *testing.T) {
+	registry := strategies.NewRegistry()
+	registry.Register("imbalance", func(params strategies.Params) (strategies.Strategy, error) {
+		return &imbalanceStrategyTest{}, nil
+	})
+	assert.Nil(t, registry.Select(domain.StrategyConfig{Name: "imbalance"}))
+
+	tickerChannel := make(chan domain.Ticker)
+	algorithm := services.NewAlgorithm(&channelWebsocketClientTest{tickerChannel: tickerChannel}, registry, newAlgorithmInstrumentServiceTest("test"), &algorithmOrderBooksTest{}, nil, nil, &loggerTest{})
+	decisionChannel := algorithm.GetDecisionChannel()
+
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
+
+	close(tickerChannel)
+}
+
+func TestAlgorithmStrategyStates(t *testing.T) {
+	instrumentService := newAlgorithmInstrumentServiceTest("test", "other")
+
+	tickerChannel := make(chan domain.Ticker)
+	algorithm := services.NewAlgorithm(&channelWebsocketClientTest{tickerChannel: tickerChannel}, strategies.NewDefaultRegistry(), instrumentService, nil, nil, nil, &loggerTest{})
+	decisionChannel := algorithm.GetDecisionChannel()
+
+	assert.Equal(t, []domain.StrategyState{}, algorithm.GetStrategyStates())
+
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	<-decisionChannel
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	<-decisionChannel
+	tickerChannel <- newTestTicker("other", 10.0, 9.0)
+	<-decisionChannel
+
+	assert.Equal(t, []domain.StrategyState{
+		{Symbol: "other", State: map[string]interface{}{"holding": false, "previous_action_price": 0.0}},
+		{Symbol: "test", Tickers: 1, State: map[string]interface{}{"holding": true, "previous_action_price": 100.0}},
+	}, algorithm.GetStrategyStates())
+
+	instrumentService.setEnabled("other", false)
+	tickerChannel <- newTestTicker("other", 10.0, 9.0)
+	<-decisionChannel
+	assert.Len(t, algorithm.GetStrategyStates(), 1)
+
+	close(tickerChannel)
+}
+
+func TestAlgorithmResetStrategy(t *testing.T) {
+	registry := strategies.NewDefaultRegistry()
+	assert.Nil(t, registry.Select(domain.StrategyConfig{Name: strategies.TakeProfitName, Params: map[string]float64{"ratio": 0.01, "stop_loss": 0.05}}))
+	positions := algorithmPositionsTest{}
+
+	tickerChannel := make(chan domain.Ticker)
+	algorithm := services.NewAlgorithm(&channelWebsocketClientTest{tickerChannel: tickerChannel}, registry, newAlgorithmInstrumentServiceTest("test"), nil, nil, &positions, &loggerTest{})
+	decisionChannel := algorithm.GetDecisionChannel()
+
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 100.0, 99.0)
+	decision := <-decisionChannel
+	assert.Equal(t, domain.ActionBuy, decision.Action)
+	assert.Equal(t, 95.0, decision.Plan.StopPrice)
+
+	// The protective stop closes the position, the strategy still waits to sell
+	tickerChannel <- newTestTicker("test", 94.0, 93.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+
+	// After the reset the strategy starts flat and enters again
+	algorithm.ResetStrategy("test")
+	tickerChannel <- newTestTicker("test", 94.0, 93.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 94.0, 93.0)
+	assert.Equal(t, domain.ActionBuy, (<-decisionChannel).Action)
+
+	// The reset of the partly closed position resumes from the rest of it
+	positions.mutex.Lock()
+	positions.positions = []domain.Position{{Symbol: "test", Quantity: 1, AverageEntryPrice: 94}}
+	positions.mutex.Unlock()
+	algorithm.ResetStrategy("test")
+	tickerChannel <- newTestTicker("test", 94.0, 93.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 94.0, 93.0)
+	assert.Equal(t, domain.ActionNothing, (<-decisionChannel).Action)
+	tickerChannel <- newTestTicker("test", 96.0, 95.5)
+	assert.Equal(t, domain.ActionSell, (<-decisionChannel).Action)
+
+	close(tickerChannel)
 }
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Random bytes in the generated keys and signing secrets
+const apiKeyBytes = 32
+
+type apiKeyStorage interface {
+	NewAPIKey(apiKey *domain.APIKey)
+	FindAPIKey(keyHash string) (domain.APIKey, bool)
+	GetAPIKeys() []domain.APIKey
+	DeleteAPIKey(name string) bool
+}
+
+// APIKeyService creates and checks the REST API keys, keys are stored only as SHA-256 hashes
+type APIKeyService struct {
+	storage apiKeyStorage
+}
+
+func NewAPIKeyService(apiKeyStorage apiKeyStorage) *APIKeyService {
+	return &APIKeyService{storage: apiKeyStorage}
+}
+
+// Generate a key with the role, signed key also gets a secret for HMAC signatures
+func (apiKeyService *APIKeyService) CreateKey(name string, role domain.APIRole, signed bool) (domain.NewAPIKey, error) {
+	key, err := randomHex()
+	if err != nil {
+		return domain.NewAPIKey{}, err
+	}
+
+	newAPIKey := domain.NewAPIKey{Name: name, Role: role, Key: key}
+	if signed {
+		newAPIKey.SigningSecret, err = randomHex()
+		if err != nil {
+			return domain.NewAPIKey{}, err
+		}
+	}
+
+	if err := apiKeyService.save(newAPIKey); err != nil {
+		return domain.NewAPIKey{}, err
+	}
+	return newAPIKey, nil
+}
+
+// Save the key given from outside, e.g. from the environment, the key saved with the same name is replaced.
+// Nothing is done if the key is already saved
+func (apiKeyService *APIKeyService) AddKey(name string, key string, role domain.APIRole) error {
+	if _, ok := apiKeyService.storage.FindAPIKey(hashAPIKey(key)); ok {
+		return nil
+	}
+	apiKeyService.storage.DeleteAPIKey(name)
+	return apiKeyService.save(domain.NewAPIKey{Name: name, Role: role, Key: key})
+}
+
+// False if there is no such key
+func (apiKeyService *APIKeyService) Authenticate(key string) (domain.APIKey, bool) {
+	if key == "" {
+		return domain.APIKey{}, false
+	}
+	return apiKeyService.storage.FindAPIKey(hashAPIKey(key))
+}
+
+func (apiKeyService *APIKeyService) GetKeys() []domain.APIKey {
+	return apiKeyService.storage.GetAPIKeys()
+}
+
+func (apiKeyService *APIKeyService) DeleteKey(name string) bool {
+	return apiKeyService.storage.DeleteAPIKey(name)
+}
+
+func (apiKeyService *APIKeyService) save(newAPIKey domain.NewAPIKey) error {
+	if newAPIKey.Name == "" {
+		return errors.New("name is required")
+	}
+	if newAPIKey.Role != domain.APIRoleReadOnly && newAPIKey.Role != domain.APIRoleOperator {
+		return fmt.Errorf("role must be %s or %s", domain.APIRoleReadOnly, domain.APIRoleOperator)
+	}
+	for _, apiKey := range apiKeyService.storage.GetAPIKeys() {
+		if apiKey.Name == newAPIKey.Name {
+			return fmt.Errorf("key %q already exists", newAPIKey.Name)
+		}
+	}
+
+	apiKeyService.storage.NewAPIKey(&domain.APIKey{
+		Name:          newAPIKey.Name,
+		KeyHash:       hashAPIKey(newAPIKey.Key),
+		Role:          newAPIKey.Role,
+		SigningSecret: newAPIKey.SigningSecret,
+		Created:       time.Now().UTC().Format(time.RFC3339),
+	})
+	return nil
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex() (string, error) {
+	bytes := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,89 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type apiKeyStorageTest struct {
+	apiKeys []domain.APIKey
+}
+
+func (apiKeyStorageTest *apiKeyStorageTest) NewAPIKey(apiKey *domain.APIKey) {
+	apiKeyStorageTest.apiKeys = append(apiKeyStorageTest.apiKeys, *apiKey)
+}
+
+func (apiKeyStorageTest *apiKeyStorageTest) FindAPIKey(keyHash string) (domain.APIKey, bool) {
+	for _, apiKey := range apiKeyStorageTest.apiKeys {
+		if apiKey.KeyHash == keyHash {
+			return apiKey, true
+		}
+	}
+	return domain.APIKey{}, false
+}
+
+func (apiKeyStorageTest *apiKeyStorageTest) GetAPIKeys() []domain.APIKey {
+	return apiKeyStorageTest.apiKeys
+}
+
+func (apiKeyStorageTest *apiKeyStorageTest) DeleteAPIKey(name string) bool {
+	for i, apiKey := range apiKeyStorageTest.apiKeys {
+		if apiKey.Name == name {
+			apiKeyStorageTest.apiKeys = append(apiKeyStorageTest.apiKeys[:i], apiKeyStorageTest.apiKeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestAPIKeyService(t *testing.T) {
+	storage := apiKeyStorageTest{}
+	apiKeyService := services.NewAPIKeyService(&storage)
+
+	reader, err := apiKeyService.CreateKey("reader", domain.APIRoleReadOnly, false)
+	assert.Nil(t, err)
+	assert.Len(t, reader.Key, 64)
+	assert.Empty(t, reader.SigningSecret)
+
+	operator, err := apiKeyService.CreateKey("operator", domain.APIRoleOperator, true)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, operator.SigningSecret)
+
+	// The key itself is not stored
+	for _, apiKey := range storage.apiKeys {
+		assert.NotEqual(t, reader.Key, apiKey.KeyHash)
+		assert.NotEqual(t, operator.Key, apiKey.KeyHash)
+	}
+
+	apiKey, ok := apiKeyService.Authenticate(operator.Key)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, domain.APIRoleOperator, apiKey.Role)
+	assert.Equal(t, operator.SigningSecret, apiKey.SigningSecret)
+
+	_, ok = apiKeyService.Authenticate("wrong")
+	assert.Equal(t, false, ok)
+	_, ok = apiKeyService.Authenticate("")
+	assert.Equal(t, false, ok)
+
+	_, err = apiKeyService.CreateKey("reader", domain.APIRoleReadOnly, false)
+	assert.NotNil(t, err)
+	_, err = apiKeyService.CreateKey("admin", domain.APIRole("admin"), false)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, apiKeyService.AddKey("bootstrap", "known-key", domain.APIRoleOperator))
+	assert.Nil(t, apiKeyService.AddKey("bootstrap", "known-key", domain.APIRoleOperator))
+	assert.Len(t, apiKeyService.GetKeys(), 3)
+
+	// Changed key replaces the old one
+	assert.Nil(t, apiKeyService.AddKey("bootstrap", "new-key", domain.APIRoleOperator))
+	assert.Len(t, apiKeyService.GetKeys(), 3)
+	_, ok = apiKeyService.Authenticate("known-key")
+	assert.Equal(t, false, ok)
+
+	assert.Equal(t, true, apiKeyService.DeleteKey("reader"))
+	_, ok = apiKeyService.Authenticate(reader.Key)
+	assert.Equal(t, false, ok)
+}
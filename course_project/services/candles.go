@@ -0,0 +1,178 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Closed candles kept in memory for every symbol and period
+const CandleHistorySize = 500
+
+type candleTradeService interface {
+	GetTradeChannel() <-chan domain.MarketTrade
+}
+
+type candleStorage interface {
+	SaveCandle(candle *domain.Candle)
+	// Last closed candles sorted from the oldest one
+	GetCandles(symbol string, period domain.CandlePeriod, limit int) []domain.Candle
+}
+
+type candleLogger interface {
+	Printf(format string, args ...interface{})
+}
+
+type candleSeries struct {
+	symbol string
+	period domain.CandlePeriod
+}
+
+// CandleBuilder aggregates ticker and trade prices into candles of the given periods.
+// Candle is closed and saved when the first price of the next period arrives, so periods without prices have no candles.
+// Prices older than the current candle are ignored
+type CandleBuilder struct {
+	storage candleStorage
+	periods []domain.CandlePeriod
+	logger  candleLogger
+
+	mutex   sync.Mutex
+	current map[candleSeries]*domain.Candle
+	// Closed candles from the oldest one, loaded from the storage when the series is used first
+	closed map[candleSeries][]domain.Candle
+}
+
+// Trades of the trade service are consumed until its channel is closed, tickers are received as a ticker observer
+func NewCandleBuilder(candleTradeService candleTradeService, candleStorage candleStorage, periods []domain.CandlePeriod, candleLogger candleLogger) *CandleBuilder {
+	candleBuilder := CandleBuilder{
+		storage: candleStorage,
+		periods: periods,
+		logger:  candleLogger,
+		current: make(map[candleSeries]*domain.Candle),
+		closed:  make(map[candleSeries][]domain.Candle),
+	}
+
+	go func() {
+		for trade := range candleTradeService.GetTradeChannel() {
+			tradeTime, err := time.Parse(time.RFC3339, trade.Time)
+			if err != nil {
+				candleBuilder.logger.Printf("Skipped %s trade with wrong time %q", trade.Symbol, trade.Time)
+				continue
+			}
+			candleBuilder.update(trade.Symbol, tradeTime, trade.Price, trade.Size)
+		}
+	}()
+
+	return &candleBuilder
+}
+
+// Last traded price of the ticker is used, mid price if there is no last price.
+// Tickers without time are counted at the time they are received
+func (candleBuilder *CandleBuilder) UpdateTicker(ticker domain.Ticker) {
+	if ticker.Validate() != nil {
+		return
+	}
+
+	price := ticker.Last
+	if price <= 0 {
+		price = ticker.Mid()
+	}
+
+	tickerTime := time.Now()
+	if ticker.Time > 0 {
+		tickerTime = time.Unix(0, ticker.Time*int64(time.Millisecond))
+	}
+
+	candleBuilder.update(ticker.Symbol, tickerTime, price, 0)
+}
+
+func (candleBuilder *CandleBuilder) GetPeriods() []domain.CandlePeriod {
+	return append([]domain.CandlePeriod(nil), candleBuilder.periods...)
+}
+
+// Last count closed candles sorted from the oldest one, at most CandleHistorySize candles are kept
+func (candleBuilder *CandleBuilder) GetCandles(symbol string, period domain.CandlePeriod, count int) []domain.Candle {
+	candleBuilder.mutex.Lock()
+	defer candleBuilder.mutex.Unlock()
+
+	if !candleBuilder.hasPeriod(period) {
+		return []domain.Candle{}
+	}
+
+	closed := candleBuilder.series(candleSeries{symbol: strings.ToUpper(symbol), period: period})
+	if count <= 0 || count > len(closed) {
+		count = len(closed)
+	}
+	return append([]domain.Candle{}, closed[len(closed)-count:]...)
+}
+
+// Candle of the current period, false before the first price
+func (candleBuilder *CandleBuilder) GetCurrentCandle(symbol string, period domain.CandlePeriod) (domain.Candle, bool) {
+	candleBuilder.mutex.Lock()
+	defer candleBuilder.mutex.Unlock()
+
+	candle, ok := candleBuilder.current[candleSeries{symbol: strings.ToUpper(symbol), period: period}]
+	if !ok {
+		return domain.Candle{}, false
+	}
+	return *candle, true
+}
+
+func (candleBuilder *CandleBuilder) update(symbol string, at time.Time, price float64, size float64) {
+	candleBuilder.mutex.Lock()
+	defer candleBuilder.mutex.Unlock()
+
+	symbol = strings.ToUpper(symbol)
+	for _, period := range candleBuilder.periods {
+		key := candleSeries{symbol: symbol, period: period}
+		start := period.Start(at)
+
+		candle, ok := candleBuilder.current[key]
+		if ok && start.Before(candle.Start) {
+			continue
+		}
+		if ok && start.Equal(candle.Start) {
+			candle.Update(price, size)
+			continue
+		}
+
+		if ok {
+			candleBuilder.close(key, *candle)
+		}
+		newCandle := domain.NewCandle(symbol, period, start, price)
+		newCandle.Update(price, size)
+		candleBuilder.current[key] = &newCandle
+	}
+}
+
+// Must be called with locked mutex
+func (candleBuilder *CandleBuilder) close(key candleSeries, candle domain.Candle) {
+	closed := append(candleBuilder.series(key), candle)
+	if len(closed) > CandleHistorySize {
+		closed = closed[len(closed)-CandleHistorySize:]
+	}
+	candleBuilder.closed[key] = closed
+
+	candleBuilder.storage.SaveCandle(&candle)
+}
+
+// Closed candles of the series, must be called with locked mutex
+func (candleBuilder *CandleBuilder) series(key candleSeries) []domain.Candle {
+	closed, ok := candleBuilder.closed[key]
+	if !ok {
+		closed = candleBuilder.storage.GetCandles(key.symbol, key.period, CandleHistorySize)
+		candleBuilder.closed[key] = closed
+	}
+	return closed
+}
+
+func (candleBuilder *CandleBuilder) hasPeriod(period domain.CandlePeriod) bool {
+	for _, candlePeriod := range candleBuilder.periods {
+		if candlePeriod == period {
+			return true
+		}
+	}
+	return false
+}
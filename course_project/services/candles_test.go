@@ -0,0 +1,95 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type candleTradeServiceTest struct {
+	tradeChannel chan domain.MarketTrade
+}
+
+func (candleTradeServiceTest *candleTradeServiceTest) GetTradeChannel() <-chan domain.MarketTrade {
+	return candleTradeServiceTest.tradeChannel
+}
+
+type candleStorageTest struct {
+	candles []domain.Candle
+}
+
+func (candleStorageTest *candleStorageTest) SaveCandle(candle *domain.Candle) {
+	candleStorageTest.candles = append(candleStorageTest.candles, *candle)
+}
+
+func (candleStorageTest *candleStorageTest) GetCandles(symbol string, period domain.CandlePeriod, limit int) []domain.Candle {
+	candles := []domain.Candle{}
+	for _, candle := range candleStorageTest.candles {
+		if candle.Symbol == symbol && candle.Period == period {
+			candles = append(candles, candle)
+		}
+	}
+	return candles
+}
+
+var candleTestStart = time.Date(2021, 11, 25, 19, 0, 0, 0, time.UTC)
+
+func newCandleTestTicker(at time.Duration, last float64) domain.Ticker {
+	return domain.Ticker{Symbol: "PI_XBTUSD", Bid: last - 1, Ask: last + 1, Last: last, Time: candleTestStart.Add(at).UnixNano() / int64(time.Millisecond)}
+}
+
+func TestCandleBuilder(t *testing.T) {
+	tradeChannel := make(chan domain.MarketTrade)
+	storage := candleStorageTest{}
+	candleBuilder := services.NewCandleBuilder(&candleTradeServiceTest{tradeChannel: tradeChannel}, &storage, []domain.CandlePeriod{domain.CandlePeriod1m, domain.CandlePeriod5m}, &loggerTest{})
+
+	candleBuilder.UpdateTicker(newCandleTestTicker(10*time.Second, 100))
+	tradeChannel <- domain.MarketTrade{Symbol: "PI_XBTUSD", Price: 104, Size: 3, Time: candleTestStart.Add(20 * time.Second).Format(time.RFC3339)}
+	tradeChannel <- domain.MarketTrade{Symbol: "PI_XBTUSD", Price: 98, Size: 1, Time: candleTestStart.Add(30 * time.Second).Format(time.RFC3339)}
+	close(tradeChannel)
+
+	assert.Eventually(t, func() bool {
+		candle, _ := candleBuilder.GetCurrentCandle("pi_xbtusd", domain.CandlePeriod1m)
+		return candle.Trades == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []domain.Candle{}, candleBuilder.GetCandles("PI_XBTUSD", domain.CandlePeriod1m, 10))
+
+	// The next minute closes the first candle, the late ticker is ignored by the closed minute but not by the open 5 minutes
+	candleBuilder.UpdateTicker(newCandleTestTicker(70*time.Second, 101))
+	candleBuilder.UpdateTicker(newCandleTestTicker(40*time.Second, 90))
+	candleBuilder.UpdateTicker(newCandleTestTicker(130*time.Second, 102))
+
+	candles := candleBuilder.GetCandles("PI_XBTUSD", domain.CandlePeriod1m, 10)
+	assert.Equal(t, []domain.Candle{
+		{Symbol: "PI_XBTUSD", Period: domain.CandlePeriod1m, Start: candleTestStart, Open: 100, High: 104, Low: 98, Close: 98, Volume: 4, Trades: 2},
+		{Symbol: "PI_XBTUSD", Period: domain.CandlePeriod1m, Start: candleTestStart.Add(time.Minute), Open: 101, High: 101, Low: 101, Close: 101},
+	}, candles)
+	assert.Equal(t, candles, storage.candles)
+	assert.Equal(t, candles[1:], candleBuilder.GetCandles("PI_XBTUSD", domain.CandlePeriod1m, 1))
+
+	current, ok := candleBuilder.GetCurrentCandle("PI_XBTUSD", domain.CandlePeriod5m)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, domain.Candle{Symbol: "PI_XBTUSD", Period: domain.CandlePeriod5m, Start: candleTestStart, Open: 100, High: 104, Low: 90, Close: 102, Volume: 4, Trades: 2}, current)
+
+	assert.Equal(t, []domain.Candle{}, candleBuilder.GetCandles("PI_XBTUSD", domain.CandlePeriod1h, 10))
+}
+
+func TestCandleBuilderHistory(t *testing.T) {
+	storage := candleStorageTest{candles: []domain.Candle{domain.NewCandle("PI_XBTUSD", domain.CandlePeriod1m, candleTestStart.Add(-time.Minute), 99)}}
+	tradeChannel := make(chan domain.MarketTrade)
+	close(tradeChannel)
+	candleBuilder := services.NewCandleBuilder(&candleTradeServiceTest{tradeChannel: tradeChannel}, &storage, []domain.CandlePeriod{domain.CandlePeriod1m}, &loggerTest{})
+
+	// Candles saved before the restart are continued
+	candleBuilder.UpdateTicker(newCandleTestTicker(0, 100))
+	candleBuilder.UpdateTicker(newCandleTestTicker(time.Minute, 101))
+
+	candles := candleBuilder.GetCandles("PI_XBTUSD", domain.CandlePeriod1m, 0)
+	if assert.Len(t, candles, 2) {
+		assert.Equal(t, 99.0, candles[0].Open)
+		assert.Equal(t, 100.0, candles[1].Open)
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import "github.com/legendiguess/kraken-trade-bot/domain"
+
+// Texts of the telegram command answers in one language
+type commandCatalog struct {
+	// Descriptions of the commands in the help by command name
+	about map[string]string
+	// List of the commands follows the title
+	help string
+
+	adminOnly      string
+	usage          string
+	unknownCommand string
+	subscribeFirst string
+
+	subscribed    string
+	unsubscribed  string
+	notSubscribed string
+
+	// Channel lists
+	channels        string
+	parkedChannels  string
+	channelsChanged string
+	// Channel and the available channels
+	unknownChannel string
+	emailFirst     string
+	webhookFirst   string
+
+	invalidEmail    string
+	emailSaved      string
+	invalidWebhook  string
+	internalWebhook string
+	webhookSaved    string
+
+	language        string
+	unknownLanguage string
+	timezone        string
+	unknownTimezone string
+
+	invalidSymbol   string
+	invalidNotional string
+	quietUsage      string
+	unknownCategory string
+	unknownFilter   string
+	filterAll       string
+	filterNone      string
+	// Instruments, sides, minimum notional, quiet hours and categories
+	filters string
+
+	none string
+	// Trading state, connection state and instruments
+	status string
+	// Realized, unrealized, fees and net profit
+	profit string
+	// Symbol, position and net profit
+	instrumentProfit string
+
+	// Maximum number of orders
+	ordersCount string
+	noOrders    string
+	// Time, side, symbol, size, price and status
+	order string
+
+	// Symbol and order size
+	instrumentSwitched string
+	paused             string
+	resumed            string
+	flattening         string
+	// Error of the change
+	tradingFailed string
+}
+
+var commandCatalogs = map[domain.Language]commandCatalog{
+	domain.LanguageRussian: {
+		about: map[string]string{
+			"/start":      "подписаться на уведомления об ордерах",
+			"/stop":       "отписаться от уведомлений",
+			"/channels":   "каналы уведомлений: %s",
+			"/email":      "адрес почты для уведомлений",
+			"/webhook":    "адрес вебхука для уведомлений",
+			"/language":   "язык уведомлений",
+			"/timezone":   "часовой пояс уведомлений, например Europe/Moscow",
+			"/filters":    "фильтры уведомлений",
+			"/status":     "состояние торговли и соединения с биржей",
+			"/pnl":        "прибыль и убытки",
+			"/orders":     "последние n ордеров, по умолчанию %d",
+			"/instrument": "торговать только этим инструментом",
+			"/pause":      "приостановить торговлю",
+			"/resume":     "возобновить торговлю",
+			"/flatten":    "закрыть все позиции и остановить торговлю",
+			"/help":       "список команд",
+		},
+		help: "Команды:",
+
+		adminOnly:      "Команда доступна только администраторам ⛔",
+		usage:          "Использование: ",
+		unknownCommand: "Неизвестная команда, список команд: /help",
+		subscribeFirst: "Сначала подпишитесь командой /start",
+
+		subscribed:    "Вы подписались на получение информации по ордерам 👍",
+		unsubscribed:  "Вы отписались от уведомлений 👋",
+		notSubscribed: "Вы не подписаны на уведомления",
+
+		channels:        "Каналы уведомлений: %s",
+		parkedChannels:  "Отключены после ошибок доставки: %s",
+		channelsChanged: "Уведомления отправляются в: %s",
+		unknownChannel:  "Неизвестный канал %s, доступны: %s",
+		emailFirst:      "Сначала задайте адрес почты командой /email",
+		webhookFirst:    "Сначала задайте адрес вебхука командой /webhook",
+
+		invalidEmail:    "Неверный адрес почты, например trader@example.com",
+		emailSaved:      "Адрес почты сохранен, включите канал командой /channels",
+		invalidWebhook:  "Неверный адрес вебхука, например https://example.com/hook",
+		internalWebhook: "Адрес вебхука должен быть доступен из интернета",
+		webhookSaved:    "Адрес вебхука сохранен, включите канал командой /channels",
+
+		language:        "Язык уведомлений: %s",
+		unknownLanguage: "Неизвестный язык, доступны: ru, en",
+		timezone:        "Часовой пояс уведомлений: %s",
+		unknownTimezone: "Неизвестный часовой пояс, например Europe/Moscow или UTC",
+
+		invalidSymbol:   "Неверный символ инструмента, например PI_XBTUSD",
+		invalidNotional: "Минимальный объем должен быть неотрицательным числом",
+		quietUsage:      "Использование: /filters quiet <from-to|off>, например /filters quiet 23-7",
+		unknownCategory: "Неизвестная категория, доступны: fills, risk, errors, summary",
+		unknownFilter:   "Неизвестный фильтр, доступны: instruments, sides, notional, quiet, categories",
+		filterAll:       "все",
+		filterNone:      "нет",
+		filters:         "Фильтры уведомлений:\nИнструменты: %s\nСтороны: %s\nМинимальный объем: %s\nТихие часы: %s\nКатегории: %s",
+
+		none:             "нет",
+		status:           "Торговля: %s\nСоединение с биржей: %s\nИнструменты: %s",
+		profit:           "Прибыль 💰\nРеализованная: %.2f\nНереализованная: %.2f\nКомиссии: %.2f\nИтого: %.2f",
+		instrumentProfit: "%s: позиция %v, итого %.2f",
+
+		ordersCount: "Число ордеров должно быть от 1 до %d",
+		noOrders:    "Ордеров пока нет",
+		order:       "%s %s %s %d по %s, %s",
+
+		instrumentSwitched: "Теперь торгуется %s, размер ордера %d",
+		paused:             "Торговля приостановлена ⏸",
+		resumed:            "Торговля возобновлена ▶️",
+		flattening:         "Позиции закрываются, торговля будет остановлена ⏹",
+		tradingFailed:      "Не удалось изменить состояние торговли: %v",
+	},
+	domain.LanguageEnglish: {
+		about: map[string]string{
+			"/start":      "subscribe to the order notifications",
+			"/stop":       "unsubscribe from the notifications",
+			"/channels":   "notification channels: %s",
+			"/email":      "email address for the notifications",
+			"/webhook":    "webhook url for the notifications",
+			"/language":   "language of the notifications",
+			"/timezone":   "time zone of the notifications, e.g. Europe/London",
+			"/filters":    "notification filters",
+			"/status":     "trading and exchange connection state",
+			"/pnl":        "profit and loss",
+			"/orders":     "last n orders, %d by default",
+			"/instrument": "trade only this instrument",
+			"/pause":      "pause trading",
+			"/resume":     "resume trading",
+			"/flatten":    "close all positions and stop trading",
+			"/help":       "list of commands",
+		},
+		help: "Commands:",
+
+		adminOnly:      "The command is available to admins only ⛔",
+		usage:          "Usage: ",
+		unknownCommand: "Unknown command, list of commands: /help",
+		subscribeFirst: "Subscribe with /start first",
+
+		subscribed:    "You are subscribed to the order notifications 👍",
+		unsubscribed:  "You are unsubscribed from the notifications 👋",
+		notSubscribed: "You are not subscribed to the notifications",
+
+		channels:        "Notification channels: %s",
+		parkedChannels:  "Turned off after delivery errors: %s",
+		channelsChanged: "Notifications are sent to: %s",
+		unknownChannel:  "Unknown channel %s, available: %s",
+		emailFirst:      "Set the email address with /email first",
+		webhookFirst:    "Set the webhook url with /webhook first",
+
+		invalidEmail:    "Invalid email address, e.g. trader@example.com",
+		emailSaved:      "Email address is saved, turn the channel on with /channels",
+		invalidWebhook:  "Invalid webhook url, e.g. https://example.com/hook",
+		internalWebhook: "Webhook must be reachable from the internet",
+		webhookSaved:    "Webhook url is saved, turn the channel on with /channels",
+
+		language:        "Notification language: %s",
+		unknownLanguage: "Unknown language, available: ru, en",
+		timezone:        "Notification time zone: %s",
+		unknownTimezone: "Unknown time zone, e.g. Europe/London or UTC",
+
+		invalidSymbol:   "Invalid instrument symbol, e.g. PI_XBTUSD",
+		invalidNotional: "Minimum notional must be a non-negative number",
+		quietUsage:      "Usage: /filters quiet <from-to|off>, e.g. /filters quiet 23-7",
+		unknownCategory: "Unknown category, available: fills, risk, errors, summary",
+		unknownFilter:   "Unknown filter, available: instruments, sides, notional, quiet, categories",
+		filterAll:       "all",
+		filterNone:      "none",
+		filters:         "Notification filters:\nInstruments: %s\nSides: %s\nMinimum notional: %s\nQuiet hours: %s\nCategories: %s",
+
+		none:             "none",
+		status:           "Trading: %s\nExchange connection: %s\nInstruments: %s",
+		profit:           "Profit 💰\nRealized: %.2f\nUnrealized: %.2f\nFees: %.2f\nNet: %.2f",
+		instrumentProfit: "%s: position %v, net %.2f",
+
+		ordersCount: "Number of orders must be from 1 to %d",
+		noOrders:    "No orders yet",
+		order:       "%s %s %s %d at %s, %s",
+
+		instrumentSwitched: "Now trading %s, order size %d",
+		paused:             "Trading is paused ⏸",
+		resumed:            "Trading is resumed ▶️",
+		flattening:         "Positions are being closed, trading will be stopped ⏹",
+		tradingFailed:      "Can't change the trading state: %v",
+	},
+}
+
+// Catalog of the language, unknown languages get the default one
+func languageCommandCatalog(language domain.Language) commandCatalog {
+	if catalog, ok := commandCatalogs[language]; ok {
+		return catalog
+	}
+	return commandCatalogs[domain.DefaultLanguage]
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const dailySummaryCheckInterval = time.Minute
+
+type dailySummaryPnL interface {
+	GetPeriodReport(from time.Time, to time.Time) domain.PnLReport
+}
+
+type dailySummaryUsers interface {
+	GetUsers() []domain.User
+}
+
+type dailySummaryNotifications interface {
+	DispatchTo(user domain.User, notification domain.Notification)
+}
+
+// DailySummary sends every subscriber the profit of the previous day at midnight of the user time zone,
+// if midnight is in the quiet hours of the user the summary is sent when they end
+type DailySummary struct {
+	pnl           dailySummaryPnL
+	users         dailySummaryUsers
+	notifications dailySummaryNotifications
+
+	mutex sync.Mutex
+	// Start of the last summarized day by chat
+	summarized map[int64]time.Time
+}
+
+func NewDailySummary(ctx context.Context, pnl dailySummaryPnL, users dailySummaryUsers, notifications dailySummaryNotifications) *DailySummary {
+	dailySummary := DailySummary{pnl: pnl, users: users, notifications: notifications, summarized: make(map[int64]time.Time)}
+
+	go func() {
+		ticker := time.NewTicker(dailySummaryCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				dailySummary.SendDue(time.Now())
+			}
+		}
+	}()
+
+	return &dailySummary
+}
+
+// Send the summaries which are due at the time. A subscriber seen for the first time waits for the next summary,
+// so the day is not sent again after a restart and a new subscriber doesn't get the day before the subscription
+func (dailySummary *DailySummary) SendDue(now time.Time) {
+	dailySummary.mutex.Lock()
+	defer dailySummary.mutex.Unlock()
+
+	for _, user := range dailySummary.users.GetUsers() {
+		day := summaryDay(user, now)
+		last, ok := dailySummary.summarized[user.ChatID]
+		dailySummary.summarized[user.ChatID] = day
+		if !ok || !day.After(last) {
+			continue
+		}
+
+		report := dailySummary.pnl.GetPeriodReport(day, day.AddDate(0, 0, 1))
+		dailySummary.notifications.DispatchTo(user, domain.Notification{Kind: domain.NotificationKindDailySummary, Summary: &report})
+	}
+}
+
+// Start of the last day whose summary is due at the time in the user time zone
+func summaryDay(user domain.User, now time.Time) time.Time {
+	local := now.In(user.GetLocation())
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+	due := midnight
+	if user.IsQuiet(midnight) {
+		due = time.Date(local.Year(), local.Month(), local.Day(), user.QuietTo, 0, 0, 0, local.Location())
+	}
+	if now.Before(due) {
+		midnight = midnight.AddDate(0, 0, -1)
+	}
+	return midnight.AddDate(0, 0, -1)
+}
@@ -0,0 +1,63 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Report has the period length in hours as the net profit and the period start as the realized profit, so the day can be checked
+type dailySummaryPnLTest struct{}
+
+func (dailySummaryPnLTest *dailySummaryPnLTest) GetPeriodReport(from time.Time, to time.Time) domain.PnLReport {
+	return domain.PnLReport{NetPnL: to.Sub(from).Hours(), RealizedPnL: float64(from.Unix())}
+}
+
+type dailySummaryNotificationsTest struct {
+	summaries map[int64][]domain.PnLReport
+}
+
+func (dailySummaryNotificationsTest *dailySummaryNotificationsTest) DispatchTo(user domain.User, notification domain.Notification) {
+	dailySummaryNotificationsTest.summaries[user.ChatID] = append(dailySummaryNotificationsTest.summaries[user.ChatID], *notification.Summary)
+}
+
+func TestDailySummary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := notificationUsersTest{users: []domain.User{
+		{ChatID: 1, Timezone: "Asia/Tokyo"},
+		// Europe/Moscow by default, midnight is in the quiet hours
+		{ChatID: 2, QuietFrom: 23, QuietTo: 7},
+	}}
+	notifications := dailySummaryNotificationsTest{summaries: make(map[int64][]domain.PnLReport)}
+	dailySummary := services.NewDailySummary(ctx, &dailySummaryPnLTest{}, &users, &notifications)
+
+	// The days which are already due at the start are not sent
+	dailySummary.SendDue(time.Date(2021, 12, 1, 14, 0, 0, 0, time.UTC))
+	assert.Empty(t, notifications.summaries)
+
+	// Midnight in Tokyo
+	dailySummary.SendDue(time.Date(2021, 12, 1, 15, 0, 0, 0, time.UTC))
+	assert.Equal(t, map[int64][]domain.PnLReport{
+		1: {{NetPnL: 24, RealizedPnL: float64(time.Date(2021, 11, 30, 15, 0, 0, 0, time.UTC).Unix())}},
+	}, notifications.summaries)
+
+	// Midnight in Moscow waits for the end of the quiet hours at 07:00
+	dailySummary.SendDue(time.Date(2021, 12, 1, 21, 0, 0, 0, time.UTC))
+	dailySummary.SendDue(time.Date(2021, 12, 2, 3, 59, 0, 0, time.UTC))
+	assert.Len(t, notifications.summaries[2], 0)
+
+	dailySummary.SendDue(time.Date(2021, 12, 2, 4, 0, 0, 0, time.UTC))
+	dailySummary.SendDue(time.Date(2021, 12, 2, 5, 0, 0, 0, time.UTC))
+	assert.Equal(t, []domain.PnLReport{{NetPnL: 24, RealizedPnL: float64(time.Date(2021, 11, 30, 21, 0, 0, 0, time.UTC).Unix())}}, notifications.summaries[2])
+	assert.Len(t, notifications.summaries[1], 1)
+
+	// The next midnight in Tokyo
+	dailySummary.SendDue(time.Date(2021, 12, 2, 15, 0, 0, 0, time.UTC))
+	assert.Len(t, notifications.summaries[1], 2)
+}
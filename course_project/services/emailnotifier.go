@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type emailCredentials interface {
+	GetSMTPAddress() string
+	GetSMTPFrom() string
+	GetSMTPUsername() string
+	GetSMTPPassword() string
+}
+
+// EmailNotifier sends the notifications as plain text emails through the SMTP server
+type EmailNotifier struct {
+	address string
+	from    string
+	// Nil if the server doesn't need authentication
+	auth smtp.Auth
+}
+
+func NewEmailNotifier(credentials emailCredentials) *EmailNotifier {
+	emailNotifier := EmailNotifier{address: credentials.GetSMTPAddress(), from: credentials.GetSMTPFrom()}
+
+	if username := credentials.GetSMTPUsername(); username != "" {
+		host, _, _ := net.SplitHostPort(emailNotifier.address)
+		emailNotifier.auth = smtp.PlainAuth("", username, credentials.GetSMTPPassword(), host)
+	}
+
+	return &emailNotifier
+}
+
+func (emailNotifier *EmailNotifier) Channel() domain.NotificationChannel {
+	return domain.NotificationChannelEmail
+}
+
+func (emailNotifier *EmailNotifier) Notify(user domain.User, notification domain.Notification) error {
+	if user.Email == "" {
+		return errors.New("email is not set")
+	}
+
+	message := "From: " + emailNotifier.from + "\r\n" +
+		"To: " + user.Email + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", notificationSubject(notification, user)) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(notificationText(notification, user), "\n", "\r\n") + "\r\n"
+
+	return smtp.SendMail(emailNotifier.address, emailNotifier.auth, emailNotifier.from, []string{user.Email}, []byte(message))
+}
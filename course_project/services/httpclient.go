@@ -8,33 +8,48 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/legendiguess/kraken-trade-bot/domain"
 )
 
+// Requests hanging longer than this fail, so the trade bot is not blocked by the exchange
+const httpClientTimeout = 15 * time.Second
+
 type httpCredentials interface {
 	GetKrakenPublicKey() string
 	GetKrakenSecretKey() string
 	GetHTTPUrl() string
 }
 
+// HTTPClient is a client of the Kraken Futures REST api v3.
+// Symbols in the answers are upper case as in the websocket feeds.
+// Errors are *APIError, *OrderRejectedError, *MalformedResponseError or transport errors
 type HTTPClient struct {
 	httpCredentials httpCredentials
+	client          *http.Client
 }
 
 func NewHTTPClient(httpCredentials httpCredentials) *HTTPClient {
-	return &HTTPClient{httpCredentials: httpCredentials}
+	return &HTTPClient{httpCredentials: httpCredentials, client: &http.Client{Timeout: httpClientTimeout}}
 }
 
 func (httpClient *HTTPClient) GenerateAuthent(postData string, endpointPath string) string {
-	concatenate := postData + endpointPath
+	return signMessage(postData+endpointPath, httpClient.httpCredentials.GetKrakenSecretKey())
+}
+
+// Kraken signature: base64(hmac-sha512(sha256(message))) keyed by the decoded secret
+func signMessage(message string, secretKey string) string {
 	hashSHA256 := sha256.New()
-	hashSHA256.Write([]byte(concatenate))
+	hashSHA256.Write([]byte(message))
 
-	decodedAPISecret, _ := base64.StdEncoding.DecodeString(httpClient.httpCredentials.GetKrakenSecretKey())
+	decodedAPISecret, _ := base64.StdEncoding.DecodeString(secretKey)
 
 	h := hmac.New(sha512.New, decodedAPISecret)
 	h.Write(hashSHA256.Sum(nil))
@@ -42,60 +57,608 @@ func (httpClient *HTTPClient) GenerateAuthent(postData string, endpointPath stri
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
-func (httpClient *HTTPClient) sendRequest(method string, postData string, endPoint string, body io.Reader) (map[string]interface{}, error) {
-	newRequest, _ := http.NewRequest(method, httpClient.httpCredentials.GetHTTPUrl()+endPoint+"?"+postData, body)
+type apiResult struct {
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+// Send request and decode the json answer into the value, answers without "success" result are returned as *APIError
+func (httpClient *HTTPClient) sendRequest(method string, postData string, endPoint string, answer interface{}) error {
+	endpointName := strings.TrimPrefix(endPoint, "/api/v3/")
+
+	newRequest, err := http.NewRequest(method, httpClient.httpCredentials.GetHTTPUrl()+endPoint+"?"+postData, nil)
+	if err != nil {
+		return err
+	}
 
 	newRequest.Header.Add("Authent", httpClient.GenerateAuthent(postData, endPoint))
 	newRequest.Header.Add("APIKey", httpClient.httpCredentials.GetKrakenPublicKey())
 
-	resp, err := http.DefaultClient.Do(newRequest)
+	resp, err := httpClient.client.Do(newRequest)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	bytesAnswer, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		return err
+	}
+
+	var result apiResult
+	if err := json.Unmarshal(bytesAnswer, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{Endpoint: endpointName, StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return &MalformedResponseError{Endpoint: endpointName, Err: err}
+	}
+
+	if result.Result != "success" {
+		message := result.Error
+		if message == "" {
+			message = fmt.Sprintf("result %q", result.Result)
+		}
+		return &APIError{Endpoint: endpointName, StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if err := json.Unmarshal(bytesAnswer, answer); err != nil {
+		return &MalformedResponseError{Endpoint: endpointName, Err: err}
+	}
+
+	return nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+type krakenOrder struct {
+	OrderID       string  `json:"orderId"`
+	ClientOrderID string  `json:"cliOrdId"`
+	Type          string  `json:"type"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	Quantity      float64 `json:"quantity"`
+	LimitPrice    float64 `json:"limitPrice"`
+	StopPrice     float64 `json:"stopPrice"`
+	ReduceOnly    bool    `json:"reduceOnly"`
+	Timestamp     string  `json:"timestamp"`
+}
+
+type orderEvent struct {
+	Type                string       `json:"type"`
+	Reason              string       `json:"reason"`
+	ExecutionID         string       `json:"executionId"`
+	Price               float64      `json:"price"`
+	Amount              float64      `json:"amount"`
+	Order               *krakenOrder `json:"order"`
+	OrderPriorExecution *krakenOrder `json:"orderPriorExecution"`
+	New                 *krakenOrder `json:"new"`
+}
+
+type orderStatus struct {
+	OrderID     string       `json:"order_id"`
+	OrderTag    string       `json:"order_tag"`
+	Status      string       `json:"status"`
+	OrderEvents []orderEvent `json:"orderEvents"`
+}
+
+type sendOrderAnswer struct {
+	SendStatus *orderStatus `json:"sendStatus"`
+}
+
+func orderParams(orderRequest domain.OrderRequest) url.Values {
+	params := url.Values{}
+	params.Set("orderType", string(orderRequest.OrderType))
+	params.Set("symbol", orderRequest.Symbol)
+	params.Set("side", string(orderRequest.Side))
+	params.Set("size", strconv.FormatUint(orderRequest.Size, 10))
+	if orderRequest.LimitPrice != 0 {
+		params.Set("limitPrice", formatFloat(orderRequest.LimitPrice))
+	}
+	if orderRequest.StopPrice != 0 {
+		params.Set("stopPrice", formatFloat(orderRequest.StopPrice))
+	}
+	if orderRequest.ReduceOnly {
+		params.Set("reduceOnly", "true")
+	}
+	if orderRequest.ClientOrderID != "" {
+		params.Set("cliOrdId", orderRequest.ClientOrderID)
+	}
+	return params
+}
+
+// Send the order, placed orders are returned with OrderStatusPlaced,
+// executed ones with OrderStatusFilled and the average execution price
+func (httpClient *HTTPClient) SendOrder(orderRequest domain.OrderRequest) (*domain.OrderInfo, error) {
+	if err := orderRequest.Validate(); err != nil {
+		return nil, err
+	}
+
+	var answer sendOrderAnswer
+	if err := httpClient.sendRequest("POST", orderParams(orderRequest).Encode(), "/api/v3/sendorder", &answer); err != nil {
 		return nil, err
 	}
 
-	var answerMap map[string]interface{}
-	json.Unmarshal(bytesAnswer, &answerMap)
-	return answerMap, nil
+	if answer.SendStatus == nil {
+		return nil, &MalformedResponseError{Endpoint: "sendorder", Err: errors.New("sendStatus is missing")}
+	}
+
+	return sentOrderInfo(orderRequest, answer.SendStatus)
 }
 
-func (httpClient HTTPClient) Order(ticker string, side domain.OrderSide) (*domain.OrderInfo, error) {
-	answer, err := httpClient.sendRequest("POST", fmt.Sprintf("orderType=mkt&symbol=%s&side=%s&size=1", ticker, side), "/api/v3/sendorder", nil)
-	if err != nil {
+// Order info from the send status of the order, the request fills the fields missing in the events.
+// Executions are summed up into one order info which keeps the IDs of all of them
+func sentOrderInfo(orderRequest domain.OrderRequest, sendStatus *orderStatus) (*domain.OrderInfo, error) {
+	orderInfo := domain.OrderInfo{
+		OrderID:       sendStatus.OrderID,
+		ClientOrderID: orderRequest.ClientOrderID,
+		Status:        domain.OrderStatusPlaced,
+		Type:          string(orderRequest.OrderType),
+		Symbol:        orderRequest.Symbol,
+		Side:          orderRequest.Side,
+		Quantity:      orderRequest.Size,
+		LimitPrice:    orderRequest.LimitPrice,
+		StopPrice:     orderRequest.StopPrice,
+		ReduceOnly:    orderRequest.ReduceOnly,
+	}
+
+	var order *krakenOrder
+	laterExecutionIDs := []string{}
+	executedAmount, executedValue := 0.0, 0.0
+	for _, event := range sendStatus.OrderEvents {
+		switch event.Type {
+		case "REJECT":
+			return nil, &OrderRejectedError{OrderID: sendStatus.OrderID, Reason: event.Reason}
+		case "PLACE":
+			order = event.Order
+		case "EXECUTION":
+			if orderInfo.ExecutionID == "" {
+				orderInfo.ExecutionID = event.ExecutionID
+			} else {
+				laterExecutionIDs = append(laterExecutionIDs, event.ExecutionID)
+			}
+			if order == nil {
+				order = event.OrderPriorExecution
+			}
+			executedAmount += event.Amount
+			executedValue += event.Price * event.Amount
+		}
+	}
+
+	// Orders rejected before matching have only the status, e.g. "insufficientAvailableFunds"
+	if order == nil {
+		return nil, &OrderRejectedError{OrderID: sendStatus.OrderID, Reason: sendStatus.Status}
+	}
+
+	orderInfo.OrderID = order.OrderID
+	orderInfo.Type = order.Type
+	orderInfo.LimitPrice = order.LimitPrice
+	orderInfo.Timestamp = order.Timestamp
+	orderInfo.LaterExecutionIDs = strings.Join(laterExecutionIDs, ",")
+
+	if executedAmount > 0 {
+		orderInfo.Status = domain.OrderStatusFilled
+		orderInfo.Amount = uint64(executedAmount)
+		orderInfo.Price = executedValue / executedAmount
+	}
+
+	return &orderInfo, nil
+}
+
+type editOrderAnswer struct {
+	EditStatus *orderStatus `json:"editStatus"`
+}
+
+func editParams(orderEdit domain.OrderEdit) url.Values {
+	params := url.Values{}
+	if orderEdit.OrderID != "" {
+		params.Set("orderId", orderEdit.OrderID)
+	} else {
+		params.Set("cliOrdId", orderEdit.ClientOrderID)
+	}
+	if orderEdit.Size != 0 {
+		params.Set("size", strconv.FormatUint(orderEdit.Size, 10))
+	}
+	if orderEdit.LimitPrice != 0 {
+		params.Set("limitPrice", formatFloat(orderEdit.LimitPrice))
+	}
+	if orderEdit.StopPrice != 0 {
+		params.Set("stopPrice", formatFloat(orderEdit.StopPrice))
+	}
+	return params
+}
+
+// Change size or prices of the resting order, the order is returned as it is after the edit
+func (httpClient *HTTPClient) EditOrder(orderEdit domain.OrderEdit) (*domain.OpenOrder, error) {
+	if err := orderEdit.Validate(); err != nil {
+		return nil, err
+	}
+
+	var answer editOrderAnswer
+	if err := httpClient.sendRequest("POST", editParams(orderEdit).Encode(), "/api/v3/editorder", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.EditStatus == nil {
+		return nil, &MalformedResponseError{Endpoint: "editorder", Err: errors.New("editStatus is missing")}
+	}
+	if answer.EditStatus.Status != "edited" {
+		return nil, &OrderRejectedError{OrderID: orderEdit.OrderID, Reason: answer.EditStatus.Status}
+	}
+
+	for _, event := range answer.EditStatus.OrderEvents {
+		if event.Type == "EDIT" && event.New != nil {
+			return &domain.OpenOrder{
+				OrderID:       event.New.OrderID,
+				ClientOrderID: event.New.ClientOrderID,
+				Symbol:        strings.ToUpper(event.New.Symbol),
+				Side:          domain.OrderSide(event.New.Side),
+				Type:          event.New.Type,
+				Quantity:      event.New.Quantity,
+				LimitPrice:    event.New.LimitPrice,
+				StopPrice:     event.New.StopPrice,
+				ReduceOnly:    event.New.ReduceOnly,
+				Timestamp:     event.New.Timestamp,
+			}, nil
+		}
+	}
+
+	return nil, &MalformedResponseError{Endpoint: "editorder", Err: errors.New("EDIT event is missing")}
+}
+
+type cancelOrderAnswer struct {
+	CancelStatus *struct {
+		Status          string `json:"status"`
+		CancelledOrders []struct {
+			OrderID string `json:"order_id"`
+		} `json:"cancelledOrders"`
+	} `json:"cancelStatus"`
+}
+
+func (httpClient *HTTPClient) CancelOrder(orderID string) error {
+	var answer cancelOrderAnswer
+	if err := httpClient.sendRequest("POST", "order_id="+url.QueryEscape(orderID), "/api/v3/cancelorder", &answer); err != nil {
+		return err
+	}
+
+	if answer.CancelStatus == nil {
+		return &MalformedResponseError{Endpoint: "cancelorder", Err: errors.New("cancelStatus is missing")}
+	}
+	if answer.CancelStatus.Status != "cancelled" {
+		return &OrderRejectedError{OrderID: orderID, Reason: answer.CancelStatus.Status}
+	}
+
+	return nil
+}
+
+// Cancel all resting orders of the symbol or of all symbols if it is empty, ids of the cancelled orders are returned
+func (httpClient *HTTPClient) CancelAllOrders(symbol string) ([]string, error) {
+	postData := ""
+	if symbol != "" {
+		postData = "symbol=" + url.QueryEscape(symbol)
+	}
+
+	var answer cancelOrderAnswer
+	if err := httpClient.sendRequest("POST", postData, "/api/v3/cancelallorders", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.CancelStatus == nil {
+		return nil, &MalformedResponseError{Endpoint: "cancelallorders", Err: errors.New("cancelStatus is missing")}
+	}
+
+	orderIDs := make([]string, 0, len(answer.CancelStatus.CancelledOrders))
+	for _, cancelledOrder := range answer.CancelStatus.CancelledOrders {
+		orderIDs = append(orderIDs, cancelledOrder.OrderID)
+	}
+
+	return orderIDs, nil
+}
+
+type batchOrderAnswer struct {
+	BatchStatus []orderStatus `json:"batchStatus"`
+}
+
+// Send, edit and cancel orders in one request, a result is returned for every instruction.
+// Failed instructions don't fail the batch, their results have RejectReason set
+func (httpClient *HTTPClient) BatchOrder(instructions []domain.BatchInstruction) ([]domain.BatchResult, error) {
+	batchOrder := make([]map[string]interface{}, 0, len(instructions))
+	for i, instruction := range instructions {
+		order, err := batchOrderEntry(instruction, i)
+		if err != nil {
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+		batchOrder = append(batchOrder, order)
+	}
+
+	batchJSON, _ := json.Marshal(map[string]interface{}{"batchOrder": batchOrder})
+
+	var answer batchOrderAnswer
+	if err := httpClient.sendRequest("POST", "json="+url.QueryEscape(string(batchJSON)), "/api/v3/batchorder", &answer); err != nil {
 		return nil, err
 	}
 
-	if value, ok := answer["result"]; ok {
-		if value == "success" {
-			sendStatus := answer["sendStatus"].(map[string]interface{})
-			orderEvents := sendStatus["orderEvents"].([]interface{})
-			orderEvent := orderEvents[0].(map[string]interface{})
-			if orderEvent["type"] == "EXECUTION" {
-				orderPriorExecution := orderEvent["orderPriorExecution"].(map[string]interface{})
-
-				var orderInfo = domain.OrderInfo{
-					OrderID:     orderPriorExecution["orderId"].(string),
-					ExecutionID: orderEvent["executionId"].(string),
-					Price:       orderEvent["price"].(float64),
-					Amount:      uint64(orderEvent["amount"].(float64)),
-					Type:        orderPriorExecution["type"].(string),
-					Symbol:      orderPriorExecution["symbol"].(string),
-					Side:        domain.OrderSide(orderPriorExecution["side"].(string)),
-					Quantity:    uint64(orderPriorExecution["quantity"].(float64)),
-					LimitPrice:  orderPriorExecution["limitPrice"].(float64),
-					Timestamp:   orderPriorExecution["timestamp"].(string),
-				}
-
-				return &orderInfo, nil
+	if len(answer.BatchStatus) != len(instructions) {
+		return nil, &MalformedResponseError{Endpoint: "batchorder", Err: fmt.Errorf("%d statuses for %d instructions", len(answer.BatchStatus), len(instructions))}
+	}
+
+	results := make([]domain.BatchResult, 0, len(instructions))
+	for i, status := range answer.BatchStatus {
+		result := domain.BatchResult{OrderID: status.OrderID, Status: status.Status}
+
+		switch {
+		case instructions[i].Send != nil:
+			if _, err := sentOrderInfo(*instructions[i].Send, &status); err != nil {
+				result.RejectReason = err.Error()
+			}
+		case instructions[i].Edit != nil:
+			if status.Status != "edited" {
+				result.RejectReason = status.Status
 			}
-			return nil, errors.New(orderEvent["reason"].(string))
+		default:
+			if status.Status != "cancelled" {
+				result.RejectReason = status.Status
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Instruction in the json format of the batchorder endpoint, sent orders are tagged by the index
+func batchOrderEntry(instruction domain.BatchInstruction, index int) (map[string]interface{}, error) {
+	switch {
+	case instruction.Send != nil:
+		if err := instruction.Send.Validate(); err != nil {
+			return nil, err
+		}
+
+		order := map[string]interface{}{
+			"order":     "send",
+			"order_tag": strconv.Itoa(index),
+			"orderType": instruction.Send.OrderType,
+			"symbol":    instruction.Send.Symbol,
+			"side":      instruction.Send.Side,
+			"size":      instruction.Send.Size,
+		}
+		if instruction.Send.LimitPrice != 0 {
+			order["limitPrice"] = instruction.Send.LimitPrice
+		}
+		if instruction.Send.StopPrice != 0 {
+			order["stopPrice"] = instruction.Send.StopPrice
+		}
+		if instruction.Send.ReduceOnly {
+			order["reduceOnly"] = true
+		}
+		if instruction.Send.ClientOrderID != "" {
+			order["cliOrdId"] = instruction.Send.ClientOrderID
+		}
+		return order, nil
+	case instruction.Edit != nil:
+		if err := instruction.Edit.Validate(); err != nil {
+			return nil, err
+		}
+
+		order := map[string]interface{}{"order": "edit"}
+		if instruction.Edit.OrderID != "" {
+			order["order_id"] = instruction.Edit.OrderID
+		} else {
+			order["cliOrdId"] = instruction.Edit.ClientOrderID
+		}
+		if instruction.Edit.Size != 0 {
+			order["size"] = instruction.Edit.Size
 		}
+		if instruction.Edit.LimitPrice != 0 {
+			order["limitPrice"] = instruction.Edit.LimitPrice
+		}
+		if instruction.Edit.StopPrice != 0 {
+			order["stopPrice"] = instruction.Edit.StopPrice
+		}
+		return order, nil
+	case instruction.CancelOrderID != "":
+		return map[string]interface{}{"order": "cancel", "order_id": instruction.CancelOrderID}, nil
+	default:
+		return nil, errors.New("instruction is empty")
+	}
+}
+
+type openPositionsAnswer struct {
+	OpenPositions []struct {
+		Side   string  `json:"side"`
+		Symbol string  `json:"symbol"`
+		Price  float64 `json:"price"`
+		Size   float64 `json:"size"`
+	} `json:"openPositions"`
+}
+
+// Positions of the account, short positions have negative quantity
+func (httpClient *HTTPClient) GetOpenPositions() ([]domain.Position, error) {
+	var answer openPositionsAnswer
+	if err := httpClient.sendRequest("GET", "", "/api/v3/openpositions", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.OpenPositions == nil {
+		return nil, &MalformedResponseError{Endpoint: "openpositions", Err: errors.New("openPositions is missing")}
+	}
+
+	positions := make([]domain.Position, 0, len(answer.OpenPositions))
+	for _, openPosition := range answer.OpenPositions {
+		quantity := openPosition.Size
+		if openPosition.Side == "short" {
+			quantity = -quantity
+		}
+		positions = append(positions, domain.Position{Symbol: strings.ToUpper(openPosition.Symbol), Quantity: quantity, AverageEntryPrice: openPosition.Price})
+	}
+
+	return positions, nil
+}
+
+type openOrdersAnswer struct {
+	OpenOrders []struct {
+		OrderID       string  `json:"order_id"`
+		ClientOrderID string  `json:"cliOrdId"`
+		Symbol        string  `json:"symbol"`
+		Side          string  `json:"side"`
+		OrderType     string  `json:"orderType"`
+		LimitPrice    float64 `json:"limitPrice"`
+		StopPrice     float64 `json:"stopPrice"`
+		UnfilledSize  float64 `json:"unfilledSize"`
+		FilledSize    float64 `json:"filledSize"`
+		ReduceOnly    bool    `json:"reduceOnly"`
+		ReceivedTime  string  `json:"receivedTime"`
+	} `json:"openOrders"`
+}
+
+func (httpClient *HTTPClient) GetOpenOrders() ([]domain.OpenOrder, error) {
+	var answer openOrdersAnswer
+	if err := httpClient.sendRequest("GET", "", "/api/v3/openorders", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.OpenOrders == nil {
+		return nil, &MalformedResponseError{Endpoint: "openorders", Err: errors.New("openOrders is missing")}
+	}
+
+	openOrders := make([]domain.OpenOrder, 0, len(answer.OpenOrders))
+	for _, openOrder := range answer.OpenOrders {
+		openOrders = append(openOrders, domain.OpenOrder{
+			OrderID:       openOrder.OrderID,
+			ClientOrderID: openOrder.ClientOrderID,
+			Symbol:        strings.ToUpper(openOrder.Symbol),
+			Side:          domain.OrderSide(openOrder.Side),
+			Type:          openOrder.OrderType,
+			Quantity:      openOrder.UnfilledSize + openOrder.FilledSize,
+			Filled:        openOrder.FilledSize,
+			LimitPrice:    openOrder.LimitPrice,
+			StopPrice:     openOrder.StopPrice,
+			ReduceOnly:    openOrder.ReduceOnly,
+			Timestamp:     openOrder.ReceivedTime,
+		})
+	}
+
+	return openOrders, nil
+}
+
+type fillsAnswer struct {
+	Fills []struct {
+		FillID        string  `json:"fill_id"`
+		OrderID       string  `json:"order_id"`
+		ClientOrderID string  `json:"cliOrdId"`
+		Symbol        string  `json:"symbol"`
+		Side          string  `json:"side"`
+		Size          float64 `json:"size"`
+		Price         float64 `json:"price"`
+		FillTime      string  `json:"fillTime"`
+		FillType      string  `json:"fillType"`
+	} `json:"fills"`
+}
+
+// Last fills of the account, lastFillTime in RFC3339 limits them to the fills before it, empty for the latest fills.
+// Fees are not reported by this endpoint
+func (httpClient *HTTPClient) GetFills(lastFillTime string) ([]domain.Fill, error) {
+	postData := ""
+	if lastFillTime != "" {
+		postData = "lastFillTime=" + url.QueryEscape(lastFillTime)
+	}
+
+	var answer fillsAnswer
+	if err := httpClient.sendRequest("GET", postData, "/api/v3/fills", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.Fills == nil {
+		return nil, &MalformedResponseError{Endpoint: "fills", Err: errors.New("fills is missing")}
+	}
+
+	fills := make([]domain.Fill, 0, len(answer.Fills))
+	for _, fill := range answer.Fills {
+		fills = append(fills, domain.Fill{
+			FillID:        fill.FillID,
+			OrderID:       fill.OrderID,
+			ClientOrderID: fill.ClientOrderID,
+			Symbol:        strings.ToUpper(fill.Symbol),
+			Side:          domain.OrderSide(fill.Side),
+			Price:         fill.Price,
+			Quantity:      fill.Size,
+			FillType:      fill.FillType,
+			Timestamp:     fill.FillTime,
+		})
+	}
+
+	return fills, nil
+}
+
+type accountsAnswer struct {
+	Accounts map[string]struct {
+		// Multi-collateral account
+		BalanceValue      float64 `json:"balanceValue"`
+		PortfolioValue    float64 `json:"portfolioValue"`
+		AvailableMargin   float64 `json:"availableMargin"`
+		InitialMargin     float64 `json:"initialMargin"`
+		MaintenanceMargin float64 `json:"maintenanceMargin"`
+		TotalUnrealized   float64 `json:"totalUnrealized"`
+
+		// Single collateral margin account
+		Auxiliary struct {
+			AvailableFunds float64 `json:"af"`
+			PnL            float64 `json:"pnl"`
+			PortfolioValue float64 `json:"pv"`
+		} `json:"auxiliary"`
+		MarginRequirements struct {
+			InitialMargin     float64 `json:"im"`
+			MaintenanceMargin float64 `json:"mm"`
+		} `json:"marginRequirements"`
+	} `json:"accounts"`
+}
+
+// Margin accounts sorted by name, cash accounts are skipped
+func (httpClient *HTTPClient) GetAccounts() ([]domain.MarginAccount, error) {
+	var answer accountsAnswer
+	if err := httpClient.sendRequest("GET", "", "/api/v3/accounts", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.Accounts == nil {
+		return nil, &MalformedResponseError{Endpoint: "accounts", Err: errors.New("accounts is missing")}
+	}
+
+	names := make([]string, 0, len(answer.Accounts))
+	for name := range answer.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	marginAccounts := make([]domain.MarginAccount, 0, len(names))
+	for _, name := range names {
+		account := answer.Accounts[name]
+
+		marginAccount := domain.MarginAccount{
+			Name:              name,
+			Balance:           account.BalanceValue,
+			PortfolioValue:    account.PortfolioValue,
+			AvailableMargin:   account.AvailableMargin,
+			InitialMargin:     account.InitialMargin,
+			MaintenanceMargin: account.MaintenanceMargin,
+			PnL:               account.TotalUnrealized,
+		}
+		if account.Auxiliary.PortfolioValue != 0 {
+			marginAccount.Balance = account.Auxiliary.PortfolioValue - account.Auxiliary.PnL
+			marginAccount.PortfolioValue = account.Auxiliary.PortfolioValue
+			marginAccount.AvailableMargin = account.Auxiliary.AvailableFunds
+			marginAccount.InitialMargin = account.MarginRequirements.InitialMargin
+			marginAccount.MaintenanceMargin = account.MarginRequirements.MaintenanceMargin
+			marginAccount.PnL = account.Auxiliary.PnL
+		}
+		if marginAccount.PortfolioValue == 0 && marginAccount.Balance == 0 && marginAccount.AvailableMargin == 0 {
+			continue
+		}
+
+		marginAccounts = append(marginAccounts, marginAccount)
 	}
 
-	return nil, errors.New("Something wrong with request parameters")
+	return marginAccounts, nil
 }
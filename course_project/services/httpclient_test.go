@@ -1,13 +1,16 @@
 package services_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/krakentest"
 	"github.com/legendiguess/kraken-trade-bot/services"
 )
 
@@ -46,7 +49,320 @@ func TestOrder(t *testing.T) {
 	defer server.Close()
 
 	httpClient := services.NewHTTPClient(&testHTTPCredentials{url: server.URL})
-	_, err := httpClient.Order("pi_xbtusd", domain.OrderSideSell)
+	orderInfo, err := httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideSell, 1))
 
 	assert.Nil(t, err)
+	assert.Equal(t, domain.OrderInfo{
+		OrderID:     "888cbc74-4048-45c9-8e60-e520a6a474af",
+		ExecutionID: "058f949f-e731-4500-b897-8e57966d630e",
+		Status:      domain.OrderStatusFilled,
+		Price:       59238.5,
+		Amount:      1,
+		Type:        "ioc",
+		Symbol:      "pi_xbtusd",
+		Side:        domain.OrderSideSell,
+		Quantity:    1,
+		LimitPrice:  30000,
+		Timestamp:   "2021-11-25T19:51:10.056Z",
+	}, *orderInfo)
+
+	_, err = httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeLimit, Size: 1})
+	assert.NotNil(t, err)
+}
+
+func TestOrderAgainstKrakenStandIn(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	kraken.ScriptOrders(krakentest.Reject("insufficientAvailableFunds"), krakentest.PartialFill(0.5))
+
+	_, err := httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 1))
+	assert.EqualError(t, err, "insufficientAvailableFunds")
+	var orderRejectedError *services.OrderRejectedError
+	assert.True(t, errors.As(err, &orderRejectedError))
+
+	orderInfo, err := httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, 59010.0, orderInfo.Price)
+
+	orderInfo, err = httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideSell, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, 59000.0, orderInfo.Price)
+	assert.Equal(t, uint64(1), orderInfo.Amount)
+	assert.Equal(t, domain.OrderSideSell, orderInfo.Side)
+
+	assert.Equal(t, 3, len(kraken.SentOrders()))
+	assert.Equal(t, -0.5, kraken.Position("PI_XBTUSD").Quantity)
+
+	// Requests signed with a wrong key are rejected
+	wrongClient := services.NewHTTPClient(&testHTTPCredentials{url: kraken.HTTPUrl()})
+	_, err = wrongClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 1))
+	assert.Equal(t, &services.APIError{Endpoint: "sendorder", StatusCode: http.StatusOK, Message: "authenticationError"}, err)
+	assert.Equal(t, 3, len(kraken.SentOrders()))
+}
+
+func TestSplitOrderAgainstKrakenStandIn(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	kraken.ScriptOrders(krakentest.SplitFill(3))
+
+	orderInfo, err := httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 5))
+	assert.Nil(t, err)
+	assert.Equal(t, domain.OrderStatusFilled, orderInfo.Status)
+	assert.Equal(t, uint64(5), orderInfo.Amount)
+	assert.Equal(t, (59010.0+59011.0+3*59012.0)/5, orderInfo.Price)
+
+	// Every execution is in the fills, all of them are kept in the order info
+	fills, err := httpClient.GetFills("")
+	assert.Nil(t, err)
+	executionIDs := []string{}
+	for _, fill := range fills {
+		assert.Equal(t, orderInfo.OrderID, fill.OrderID)
+		executionIDs = append(executionIDs, fill.FillID)
+	}
+	if assert.Len(t, executionIDs, 3) {
+		assert.ElementsMatch(t, executionIDs, append([]string{orderInfo.ExecutionID}, strings.Split(orderInfo.LaterExecutionIDs, ",")...))
+	}
+	assert.Equal(t, 5.0, kraken.Position("PI_XBTUSD").Quantity)
+}
+
+func TestOrderTypesAgainstKrakenStandIn(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+
+	// Reduce only order can't open a position
+	_, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeMarket, Size: 1, ReduceOnly: true})
+	assert.EqualError(t, err, "WOULD_NOT_REDUCE_POSITION")
+
+	orderInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeLimit, Size: 2, LimitPrice: 58000, ClientOrderID: "entry"})
+	assert.Nil(t, err)
+	assert.Equal(t, domain.OrderStatusPlaced, orderInfo.Status)
+	assert.Equal(t, "entry", orderInfo.ClientOrderID)
+	assert.Equal(t, uint64(2), orderInfo.Quantity)
+	assert.Equal(t, uint64(0), orderInfo.Amount)
+
+	params := kraken.SentOrders()[1]
+	assert.Equal(t, "lmt", params.Get("orderType"))
+	assert.Equal(t, "58000", params.Get("limitPrice"))
+	assert.Equal(t, "entry", params.Get("cliOrdId"))
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 57900.0, "ask": 57950.0})
+	assert.Equal(t, 2.0, kraken.Position("PI_XBTUSD").Quantity)
+
+	stopInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 5, StopPrice: 57000, ReduceOnly: true})
+	assert.Nil(t, err)
+	assert.Equal(t, domain.OrderStatusPlaced, stopInfo.Status)
+	assert.Equal(t, 57000.0, stopInfo.StopPrice)
+	assert.True(t, stopInfo.ReduceOnly)
+
+	takeProfitInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeTakeProfit, Size: 1, StopPrice: 60000})
+	assert.Nil(t, err)
+	assert.Nil(t, httpClient.CancelOrder(takeProfitInfo.OrderID))
+	assert.NotNil(t, httpClient.CancelOrder(takeProfitInfo.OrderID))
+
+	// Stop closes only the position, not the whole size
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 56900.0, "ask": 56950.0})
+	assert.Equal(t, 0.0, kraken.Position("PI_XBTUSD").Quantity)
+
+	_, err = httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypePost, Size: 1, LimitPrice: 57000})
+	assert.EqualError(t, err, "POST_WOULD_EXECUTE")
+}
+
+func TestHTTPClientErrors(t *testing.T) {
+	var answer string
+	var statusCode int
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(statusCode)
+		_, _ = resp.Write([]byte(answer))
+	}))
+	defer server.Close()
+
+	httpClient := services.NewHTTPClient(&testHTTPCredentials{url: server.URL})
+	orderRequest := domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 1)
+
+	statusCode, answer = http.StatusOK, `{"result":"error","error":"apiLimitExceeded","serverTime":"2021-11-25T19:51:10.241Z"}`
+	_, err := httpClient.SendOrder(orderRequest)
+	assert.Equal(t, &services.APIError{Endpoint: "sendorder", StatusCode: http.StatusOK, Message: "apiLimitExceeded"}, err)
+	assert.EqualError(t, err, "sendorder failed: apiLimitExceeded")
+
+	statusCode, answer = http.StatusBadGateway, `<html>Bad Gateway</html>`
+	_, err = httpClient.GetOpenPositions()
+	assert.Equal(t, &services.APIError{Endpoint: "openpositions", StatusCode: http.StatusBadGateway, Message: "Bad Gateway"}, err)
+
+	var malformedResponseError *services.MalformedResponseError
+
+	statusCode, answer = http.StatusOK, `{"result":"success","sendStatus":`
+	_, err = httpClient.SendOrder(orderRequest)
+	assert.True(t, errors.As(err, &malformedResponseError))
+	assert.Equal(t, "sendorder", malformedResponseError.Endpoint)
+
+	statusCode, answer = http.StatusOK, `{"result":"success","serverTime":"2021-11-25T19:51:10.241Z"}`
+	_, err = httpClient.SendOrder(orderRequest)
+	assert.EqualError(t, err, "malformed sendorder response: sendStatus is missing")
+	_, err = httpClient.GetOrderBook("pi_xbtusd")
+	assert.EqualError(t, err, "malformed orderbook response: orderBook is missing")
+
+	// Wrong type of the field
+	statusCode, answer = http.StatusOK, `{"result":"success","openOrders":[{"order_id":1}]}`
+	_, err = httpClient.GetOpenOrders()
+	assert.True(t, errors.As(err, &malformedResponseError))
+	assert.Equal(t, "openorders", malformedResponseError.Endpoint)
+
+	// Orders rejected before matching have only the status
+	statusCode, answer = http.StatusOK, `{"result":"success","sendStatus":{"order_id":"61ca5732-3478-42fe-8362-abbfd9465294","status":"insufficientAvailableFunds","receivedTime":"2021-11-25T19:51:10.056Z"}}`
+	_, err = httpClient.SendOrder(orderRequest)
+	assert.Equal(t, &services.OrderRejectedError{OrderID: "61ca5732-3478-42fe-8362-abbfd9465294", Reason: "insufficientAvailableFunds"}, err)
+
+	statusCode, answer = http.StatusOK, `{"result":"success","cancelStatus":{"status":"notFound","receivedTime":"2021-11-25T19:51:10.056Z"}}`
+	err = httpClient.CancelOrder("unknown")
+	assert.Equal(t, &services.OrderRejectedError{OrderID: "unknown", Reason: "notFound"}, err)
+}
+
+func TestMarketDataAgainstKrakenStandIn(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0, "markPrice": 59005.0, "volume": 1500.0})
+	kraken.SetOrderBook(domain.OrderBookSnapshot{
+		Symbol: "PI_XBTUSD",
+		Bids:   []domain.PriceLevel{{Price: 59000, Size: 10}, {Price: 58990, Size: 20}},
+		Asks:   []domain.PriceLevel{{Price: 59010, Size: 5}},
+	})
+
+	instruments, err := httpClient.GetInstruments()
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.Instrument{{Symbol: "PI_XBTUSD", Type: "futures_inverse", Tradeable: true, TickSize: 0.5, ContractSize: 1, Tag: "perpetual"}}, instruments)
+
+	tickers, err := httpClient.GetTickers()
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.MarketTicker{{Symbol: "PI_XBTUSD", Bid: 59000, Ask: 59010, MarkPrice: 59005, Volume24h: 1500, Tag: "perpetual"}}, tickers)
+
+	orderBook, err := httpClient.GetOrderBook("pi_xbtusd")
+	assert.Nil(t, err)
+	assert.Equal(t, &domain.OrderBookSnapshot{
+		Symbol: "PI_XBTUSD",
+		Bids:   []domain.PriceLevel{{Price: 59000, Size: 10}, {Price: 58990, Size: 20}},
+		Asks:   []domain.PriceLevel{{Price: 59010, Size: 5}},
+	}, orderBook)
+
+	_, err = httpClient.GetOrderBook("pi_unknown")
+	assert.Equal(t, &services.APIError{Endpoint: "orderbook", StatusCode: http.StatusOK, Message: "invalidArgument"}, err)
+
+	_, err = httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 2))
+	assert.Nil(t, err)
+	_, err = httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideSell, 1))
+	assert.Nil(t, err)
+
+	history, err := httpClient.GetHistory("pi_xbtusd", "")
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, domain.OrderSideSell, history[0].Side)
+	assert.Equal(t, 59000.0, history[0].Price)
+	assert.Equal(t, 1.0, history[0].Size)
+	assert.Equal(t, "PI_XBTUSD", history[0].Symbol)
+	assert.Equal(t, uint64(1), history[1].TradeID)
+}
+
+func TestOrderManagementAgainstKrakenStandIn(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_ETHUSD", "bid": 4000.0, "ask": 4001.0})
+
+	limitInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeLimit, Size: 1, LimitPrice: 58000, ClientOrderID: "entry"})
+	assert.Nil(t, err)
+
+	editedOrder, err := httpClient.EditOrder(domain.OrderEdit{ClientOrderID: "entry", Size: 3, LimitPrice: 58500})
+	assert.Nil(t, err)
+	assert.Equal(t, limitInfo.OrderID, editedOrder.OrderID)
+	assert.Equal(t, "PI_XBTUSD", editedOrder.Symbol)
+	assert.Equal(t, 3.0, editedOrder.Quantity)
+	assert.Equal(t, 58500.0, editedOrder.LimitPrice)
+
+	_, err = httpClient.EditOrder(domain.OrderEdit{OrderID: limitInfo.OrderID, StopPrice: 57000})
+	assert.Equal(t, &services.OrderRejectedError{OrderID: limitInfo.OrderID, Reason: "orderForEditNotAStop"}, err)
+	_, err = httpClient.EditOrder(domain.OrderEdit{OrderID: limitInfo.OrderID})
+	assert.NotNil(t, err)
+
+	// Edited limit price crosses the market, the order is executed
+	_, err = httpClient.EditOrder(domain.OrderEdit{OrderID: limitInfo.OrderID, LimitPrice: 59010})
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, kraken.Position("PI_XBTUSD").Quantity)
+
+	results, err := httpClient.BatchOrder([]domain.BatchInstruction{
+		{Send: &domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 3, StopPrice: 57000, ReduceOnly: true}},
+		{Send: &domain.OrderRequest{Symbol: "pi_ethusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypePost, Size: 1, LimitPrice: 4002}},
+		{Send: &domain.OrderRequest{Symbol: "pi_ethusd", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeLimit, Size: 1, LimitPrice: 3900}},
+		{CancelOrderID: "unknown"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, results, 4)
+	assert.Equal(t, "placed", results[0].Status)
+	assert.Equal(t, "", results[0].RejectReason)
+	assert.Equal(t, "POST_WOULD_EXECUTE", results[1].RejectReason)
+	assert.Equal(t, "notFound", results[3].RejectReason)
+
+	stopOrderID, limitOrderID := results[0].OrderID, results[2].OrderID
+	results, err = httpClient.BatchOrder([]domain.BatchInstruction{
+		{Edit: &domain.OrderEdit{OrderID: stopOrderID, StopPrice: 56000}},
+		{CancelOrderID: limitOrderID},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.BatchResult{{OrderID: stopOrderID, Status: "edited"}, {OrderID: limitOrderID, Status: "cancelled"}}, results)
+
+	_, err = httpClient.BatchOrder([]domain.BatchInstruction{{}})
+	assert.NotNil(t, err)
+
+	openOrders, err := httpClient.GetOpenOrders()
+	assert.Nil(t, err)
+	assert.Len(t, openOrders, 1)
+	assert.Equal(t, 56000.0, openOrders[0].StopPrice)
+
+	cancelledOrderIDs, err := httpClient.CancelAllOrders("pi_ethusd")
+	assert.Nil(t, err)
+	assert.Empty(t, cancelledOrderIDs)
+	cancelledOrderIDs, err = httpClient.CancelAllOrders("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{openOrders[0].OrderID}, cancelledOrderIDs)
+
+	fills, err := httpClient.GetFills("")
+	assert.Nil(t, err)
+	assert.Len(t, fills, 1)
+	assert.Equal(t, limitInfo.OrderID, fills[0].OrderID)
+	assert.Equal(t, "entry", fills[0].ClientOrderID)
+	assert.Equal(t, "PI_XBTUSD", fills[0].Symbol)
+	assert.Equal(t, 3.0, fills[0].Quantity)
+	assert.Equal(t, 59010.0, fills[0].Price)
+}
+
+type krakenCredentialsTest struct {
+	url string
+}
+
+func (krakenCredentialsTest *krakenCredentialsTest) GetKrakenSecretKey() string {
+	return krakentest.SecretKey
+}
+
+func (krakenCredentialsTest *krakenCredentialsTest) GetKrakenPublicKey() string {
+	return krakentest.PublicKey
+}
+
+func (krakenCredentialsTest *krakenCredentialsTest) GetHTTPUrl() string {
+	return krakenCredentialsTest.url
 }
@@ -0,0 +1,39 @@
+package services
+
+import "fmt"
+
+// APIError is returned when the exchange answers with an error result or an error http status
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Message    string
+}
+
+func (apiError *APIError) Error() string {
+	return fmt.Sprintf("%s failed: %s", apiError.Endpoint, apiError.Message)
+}
+
+// OrderRejectedError is returned when the request is accepted but the order is rejected,
+// not edited or not cancelled, Reason is the exchange reason or status, e.g. "insufficientAvailableFunds"
+type OrderRejectedError struct {
+	OrderID string
+	Reason  string
+}
+
+func (orderRejectedError *OrderRejectedError) Error() string {
+	return orderRejectedError.Reason
+}
+
+// MalformedResponseError is returned when the answer can't be decoded or misses required fields
+type MalformedResponseError struct {
+	Endpoint string
+	Err      error
+}
+
+func (malformedResponseError *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed %s response: %v", malformedResponseError.Endpoint, malformedResponseError.Err)
+}
+
+func (malformedResponseError *MalformedResponseError) Unwrap() error {
+	return malformedResponseError.Err
+}
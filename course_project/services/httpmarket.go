@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type instrumentsAnswer struct {
+	Instruments []struct {
+		Symbol          string  `json:"symbol"`
+		Type            string  `json:"type"`
+		Underlying      string  `json:"underlying"`
+		Tradeable       bool    `json:"tradeable"`
+		TickSize        float64 `json:"tickSize"`
+		ContractSize    float64 `json:"contractSize"`
+		LastTradingTime string  `json:"lastTradingTime"`
+		Tag             string  `json:"tag"`
+	} `json:"instruments"`
+}
+
+// Contracts listed on the exchange
+func (httpClient *HTTPClient) GetInstruments() ([]domain.Instrument, error) {
+	var answer instrumentsAnswer
+	if err := httpClient.sendRequest("GET", "", "/api/v3/instruments", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.Instruments == nil {
+		return nil, &MalformedResponseError{Endpoint: "instruments", Err: errors.New("instruments is missing")}
+	}
+
+	instruments := make([]domain.Instrument, 0, len(answer.Instruments))
+	for _, instrument := range answer.Instruments {
+		instruments = append(instruments, domain.Instrument{
+			Symbol:          strings.ToUpper(instrument.Symbol),
+			Type:            instrument.Type,
+			Underlying:      instrument.Underlying,
+			Tradeable:       instrument.Tradeable,
+			TickSize:        instrument.TickSize,
+			ContractSize:    instrument.ContractSize,
+			LastTradingTime: instrument.LastTradingTime,
+			Tag:             instrument.Tag,
+		})
+	}
+
+	return instruments, nil
+}
+
+type tickersAnswer struct {
+	Tickers []struct {
+		Symbol       string  `json:"symbol"`
+		Bid          float64 `json:"bid"`
+		BidSize      float64 `json:"bidSize"`
+		Ask          float64 `json:"ask"`
+		AskSize      float64 `json:"askSize"`
+		Last         float64 `json:"last"`
+		LastSize     float64 `json:"lastSize"`
+		LastTime     string  `json:"lastTime"`
+		Open24h      float64 `json:"open24h"`
+		Volume24h    float64 `json:"vol24h"`
+		OpenInterest float64 `json:"openInterest"`
+		MarkPrice    float64 `json:"markPrice"`
+		Suspended    bool    `json:"suspended"`
+		Tag          string  `json:"tag"`
+	} `json:"tickers"`
+}
+
+// Market summaries of all listed contracts and indices
+func (httpClient *HTTPClient) GetTickers() ([]domain.MarketTicker, error) {
+	var answer tickersAnswer
+	if err := httpClient.sendRequest("GET", "", "/api/v3/tickers", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.Tickers == nil {
+		return nil, &MalformedResponseError{Endpoint: "tickers", Err: errors.New("tickers is missing")}
+	}
+
+	tickers := make([]domain.MarketTicker, 0, len(answer.Tickers))
+	for _, ticker := range answer.Tickers {
+		tickers = append(tickers, domain.MarketTicker{
+			Symbol:       strings.ToUpper(ticker.Symbol),
+			Bid:          ticker.Bid,
+			BidSize:      ticker.BidSize,
+			Ask:          ticker.Ask,
+			AskSize:      ticker.AskSize,
+			Last:         ticker.Last,
+			LastSize:     ticker.LastSize,
+			LastTime:     ticker.LastTime,
+			Open24h:      ticker.Open24h,
+			Volume24h:    ticker.Volume24h,
+			OpenInterest: ticker.OpenInterest,
+			MarkPrice:    ticker.MarkPrice,
+			Suspended:    ticker.Suspended,
+			Tag:          ticker.Tag,
+		})
+	}
+
+	return tickers, nil
+}
+
+type orderBookAnswer struct {
+	OrderBook *struct {
+		Bids [][2]float64 `json:"bids"`
+		Asks [][2]float64 `json:"asks"`
+	} `json:"orderBook"`
+}
+
+func (httpClient *HTTPClient) GetOrderBook(symbol string) (*domain.OrderBookSnapshot, error) {
+	var answer orderBookAnswer
+	if err := httpClient.sendRequest("GET", "symbol="+url.QueryEscape(symbol), "/api/v3/orderbook", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.OrderBook == nil {
+		return nil, &MalformedResponseError{Endpoint: "orderbook", Err: errors.New("orderBook is missing")}
+	}
+
+	orderBook := domain.OrderBookSnapshot{
+		Symbol: strings.ToUpper(symbol),
+		Bids:   make([]domain.PriceLevel, 0, len(answer.OrderBook.Bids)),
+		Asks:   make([]domain.PriceLevel, 0, len(answer.OrderBook.Asks)),
+	}
+	for _, bid := range answer.OrderBook.Bids {
+		orderBook.Bids = append(orderBook.Bids, domain.PriceLevel{Price: bid[0], Size: bid[1]})
+	}
+	for _, ask := range answer.OrderBook.Asks {
+		orderBook.Asks = append(orderBook.Asks, domain.PriceLevel{Price: ask[0], Size: ask[1]})
+	}
+
+	return &orderBook, nil
+}
+
+type historyAnswer struct {
+	History []struct {
+		TradeID uint64  `json:"trade_id"`
+		UID     string  `json:"uid"`
+		Side    string  `json:"side"`
+		Price   float64 `json:"price"`
+		Size    float64 `json:"size"`
+		Type    string  `json:"type"`
+		Time    string  `json:"time"`
+	} `json:"history"`
+}
+
+// Last public trades of the symbol, lastTime in RFC3339 limits them to the trades before it, empty for the latest trades
+func (httpClient *HTTPClient) GetHistory(symbol string, lastTime string) ([]domain.MarketTrade, error) {
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	if lastTime != "" {
+		params.Set("lastTime", lastTime)
+	}
+
+	var answer historyAnswer
+	if err := httpClient.sendRequest("GET", params.Encode(), "/api/v3/history", &answer); err != nil {
+		return nil, err
+	}
+
+	if answer.History == nil {
+		return nil, &MalformedResponseError{Endpoint: "history", Err: errors.New("history is missing")}
+	}
+
+	trades := make([]domain.MarketTrade, 0, len(answer.History))
+	for _, trade := range answer.History {
+		trades = append(trades, domain.MarketTrade{
+			TradeID: trade.TradeID,
+			UID:     trade.UID,
+			Symbol:  strings.ToUpper(symbol),
+			Side:    domain.OrderSide(trade.Side),
+			Price:   trade.Price,
+			Size:    trade.Size,
+			Type:    trade.Type,
+			Time:    trade.Time,
+		})
+	}
+
+	return trades, nil
+}
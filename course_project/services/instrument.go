@@ -1,24 +1,115 @@
 package services
 
-import "github.com/legendiguess/kraken-trade-bot/domain"
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
 
 type instrumentStorage interface {
 	SaveInstrument(newInstrument domain.InstrumentConfig)
-	GetInstrument() (domain.InstrumentConfig, bool)
+	DeleteInstrument(symbol string) bool
+	GetInstruments() []domain.InstrumentConfig
 }
 
+// InstrumentService keeps instruments in memory, so they can be checked on every ticker,
+// all changes are written to the storage. Symbols are upper case like in the exchange feeds
 type InstrumentService struct {
-	storage instrumentStorage
+	storage     instrumentStorage
+	mutex       sync.RWMutex
+	instruments map[string]domain.InstrumentConfig
 }
 
 func NewInstrumentService(storage instrumentStorage) *InstrumentService {
-	return &InstrumentService{storage: storage}
+	instrumentService := InstrumentService{storage: storage, instruments: make(map[string]domain.InstrumentConfig)}
+
+	for _, instrument := range storage.GetInstruments() {
+		// Instruments saved before the symbols were normalized are stored again
+		if symbol := strings.ToUpper(instrument.Symbol); symbol != instrument.Symbol {
+			storage.DeleteInstrument(instrument.Symbol)
+			instrument.Symbol = symbol
+			storage.SaveInstrument(instrument)
+		}
+		instrumentService.instruments[instrument.Symbol] = instrument
+	}
+
+	return &instrumentService
 }
 
-func (instrumentService InstrumentService) SaveInstrument(newInstrument domain.InstrumentConfig) {
+func (instrumentService *InstrumentService) SaveInstrument(newInstrument domain.InstrumentConfig) {
+	instrumentService.mutex.Lock()
+	defer instrumentService.mutex.Unlock()
+
+	newInstrument.Symbol = strings.ToUpper(newInstrument.Symbol)
 	instrumentService.storage.SaveInstrument(newInstrument)
+	instrumentService.instruments[newInstrument.Symbol] = newInstrument
+}
+
+func (instrumentService *InstrumentService) DeleteInstrument(symbol string) bool {
+	instrumentService.mutex.Lock()
+	defer instrumentService.mutex.Unlock()
+
+	symbol = strings.ToUpper(symbol)
+	delete(instrumentService.instruments, symbol)
+	return instrumentService.storage.DeleteInstrument(symbol)
+}
+
+func (instrumentService *InstrumentService) GetInstrument(symbol string) (domain.InstrumentConfig, bool) {
+	instrumentService.mutex.RLock()
+	defer instrumentService.mutex.RUnlock()
+
+	instrument, ok := instrumentService.instruments[strings.ToUpper(symbol)]
+	return instrument, ok
 }
 
-func (instrumentService InstrumentService) GetInstrument() (domain.InstrumentConfig, bool) {
-	return instrumentService.storage.GetInstrument()
+// Return instruments sorted by symbol
+func (instrumentService *InstrumentService) GetInstruments() []domain.InstrumentConfig {
+	instrumentService.mutex.RLock()
+	defer instrumentService.mutex.RUnlock()
+
+	instruments := make([]domain.InstrumentConfig, 0, len(instrumentService.instruments))
+	for _, instrument := range instrumentService.instruments {
+		instruments = append(instruments, instrument)
+	}
+	sort.Slice(instruments, func(i, j int) bool { return instruments[i].Symbol < instruments[j].Symbol })
+
+	return instruments
+}
+
+// Symbols of the instruments that are traded
+func (instrumentService *InstrumentService) GetEnabledSymbols() []string {
+	symbols := []string{}
+	for _, instrument := range instrumentService.GetInstruments() {
+		if instrument.Enabled {
+			symbols = append(symbols, instrument.Symbol)
+		}
+	}
+	return symbols
+}
+
+// Enable the instrument and disable all others, the instrument is added with default settings if it is unknown
+func (instrumentService *InstrumentService) SwitchInstrument(symbol string) domain.InstrumentConfig {
+	instrumentService.mutex.Lock()
+	defer instrumentService.mutex.Unlock()
+
+	symbol = strings.ToUpper(symbol)
+	for _, instrument := range instrumentService.instruments {
+		if instrument.Symbol != symbol && instrument.Enabled {
+			instrument.Enabled = false
+			instrumentService.storage.SaveInstrument(instrument)
+			instrumentService.instruments[instrument.Symbol] = instrument
+		}
+	}
+
+	instrument, ok := instrumentService.instruments[symbol]
+	if !ok {
+		instrument = domain.NewInstrumentConfig(symbol)
+	}
+	instrument.Enabled = true
+	instrumentService.storage.SaveInstrument(instrument)
+	instrumentService.instruments[symbol] = instrument
+
+	return instrument
 }
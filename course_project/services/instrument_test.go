@@ -9,25 +9,63 @@ import (
 )
 
 type instrumentStorageTest struct {
-	instrument domain.InstrumentConfig
+	instruments []domain.InstrumentConfig
 }
 
 func (instrumentStorageTest *instrumentStorageTest) SaveInstrument(newInstrument domain.InstrumentConfig) {
-	instrumentStorageTest.instrument = newInstrument
+	instrumentStorageTest.DeleteInstrument(newInstrument.Symbol)
+	instrumentStorageTest.instruments = append(instrumentStorageTest.instruments, newInstrument)
 }
 
-func (instrumentStorageTest *instrumentStorageTest) GetInstrument() (domain.InstrumentConfig, bool) {
-	return instrumentStorageTest.instrument, true
+func (instrumentStorageTest *instrumentStorageTest) DeleteInstrument(symbol string) bool {
+	for i, instrument := range instrumentStorageTest.instruments {
+		if instrument.Symbol == symbol {
+			instrumentStorageTest.instruments = append(instrumentStorageTest.instruments[:i], instrumentStorageTest.instruments[i+1:]...)
+			return true
+		}
+	}
+	return false
 }
 
-func TestInstrumentService(t *testing.T) {
-	instrumentService := services.NewInstrumentService(&instrumentStorageTest{})
+func (instrumentStorageTest *instrumentStorageTest) GetInstruments() []domain.InstrumentConfig {
+	return instrumentStorageTest.instruments
+}
 
-	testInstrument := domain.InstrumentConfig{Symbol: "test"}
-	instrumentService.SaveInstrument(testInstrument)
+func TestInstrumentService(t *testing.T) {
+	// Symbols are stored in upper case, including the ones stored in lower case before
+	storage := instrumentStorageTest{instruments: []domain.InstrumentConfig{domain.NewInstrumentConfig("stored")}}
+	instrumentService := services.NewInstrumentService(&storage)
+	assert.Equal(t, []domain.InstrumentConfig{domain.NewInstrumentConfig("STORED")}, storage.instruments)
 
-	instrument, ok := instrumentService.GetInstrument()
+	testInstrument := domain.InstrumentConfig{Symbol: "TEST", OrderSize: 2}
+	instrumentService.SaveInstrument(domain.InstrumentConfig{Symbol: "test", OrderSize: 2})
 
+	instrument, ok := instrumentService.GetInstrument("test")
 	assert.Equal(t, true, ok)
 	assert.Equal(t, testInstrument, instrument)
+	instrument, ok = instrumentService.GetInstrument("TEST")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, testInstrument, instrument)
+
+	assert.Equal(t, []domain.InstrumentConfig{domain.NewInstrumentConfig("STORED"), testInstrument}, instrumentService.GetInstruments())
+	assert.Equal(t, []string{"STORED"}, instrumentService.GetEnabledSymbols())
+
+	assert.True(t, instrumentService.DeleteInstrument("Stored"))
+	assert.False(t, instrumentService.DeleteInstrument("STORED"))
+
+	_, ok = instrumentService.GetInstrument("stored")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, []domain.InstrumentConfig{testInstrument}, storage.instruments)
+}
+
+func TestInstrumentServiceSwitch(t *testing.T) {
+	storage := instrumentStorageTest{instruments: []domain.InstrumentConfig{domain.NewInstrumentConfig("OLD"), {Symbol: "KNOWN", OrderSize: 3}}}
+	instrumentService := services.NewInstrumentService(&storage)
+
+	assert.Equal(t, domain.InstrumentConfig{Symbol: "KNOWN", OrderSize: 3, Enabled: true}, instrumentService.SwitchInstrument("known"))
+	assert.Equal(t, []string{"KNOWN"}, instrumentService.GetEnabledSymbols())
+
+	assert.Equal(t, domain.NewInstrumentConfig("NEW"), instrumentService.SwitchInstrument("new"))
+	assert.Equal(t, []string{"NEW"}, instrumentService.GetEnabledSymbols())
+	assert.Len(t, storage.instruments, 3)
 }
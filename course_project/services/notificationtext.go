@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Texts of the notifications in one language
+type notificationCatalog struct {
+	bought string
+	sold   string
+	// Side, symbol, size, price and time
+	order        string
+	orderSubject string
+
+	buy  string
+	sell string
+	// Side, size, symbol, reason and time
+	blockedOrder        string
+	blockedOrderSubject string
+
+	// Mismatches follow the title
+	reconciliation        string
+	reconciliationSubject string
+
+	// Error text follows the title
+	errorTitle   string
+	errorSubject string
+
+	// Realized, unrealized, fees and net profit
+	dailySummary        string
+	dailySummarySubject string
+}
+
+var notificationCatalogs = map[domain.Language]notificationCatalog{
+	domain.LanguageRussian: {
+		bought:                "Куплен ➕",
+		sold:                  "Продан ➖",
+		order:                 "%s %s %d по цене %s 💵\n%s ⏱",
+		orderSubject:          "Ордер %s",
+		buy:                   "Покупка",
+		sell:                  "Продажа",
+		blockedOrder:          "Ордер заблокирован ⛔\n%s %d %s: %s\n%s ⏱",
+		blockedOrderSubject:   "Ордер заблокирован %s",
+		reconciliation:        "Расхождения с биржей при запуске ⚠️",
+		reconciliationSubject: "Расхождения с биржей",
+		errorTitle:            "Ошибка ❗",
+		errorSubject:          "Ошибка торгового бота",
+		dailySummary:          "Итоги дня 📊\nРеализованная прибыль: %.2f\nНереализованная прибыль: %.2f\nКомиссии: %.2f\nИтого: %.2f",
+		dailySummarySubject:   "Итоги дня",
+	},
+	domain.LanguageEnglish: {
+		bought:                "Bought ➕",
+		sold:                  "Sold ➖",
+		order:                 "%s %s %d at %s 💵\n%s ⏱",
+		orderSubject:          "Order %s",
+		buy:                   "Buy",
+		sell:                  "Sell",
+		blockedOrder:          "Order blocked ⛔\n%s %d %s: %s\n%s ⏱",
+		blockedOrderSubject:   "Order blocked %s",
+		reconciliation:        "Mismatches with the exchange at the start ⚠️",
+		reconciliationSubject: "Mismatches with the exchange",
+		errorTitle:            "Error ❗",
+		errorSubject:          "Trade bot error",
+		dailySummary:          "Daily summary 📊\nRealized PnL: %.2f\nUnrealized PnL: %.2f\nFees: %.2f\nNet PnL: %.2f",
+		dailySummarySubject:   "Daily summary",
+	},
+}
+
+// Catalog of the user language, unknown languages get the default one
+func userCatalog(user domain.User) notificationCatalog {
+	if catalog, ok := notificationCatalogs[user.GetLanguage()]; ok {
+		return catalog
+	}
+	return notificationCatalogs[domain.DefaultLanguage]
+}
+
+// Short title of the notification, used as the email subject
+func notificationSubject(notification domain.Notification, user domain.User) string {
+	catalog := userCatalog(user)
+
+	switch notification.Kind {
+	case domain.NotificationKindOrder:
+		return fmt.Sprintf(catalog.orderSubject, strings.ToUpper(notification.OrderInfo.Symbol))
+	case domain.NotificationKindBlockedOrder:
+		return fmt.Sprintf(catalog.blockedOrderSubject, strings.ToUpper(notification.BlockedOrder.Symbol))
+	case domain.NotificationKindReconciliation:
+		return catalog.reconciliationSubject
+	case domain.NotificationKindError:
+		return catalog.errorSubject
+	case domain.NotificationKindDailySummary:
+		return catalog.dailySummarySubject
+	}
+	return string(notification.Kind)
+}
+
+// Text of the notification in the language and time zone of the user
+func notificationText(notification domain.Notification, user domain.User) string {
+	catalog := userCatalog(user)
+
+	switch notification.Kind {
+	case domain.NotificationKindOrder:
+		orderInfo := notification.OrderInfo
+
+		side := catalog.bought
+		if orderInfo.Side == domain.OrderSideSell {
+			side = catalog.sold
+		}
+		// Orders resting on the book have nothing filled yet
+		size := orderInfo.Amount
+		if size == 0 {
+			size = orderInfo.Quantity
+		}
+
+		return fmt.Sprintf(catalog.order, side, strings.ToUpper(orderInfo.Symbol), size, strconv.FormatFloat(orderInfo.Price, 'f', -1, 64), userTime(orderInfo.Timestamp, user))
+	case domain.NotificationKindBlockedOrder:
+		blockedOrder := notification.BlockedOrder
+
+		side := catalog.buy
+		if blockedOrder.Side == domain.OrderSideSell {
+			side = catalog.sell
+		}
+
+		return fmt.Sprintf(catalog.blockedOrder, side, blockedOrder.Size, strings.ToUpper(blockedOrder.Symbol), blockedOrder.Reason, userTime(blockedOrder.Timestamp, user))
+	case domain.NotificationKindReconciliation:
+		return catalog.reconciliation + "\n" + strings.Join(notification.Reconciliation.Mismatches, "\n")
+	case domain.NotificationKindError:
+		return catalog.errorTitle + "\n" + notification.Error
+	case domain.NotificationKindDailySummary:
+		summary := notification.Summary
+		return fmt.Sprintf(catalog.dailySummary, summary.RealizedPnL, summary.UnrealizedPnL, summary.Fees, summary.NetPnL)
+	}
+	return string(notification.Kind)
+}
+
+// Timestamp in the user time zone, timestamps which can't be parsed are shown as they are
+func userTime(timestamp string, user domain.User) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.In(user.GetLocation()).Format(time.RFC1123)
+}
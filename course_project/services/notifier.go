@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const (
+	outboxPollInterval = 100 * time.Millisecond
+	// Recipients served in one pass
+	outboxBatchSize = 100
+	// The channel of the recipient is parked after this number of failed attempts of one message
+	outboxMaxAttempts = 8
+	outboxMaxBackoff  = 5 * time.Minute
+
+	// Telegram allows one message per second to a chat and about thirty messages per second overall
+	telegramChatInterval = time.Second
+	telegramGlobalLimit  = 30
+)
+
+// Notifier delivers notifications to the subscribers through one channel
+type Notifier interface {
+	Channel() domain.NotificationChannel
+	Notify(user domain.User, notification domain.Notification) error
+}
+
+// RecipientBlockedError is returned by a notifier when the recipient can't get messages anymore, e.g. blocked the bot
+type RecipientBlockedError struct {
+	Reason string
+}
+
+func (recipientBlockedError *RecipientBlockedError) Error() string {
+	return "recipient is blocked: " + recipientBlockedError.Reason
+}
+
+// RetryAfterError is returned by a notifier when the channel asks to wait before the next message
+type RetryAfterError struct {
+	Delay time.Duration
+}
+
+func (retryAfterError *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %v", retryAfterError.Delay)
+}
+
+type outboxStorage interface {
+	NewOutboxMessage(message *domain.OutboxMessage)
+	// The oldest pending message of every chat in the channel if its next attempt is not after the time
+	GetDueOutboxHeads(channel domain.NotificationChannel, now string, limit int) []domain.OutboxMessage
+	SaveOutboxMessage(message *domain.OutboxMessage)
+	DeleteOutboxMessage(id uint)
+	ParkOutboxMessages(chatID int64, channel domain.NotificationChannel, reason string)
+}
+
+type notificationUsers interface {
+	GetUsers() []domain.User
+	GetUser(chatID int64) (domain.User, bool)
+	UpdateUser(user domain.User)
+	DeleteUser(chatID int64) bool
+}
+
+type notificationLogger interface {
+	Printf(format string, args ...interface{})
+}
+
+// NotificationDispatcher saves every notification to the outbox for the subscribers whose filters accept it,
+// one message for every channel they chose and which is not parked. Every channel has its own worker delivering
+// the messages with retries, so a slow webhook or mail server doesn't hold telegram back. Telegram messages follow
+// the telegram rate limits, undelivered messages survive restarts
+type NotificationDispatcher struct {
+	outbox    outboxStorage
+	users     notificationUsers
+	notifiers map[domain.NotificationChannel]Notifier
+	logger    notificationLogger
+
+	// Wake the workers up when messages are added, by channel
+	wakes   map[domain.NotificationChannel]chan struct{}
+	limiter *telegramRateLimiter
+	// Workers of different channels may park the channels of one user at the same time
+	usersMutex sync.Mutex
+}
+
+func NewNotificationDispatcher(ctx context.Context, outbox outboxStorage, users notificationUsers, logger notificationLogger, notifiers ...Notifier) *NotificationDispatcher {
+	notificationDispatcher := NotificationDispatcher{
+		outbox:    outbox,
+		users:     users,
+		notifiers: make(map[domain.NotificationChannel]Notifier),
+		logger:    logger,
+		wakes:     make(map[domain.NotificationChannel]chan struct{}),
+		limiter:   newTelegramRateLimiter(),
+	}
+
+	for _, notifier := range notifiers {
+		notificationDispatcher.notifiers[notifier.Channel()] = notifier
+	}
+
+	for channel, notifier := range notificationDispatcher.notifiers {
+		wake := make(chan struct{}, 1)
+		notificationDispatcher.wakes[channel] = wake
+		go notificationDispatcher.work(ctx, notifier, wake)
+	}
+
+	return &notificationDispatcher
+}
+
+func (notificationDispatcher *NotificationDispatcher) work(ctx context.Context, notifier Notifier, wake <-chan struct{}) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+		notificationDispatcher.deliver(notifier, time.Now())
+	}
+}
+
+// Messages are only saved here, so the caller is not blocked by the delivery
+func (notificationDispatcher *NotificationDispatcher) Dispatch(notification domain.Notification) {
+	notificationDispatcher.dispatch(notificationDispatcher.users.GetUsers(), notification)
+}
+
+// Notification for one subscriber, e.g. the summary of the day in the user time zone
+func (notificationDispatcher *NotificationDispatcher) DispatchTo(user domain.User, notification domain.Notification) {
+	notificationDispatcher.dispatch([]domain.User{user}, notification)
+}
+
+func (notificationDispatcher *NotificationDispatcher) dispatch(users []domain.User, notification domain.Notification) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		notificationDispatcher.logger.Printf("Can't encode %s notification: %v", notification.Kind, err)
+		return
+	}
+
+	now := time.Now()
+	created := now.UTC().Format(domain.OutboxTimeFormat)
+
+	for _, user := range users {
+		if !user.Wants(notification, now) {
+			continue
+		}
+
+		for _, channel := range user.GetChannels() {
+			if _, ok := notificationDispatcher.notifiers[channel]; !ok {
+				notificationDispatcher.logger.Printf("Can't notify chat %d: channel %s is not configured", user.ChatID, channel)
+				continue
+			}
+			if user.IsParked(channel) {
+				continue
+			}
+
+			notificationDispatcher.outbox.NewOutboxMessage(&domain.OutboxMessage{
+				ChatID:       user.ChatID,
+				Channel:      channel,
+				Notification: string(payload),
+				Status:       domain.OutboxStatusPending,
+				NextAttempt:  created,
+				Created:      created,
+			})
+		}
+	}
+
+	for _, wake := range notificationDispatcher.wakes {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Deliver the due messages of the notifier channel. Messages of a chat keep their order: only the oldest pending one is sent,
+// so while it waits for the retry or the rate limit the later ones wait too
+func (notificationDispatcher *NotificationDispatcher) deliver(notifier Notifier, now time.Time) {
+	for _, message := range notificationDispatcher.outbox.GetDueOutboxHeads(notifier.Channel(), now.UTC().Format(domain.OutboxTimeFormat), outboxBatchSize) {
+		message := message
+
+		user, ok := notificationDispatcher.users.GetUser(message.ChatID)
+		if !ok {
+			notificationDispatcher.park(&message, "chat is unsubscribed")
+			continue
+		}
+
+		var notification domain.Notification
+		if err := json.Unmarshal([]byte(message.Notification), &notification); err != nil {
+			notificationDispatcher.parkMessage(&message, fmt.Sprintf("can't decode notification: %v", err))
+			continue
+		}
+
+		if message.Channel == domain.NotificationChannelTelegram && !notificationDispatcher.limiter.allow(message.ChatID, now) {
+			continue
+		}
+
+		err := notifier.Notify(user, notification)
+		if err == nil {
+			notificationDispatcher.outbox.DeleteOutboxMessage(message.ID)
+			continue
+		}
+
+		notificationDispatcher.fail(&message, err, now)
+	}
+}
+
+// Blocked recipient is unsubscribed, flood control delays the message without counting the attempt,
+// other errors are retried with the exponential backoff. The channel of the user is parked after the last attempt
+func (notificationDispatcher *NotificationDispatcher) fail(message *domain.OutboxMessage, err error, now time.Time) {
+	var recipientBlockedError *RecipientBlockedError
+	if errors.As(err, &recipientBlockedError) {
+		if notificationDispatcher.users.DeleteUser(message.ChatID) {
+			notificationDispatcher.logger.Printf("Chat %d is unsubscribed: %v", message.ChatID, err)
+		}
+		notificationDispatcher.park(message, err.Error())
+		return
+	}
+
+	message.LastError = err.Error()
+
+	var retryAfterError *RetryAfterError
+	if errors.As(err, &retryAfterError) {
+		message.NextAttempt = now.Add(retryAfterError.Delay).UTC().Format(domain.OutboxTimeFormat)
+		notificationDispatcher.outbox.SaveOutboxMessage(message)
+		return
+	}
+
+	message.Attempts++
+	if message.Attempts >= outboxMaxAttempts {
+		notificationDispatcher.parkChannel(message.ChatID, message.Channel)
+		notificationDispatcher.park(message, err.Error())
+		return
+	}
+
+	backoff := time.Second << (message.Attempts - 1)
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	message.NextAttempt = now.Add(backoff).UTC().Format(domain.OutboxTimeFormat)
+	notificationDispatcher.outbox.SaveOutboxMessage(message)
+}
+
+// The user is read again, so the channels parked by the other workers are kept
+func (notificationDispatcher *NotificationDispatcher) parkChannel(chatID int64, channel domain.NotificationChannel) {
+	notificationDispatcher.usersMutex.Lock()
+	defer notificationDispatcher.usersMutex.Unlock()
+
+	if user, ok := notificationDispatcher.users.GetUser(chatID); ok {
+		user.ParkChannel(channel)
+		notificationDispatcher.users.UpdateUser(user)
+	}
+}
+
+// The message and all pending messages of its chat and channel are parked,
+// parked messages stay in the outbox and are not delivered anymore
+func (notificationDispatcher *NotificationDispatcher) park(message *domain.OutboxMessage, reason string) {
+	notificationDispatcher.logger.Printf("Parked %s messages to chat %d: %s", message.Channel, message.ChatID, reason)
+
+	notificationDispatcher.outbox.SaveOutboxMessage(message)
+	notificationDispatcher.outbox.ParkOutboxMessages(message.ChatID, message.Channel, reason)
+}
+
+// Only the message is parked, the later messages of the recipient are delivered
+func (notificationDispatcher *NotificationDispatcher) parkMessage(message *domain.OutboxMessage, reason string) {
+	notificationDispatcher.logger.Printf("Parked %s message %d to chat %d: %s", message.Channel, message.ID, message.ChatID, reason)
+
+	message.Status = domain.OutboxStatusParked
+	message.LastError = reason
+	notificationDispatcher.outbox.SaveOutboxMessage(message)
+}
+
+// Used only by the telegram worker goroutine
+type telegramRateLimiter struct {
+	// Time of the last message by chat
+	chats map[int64]time.Time
+	// Times of the messages sent during the last second
+	recent []time.Time
+}
+
+func newTelegramRateLimiter() *telegramRateLimiter {
+	return &telegramRateLimiter{chats: make(map[int64]time.Time)}
+}
+
+// The message is counted if it is allowed
+func (telegramRateLimiter *telegramRateLimiter) allow(chatID int64, now time.Time) bool {
+	recent := telegramRateLimiter.recent[:0]
+	for _, sentAt := range telegramRateLimiter.recent {
+		if now.Sub(sentAt) < time.Second {
+			recent = append(recent, sentAt)
+		}
+	}
+	telegramRateLimiter.recent = recent
+
+	for chat, sentAt := range telegramRateLimiter.chats {
+		if now.Sub(sentAt) >= telegramChatInterval {
+			delete(telegramRateLimiter.chats, chat)
+		}
+	}
+
+	if len(telegramRateLimiter.recent) >= telegramGlobalLimit {
+		return false
+	}
+	if _, ok := telegramRateLimiter.chats[chatID]; ok {
+		return false
+	}
+
+	telegramRateLimiter.recent = append(telegramRateLimiter.recent, now)
+	telegramRateLimiter.chats[chatID] = now
+	return true
+}
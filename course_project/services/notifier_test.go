@@ -0,0 +1,539 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/legendiguess/kraken-trade-bot/smtptest"
+	"github.com/stretchr/testify/assert"
+)
+
+type notificationUsersTest struct {
+	mutex sync.Mutex
+	users []domain.User
+}
+
+func (notificationUsersTest *notificationUsersTest) GetUsers() []domain.User {
+	notificationUsersTest.mutex.Lock()
+	defer notificationUsersTest.mutex.Unlock()
+
+	return append([]domain.User(nil), notificationUsersTest.users...)
+}
+
+func (notificationUsersTest *notificationUsersTest) GetUser(chatID int64) (domain.User, bool) {
+	for _, user := range notificationUsersTest.GetUsers() {
+		if user.ChatID == chatID {
+			return user, true
+		}
+	}
+	return domain.User{}, false
+}
+
+func (notificationUsersTest *notificationUsersTest) UpdateUser(updateUser domain.User) {
+	notificationUsersTest.mutex.Lock()
+	defer notificationUsersTest.mutex.Unlock()
+
+	for i, user := range notificationUsersTest.users {
+		if user.ChatID == updateUser.ChatID {
+			notificationUsersTest.users[i] = updateUser
+		}
+	}
+}
+
+func (notificationUsersTest *notificationUsersTest) DeleteUser(chatID int64) bool {
+	notificationUsersTest.mutex.Lock()
+	defer notificationUsersTest.mutex.Unlock()
+
+	for i, user := range notificationUsersTest.users {
+		if user.ChatID == chatID {
+			notificationUsersTest.users = append(notificationUsersTest.users[:i], notificationUsersTest.users[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type outboxStorageTest struct {
+	mutex    sync.Mutex
+	nextID   uint
+	messages []domain.OutboxMessage
+}
+
+func (outboxStorageTest *outboxStorageTest) NewOutboxMessage(message *domain.OutboxMessage) {
+	outboxStorageTest.mutex.Lock()
+	defer outboxStorageTest.mutex.Unlock()
+
+	outboxStorageTest.nextID++
+	message.ID = outboxStorageTest.nextID
+	outboxStorageTest.messages = append(outboxStorageTest.messages, *message)
+}
+
+func (outboxStorageTest *outboxStorageTest) GetDueOutboxHeads(channel domain.NotificationChannel, now string, limit int) []domain.OutboxMessage {
+	outboxStorageTest.mutex.Lock()
+	defer outboxStorageTest.mutex.Unlock()
+
+	type recipient struct {
+		chatID  int64
+		channel domain.NotificationChannel
+	}
+	seen := make(map[recipient]bool)
+
+	messages := []domain.OutboxMessage{}
+	for _, message := range outboxStorageTest.messages {
+		if message.Channel != channel || message.Status != domain.OutboxStatusPending || seen[recipient{message.ChatID, message.Channel}] {
+			continue
+		}
+		seen[recipient{message.ChatID, message.Channel}] = true
+
+		if message.NextAttempt <= now && len(messages) < limit {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func (outboxStorageTest *outboxStorageTest) ParkOutboxMessages(chatID int64, channel domain.NotificationChannel, reason string) {
+	outboxStorageTest.mutex.Lock()
+	defer outboxStorageTest.mutex.Unlock()
+
+	for i, message := range outboxStorageTest.messages {
+		if message.ChatID == chatID && message.Channel == channel && message.Status == domain.OutboxStatusPending {
+			outboxStorageTest.messages[i].Status = domain.OutboxStatusParked
+			outboxStorageTest.messages[i].LastError = reason
+		}
+	}
+}
+
+func (outboxStorageTest *outboxStorageTest) SaveOutboxMessage(saveMessage *domain.OutboxMessage) {
+	outboxStorageTest.mutex.Lock()
+	defer outboxStorageTest.mutex.Unlock()
+
+	for i, message := range outboxStorageTest.messages {
+		if message.ID == saveMessage.ID {
+			outboxStorageTest.messages[i] = *saveMessage
+		}
+	}
+}
+
+func (outboxStorageTest *outboxStorageTest) DeleteOutboxMessage(id uint) {
+	outboxStorageTest.mutex.Lock()
+	defer outboxStorageTest.mutex.Unlock()
+
+	for i, message := range outboxStorageTest.messages {
+		if message.ID == id {
+			outboxStorageTest.messages = append(outboxStorageTest.messages[:i], outboxStorageTest.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+func (outboxStorageTest *outboxStorageTest) getMessages() []domain.OutboxMessage {
+	outboxStorageTest.mutex.Lock()
+	defer outboxStorageTest.mutex.Unlock()
+
+	return append([]domain.OutboxMessage(nil), outboxStorageTest.messages...)
+}
+
+type notifierTest struct {
+	mutex   sync.Mutex
+	chatIDs []int64
+	// Errors returned by chat, nil means delivered
+	errs map[int64]error
+}
+
+func (notifierTest *notifierTest) Channel() domain.NotificationChannel {
+	return domain.NotificationChannelTelegram
+}
+
+func (notifierTest *notifierTest) Notify(user domain.User, notification domain.Notification) error {
+	notifierTest.mutex.Lock()
+	defer notifierTest.mutex.Unlock()
+
+	notifierTest.chatIDs = append(notifierTest.chatIDs, user.ChatID)
+	return notifierTest.errs[user.ChatID]
+}
+
+func (notifierTest *notifierTest) getChatIDs() []int64 {
+	notifierTest.mutex.Lock()
+	defer notifierTest.mutex.Unlock()
+
+	return append([]int64(nil), notifierTest.chatIDs...)
+}
+
+// Webhook notifier which answers only when it is released
+type slowNotifierTest struct {
+	release chan struct{}
+}
+
+func (slowNotifierTest *slowNotifierTest) Channel() domain.NotificationChannel {
+	return domain.NotificationChannelWebhook
+}
+
+func (slowNotifierTest *slowNotifierTest) Notify(user domain.User, notification domain.Notification) error {
+	<-slowNotifierTest.release
+	return nil
+}
+
+// Collects the requests of the webhook
+type webhookTest struct {
+	mutex    sync.Mutex
+	server   *httptest.Server
+	requests []map[string]interface{}
+}
+
+func newWebhookTest(t *testing.T) *webhookTest {
+	webhook := webhookTest{}
+	webhook.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+
+		webhook.mutex.Lock()
+		webhook.requests = append(webhook.requests, request)
+		webhook.mutex.Unlock()
+	}))
+	return &webhook
+}
+
+func (webhookTest *webhookTest) getRequests() []map[string]interface{} {
+	webhookTest.mutex.Lock()
+	defer webhookTest.mutex.Unlock()
+
+	return append([]map[string]interface{}(nil), webhookTest.requests...)
+}
+
+// Texts of the last requests by chat
+func (webhookTest *webhookTest) getTexts() map[int64]string {
+	texts := make(map[int64]string)
+	for _, request := range webhookTest.getRequests() {
+		texts[int64(request["chat_id"].(float64))] = request["text"].(string)
+	}
+	return texts
+}
+
+type emailCredentialsTest struct {
+	address string
+}
+
+func (emailCredentialsTest *emailCredentialsTest) GetSMTPAddress() string {
+	return emailCredentialsTest.address
+}
+
+func (emailCredentialsTest *emailCredentialsTest) GetSMTPFrom() string {
+	return "bot@example.com"
+}
+
+func (emailCredentialsTest *emailCredentialsTest) GetSMTPUsername() string {
+	return "bot"
+}
+
+func (emailCredentialsTest *emailCredentialsTest) GetSMTPPassword() string {
+	return "password"
+}
+
+func TestNotificationDispatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	webhook := newWebhookTest(t)
+	defer webhook.server.Close()
+
+	mailServer := smtptest.NewServer()
+	defer mailServer.Close()
+
+	users := notificationUsersTest{users: []domain.User{
+		{ChatID: 1},
+		{ChatID: 2, Channels: "webhook,email", Email: "trader@example.com", WebhookURL: webhook.server.URL},
+		// Failed channel doesn't stop the others
+		{ChatID: 3, Channels: "email,telegram"},
+	}}
+	outbox := outboxStorageTest{}
+	telegram := notifierTest{}
+
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outbox, &users, &loggerTest{}, &telegram, services.NewWebhookNotifier(true), services.NewEmailNotifier(&emailCredentialsTest{address: mailServer.Address()}))
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &domain.OrderInfo{
+		Symbol:    "pi_xbtusd",
+		Side:      domain.OrderSideBuy,
+		Price:     59010,
+		Timestamp: "2021-12-01T10:00:00Z",
+	}})
+
+	assert.Eventually(t, func() bool { return len(outbox.getMessages()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []int64{1, 3}, telegram.getChatIDs())
+
+	webhookRequests := webhook.getRequests()
+	if assert.Len(t, webhookRequests, 1) {
+		assert.Equal(t, "order", webhookRequests[0]["kind"])
+		assert.Equal(t, 2.0, webhookRequests[0]["chat_id"])
+		assert.Equal(t, 59010.0, webhookRequests[0]["order_info"].(map[string]interface{})["price"])
+		assert.Contains(t, webhookRequests[0]["text"], "59010")
+	}
+
+	messages := mailServer.Messages()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "bot@example.com", messages[0].From)
+		assert.Equal(t, []string{"trader@example.com"}, messages[0].To)
+		assert.Equal(t, "bot", messages[0].Username)
+		assert.Contains(t, messages[0].Data, "To: trader@example.com")
+		assert.Contains(t, messages[0].Data, "59010")
+	}
+
+	// Email of the chat without the address is retried later
+	failed := outbox.getMessages()[0]
+	assert.Equal(t, int64(3), failed.ChatID)
+	assert.Equal(t, domain.NotificationChannelEmail, failed.Channel)
+	assert.Equal(t, domain.OutboxStatusPending, failed.Status)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "email is not set", failed.LastError)
+}
+
+func TestWebhookNotifierStatus(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer webhook.Close()
+
+	webhookNotifier := services.NewWebhookNotifier(true)
+	notification := domain.Notification{Kind: domain.NotificationKindReconciliation, Reconciliation: &domain.Reconciliation{Mismatches: []string{"test"}}}
+
+	assert.NotNil(t, webhookNotifier.Notify(domain.User{ChatID: 1, WebhookURL: webhook.URL}, notification))
+	assert.NotNil(t, webhookNotifier.Notify(domain.User{ChatID: 1}, notification))
+}
+
+func TestWebhookNotifierInternalAddresses(t *testing.T) {
+	webhook := newWebhookTest(t)
+	defer webhook.server.Close()
+
+	webhookNotifier := services.NewWebhookNotifier(false)
+	notification := domain.Notification{Kind: domain.NotificationKindReconciliation, Reconciliation: &domain.Reconciliation{Mismatches: []string{"test"}}}
+
+	_, port, _ := net.SplitHostPort(webhook.server.Listener.Addr().String())
+	for _, host := range []string{"127.0.0.1", "localhost", "10.0.0.1", "192.168.1.1", "169.254.169.254", "[::1]", "0.0.0.0"} {
+		assert.NotNil(t, webhookNotifier.Notify(domain.User{ChatID: 1, WebhookURL: "http://" + host + ":" + port}, notification), host)
+	}
+	assert.Empty(t, webhook.getRequests())
+}
+
+func TestNotificationDispatcherErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := notificationUsersTest{users: []domain.User{{ChatID: 1}, {ChatID: 2}, {ChatID: 3}, {ChatID: 4}, {ChatID: 5, Channels: "webhook"}}}
+	telegram := notifierTest{errs: map[int64]error{
+		1: errors.New("unavailable"),
+		2: errors.New("unavailable"),
+		3: &services.RecipientBlockedError{Reason: "blocked"},
+		4: &services.RetryAfterError{Delay: time.Minute},
+	}}
+	// Last attempt of the chat 2 and a message to the chat which is already unsubscribed
+	outbox := outboxStorageTest{}
+	outbox.NewOutboxMessage(&domain.OutboxMessage{ChatID: 2, Channel: domain.NotificationChannelTelegram, Notification: `{"kind":"error"}`, Status: domain.OutboxStatusPending, Attempts: 7})
+	outbox.NewOutboxMessage(&domain.OutboxMessage{ChatID: 6, Channel: domain.NotificationChannelTelegram, Notification: `{"kind":"error"}`, Status: domain.OutboxStatusPending})
+
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outbox, &users, &loggerTest{}, &telegram)
+	start := time.Now().UTC().Format(domain.OutboxTimeFormat)
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "test"})
+
+	// Chat 5 has no configured channel, so it gets no message
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 4 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{2, 1, 3, 4}, telegram.getChatIDs())
+
+	messages := outbox.getMessages()
+	if assert.Len(t, messages, 6) {
+		assert.Equal(t, domain.OutboxStatusParked, messages[0].Status)
+		assert.Equal(t, 8, messages[0].Attempts)
+		assert.Equal(t, "unavailable", messages[0].LastError)
+
+		assert.Equal(t, domain.OutboxStatusParked, messages[1].Status)
+		assert.Equal(t, "chat is unsubscribed", messages[1].LastError)
+
+		assert.Equal(t, domain.OutboxStatusPending, messages[2].Status)
+		assert.Equal(t, 1, messages[2].Attempts)
+		assert.Greater(t, messages[2].NextAttempt, start)
+
+		// The channel of the chat 2 is parked after the last attempt with all its messages
+		assert.Equal(t, domain.OutboxStatusParked, messages[3].Status)
+		assert.Equal(t, int64(2), messages[3].ChatID)
+		assert.Equal(t, "unavailable", messages[3].LastError)
+
+		assert.Equal(t, domain.OutboxStatusParked, messages[4].Status)
+		assert.Equal(t, "recipient is blocked: blocked", messages[4].LastError)
+
+		assert.Equal(t, domain.OutboxStatusPending, messages[5].Status)
+		assert.Equal(t, 0, messages[5].Attempts)
+		assert.Greater(t, messages[5].NextAttempt, time.Now().Add(50*time.Second).UTC().Format(domain.OutboxTimeFormat))
+	}
+
+	// Blocked chat is unsubscribed
+	_, ok := users.GetUser(3)
+	assert.Equal(t, false, ok)
+
+	// Nothing is saved for the parked channel anymore
+	user, _ := users.GetUser(2)
+	assert.Equal(t, true, user.IsParked(domain.NotificationChannelTelegram))
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "test"})
+	for _, message := range outbox.getMessages()[6:] {
+		assert.NotEqual(t, int64(2), message.ChatID)
+	}
+}
+
+func TestNotificationDispatcherOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := notificationUsersTest{users: []domain.User{{ChatID: 1}, {ChatID: 2}}}
+	telegram := notifierTest{}
+	outbox := outboxStorageTest{}
+	// The first message of the chat 1 waits for the retry, many messages of the chat 2 wait for the rate limit
+	outbox.NewOutboxMessage(&domain.OutboxMessage{ChatID: 1, Channel: domain.NotificationChannelTelegram, Notification: `{"kind":"error","error":"first"}`,
+		Status: domain.OutboxStatusPending, Attempts: 1, NextAttempt: time.Now().Add(700 * time.Millisecond).UTC().Format(domain.OutboxTimeFormat)})
+	for i := 0; i < 150; i++ {
+		outbox.NewOutboxMessage(&domain.OutboxMessage{ChatID: 2, Channel: domain.NotificationChannelTelegram, Notification: `{"kind":"error"}`, Status: domain.OutboxStatusPending})
+	}
+
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outbox, &users, &loggerTest{}, &telegram)
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "second"})
+
+	// The later message of the chat 1 is not sent before the retried one, the chat 2 doesn't hold the chat 1 back
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 3 }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{2, 1, 2}, telegram.getChatIDs())
+
+	// Only the later message is left for the chat 1
+	left := []domain.OutboxMessage{}
+	for _, message := range outbox.getMessages() {
+		if message.ChatID == 1 {
+			left = append(left, message)
+		}
+	}
+	if assert.Len(t, left, 1) {
+		assert.Contains(t, left[0].Notification, "second")
+	}
+}
+
+func TestNotificationDispatcherSlowChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := notificationUsersTest{users: []domain.User{{ChatID: 1, Channels: "webhook,telegram"}, {ChatID: 2}}}
+	outbox := outboxStorageTest{}
+	telegram := notifierTest{}
+	webhook := slowNotifierTest{release: make(chan struct{})}
+
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outbox, &users, &loggerTest{}, &webhook, &telegram)
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "test"})
+
+	// Telegram doesn't wait for the webhook
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, outbox.getMessages(), 1)
+
+	close(webhook.release)
+	assert.Eventually(t, func() bool { return len(outbox.getMessages()) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestNotificationDispatcherRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := notificationUsersTest{users: []domain.User{{ChatID: 1}}}
+	outbox := outboxStorageTest{}
+	telegram := notifierTest{}
+
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outbox, &users, &loggerTest{}, &telegram)
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "first"})
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "second"})
+	users.users = append(users.users, domain.User{ChatID: 2})
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: "third"})
+
+	// The second message to the chat 1 waits for a second, other chats are not delayed
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{1, 2}, telegram.getChatIDs())
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, 2, len(telegram.getChatIDs()))
+
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 4 }, 3*time.Second, 10*time.Millisecond)
+	assert.Empty(t, outbox.getMessages())
+}
+
+func TestNotificationLanguage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	webhook := newWebhookTest(t)
+	defer webhook.server.Close()
+
+	users := notificationUsersTest{users: []domain.User{
+		{ChatID: 1, Channels: "webhook", WebhookURL: webhook.server.URL},
+		{ChatID: 2, Channels: "webhook", WebhookURL: webhook.server.URL, Language: domain.LanguageEnglish, Timezone: "Asia/Tokyo"},
+		// Unknown settings fall back to Russian and UTC
+		{ChatID: 3, Channels: "webhook", WebhookURL: webhook.server.URL, Language: "de", Timezone: "Mars/Base"},
+	}}
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outboxStorageTest{}, &users, &loggerTest{}, services.NewWebhookNotifier(true))
+
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &domain.OrderInfo{
+		Symbol:    "pi",
+		Side:      domain.OrderSideSell,
+		Amount:    2,
+		Price:     59010.5,
+		Timestamp: "2021-12-01T10:00:00.000Z",
+	}})
+	assert.Eventually(t, func() bool { return len(webhook.getRequests()) == 3 }, time.Second, 10*time.Millisecond)
+	texts := webhook.getTexts()
+	assert.Equal(t, "Продан ➖ PI 2 по цене 59010.5 💵\nWed, 01 Dec 2021 13:00:00 MSK ⏱", texts[1])
+	assert.Equal(t, "Sold ➖ PI 2 at 59010.5 💵\nWed, 01 Dec 2021 19:00:00 JST ⏱", texts[2])
+	assert.Equal(t, "Продан ➖ PI 2 по цене 59010.5 💵\nWed, 01 Dec 2021 10:00:00 UTC ⏱", texts[3])
+
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindBlockedOrder, BlockedOrder: &domain.BlockedOrder{
+		Symbol:    "pi_xbtusd",
+		Side:      domain.OrderSideBuy,
+		Size:      3,
+		Reason:    "limit",
+		Timestamp: "wrong",
+	}})
+	assert.Eventually(t, func() bool { return len(webhook.getRequests()) == 6 }, time.Second, 10*time.Millisecond)
+	texts = webhook.getTexts()
+	assert.Equal(t, "Ордер заблокирован ⛔\nПокупка 3 PI_XBTUSD: limit\nwrong ⏱", texts[1])
+	assert.Equal(t, "Order blocked ⛔\nBuy 3 PI_XBTUSD: limit\nwrong ⏱", texts[2])
+
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindReconciliation, Reconciliation: &domain.Reconciliation{Mismatches: []string{"a", "b"}}})
+	assert.Eventually(t, func() bool { return len(webhook.getRequests()) == 9 }, time.Second, 10*time.Millisecond)
+	texts = webhook.getTexts()
+	assert.Equal(t, "Расхождения с биржей при запуске ⚠️\na\nb", texts[1])
+	assert.Equal(t, "Mismatches with the exchange at the start ⚠️\na\nb", texts[2])
+}
+
+func TestNotificationDispatcherFilters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := notificationUsersTest{users: []domain.User{{ChatID: 1, Categories: "risk"}, {ChatID: 2, Instruments: "PI_XBTUSD"}, {ChatID: 3}}}
+	outbox := outboxStorageTest{}
+	telegram := notifierTest{}
+
+	notificationDispatcher := services.NewNotificationDispatcher(ctx, &outbox, &users, &loggerTest{}, &telegram)
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &domain.OrderInfo{Symbol: "PI_ETHUSD", Side: domain.OrderSideBuy}})
+	notificationDispatcher.Dispatch(domain.Notification{Kind: domain.NotificationKindDailySummary, Summary: &domain.PnLReport{}})
+
+	messages := outbox.getMessages()
+	chatIDs := []int64{}
+	for _, message := range messages {
+		chatIDs = append(chatIDs, message.ChatID)
+	}
+	// Messages may be already delivered and deleted
+	assert.Subset(t, []int64{3, 2, 3}, chatIDs)
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 3 }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{3, 2, 3}, telegram.getChatIDs())
+
+	// Only the given subscriber gets the notification, if the filters accept it
+	notificationDispatcher.DispatchTo(domain.User{ChatID: 2}, domain.Notification{Kind: domain.NotificationKindDailySummary, Summary: &domain.PnLReport{}})
+	notificationDispatcher.DispatchTo(domain.User{ChatID: 1, Categories: "risk"}, domain.Notification{Kind: domain.NotificationKindDailySummary, Summary: &domain.PnLReport{}})
+	assert.Eventually(t, func() bool { return len(telegram.getChatIDs()) == 4 }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{3, 2, 3, 2}, telegram.getChatIDs())
+}
@@ -1,11 +1,19 @@
 package services
 
 import (
+	"strconv"
+
 	"github.com/legendiguess/kraken-trade-bot/domain"
 )
 
 type orderInfosStorage interface {
 	NewOrderInfo(orderInfo *domain.OrderInfo)
+	NewBlockedOrder(blockedOrder *domain.BlockedOrder)
+	HasOrder(orderID string) bool
+	HasExecution(executionID string) bool
+	SetOrderStatus(orderID string, status domain.OrderStatus)
+	GetOrderInfos() []domain.OrderInfo
+	FindOrderInfos(filter domain.OrderFilter) []domain.OrderInfo
 }
 
 type OrderInfosService struct {
@@ -19,3 +27,44 @@ func NewOrderInfosService(orderInfosStorage orderInfosStorage) *OrderInfosServic
 func (orderInfosService *OrderInfosService) NewOrderInfo(orderInfo *domain.OrderInfo) {
 	orderInfosService.storage.NewOrderInfo(orderInfo)
 }
+
+func (orderInfosService *OrderInfosService) NewBlockedOrder(blockedOrder *domain.BlockedOrder) {
+	orderInfosService.storage.NewBlockedOrder(blockedOrder)
+}
+
+func (orderInfosService *OrderInfosService) HasOrder(orderID string) bool {
+	return orderInfosService.storage.HasOrder(orderID)
+}
+
+func (orderInfosService *OrderInfosService) HasExecution(executionID string) bool {
+	return orderInfosService.storage.HasExecution(executionID)
+}
+
+// Status of the placed order is changed when it is executed or cancelled
+func (orderInfosService *OrderInfosService) SetOrderStatus(orderID string, status domain.OrderStatus) {
+	orderInfosService.storage.SetOrderStatus(orderID, status)
+}
+
+func (orderInfosService *OrderInfosService) GetOrderInfos() []domain.OrderInfo {
+	return orderInfosService.storage.GetOrderInfos()
+}
+
+// Page of the orders matching the filter, all orders without a limit.
+// One more order is requested to know if there is the next page
+func (orderInfosService *OrderInfosService) GetOrderPage(filter domain.OrderFilter) domain.OrderPage {
+	limit := filter.Limit
+	if limit > 0 {
+		filter.Limit++
+	}
+
+	page := domain.OrderPage{Orders: orderInfosService.storage.FindOrderInfos(filter)}
+	if limit > 0 && len(page.Orders) > limit {
+		page.Orders = page.Orders[:limit]
+		page.NextCursor = strconv.FormatUint(uint64(page.Orders[limit-1].ID), 10)
+	}
+	if page.Orders == nil {
+		page.Orders = []domain.OrderInfo{}
+	}
+
+	return page
+}
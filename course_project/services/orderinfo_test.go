@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type orderInfosStorageTest struct {
+	// From the newest one
+	orderInfos []domain.OrderInfo
+}
+
+func (orderInfosStorageTest *orderInfosStorageTest) NewOrderInfo(orderInfo *domain.OrderInfo) {}
+
+func (orderInfosStorageTest *orderInfosStorageTest) NewBlockedOrder(blockedOrder *domain.BlockedOrder) {
+}
+
+func (orderInfosStorageTest *orderInfosStorageTest) HasOrder(orderID string) bool {
+	return false
+}
+
+func (orderInfosStorageTest *orderInfosStorageTest) HasExecution(executionID string) bool {
+	return false
+}
+
+func (orderInfosStorageTest *orderInfosStorageTest) SetOrderStatus(orderID string, status domain.OrderStatus) {
+}
+
+func (orderInfosStorageTest *orderInfosStorageTest) GetOrderInfos() []domain.OrderInfo {
+	return orderInfosStorageTest.orderInfos
+}
+
+func (orderInfosStorageTest *orderInfosStorageTest) FindOrderInfos(filter domain.OrderFilter) []domain.OrderInfo {
+	orderInfos := []domain.OrderInfo{}
+	for _, orderInfo := range orderInfosStorageTest.orderInfos {
+		if filter.Cursor != 0 && orderInfo.ID >= filter.Cursor {
+			continue
+		}
+		if filter.Limit > 0 && len(orderInfos) == filter.Limit {
+			break
+		}
+		orderInfos = append(orderInfos, orderInfo)
+	}
+	return orderInfos
+}
+
+func TestOrderInfosServiceGetOrderPage(t *testing.T) {
+	storage := orderInfosStorageTest{orderInfos: []domain.OrderInfo{{ID: 5}, {ID: 4}, {ID: 2}, {ID: 1}}}
+	orderInfosService := services.NewOrderInfosService(&storage)
+
+	page := orderInfosService.GetOrderPage(domain.OrderFilter{Limit: 2})
+	assert.Equal(t, domain.OrderPage{Orders: []domain.OrderInfo{{ID: 5}, {ID: 4}}, NextCursor: "4"}, page)
+
+	page = orderInfosService.GetOrderPage(domain.OrderFilter{Limit: 2, Cursor: 4})
+	assert.Equal(t, domain.OrderPage{Orders: []domain.OrderInfo{{ID: 2}, {ID: 1}}}, page)
+
+	page = orderInfosService.GetOrderPage(domain.OrderFilter{Limit: 2, Cursor: 1})
+	assert.Equal(t, domain.OrderPage{Orders: []domain.OrderInfo{}}, page)
+}
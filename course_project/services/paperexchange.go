@@ -0,0 +1,327 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const (
+	PaperExchangeInitialBalance = 10000.0
+	PaperExchangeFeeRate        = 0.0005
+
+	paperExchangeAccountEventsBuffer = 100
+)
+
+// PaperExchange fills orders by the bid or ask of the last ticker, limit and stop orders
+// rest until a ticker crosses their price, positions and balance are kept in memory.
+// Fills of the resting orders are published as account events like the exchange feeds do
+type PaperExchange struct {
+	mutex         sync.Mutex
+	feeRate       float64
+	balance       float64
+	tickers       map[string]domain.Ticker
+	positions     map[string]*domain.Position
+	openOrders    []paperOrder
+	accountEvents chan domain.AccountEvent
+}
+
+type paperOrder struct {
+	orderID   string
+	request   domain.OrderRequest
+	timestamp string
+}
+
+// Fee rate is a part of the order notional paid on every fill, e.g. 0.0005
+func NewPaperExchange(initialBalance float64, feeRate float64) *PaperExchange {
+	return &PaperExchange{
+		feeRate:   feeRate,
+		balance:   initialBalance,
+		tickers:   make(map[string]domain.Ticker),
+		positions: make(map[string]*domain.Position),
+		// Events are published by the ticker updates, so the buffer lets the reader send orders meanwhile
+		accountEvents: make(chan domain.AccountEvent, paperExchangeAccountEventsBuffer),
+	}
+}
+
+func (paperExchange *PaperExchange) GetAccountEventChannel() <-chan domain.AccountEvent {
+	return paperExchange.accountEvents
+}
+
+// Ticker sets the market price for the next orders and fills crossed open orders
+func (paperExchange *PaperExchange) UpdateTicker(ticker domain.Ticker) {
+	// Events are sent after the mutex is released, the reader may be sending an order
+	for _, accountEvent := range paperExchange.fillOpenOrders(ticker) {
+		paperExchange.accountEvents <- accountEvent
+	}
+}
+
+func (paperExchange *PaperExchange) fillOpenOrders(ticker domain.Ticker) []domain.AccountEvent {
+	paperExchange.mutex.Lock()
+	defer paperExchange.mutex.Unlock()
+
+	paperExchange.tickers[ticker.Symbol] = ticker
+
+	accountEvents := []domain.AccountEvent{}
+
+	openOrders := []paperOrder{}
+	for _, order := range paperExchange.openOrders {
+		if order.request.Symbol != ticker.Symbol {
+			openOrders = append(openOrders, order)
+			continue
+		}
+
+		price, ok := paperExchange.triggeredPrice(order.request, ticker)
+		if !ok {
+			openOrders = append(openOrders, order)
+			continue
+		}
+
+		// Orders which can't be filled anymore are cancelled
+		orderInfo, err := paperExchange.fill(order.orderID, order.request, price)
+		if err != nil {
+			continue
+		}
+
+		fill := domain.Fill{
+			FillID:        orderInfo.ExecutionID,
+			OrderID:       orderInfo.OrderID,
+			ClientOrderID: orderInfo.ClientOrderID,
+			Symbol:        orderInfo.Symbol,
+			Side:          orderInfo.Side,
+			Price:         orderInfo.Price,
+			Quantity:      float64(orderInfo.Amount),
+			Fee:           orderInfo.Fee,
+			Timestamp:     orderInfo.Timestamp,
+		}
+		accountEvents = append(accountEvents,
+			domain.AccountEvent{Type: domain.AccountEventFills, Fills: []domain.Fill{fill}},
+			domain.AccountEvent{Type: domain.AccountEventOrderClosed, OrderID: orderInfo.OrderID, ClientOrderID: orderInfo.ClientOrderID, Reason: domain.OrderClosedFullFill},
+		)
+	}
+	paperExchange.openOrders = openOrders
+
+	return accountEvents
+}
+
+// Market order of the given size
+func (paperExchange *PaperExchange) Order(ticker string, side domain.OrderSide, size uint64) (*domain.OrderInfo, error) {
+	return paperExchange.SendOrder(domain.NewMarketOrderRequest(ticker, side, size))
+}
+
+func (paperExchange *PaperExchange) SendOrder(orderRequest domain.OrderRequest) (*domain.OrderInfo, error) {
+	if err := orderRequest.Validate(); err != nil {
+		return nil, err
+	}
+
+	paperExchange.mutex.Lock()
+	defer paperExchange.mutex.Unlock()
+
+	lastTicker, ok := paperExchange.tickers[orderRequest.Symbol]
+	if !ok {
+		return nil, fmt.Errorf("no market data for %s", orderRequest.Symbol)
+	}
+
+	marketPrice := lastTicker.Ask
+	if orderRequest.Side == domain.OrderSideSell {
+		marketPrice = lastTicker.Bid
+	}
+	if marketPrice <= 0 {
+		return nil, errors.New("no liquidity")
+	}
+
+	orderID := newPaperID()
+
+	switch orderRequest.OrderType {
+	case domain.OrderTypeMarket:
+		return paperExchange.fill(orderID, orderRequest, marketPrice)
+	case domain.OrderTypeIOC, domain.OrderTypeLimit, domain.OrderTypePost:
+		if isMarketable(orderRequest.Side, orderRequest.LimitPrice, marketPrice) {
+			if orderRequest.OrderType == domain.OrderTypePost {
+				return nil, errors.New("post only order would be executed immediately")
+			}
+			return paperExchange.fill(orderID, orderRequest, marketPrice)
+		}
+		if orderRequest.OrderType == domain.OrderTypeIOC {
+			return nil, errors.New("ioc order is cancelled, limit price is not reached")
+		}
+	}
+
+	order := paperOrder{orderID: orderID, request: orderRequest, timestamp: paperExchange.timestamp(lastTicker)}
+	paperExchange.openOrders = append(paperExchange.openOrders, order)
+
+	return paperExchange.orderInfo(order.orderID, orderRequest, order.timestamp), nil
+}
+
+func (paperExchange *PaperExchange) CancelOrder(orderID string) error {
+	paperExchange.mutex.Lock()
+	defer paperExchange.mutex.Unlock()
+
+	for i, order := range paperExchange.openOrders {
+		if order.orderID == orderID {
+			paperExchange.openOrders = append(paperExchange.openOrders[:i], paperExchange.openOrders[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("order %s is not found", orderID)
+}
+
+func (paperExchange *PaperExchange) GetOpenOrders() []domain.OrderInfo {
+	paperExchange.mutex.Lock()
+	defer paperExchange.mutex.Unlock()
+
+	openOrders := make([]domain.OrderInfo, 0, len(paperExchange.openOrders))
+	for _, order := range paperExchange.openOrders {
+		openOrders = append(openOrders, *paperExchange.orderInfo(order.orderID, order.request, order.timestamp))
+	}
+
+	return openOrders
+}
+
+// Fill price of the open order if the ticker crosses it, must be called with locked mutex
+func (paperExchange *PaperExchange) triggeredPrice(orderRequest domain.OrderRequest, ticker domain.Ticker) (float64, bool) {
+	marketPrice := ticker.Ask
+	if orderRequest.Side == domain.OrderSideSell {
+		marketPrice = ticker.Bid
+	}
+	if marketPrice <= 0 {
+		return 0, false
+	}
+
+	switch orderRequest.OrderType {
+	case domain.OrderTypeLimit, domain.OrderTypePost:
+		return orderRequest.LimitPrice, isMarketable(orderRequest.Side, orderRequest.LimitPrice, marketPrice)
+	case domain.OrderTypeStop, domain.OrderTypeTakeProfit:
+		// Stop buys when the price rises to the stop price, take profit buys when it falls to it
+		rising := orderRequest.Side == domain.OrderSideBuy
+		if orderRequest.OrderType == domain.OrderTypeTakeProfit {
+			rising = !rising
+		}
+		triggered := (rising && marketPrice >= orderRequest.StopPrice) || (!rising && marketPrice <= orderRequest.StopPrice)
+		if !triggered {
+			return 0, false
+		}
+		if orderRequest.LimitPrice != 0 && !isMarketable(orderRequest.Side, orderRequest.LimitPrice, marketPrice) {
+			return 0, false
+		}
+		return marketPrice, true
+	}
+
+	return 0, false
+}
+
+// Execute the order by the price, must be called with locked mutex
+func (paperExchange *PaperExchange) fill(orderID string, orderRequest domain.OrderRequest, price float64) (*domain.OrderInfo, error) {
+	position, ok := paperExchange.positions[orderRequest.Symbol]
+	if !ok {
+		position = &domain.Position{Symbol: orderRequest.Symbol}
+		paperExchange.positions[orderRequest.Symbol] = position
+	}
+
+	quantity := float64(orderRequest.Size)
+	if orderRequest.ReduceOnly {
+		reducible := position.Quantity
+		if orderRequest.Side == domain.OrderSideBuy {
+			reducible = -position.Quantity
+		}
+		if reducible <= 0 {
+			return nil, errors.New("reduce only order would not reduce the position")
+		}
+		if quantity > reducible {
+			quantity = reducible
+		}
+	}
+
+	fee := price * quantity * paperExchange.feeRate
+	if orderRequest.Side == domain.OrderSideBuy && paperExchange.balance < price*quantity+fee {
+		return nil, errors.New("insufficient funds")
+	}
+
+	position.Fill(orderRequest.Side, quantity, price)
+
+	if orderRequest.Side == domain.OrderSideBuy {
+		paperExchange.balance -= price*quantity + fee
+	} else {
+		paperExchange.balance += price*quantity - fee
+	}
+
+	orderInfo := paperExchange.orderInfo(orderID, orderRequest, paperExchange.timestamp(paperExchange.tickers[orderRequest.Symbol]))
+	orderInfo.ExecutionID = newPaperID()
+	orderInfo.Status = domain.OrderStatusFilled
+	orderInfo.Price = price
+	orderInfo.Amount = uint64(quantity)
+	orderInfo.Fee = fee
+
+	return orderInfo, nil
+}
+
+func (paperExchange *PaperExchange) orderInfo(orderID string, orderRequest domain.OrderRequest, timestamp string) *domain.OrderInfo {
+	limitPrice := orderRequest.LimitPrice
+	if orderRequest.OrderType == domain.OrderTypeMarket {
+		limitPrice = 0
+	}
+
+	return &domain.OrderInfo{
+		OrderID:       orderID,
+		ClientOrderID: orderRequest.ClientOrderID,
+		Status:        domain.OrderStatusPlaced,
+		Type:          string(orderRequest.OrderType),
+		Symbol:        orderRequest.Symbol,
+		Side:          orderRequest.Side,
+		Quantity:      orderRequest.Size,
+		LimitPrice:    limitPrice,
+		StopPrice:     orderRequest.StopPrice,
+		ReduceOnly:    orderRequest.ReduceOnly,
+		Timestamp:     timestamp,
+	}
+}
+
+// Time of the ticker, so backtests get the recorded time
+func (paperExchange *PaperExchange) timestamp(ticker domain.Ticker) string {
+	if ticker.Time != 0 {
+		return millisecondsToTimestamp(float64(ticker.Time))
+	}
+
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func (paperExchange *PaperExchange) GetBalance() float64 {
+	paperExchange.mutex.Lock()
+	defer paperExchange.mutex.Unlock()
+
+	return paperExchange.balance
+}
+
+func (paperExchange *PaperExchange) GetPositions() []domain.Position {
+	paperExchange.mutex.Lock()
+	defer paperExchange.mutex.Unlock()
+
+	positions := make([]domain.Position, 0, len(paperExchange.positions))
+	for _, position := range paperExchange.positions {
+		if position.Quantity != 0 {
+			positions = append(positions, *position)
+		}
+	}
+
+	return positions
+}
+
+// Limit price allows to take the market price
+func isMarketable(side domain.OrderSide, limitPrice float64, marketPrice float64) bool {
+	if side == domain.OrderSideBuy {
+		return marketPrice <= limitPrice
+	}
+	return marketPrice >= limitPrice
+}
+
+// Random id in the uuid format used by the exchange
+func newPaperID() string {
+	bytes := make([]byte, 16)
+	_, _ = rand.Read(bytes)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:])
+}
@@ -0,0 +1,93 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaperExchange(t *testing.T) {
+	paperExchange := services.NewPaperExchange(1000, 0.001)
+
+	_, err := paperExchange.Order("test", domain.OrderSideBuy, 1)
+	assert.NotNil(t, err)
+
+	paperExchange.UpdateTicker(domain.Ticker{Symbol: "test", Ask: 500.0, Bid: 490.0, Time: 1637869870056})
+
+	orderInfo, err := paperExchange.Order("test", domain.OrderSideBuy, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 500.0, orderInfo.Price)
+	assert.Equal(t, 0.5, orderInfo.Fee)
+	assert.Equal(t, domain.OrderSideBuy, orderInfo.Side)
+	assert.Equal(t, "test", orderInfo.Symbol)
+	assert.Equal(t, uint64(1), orderInfo.Quantity)
+	assert.Equal(t, "2021-11-25T19:51:10.056Z", orderInfo.Timestamp)
+	assert.Len(t, orderInfo.OrderID, 36)
+	assert.Equal(t, 499.5, paperExchange.GetBalance())
+	assert.Equal(t, []domain.Position{{Symbol: "test", Quantity: 1, AverageEntryPrice: 500}}, paperExchange.GetPositions())
+
+	// Not enough balance for the second contract
+	_, err = paperExchange.Order("test", domain.OrderSideBuy, 1)
+	assert.NotNil(t, err)
+
+	orderInfo, err = paperExchange.Order("test", domain.OrderSideSell, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 490.0, orderInfo.Price)
+	assert.InDelta(t, 989.01, paperExchange.GetBalance(), 1e-9)
+	assert.Empty(t, paperExchange.GetPositions())
+}
+
+func TestPaperExchangeOrderTypes(t *testing.T) {
+	paperExchange := services.NewPaperExchange(10000, 0)
+	paperExchange.UpdateTicker(domain.Ticker{Symbol: "test", Ask: 101.0, Bid: 99.0})
+
+	_, err := paperExchange.SendOrder(domain.OrderRequest{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeMarket, Size: 1, ReduceOnly: true})
+	assert.NotNil(t, err)
+
+	_, err = paperExchange.SendOrder(domain.OrderRequest{Symbol: "test", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeIOC, Size: 1, LimitPrice: 100})
+	assert.NotNil(t, err)
+
+	_, err = paperExchange.SendOrder(domain.OrderRequest{Symbol: "test", Side: domain.OrderSideBuy, OrderType: domain.OrderTypePost, Size: 1, LimitPrice: 102})
+	assert.NotNil(t, err)
+
+	orderInfo, err := paperExchange.SendOrder(domain.OrderRequest{Symbol: "test", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeLimit, Size: 2, LimitPrice: 100, ClientOrderID: "entry"})
+	assert.Nil(t, err)
+	assert.Equal(t, domain.OrderStatusPlaced, orderInfo.Status)
+	assert.Equal(t, "entry", orderInfo.ClientOrderID)
+	assert.Len(t, paperExchange.GetOpenOrders(), 1)
+
+	paperExchange.UpdateTicker(domain.Ticker{Symbol: "test", Ask: 99.5, Bid: 98.0})
+	assert.Equal(t, []domain.Position{{Symbol: "test", Quantity: 2, AverageEntryPrice: 100}}, paperExchange.GetPositions())
+	assert.Empty(t, paperExchange.GetOpenOrders())
+
+	stopInfo, err := paperExchange.SendOrder(domain.OrderRequest{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 5, StopPrice: 95, ReduceOnly: true})
+	assert.Nil(t, err)
+	takeProfitInfo, err := paperExchange.SendOrder(domain.OrderRequest{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeTakeProfit, Size: 1, StopPrice: 110})
+	assert.Nil(t, err)
+	assert.Nil(t, paperExchange.CancelOrder(takeProfitInfo.OrderID))
+	assert.NotNil(t, paperExchange.CancelOrder(takeProfitInfo.OrderID))
+
+	paperExchange.UpdateTicker(domain.Ticker{Symbol: "test", Ask: 97.0, Bid: 96.0})
+	assert.Len(t, paperExchange.GetOpenOrders(), 1)
+	assert.Equal(t, stopInfo.OrderID, paperExchange.GetOpenOrders()[0].OrderID)
+
+	// Reduce only stop closes the position and not more
+	paperExchange.UpdateTicker(domain.Ticker{Symbol: "test", Ask: 95.0, Bid: 94.0})
+	assert.Empty(t, paperExchange.GetPositions())
+	assert.Empty(t, paperExchange.GetOpenOrders())
+	assert.InDelta(t, 10000-200+2*94, paperExchange.GetBalance(), 1e-9)
+
+	// Fills of the resting orders are published like the exchange feeds do
+	accountEvents := paperExchange.GetAccountEventChannel()
+	for _, orderID := range []string{orderInfo.OrderID, stopInfo.OrderID} {
+		fills := <-accountEvents
+		assert.Equal(t, domain.AccountEventFills, fills.Type)
+		assert.Equal(t, orderID, fills.Fills[0].OrderID)
+		assert.Equal(t, 2.0, fills.Fills[0].Quantity)
+		assert.NotEmpty(t, fills.Fills[0].FillID)
+		assert.Equal(t, domain.AccountEvent{Type: domain.AccountEventOrderClosed, OrderID: orderID, ClientOrderID: fills.Fills[0].ClientOrderID, Reason: domain.OrderClosedFullFill}, <-accountEvents)
+	}
+	assert.Empty(t, accountEvents)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type pnlStorage interface {
+	GetOrderInfos() []domain.OrderInfo
+}
+
+// PnLService calculates profit from the stored orders, mark prices are taken from the tickers
+type PnLService struct {
+	storage pnlStorage
+
+	mutex      sync.Mutex
+	markPrices map[string]float64
+}
+
+func NewPnLService(pnlStorage pnlStorage) *PnLService {
+	return &PnLService{storage: pnlStorage, markPrices: make(map[string]float64)}
+}
+
+// Mark price of the ticker is used, mid price if there is no mark price
+func (pnlService *PnLService) UpdateTicker(ticker domain.Ticker) {
+	if ticker.Validate() != nil {
+		return
+	}
+
+	markPrice := ticker.MarkPrice
+	if markPrice <= 0 {
+		markPrice = ticker.Mid()
+	}
+
+	pnlService.mutex.Lock()
+	defer pnlService.mutex.Unlock()
+
+	pnlService.markPrices[strings.ToUpper(ticker.Symbol)] = markPrice
+}
+
+func (pnlService *PnLService) GetReport() domain.PnLReport {
+	return domain.NewPnLReport(pnlService.storage.GetOrderInfos(), pnlService.getMarkPrices())
+}
+
+// Profit of the fills from the inclusive time to the exclusive one, unrealized profit is at the current mark prices
+func (pnlService *PnLService) GetPeriodReport(from time.Time, to time.Time) domain.PnLReport {
+	return domain.NewPnLPeriodReport(pnlService.storage.GetOrderInfos(), pnlService.getMarkPrices(), from, to)
+}
+
+func (pnlService *PnLService) getMarkPrices() map[string]float64 {
+	pnlService.mutex.Lock()
+	defer pnlService.mutex.Unlock()
+
+	markPrices := make(map[string]float64, len(pnlService.markPrices))
+	for symbol, markPrice := range pnlService.markPrices {
+		markPrices[symbol] = markPrice
+	}
+	return markPrices
+}
+
+// False if the instrument has no fills
+func (pnlService *PnLService) GetInstrumentPnL(symbol string) (domain.InstrumentPnL, bool) {
+	for _, instrument := range pnlService.GetReport().Instruments {
+		if strings.EqualFold(instrument.Symbol, symbol) {
+			return instrument, true
+		}
+	}
+	return domain.InstrumentPnL{}, false
+}
@@ -0,0 +1,42 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type pnlStorageTest struct {
+	orderInfos []domain.OrderInfo
+}
+
+func (pnlStorageTest *pnlStorageTest) GetOrderInfos() []domain.OrderInfo {
+	return pnlStorageTest.orderInfos
+}
+
+func TestPnLService(t *testing.T) {
+	storage := pnlStorageTest{orderInfos: []domain.OrderInfo{
+		{Symbol: "pi_xbtusd", Side: domain.OrderSideBuy, Amount: 2, Price: 100, Fee: 0.1},
+	}}
+	pnlService := services.NewPnLService(&storage)
+
+	instrument, ok := pnlService.GetInstrumentPnL("PI_XBTUSD")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 0.0, instrument.UnrealizedPnL)
+
+	// Mark price is preferred to the mid price
+	pnlService.UpdateTicker(domain.Ticker{Symbol: "PI_XBTUSD", Bid: 104, Ask: 106})
+	instrument, _ = pnlService.GetInstrumentPnL("pi_xbtusd")
+	assert.Equal(t, 10.0, instrument.UnrealizedPnL)
+
+	pnlService.UpdateTicker(domain.Ticker{Symbol: "PI_XBTUSD", Bid: 104, Ask: 106, MarkPrice: 103})
+	report := pnlService.GetReport()
+	assert.Equal(t, 6.0, report.UnrealizedPnL)
+	assert.Equal(t, 206.0, report.Exposure)
+	assert.Equal(t, 5.9, report.NetPnL)
+
+	_, ok = pnlService.GetInstrumentPnL("PI_ETHUSD")
+	assert.Equal(t, false, ok)
+}
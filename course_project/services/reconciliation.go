@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type reconciliationExchange interface {
+	GetOpenPositions() ([]domain.Position, error)
+	GetOpenOrders() ([]domain.OpenOrder, error)
+	GetAccounts() ([]domain.MarginAccount, error)
+}
+
+type reconciliationStorage interface {
+	GetOrderInfos() []domain.OrderInfo
+}
+
+// Reconcile compares positions and open orders on the exchange with the stored orders.
+// Stored positions are the sum of the executed amounts, symbols are compared case-insensitively
+func Reconcile(exchange reconciliationExchange, storage reconciliationStorage) (domain.Reconciliation, error) {
+	var reconciliation domain.Reconciliation
+	var err error
+
+	if reconciliation.Positions, err = exchange.GetOpenPositions(); err != nil {
+		return reconciliation, err
+	}
+	if reconciliation.OpenOrders, err = exchange.GetOpenOrders(); err != nil {
+		return reconciliation, err
+	}
+	if reconciliation.MarginAccounts, err = exchange.GetAccounts(); err != nil {
+		return reconciliation, err
+	}
+
+	storedPositions := make(map[string]*domain.Position)
+	placedOrders := make(map[string]domain.OrderInfo)
+	storedOrders := make(map[string]bool)
+	for _, orderInfo := range storage.GetOrderInfos() {
+		storedOrders[orderInfo.OrderID] = true
+
+		if orderInfo.Status == domain.OrderStatusPlaced {
+			placedOrders[orderInfo.OrderID] = orderInfo
+		}
+
+		if orderInfo.Amount > 0 {
+			symbol := strings.ToUpper(orderInfo.Symbol)
+			position, ok := storedPositions[symbol]
+			if !ok {
+				position = &domain.Position{Symbol: symbol}
+				storedPositions[symbol] = position
+			}
+			position.Fill(orderInfo.Side, float64(orderInfo.Amount), orderInfo.Price)
+		}
+	}
+
+	exchangePositions := make(map[string]float64)
+	for _, position := range reconciliation.Positions {
+		exchangePositions[strings.ToUpper(position.Symbol)] = position.Quantity
+	}
+
+	symbols := make([]string, 0, len(storedPositions)+len(exchangePositions))
+	for symbol := range exchangePositions {
+		symbols = append(symbols, symbol)
+	}
+	for symbol := range storedPositions {
+		if _, ok := exchangePositions[symbol]; !ok {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+
+	for _, symbol := range symbols {
+		storedQuantity := 0.0
+		if position, ok := storedPositions[symbol]; ok {
+			storedQuantity = position.Quantity
+		}
+
+		if exchangePositions[symbol] != storedQuantity {
+			reconciliation.Mismatches = append(reconciliation.Mismatches,
+				fmt.Sprintf("position %s is %v on the exchange and %v in the stored orders", symbol, exchangePositions[symbol], storedQuantity))
+		}
+	}
+
+	openOrders := make(map[string]bool)
+	for _, openOrder := range reconciliation.OpenOrders {
+		openOrders[openOrder.OrderID] = true
+
+		if _, ok := placedOrders[openOrder.OrderID]; ok {
+			continue
+		}
+
+		if storedOrders[openOrder.OrderID] {
+			reconciliation.Mismatches = append(reconciliation.Mismatches,
+				fmt.Sprintf("order %s %s %s is open on the exchange but is not stored as placed", openOrder.OrderID, openOrder.Side, openOrder.Symbol))
+		} else {
+			reconciliation.Mismatches = append(reconciliation.Mismatches,
+				fmt.Sprintf("order %s %s %s is open on the exchange but is not stored", openOrder.OrderID, openOrder.Side, openOrder.Symbol))
+		}
+	}
+
+	orderIDs := make([]string, 0, len(placedOrders))
+	for orderID := range placedOrders {
+		if !openOrders[orderID] {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	sort.Strings(orderIDs)
+
+	for _, orderID := range orderIDs {
+		reconciliation.Mismatches = append(reconciliation.Mismatches,
+			fmt.Sprintf("order %s %s %s is stored as placed but is not open on the exchange", orderID, placedOrders[orderID].Side, placedOrders[orderID].Symbol))
+	}
+
+	return reconciliation, nil
+}
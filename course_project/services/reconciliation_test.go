@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/krakentest"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type reconciliationStorageTest struct {
+	orderInfos []domain.OrderInfo
+}
+
+func (reconciliationStorageTest *reconciliationStorageTest) GetOrderInfos() []domain.OrderInfo {
+	return reconciliationStorageTest.orderInfos
+}
+
+func TestReconcile(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_ETHUSD", "bid": 4000.0, "ask": 4001.0})
+
+	buyInfo, err := httpClient.SendOrder(domain.NewMarketOrderRequest("PI_XBTUSD", domain.OrderSideBuy, 2))
+	assert.Nil(t, err)
+	_, err = httpClient.SendOrder(domain.NewMarketOrderRequest("PI_ETHUSD", domain.OrderSideSell, 3))
+	assert.Nil(t, err)
+	limitInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeLimit, Size: 1, LimitPrice: 50000})
+	assert.Nil(t, err)
+	outsideInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, OrderType: domain.OrderTypeLimit, Size: 1, LimitPrice: 70000})
+	assert.Nil(t, err)
+
+	// Sell of PI_ETHUSD and the second limit order are made outside the bot, cancelled order is not known to the bot
+	storage := reconciliationStorageTest{orderInfos: []domain.OrderInfo{
+		*buyInfo,
+		*limitInfo,
+		{OrderID: "cancelled", Status: domain.OrderStatusPlaced, Symbol: "PI_XBTUSD", Side: domain.OrderSideSell},
+	}}
+
+	reconciliation, err := services.Reconcile(httpClient, &storage)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []domain.Position{
+		{Symbol: "PI_ETHUSD", Quantity: -3, AverageEntryPrice: 4000},
+		{Symbol: "PI_XBTUSD", Quantity: 2, AverageEntryPrice: 59010},
+	}, reconciliation.Positions)
+
+	assert.Len(t, reconciliation.OpenOrders, 2)
+	assert.Equal(t, limitInfo.OrderID, reconciliation.OpenOrders[0].OrderID)
+	assert.Equal(t, "PI_XBTUSD", reconciliation.OpenOrders[0].Symbol)
+	assert.Equal(t, 1.0, reconciliation.OpenOrders[0].Quantity)
+	assert.Equal(t, 50000.0, reconciliation.OpenOrders[0].LimitPrice)
+
+	// Positions are marked at the mid price
+	assert.Equal(t, []domain.MarginAccount{{
+		Name:            "flex",
+		Balance:         krakentest.InitialBalance,
+		PortfolioValue:  krakentest.InitialBalance - 11.5,
+		AvailableMargin: krakentest.InitialBalance - 11.5,
+		PnL:             -11.5,
+	}}, reconciliation.MarginAccounts)
+
+	assert.Equal(t, []string{
+		"position PI_ETHUSD is -3 on the exchange and 0 in the stored orders",
+		"order " + outsideInfo.OrderID + " sell PI_XBTUSD is open on the exchange but is not stored",
+		"order cancelled sell PI_XBTUSD is stored as placed but is not open on the exchange",
+	}, reconciliation.Mismatches)
+
+	// Nothing to report when the storage matches the exchange
+	storage.orderInfos = []domain.OrderInfo{*buyInfo, *limitInfo, {OrderID: outsideInfo.OrderID, Status: domain.OrderStatusPlaced}, {Symbol: "pi_ethusd", Side: domain.OrderSideSell, Amount: 3, Price: 4000}}
+	reconciliation, err = services.Reconcile(httpClient, &storage)
+	assert.Nil(t, err)
+	assert.Empty(t, reconciliation.Mismatches)
+
+	wrongClient := services.NewHTTPClient(&testHTTPCredentials{url: kraken.HTTPUrl()})
+	_, err = services.Reconcile(wrongClient, &storage)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type riskStorage interface {
+	GetRiskLimits() (domain.RiskLimits, bool)
+	SaveRiskLimits(limits domain.RiskLimits)
+}
+
+type riskOrderBooks interface {
+	GetOrderBook(symbol string) (domain.OrderBook, bool)
+}
+
+// RiskError is returned for orders blocked by the risk engine
+type RiskError struct {
+	Reason string
+}
+
+func (riskError *RiskError) Error() string {
+	return riskError.Reason
+}
+
+// RiskEngine checks every order against the limits before it is sent to the exchange.
+// Positions and daily profit are counted from the orders made since start,
+// orders reducing a position are allowed by the position, notional and daily loss limits
+type RiskEngine struct {
+	storage    riskStorage
+	orderBooks riskOrderBooks
+
+	mutex  sync.Mutex
+	limits domain.RiskLimits
+	// Positions and prices by upper case symbol, the exchange reports symbols in both cases
+	positions        map[string]*domain.Position
+	prices           map[string]float64
+	orderTimes       []time.Time
+	day              string
+	dailyRealizedPnL float64
+}
+
+// Order books are used to estimate slippage, nil if there are no books
+func NewRiskEngine(riskStorage riskStorage, riskOrderBooks riskOrderBooks) *RiskEngine {
+	riskEngine := RiskEngine{
+		storage:    riskStorage,
+		orderBooks: riskOrderBooks,
+		positions:  make(map[string]*domain.Position),
+		prices:     make(map[string]float64),
+	}
+
+	if limits, ok := riskStorage.GetRiskLimits(); ok {
+		riskEngine.limits = limits
+	}
+
+	return &riskEngine
+}
+
+func (riskEngine *RiskEngine) GetLimits() domain.RiskLimits {
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	return riskEngine.limits
+}
+
+func (riskEngine *RiskEngine) SetLimits(limits domain.RiskLimits) {
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	riskEngine.storage.SaveRiskLimits(limits)
+	riskEngine.limits = limits
+}
+
+func (riskEngine *RiskEngine) GetState() domain.RiskState {
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	now := time.Now()
+	riskEngine.update(now)
+
+	state := domain.RiskState{
+		Positions:        []domain.Position{},
+		OrdersLastMinute: len(riskEngine.orderTimes),
+		DailyRealizedPnL: riskEngine.dailyRealizedPnL,
+	}
+	state.DailyLossExceeded = riskEngine.dailyLossExceeded()
+
+	for _, position := range riskEngine.positions {
+		if position.Quantity != 0 {
+			state.Positions = append(state.Positions, *position)
+		}
+	}
+	sort.Slice(state.Positions, func(i, j int) bool {
+		return state.Positions[i].Symbol < state.Positions[j].Symbol
+	})
+
+	return state
+}
+
+// Last mid price is used to calculate the notional of the position
+func (riskEngine *RiskEngine) UpdateTicker(ticker domain.Ticker) {
+	if ticker.Validate() != nil {
+		return
+	}
+
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	riskEngine.prices[strings.ToUpper(ticker.Symbol)] = ticker.Mid()
+}
+
+// Check the order and count it towards the orders per minute limit if it is allowed
+func (riskEngine *RiskEngine) Check(symbol string, side domain.OrderSide, size uint64) error {
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	symbol = strings.ToUpper(symbol)
+	now := time.Now()
+	riskEngine.update(now)
+	limits := riskEngine.limits
+
+	if limits.KillSwitch {
+		return &RiskError{Reason: "kill switch is on"}
+	}
+
+	if limits.MaxOrdersPerMinute > 0 && len(riskEngine.orderTimes) >= limits.MaxOrdersPerMinute {
+		return &RiskError{Reason: fmt.Sprintf("limit of %d orders per minute is reached", limits.MaxOrdersPerMinute)}
+	}
+
+	quantity := 0.0
+	if position, ok := riskEngine.positions[symbol]; ok {
+		quantity = position.Quantity
+	}
+	newQuantity := quantity + float64(size)
+	if side == domain.OrderSideSell {
+		newQuantity = quantity - float64(size)
+	}
+
+	if math.Abs(newQuantity) > math.Abs(quantity) || quantity*newQuantity < 0 {
+		if riskEngine.dailyLossExceeded() {
+			return &RiskError{Reason: fmt.Sprintf("daily loss limit %v is reached", limits.MaxDailyLoss)}
+		}
+
+		if limits.MaxPosition > 0 && math.Abs(newQuantity) > limits.MaxPosition {
+			return &RiskError{Reason: fmt.Sprintf("position %v would exceed max position %v", newQuantity, limits.MaxPosition)}
+		}
+
+		if limits.MaxNotional > 0 {
+			price, ok := riskEngine.prices[symbol]
+			if !ok {
+				return &RiskError{Reason: fmt.Sprintf("no price to check notional of %s", symbol)}
+			}
+			if notional := math.Abs(newQuantity) * price; notional > limits.MaxNotional {
+				return &RiskError{Reason: fmt.Sprintf("notional %v would exceed max notional %v", notional, limits.MaxNotional)}
+			}
+		}
+
+		if limits.MaxSlippage > 0 {
+			if err := riskEngine.checkSlippage(symbol, side, size); err != nil {
+				return err
+			}
+		}
+	}
+
+	riskEngine.orderTimes = append(riskEngine.orderTimes, now)
+	return nil
+}
+
+// Must be called with locked mutex
+func (riskEngine *RiskEngine) checkSlippage(symbol string, side domain.OrderSide, size uint64) error {
+	var orderBook domain.OrderBook
+	ok := false
+	if riskEngine.orderBooks != nil {
+		orderBook, ok = riskEngine.orderBooks.GetOrderBook(symbol)
+	}
+	if !ok {
+		return &RiskError{Reason: fmt.Sprintf("no order book to check slippage of %s", symbol)}
+	}
+
+	slippage, ok := orderBook.Slippage(side, float64(size))
+	if !ok {
+		return &RiskError{Reason: fmt.Sprintf("order book of %s is too thin for %d contracts", symbol, size)}
+	}
+	if slippage > riskEngine.limits.MaxSlippage {
+		return &RiskError{Reason: fmt.Sprintf("estimated slippage %v would exceed max slippage %v", slippage, riskEngine.limits.MaxSlippage)}
+	}
+	return nil
+}
+
+// Apply executed order to the position and the daily profit
+func (riskEngine *RiskEngine) RecordOrder(orderInfo *domain.OrderInfo) {
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	riskEngine.update(time.Now())
+
+	position, ok := riskEngine.positions[strings.ToUpper(orderInfo.Symbol)]
+	if !ok {
+		position = &domain.Position{Symbol: orderInfo.Symbol}
+		riskEngine.positions[strings.ToUpper(orderInfo.Symbol)] = position
+	}
+
+	riskEngine.dailyRealizedPnL += position.Fill(orderInfo.Side, float64(orderInfo.Amount), orderInfo.Price) - orderInfo.Fee
+}
+
+// Replace positions by the ones reported by the exchange
+func (riskEngine *RiskEngine) SetPositions(positions []domain.Position) {
+	riskEngine.mutex.Lock()
+	defer riskEngine.mutex.Unlock()
+
+	riskEngine.positions = make(map[string]*domain.Position)
+	for _, position := range positions {
+		position := position
+		riskEngine.positions[strings.ToUpper(position.Symbol)] = &position
+	}
+}
+
+// Forget orders older than a minute and reset the daily profit at UTC midnight, must be called with locked mutex
+func (riskEngine *RiskEngine) update(now time.Time) {
+	orderTimes := riskEngine.orderTimes[:0]
+	for _, orderTime := range riskEngine.orderTimes {
+		if now.Sub(orderTime) < time.Minute {
+			orderTimes = append(orderTimes, orderTime)
+		}
+	}
+	riskEngine.orderTimes = orderTimes
+
+	if day := now.UTC().Format("2006-01-02"); day != riskEngine.day {
+		riskEngine.day = day
+		riskEngine.dailyRealizedPnL = 0
+	}
+}
+
+// Must be called with locked mutex
+func (riskEngine *RiskEngine) dailyLossExceeded() bool {
+	return riskEngine.limits.MaxDailyLoss > 0 && riskEngine.dailyRealizedPnL <= -riskEngine.limits.MaxDailyLoss
+}
@@ -0,0 +1,152 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type riskStorageTest struct {
+	limits *domain.RiskLimits
+}
+
+func (riskStorageTest *riskStorageTest) GetRiskLimits() (domain.RiskLimits, bool) {
+	if riskStorageTest.limits == nil {
+		return domain.RiskLimits{}, false
+	}
+	return *riskStorageTest.limits, true
+}
+
+func (riskStorageTest *riskStorageTest) SaveRiskLimits(limits domain.RiskLimits) {
+	riskStorageTest.limits = &limits
+}
+
+func newRiskEngine(limits domain.RiskLimits) *services.RiskEngine {
+	return services.NewRiskEngine(&riskStorageTest{limits: &limits}, nil)
+}
+
+func recordOrder(riskEngine *services.RiskEngine, side domain.OrderSide, amount uint64, price float64) {
+	riskEngine.RecordOrder(&domain.OrderInfo{Symbol: "test", Side: side, Amount: amount, Price: price})
+}
+
+func TestRiskEngineNoLimits(t *testing.T) {
+	riskEngine := services.NewRiskEngine(&riskStorageTest{}, nil)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 1000))
+		recordOrder(riskEngine, domain.OrderSideBuy, 1000, 100)
+	}
+}
+
+func TestRiskEngineMaxPosition(t *testing.T) {
+	riskEngine := newRiskEngine(domain.RiskLimits{MaxPosition: 2})
+
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 2))
+	recordOrder(riskEngine, domain.OrderSideBuy, 2, 100)
+
+	assert.IsType(t, &services.RiskError{}, riskEngine.Check("test", domain.OrderSideBuy, 1))
+	assert.IsType(t, &services.RiskError{}, riskEngine.Check("test", domain.OrderSideSell, 5))
+
+	// Reducing the position is always allowed, other instruments have their own positions
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideSell, 1))
+	assert.Nil(t, riskEngine.Check("other", domain.OrderSideSell, 2))
+}
+
+func TestRiskEngineMaxNotional(t *testing.T) {
+	riskEngine := newRiskEngine(domain.RiskLimits{MaxNotional: 250})
+
+	// Notional can't be checked before the first ticker
+	assert.NotNil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+
+	riskEngine.UpdateTicker(domain.Ticker{Symbol: "test", Bid: 99.0, Ask: 101.0})
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 2))
+	recordOrder(riskEngine, domain.OrderSideBuy, 2, 101)
+
+	assert.NotNil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+
+	riskEngine.UpdateTicker(domain.Ticker{Symbol: "test", Bid: 79.0, Ask: 81.0})
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+
+	// Symbols of the tickers, orders and positions are compared ignoring the case
+	riskEngine.UpdateTicker(domain.Ticker{Symbol: "TEST", Bid: 99.0, Ask: 101.0})
+	assert.NotNil(t, riskEngine.Check("Test", domain.OrderSideBuy, 1))
+	riskEngine.SetPositions([]domain.Position{{Symbol: "TEST", Quantity: 1, AverageEntryPrice: 100}})
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+}
+
+func TestRiskEngineOrdersPerMinute(t *testing.T) {
+	riskEngine := newRiskEngine(domain.RiskLimits{MaxOrdersPerMinute: 2})
+
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+	assert.Nil(t, riskEngine.Check("other", domain.OrderSideSell, 1))
+	assert.NotNil(t, riskEngine.Check("test", domain.OrderSideSell, 1))
+
+	assert.Equal(t, 2, riskEngine.GetState().OrdersLastMinute)
+}
+
+func TestRiskEngineDailyLoss(t *testing.T) {
+	riskEngine := newRiskEngine(domain.RiskLimits{MaxDailyLoss: 10})
+
+	recordOrder(riskEngine, domain.OrderSideBuy, 2, 100)
+	riskEngine.RecordOrder(&domain.OrderInfo{Symbol: "test", Side: domain.OrderSideSell, Amount: 1, Price: 91, Fee: 1})
+
+	state := riskEngine.GetState()
+	assert.Equal(t, -10.0, state.DailyRealizedPnL)
+	assert.True(t, state.DailyLossExceeded)
+	assert.Equal(t, []domain.Position{{Symbol: "test", Quantity: 1, AverageEntryPrice: 100}}, state.Positions)
+
+	assert.NotNil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+	assert.NotNil(t, riskEngine.Check("other", domain.OrderSideSell, 1))
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideSell, 1))
+}
+
+func TestRiskEngineKillSwitch(t *testing.T) {
+	storage := riskStorageTest{}
+	riskEngine := services.NewRiskEngine(&storage, nil)
+
+	riskEngine.SetLimits(domain.RiskLimits{KillSwitch: true})
+	assert.Equal(t, domain.RiskLimits{KillSwitch: true}, *storage.limits)
+
+	err := riskEngine.Check("test", domain.OrderSideBuy, 1)
+	assert.Equal(t, &services.RiskError{Reason: "kill switch is on"}, err)
+
+	riskEngine.SetLimits(domain.RiskLimits{})
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 1))
+}
+
+type riskOrderBooksTest struct {
+	orderBook *domain.OrderBook
+}
+
+func (riskOrderBooksTest *riskOrderBooksTest) GetOrderBook(symbol string) (domain.OrderBook, bool) {
+	if riskOrderBooksTest.orderBook == nil {
+		return domain.OrderBook{}, false
+	}
+	return *riskOrderBooksTest.orderBook, true
+}
+
+func TestRiskEngineMaxSlippage(t *testing.T) {
+	orderBooks := riskOrderBooksTest{}
+	riskEngine := services.NewRiskEngine(&riskStorageTest{limits: &domain.RiskLimits{MaxSlippage: 0.01}}, &orderBooks)
+
+	// Slippage can't be checked before the book snapshot
+	assert.IsType(t, &services.RiskError{}, riskEngine.Check("test", domain.OrderSideBuy, 1))
+
+	orderBooks.orderBook = &domain.OrderBook{OrderBookSnapshot: domain.OrderBookSnapshot{
+		Symbol: "test",
+		Bids:   []domain.PriceLevel{{Price: 99, Size: 2}},
+		Asks:   []domain.PriceLevel{{Price: 100, Size: 2}, {Price: 103, Size: 2}},
+	}}
+
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideBuy, 2))
+	// Average price 101.5 is 2% above the mid price
+	assert.IsType(t, &services.RiskError{}, riskEngine.Check("test", domain.OrderSideBuy, 4))
+	// The book is too thin
+	assert.IsType(t, &services.RiskError{}, riskEngine.Check("test", domain.OrderSideSell, 3))
+
+	recordOrder(riskEngine, domain.OrderSideBuy, 5, 100)
+	// Reducing the position is allowed
+	assert.Nil(t, riskEngine.Check("test", domain.OrderSideSell, 5))
+}
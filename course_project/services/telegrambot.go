@@ -1,8 +1,8 @@
 package services
 
 import (
-	"fmt"
-	"strconv"
+	"errors"
+	"net/http"
 	"strings"
 	"time"
 
@@ -10,32 +10,34 @@ import (
 	"github.com/legendiguess/kraken-trade-bot/domain"
 )
 
-type usersService interface {
-	CheckAddUser(user *domain.User)
-	GetUsers() []domain.User
+type telegramCommandHandler interface {
+	Handle(chatID int64, text string) string
 }
 
 type telegramBotCredentials interface {
 	GetTelegramBotAPIToken() string
+	GetTelegramAPIEndpoint() string
 }
 
 type telegramBotLogger interface {
 	Panic(args ...interface{})
 	Panicf(format string, args ...interface{})
+	Printf(format string, args ...interface{})
 }
 
 type TelegramBot struct {
-	bot          *tgbotapi.BotAPI
-	usersService usersService
-	logger       telegramBotLogger
+	bot      *tgbotapi.BotAPI
+	commands telegramCommandHandler
+	logger   telegramBotLogger
 }
 
-func NewTelegramBot(usersService usersService, telegramBotCredentials telegramBotCredentials, telegramBotLogger telegramBotLogger) *TelegramBot {
-	telegramBot := TelegramBot{usersService: usersService, logger: telegramBotLogger}
+// Messages from the chats are answered by the command handler
+func NewTelegramBot(telegramCommandHandler telegramCommandHandler, telegramBotCredentials telegramBotCredentials, telegramBotLogger telegramBotLogger) *TelegramBot {
+	telegramBot := TelegramBot{commands: telegramCommandHandler, logger: telegramBotLogger}
 
 	var err error
 
-	telegramBot.bot, err = tgbotapi.NewBotAPI(telegramBotCredentials.GetTelegramBotAPIToken())
+	telegramBot.bot, err = tgbotapi.NewBotAPIWithAPIEndpoint(telegramBotCredentials.GetTelegramBotAPIToken(), telegramBotCredentials.GetTelegramAPIEndpoint())
 	if err != nil {
 		telegramBot.logger.Panic(err)
 	}
@@ -51,10 +53,8 @@ func NewTelegramBot(usersService usersService, telegramBotCredentials telegramBo
 				continue
 			}
 
-			if update.Message.Text == "/start" {
-				telegramBot.usersService.CheckAddUser(&domain.User{ChatID: update.Message.Chat.ID})
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Вы подписались на получение информации по ордерам 👍")
-				telegramBot.bot.Send(msg)
+			if answer := telegramBot.commands.Handle(update.Message.Chat.ID, update.Message.Text); answer != "" {
+				telegramBot.send(update.Message.Chat.ID, answer)
 			}
 		}
 	}()
@@ -62,20 +62,29 @@ func NewTelegramBot(usersService usersService, telegramBotCredentials telegramBo
 	return &telegramBot
 }
 
-func (telegramBot *TelegramBot) SendOrderInfo(chatID int64, orderInfo *domain.OrderInfo) {
-	template := "%s %s по цене %s 💵\n%s ⏱"
-
-	textSide := "Куплен ➕"
-	if orderInfo.Side == domain.OrderSideSell {
-		textSide = "Продан ➖"
+func (telegramBot *TelegramBot) send(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	if _, err := telegramBot.bot.Send(msg); err != nil {
+		telegramBot.logger.Printf("Can't answer chat %d: %v", chatID, err)
 	}
+}
 
-	t, _ := time.Parse(time.RFC3339, orderInfo.Timestamp)
-	loc, _ := time.LoadLocation("Europe/Moscow")
-	t = t.In(loc)
-
-	text := fmt.Sprintf(template, textSide, strings.ToUpper(orderInfo.Symbol[3:6]), strconv.FormatFloat(orderInfo.Price, 'f', -1, 64), t.Format(time.RFC1123))
+func (telegramBot *TelegramBot) Channel() domain.NotificationChannel {
+	return domain.NotificationChannelTelegram
+}
 
-	msg := tgbotapi.NewMessage(chatID, text)
-	telegramBot.bot.Send(msg)
+// Forbidden answer means the user blocked the bot or left the chat, flood control answer has the time to wait
+func (telegramBot *TelegramBot) Notify(user domain.User, notification domain.Notification) error {
+	_, err := telegramBot.bot.Send(tgbotapi.NewMessage(user.ChatID, notificationText(notification, user)))
+
+	var apiError *tgbotapi.Error
+	if errors.As(err, &apiError) {
+		switch {
+		case apiError.Code == http.StatusForbidden || (apiError.Code == http.StatusBadRequest && strings.Contains(apiError.Message, "chat not found")):
+			return &RecipientBlockedError{Reason: apiError.Message}
+		case apiError.Code == http.StatusTooManyRequests && apiError.RetryAfter > 0:
+			return &RetryAfterError{Delay: time.Duration(apiError.RetryAfter) * time.Second}
+		}
+	}
+	return err
 }
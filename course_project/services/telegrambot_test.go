@@ -0,0 +1,67 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/legendiguess/kraken-trade-bot/telegramtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type telegramBotCommandsTest struct{}
+
+func (telegramBotCommandsTest *telegramBotCommandsTest) Handle(chatID int64, text string) string {
+	return ""
+}
+
+type telegramBotCredentialsTest struct {
+	endpoint string
+}
+
+func (telegramBotCredentialsTest *telegramBotCredentialsTest) GetTelegramBotAPIToken() string {
+	return "token"
+}
+
+func (telegramBotCredentialsTest *telegramBotCredentialsTest) GetTelegramAPIEndpoint() string {
+	return telegramBotCredentialsTest.endpoint
+}
+
+type telegramBotLoggerTest struct {
+	t *testing.T
+}
+
+func (telegramBotLoggerTest *telegramBotLoggerTest) Panic(args ...interface{}) {
+	telegramBotLoggerTest.t.Fatal(args...)
+}
+
+func (telegramBotLoggerTest *telegramBotLoggerTest) Panicf(format string, args ...interface{}) {
+	telegramBotLoggerTest.t.Fatalf(format, args...)
+}
+
+func (telegramBotLoggerTest *telegramBotLoggerTest) Printf(format string, args ...interface{}) {}
+
+func TestTelegramBotNotifyErrors(t *testing.T) {
+	telegram := telegramtest.NewServer()
+	defer telegram.Close()
+
+	telegramBot := services.NewTelegramBot(&telegramBotCommandsTest{}, &telegramBotCredentialsTest{endpoint: telegram.APIEndpoint()}, &telegramBotLoggerTest{t: t})
+	notification := domain.Notification{Kind: domain.NotificationKindError, Error: "test"}
+
+	assert.Nil(t, telegramBot.Notify(domain.User{ChatID: 1}, notification))
+
+	telegram.RateLimitNext(3)
+	var retryAfterError *services.RetryAfterError
+	if assert.True(t, errors.As(telegramBot.Notify(domain.User{ChatID: 1}, notification), &retryAfterError)) {
+		assert.Equal(t, 3*time.Second, retryAfterError.Delay)
+	}
+
+	telegram.BlockChat(2)
+	var recipientBlockedError *services.RecipientBlockedError
+	assert.True(t, errors.As(telegramBot.Notify(domain.User{ChatID: 2}, notification), &recipientBlockedError))
+
+	// Only the accepted message is delivered
+	assert.Len(t, telegram.Messages(), 1)
+}
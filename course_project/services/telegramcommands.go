@@ -0,0 +1,563 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const (
+	defaultTelegramOrders = 5
+	maxTelegramOrders     = 20
+	// Filter name and its values
+	maxTelegramFilterArgs = 11
+)
+
+// Kraken Futures symbols, e.g. PI_XBTUSD or FI_XBTUSD_211231
+var telegramSymbolPattern = regexp.MustCompile(`^[A-Z]{2}_[A-Z0-9_]+$`)
+
+type telegramCommandUsers interface {
+	CheckAddUser(user *domain.User)
+	GetUser(chatID int64) (domain.User, bool)
+	UpdateUser(user domain.User)
+	DeleteUser(chatID int64) bool
+	IsAdmin(chatID int64) bool
+}
+
+type telegramCommandTrading interface {
+	GetState() domain.TradingState
+	Start(source string, actor string) error
+	Pause(source string, actor string) error
+	Flatten(source string, actor string) error
+}
+
+type telegramCommandInstruments interface {
+	SwitchInstrument(symbol string) domain.InstrumentConfig
+	GetEnabledSymbols() []string
+}
+
+type telegramCommandMarket interface {
+	SetMarketSubscription(productIDs []string)
+	GetConnectionStatus() domain.ConnectionStatus
+}
+
+type telegramCommandPnL interface {
+	GetReport() domain.PnLReport
+}
+
+type telegramCommandOrders interface {
+	GetOrderPage(filter domain.OrderFilter) domain.OrderPage
+}
+
+type telegramCommandLogger interface {
+	Printf(format string, args ...interface{})
+}
+
+type telegramCommand struct {
+	name  string
+	usage string
+	// Arguments of the description from the catalog
+	aboutArgs []interface{}
+	// Only chats from the admin whitelist can run the command
+	admin   bool
+	maxArgs int
+	minArgs int
+	handle  func(chatID int64, args []string, catalog commandCatalog) string
+}
+
+// TelegramCommands parses the chat messages and runs the bot commands, the answer is returned as text
+type TelegramCommands struct {
+	users       telegramCommandUsers
+	trading     telegramCommandTrading
+	instruments telegramCommandInstruments
+	market      telegramCommandMarket
+	pnl         telegramCommandPnL
+	orders      telegramCommandOrders
+	logger      telegramCommandLogger
+	// Notification channels the subscribers can choose
+	channels []domain.NotificationChannel
+
+	// In the order of the help
+	commands []telegramCommand
+}
+
+func NewTelegramCommands(users telegramCommandUsers, trading telegramCommandTrading, instruments telegramCommandInstruments, market telegramCommandMarket, pnl telegramCommandPnL, orders telegramCommandOrders, channels []domain.NotificationChannel, logger telegramCommandLogger) *TelegramCommands {
+	telegramCommands := TelegramCommands{
+		users:       users,
+		trading:     trading,
+		instruments: instruments,
+		market:      market,
+		pnl:         pnl,
+		orders:      orders,
+		logger:      logger,
+		channels:    channels,
+	}
+
+	telegramCommands.commands = []telegramCommand{
+		{name: "/start", handle: telegramCommands.subscribe},
+		{name: "/stop", handle: telegramCommands.unsubscribe},
+		{name: "/channels", usage: "/channels [channel ...]", aboutArgs: []interface{}{joinNotificationChannels(channels, ", ")}, maxArgs: len(channels), handle: telegramCommands.notificationChannels},
+		{name: "/email", usage: "/email <address>", minArgs: 1, maxArgs: 1, handle: telegramCommands.email},
+		{name: "/webhook", usage: "/webhook <url>", minArgs: 1, maxArgs: 1, handle: telegramCommands.webhook},
+		{name: "/language", usage: "/language [ru|en]", maxArgs: 1, handle: telegramCommands.language},
+		{name: "/timezone", usage: "/timezone [zone]", maxArgs: 1, handle: telegramCommands.timezone},
+		{name: "/filters", usage: "/filters [instruments|sides|notional|quiet|categories] [value ...]", maxArgs: maxTelegramFilterArgs, handle: telegramCommands.filters},
+		{name: "/status", handle: telegramCommands.status},
+		{name: "/pnl", handle: telegramCommands.profit},
+		{name: "/orders", usage: "/orders [n]", aboutArgs: []interface{}{defaultTelegramOrders}, maxArgs: 1, handle: telegramCommands.lastOrders},
+		{name: "/instrument", usage: "/instrument <symbol>", admin: true, minArgs: 1, maxArgs: 1, handle: telegramCommands.switchInstrument},
+		{name: "/pause", admin: true, handle: telegramCommands.pause},
+		{name: "/resume", admin: true, handle: telegramCommands.resume},
+		{name: "/flatten", admin: true, handle: telegramCommands.flatten},
+		{name: "/help", handle: telegramCommands.help},
+	}
+
+	return &telegramCommands
+}
+
+// Answer to the message in the language of the subscriber, empty if the message is not a command
+func (telegramCommands *TelegramCommands) Handle(chatID int64, text string) string {
+	name, args, ok := parseTelegramCommand(text)
+	if !ok {
+		return ""
+	}
+
+	// Chats which are not subscribed get the default language
+	user, _ := telegramCommands.users.GetUser(chatID)
+	catalog := languageCommandCatalog(user.GetLanguage())
+
+	for _, command := range telegramCommands.commands {
+		if command.name != name {
+			continue
+		}
+
+		if command.admin && !telegramCommands.users.IsAdmin(chatID) {
+			telegramCommands.logger.Printf("Chat %d is not allowed to run %s", chatID, name)
+			return catalog.adminOnly
+		}
+		if len(args) < command.minArgs || len(args) > command.maxArgs {
+			return catalog.usage + command.usageText()
+		}
+		return command.handle(chatID, args, catalog)
+	}
+
+	return catalog.unknownCommand
+}
+
+// Command name is lower cased and the bot name is removed, e.g. "/Orders@kraken_bot 5" is "/orders" with argument "5"
+func parseTelegramCommand(text string) (string, []string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil, false
+	}
+
+	name := strings.ToLower(fields[0])
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	return name, fields[1:], true
+}
+
+func (command telegramCommand) usageText() string {
+	if command.usage != "" {
+		return command.usage
+	}
+	return command.name
+}
+
+func (telegramCommands *TelegramCommands) subscribe(chatID int64, args []string, catalog commandCatalog) string {
+	telegramCommands.users.CheckAddUser(&domain.User{ChatID: chatID})
+	return catalog.subscribed
+}
+
+func (telegramCommands *TelegramCommands) unsubscribe(chatID int64, args []string, catalog commandCatalog) string {
+	if !telegramCommands.users.DeleteUser(chatID) {
+		return catalog.notSubscribed
+	}
+	return catalog.unsubscribed
+}
+
+// Without arguments the chosen channels are shown, channels can be separated by spaces or commas
+func (telegramCommands *TelegramCommands) notificationChannels(chatID int64, args []string, catalog commandCatalog) string {
+	user, ok := telegramCommands.users.GetUser(chatID)
+	if !ok {
+		return catalog.subscribeFirst
+	}
+	if len(args) == 0 {
+		text := fmt.Sprintf(catalog.channels, joinNotificationChannels(user.GetChannels(), ", "))
+		if user.ParkedChannels != "" {
+			text += "\n" + fmt.Sprintf(catalog.parkedChannels, strings.ReplaceAll(user.ParkedChannels, ",", ", "))
+		}
+		return text
+	}
+
+	channels := []domain.NotificationChannel{}
+	for _, channel := range domain.ParseNotificationChannels(strings.ToLower(strings.Join(args, ","))) {
+		if !containsNotificationChannel(telegramCommands.channels, channel) {
+			return fmt.Sprintf(catalog.unknownChannel, channel, joinNotificationChannels(telegramCommands.channels, ", "))
+		}
+		if channel == domain.NotificationChannelEmail && user.Email == "" {
+			return catalog.emailFirst
+		}
+		if channel == domain.NotificationChannelWebhook && user.WebhookURL == "" {
+			return catalog.webhookFirst
+		}
+		if !containsNotificationChannel(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	if len(channels) == 0 {
+		return catalog.usage + "/channels [channel ...]"
+	}
+
+	// Chosen again after the delivery failed, so the channel gets another chance
+	for _, channel := range channels {
+		user.UnparkChannel(channel)
+	}
+	user.Channels = joinNotificationChannels(channels, ",")
+	telegramCommands.users.UpdateUser(user)
+	return fmt.Sprintf(catalog.channelsChanged, joinNotificationChannels(channels, ", "))
+}
+
+func (telegramCommands *TelegramCommands) email(chatID int64, args []string, catalog commandCatalog) string {
+	user, ok := telegramCommands.users.GetUser(chatID)
+	if !ok {
+		return catalog.subscribeFirst
+	}
+
+	address, err := mail.ParseAddress(args[0])
+	if err != nil || address.Address != args[0] {
+		return catalog.invalidEmail
+	}
+
+	user.Email = address.Address
+	user.UnparkChannel(domain.NotificationChannelEmail)
+	telegramCommands.users.UpdateUser(user)
+	return catalog.emailSaved
+}
+
+func (telegramCommands *TelegramCommands) webhook(chatID int64, args []string, catalog commandCatalog) string {
+	user, ok := telegramCommands.users.GetUser(chatID)
+	if !ok {
+		return catalog.subscribeFirst
+	}
+
+	webhookURL, err := url.ParseRequestURI(args[0])
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+		return catalog.invalidWebhook
+	}
+	// Host names are checked when the webhook is called
+	if ip := net.ParseIP(webhookURL.Hostname()); strings.EqualFold(webhookURL.Hostname(), "localhost") || (ip != nil && isInternalIP(ip)) {
+		return catalog.internalWebhook
+	}
+
+	user.WebhookURL = webhookURL.String()
+	user.UnparkChannel(domain.NotificationChannelWebhook)
+	telegramCommands.users.UpdateUser(user)
+	return catalog.webhookSaved
+}
+
+// Without arguments the current language is shown
+func (telegramCommands *TelegramCommands) language(chatID int64, args []string, catalog commandCatalog) string {
+	user, ok := telegramCommands.users.GetUser(chatID)
+	if !ok {
+		return catalog.subscribeFirst
+	}
+	if len(args) == 0 {
+		return fmt.Sprintf(catalog.language, user.GetLanguage())
+	}
+
+	language := domain.Language(strings.ToLower(args[0]))
+	if _, ok := notificationCatalogs[language]; !ok {
+		return catalog.unknownLanguage
+	}
+
+	user.Language = language
+	telegramCommands.users.UpdateUser(user)
+	// Answered already in the new language
+	return fmt.Sprintf(languageCommandCatalog(language).language, language)
+}
+
+// Without arguments the current time zone is shown
+func (telegramCommands *TelegramCommands) timezone(chatID int64, args []string, catalog commandCatalog) string {
+	user, ok := telegramCommands.users.GetUser(chatID)
+	if !ok {
+		return catalog.subscribeFirst
+	}
+	if len(args) == 0 {
+		return fmt.Sprintf(catalog.timezone, user.GetTimezone())
+	}
+
+	// Local is the zone of the server, not of the user
+	if _, err := time.LoadLocation(args[0]); err != nil || args[0] == "Local" {
+		return catalog.unknownTimezone
+	}
+
+	user.Timezone = args[0]
+	telegramCommands.users.UpdateUser(user)
+	return fmt.Sprintf(catalog.timezone, args[0])
+}
+
+// Without arguments the filters are shown, "all" or "off" turns the filter off
+func (telegramCommands *TelegramCommands) filters(chatID int64, args []string, catalog commandCatalog) string {
+	user, ok := telegramCommands.users.GetUser(chatID)
+	if !ok {
+		return catalog.subscribeFirst
+	}
+	if len(args) == 0 {
+		return filtersText(user, catalog)
+	}
+
+	values := telegramListArgs(args[1:])
+	off := len(values) == 1 && (strings.EqualFold(values[0], "all") || strings.EqualFold(values[0], "off"))
+
+	switch strings.ToLower(args[0]) {
+	case "instruments":
+		if len(values) == 0 {
+			return catalog.usage + "/filters instruments <symbol ...|all>"
+		}
+		symbols := []string{}
+		for _, value := range values {
+			symbol := strings.ToUpper(value)
+			if !off && !telegramSymbolPattern.MatchString(symbol) {
+				return catalog.invalidSymbol
+			}
+			symbols = append(symbols, symbol)
+		}
+		if off {
+			symbols = nil
+		}
+		user.Instruments = strings.Join(symbols, ",")
+	case "sides":
+		if len(values) != 1 {
+			return catalog.usage + "/filters sides <buy|sell|all>"
+		}
+		side := domain.OrderSide(strings.ToLower(values[0]))
+		if !off && side != domain.OrderSideBuy && side != domain.OrderSideSell {
+			return catalog.usage + "/filters sides <buy|sell|all>"
+		}
+		user.Sides = string(side)
+		if off {
+			user.Sides = ""
+		}
+	case "notional":
+		if len(values) != 1 {
+			return catalog.usage + "/filters notional <value|off>"
+		}
+		notional := 0.0
+		if !off {
+			var err error
+			notional, err = strconv.ParseFloat(values[0], 64)
+			if err != nil || notional < 0 || math.IsInf(notional, 0) || math.IsNaN(notional) {
+				return catalog.invalidNotional
+			}
+		}
+		user.MinNotional = notional
+	case "quiet":
+		if len(values) != 1 {
+			return catalog.quietUsage
+		}
+		user.QuietFrom, user.QuietTo = 0, 0
+		if !off {
+			from, to, ok := parseQuietHours(values[0])
+			if !ok {
+				return catalog.quietUsage
+			}
+			user.QuietFrom, user.QuietTo = from, to
+		}
+	case "categories":
+		if len(values) == 0 {
+			return catalog.usage + "/filters categories <fills|risk|errors|summary ...|all>"
+		}
+		categories := []string{}
+		for _, value := range values {
+			category := domain.NotificationCategory(strings.ToLower(value))
+			if !off && !containsNotificationCategory(category) {
+				return catalog.unknownCategory
+			}
+			categories = append(categories, string(category))
+		}
+		if off {
+			categories = nil
+		}
+		user.Categories = strings.Join(categories, ",")
+	default:
+		return catalog.unknownFilter
+	}
+
+	telegramCommands.users.UpdateUser(user)
+	return filtersText(user, catalog)
+}
+
+func filtersText(user domain.User, catalog commandCatalog) string {
+	all := func(list string) string {
+		if list == "" {
+			return catalog.filterAll
+		}
+		return strings.ReplaceAll(list, ",", ", ")
+	}
+
+	notional := catalog.filterNone
+	if user.MinNotional > 0 {
+		notional = strconv.FormatFloat(user.MinNotional, 'f', -1, 64)
+	}
+	quiet := catalog.filterNone
+	if user.QuietFrom != user.QuietTo {
+		quiet = fmt.Sprintf("%02d:00-%02d:00 (%s)", user.QuietFrom, user.QuietTo, user.GetTimezone())
+	}
+
+	return fmt.Sprintf(catalog.filters, all(user.Instruments), all(user.Sides), notional, quiet, all(user.Categories))
+}
+
+// Values given with spaces or commas, e.g. "PI_XBTUSD, PI_ETHUSD PF_SOLUSD"
+func telegramListArgs(args []string) []string {
+	values := []string{}
+	for _, arg := range args {
+		for _, value := range strings.Split(arg, ",") {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// "23-7" is from 23:00 to 07:00, hours must differ
+func parseQuietHours(value string) (int, int, bool) {
+	hours := strings.Split(value, "-")
+	if len(hours) != 2 {
+		return 0, 0, false
+	}
+	from, fromErr := strconv.Atoi(hours[0])
+	to, toErr := strconv.Atoi(hours[1])
+	if fromErr != nil || toErr != nil || from < 0 || from > 23 || to < 0 || to > 23 || from == to {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+func containsNotificationCategory(category domain.NotificationCategory) bool {
+	for _, next := range domain.NotificationCategories {
+		if next == category {
+			return true
+		}
+	}
+	return false
+}
+
+func joinNotificationChannels(channels []domain.NotificationChannel, separator string) string {
+	names := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		names = append(names, string(channel))
+	}
+	return strings.Join(names, separator)
+}
+
+func containsNotificationChannel(channels []domain.NotificationChannel, channel domain.NotificationChannel) bool {
+	for _, next := range channels {
+		if next == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (telegramCommands *TelegramCommands) status(chatID int64, args []string, catalog commandCatalog) string {
+	symbols := strings.Join(telegramCommands.instruments.GetEnabledSymbols(), ", ")
+	if symbols == "" {
+		symbols = catalog.none
+	}
+
+	return fmt.Sprintf(catalog.status, telegramCommands.trading.GetState(), telegramCommands.market.GetConnectionStatus().State, symbols)
+}
+
+func (telegramCommands *TelegramCommands) profit(chatID int64, args []string, catalog commandCatalog) string {
+	report := telegramCommands.pnl.GetReport()
+
+	lines := []string{fmt.Sprintf(catalog.profit, report.RealizedPnL, report.UnrealizedPnL, report.Fees, report.NetPnL)}
+	for _, instrument := range report.Instruments {
+		lines = append(lines, fmt.Sprintf(catalog.instrumentProfit, instrument.Symbol, instrument.Position, instrument.NetPnL))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (telegramCommands *TelegramCommands) lastOrders(chatID int64, args []string, catalog commandCatalog) string {
+	count := defaultTelegramOrders
+	if len(args) == 1 {
+		var err error
+		count, err = strconv.Atoi(args[0])
+		if err != nil || count <= 0 || count > maxTelegramOrders {
+			return fmt.Sprintf(catalog.ordersCount, maxTelegramOrders)
+		}
+	}
+
+	orders := telegramCommands.orders.GetOrderPage(domain.OrderFilter{Limit: count}).Orders
+	if len(orders) == 0 {
+		return catalog.noOrders
+	}
+
+	lines := make([]string, 0, len(orders))
+	for _, order := range orders {
+		size, price := order.Amount, order.Price
+		if order.Status == domain.OrderStatusPlaced {
+			size, price = order.Quantity, order.LimitPrice
+		}
+		lines = append(lines, fmt.Sprintf(catalog.order, order.Timestamp, order.Side, order.Symbol, size, strconv.FormatFloat(price, 'f', -1, 64), order.Status))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (telegramCommands *TelegramCommands) switchInstrument(chatID int64, args []string, catalog commandCatalog) string {
+	symbol := strings.ToUpper(args[0])
+	if !telegramSymbolPattern.MatchString(symbol) {
+		return catalog.invalidSymbol
+	}
+
+	instrument := telegramCommands.instruments.SwitchInstrument(symbol)
+	telegramCommands.market.SetMarketSubscription(telegramCommands.instruments.GetEnabledSymbols())
+	telegramCommands.logger.Printf("Chat %d switched trading to %s", chatID, symbol)
+
+	return fmt.Sprintf(catalog.instrumentSwitched, instrument.Symbol, instrument.OrderSize)
+}
+
+func (telegramCommands *TelegramCommands) pause(chatID int64, args []string, catalog commandCatalog) string {
+	return telegramCommands.changeTrading(telegramCommands.trading.Pause, chatID, catalog, catalog.paused)
+}
+
+func (telegramCommands *TelegramCommands) resume(chatID int64, args []string, catalog commandCatalog) string {
+	return telegramCommands.changeTrading(telegramCommands.trading.Start, chatID, catalog, catalog.resumed)
+}
+
+func (telegramCommands *TelegramCommands) flatten(chatID int64, args []string, catalog commandCatalog) string {
+	return telegramCommands.changeTrading(telegramCommands.trading.Flatten, chatID, catalog, catalog.flattening)
+}
+
+// The chat id is saved as the actor of the change
+func (telegramCommands *TelegramCommands) changeTrading(change func(source string, actor string) error, chatID int64, catalog commandCatalog, text string) string {
+	if err := change(TradingSourceTelegram, strconv.FormatInt(chatID, 10)); err != nil {
+		return fmt.Sprintf(catalog.tradingFailed, err)
+	}
+	return text
+}
+
+// Privileged commands are listed only to admins
+func (telegramCommands *TelegramCommands) help(chatID int64, args []string, catalog commandCatalog) string {
+	isAdmin := telegramCommands.users.IsAdmin(chatID)
+
+	lines := []string{catalog.help}
+	for _, command := range telegramCommands.commands {
+		if command.admin && !isAdmin {
+			continue
+		}
+		lines = append(lines, command.usageText()+" - "+fmt.Sprintf(catalog.about[command.name], command.aboutArgs...))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,201 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type telegramCommandMarketTest struct {
+	subscription []string
+}
+
+func (telegramCommandMarketTest *telegramCommandMarketTest) SetMarketSubscription(productIDs []string) {
+	telegramCommandMarketTest.subscription = productIDs
+}
+
+func (telegramCommandMarketTest *telegramCommandMarketTest) GetConnectionStatus() domain.ConnectionStatus {
+	return domain.ConnectionStatus{State: domain.ConnectionStateConnected}
+}
+
+type telegramCommandPnLTest struct{}
+
+func (telegramCommandPnLTest *telegramCommandPnLTest) GetReport() domain.PnLReport {
+	return domain.PnLReport{
+		Instruments:   []domain.InstrumentPnL{{Symbol: "PI_XBTUSD", Position: 2, NetPnL: 9}},
+		RealizedPnL:   10,
+		UnrealizedPnL: 1,
+		Fees:          2,
+		NetPnL:        9,
+	}
+}
+
+const (
+	telegramAdminTest = int64(1)
+	telegramUserTest  = int64(2)
+)
+
+func newTelegramCommandsTest() (*services.TelegramCommands, *services.UsersService, *services.TradingController, *telegramCommandMarketTest) {
+	usersService := services.NewUsersService(&testUsersStorage{})
+	usersService.AddAdmin(telegramAdminTest)
+	tradingController := services.NewTradingController(&tradingControlStorageTest{})
+	instrumentService := services.NewInstrumentService(&instrumentStorageTest{instruments: []domain.InstrumentConfig{domain.NewInstrumentConfig("PI_XBTUSD")}})
+	market := telegramCommandMarketTest{}
+	orderInfosService := services.NewOrderInfosService(&orderInfosStorageTest{orderInfos: []domain.OrderInfo{
+		{ID: 2, Status: domain.OrderStatusFilled, Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Amount: 1, Price: 50000.5, Timestamp: "2021-12-01T10:00:00.000Z"},
+		{ID: 1, Status: domain.OrderStatusPlaced, Symbol: "PI_XBTUSD", Side: domain.OrderSideSell, Quantity: 3, LimitPrice: 51000, Timestamp: "2021-12-01T09:00:00.000Z"},
+	}})
+
+	telegramCommands := services.NewTelegramCommands(usersService, tradingController, instrumentService, &market, &telegramCommandPnLTest{}, orderInfosService, []domain.NotificationChannel{domain.NotificationChannelTelegram, domain.NotificationChannelWebhook, domain.NotificationChannelEmail}, &loggerTest{})
+	return telegramCommands, usersService, tradingController, &market
+}
+
+func TestTelegramCommandsSubscription(t *testing.T) {
+	telegramCommands, usersService, _, _ := newTelegramCommandsTest()
+
+	assert.Equal(t, "", telegramCommands.Handle(telegramUserTest, "hello"))
+	assert.Equal(t, "Вы подписались на получение информации по ордерам 👍", telegramCommands.Handle(telegramUserTest, "/start"))
+	assert.Equal(t, []domain.User{{ChatID: telegramUserTest}}, usersService.GetUsers())
+
+	assert.Equal(t, "Вы отписались от уведомлений 👋", telegramCommands.Handle(telegramUserTest, "/stop@kraken_bot"))
+	assert.Empty(t, usersService.GetUsers())
+	assert.Equal(t, "Вы не подписаны на уведомления", telegramCommands.Handle(telegramUserTest, "/stop"))
+
+	assert.Equal(t, "Неизвестная команда, список команд: /help", telegramCommands.Handle(telegramUserTest, "/unknown"))
+	assert.Equal(t, "Использование: /start", telegramCommands.Handle(telegramUserTest, "/start now"))
+}
+
+func TestTelegramCommandsInformation(t *testing.T) {
+	telegramCommands, _, _, _ := newTelegramCommandsTest()
+
+	assert.Equal(t, "Торговля: running\nСоединение с биржей: connected\nИнструменты: PI_XBTUSD", telegramCommands.Handle(telegramUserTest, "/status"))
+	assert.Equal(t, "Прибыль 💰\nРеализованная: 10.00\nНереализованная: 1.00\nКомиссии: 2.00\nИтого: 9.00\nPI_XBTUSD: позиция 2, итого 9.00", telegramCommands.Handle(telegramUserTest, "/pnl"))
+
+	assert.Equal(t, "2021-12-01T10:00:00.000Z buy PI_XBTUSD 1 по 50000.5, filled", telegramCommands.Handle(telegramUserTest, "/orders 1"))
+	assert.Equal(t, "2021-12-01T10:00:00.000Z buy PI_XBTUSD 1 по 50000.5, filled\n2021-12-01T09:00:00.000Z sell PI_XBTUSD 3 по 51000, placed", telegramCommands.Handle(telegramUserTest, "/Orders"))
+	assert.Equal(t, "Число ордеров должно быть от 1 до 20", telegramCommands.Handle(telegramUserTest, "/orders many"))
+	assert.Equal(t, "Число ордеров должно быть от 1 до 20", telegramCommands.Handle(telegramUserTest, "/orders 0"))
+	assert.Equal(t, "Использование: /orders [n]", telegramCommands.Handle(telegramUserTest, "/orders 1 2"))
+
+	assert.NotContains(t, telegramCommands.Handle(telegramUserTest, "/help"), "/pause")
+	assert.Contains(t, telegramCommands.Handle(telegramAdminTest, "/help"), "/pause")
+}
+
+func TestTelegramCommandsAdmin(t *testing.T) {
+	telegramCommands, _, tradingController, market := newTelegramCommandsTest()
+
+	for _, command := range []string{"/instrument PI_ETHUSD", "/pause", "/resume", "/flatten"} {
+		assert.Equal(t, "Команда доступна только администраторам ⛔", telegramCommands.Handle(telegramUserTest, command))
+	}
+	assert.Equal(t, domain.TradingStateRunning, tradingController.GetState())
+
+	// /stop only unsubscribes, even for an admin
+	telegramCommands.Handle(telegramAdminTest, "/stop")
+	assert.Equal(t, domain.TradingStateRunning, tradingController.GetState())
+
+	assert.Equal(t, "Использование: /instrument <symbol>", telegramCommands.Handle(telegramAdminTest, "/instrument"))
+	assert.Equal(t, "Неверный символ инструмента, например PI_XBTUSD", telegramCommands.Handle(telegramAdminTest, "/instrument eth"))
+	assert.Equal(t, "Теперь торгуется PI_ETHUSD, размер ордера 1", telegramCommands.Handle(telegramAdminTest, "/instrument pi_ethusd"))
+	assert.Equal(t, []string{"PI_ETHUSD"}, market.subscription)
+
+	assert.Equal(t, "Торговля приостановлена ⏸", telegramCommands.Handle(telegramAdminTest, "/pause"))
+	assert.Equal(t, domain.TradingStatePaused, tradingController.GetState())
+	assert.Equal(t, "Не удалось изменить состояние торговли: can't change trading state from paused to paused", telegramCommands.Handle(telegramAdminTest, "/pause"))
+	assert.Equal(t, "Торговля возобновлена ▶️", telegramCommands.Handle(telegramAdminTest, "/resume"))
+	assert.Equal(t, "Позиции закрываются, торговля будет остановлена ⏹", telegramCommands.Handle(telegramAdminTest, "/flatten"))
+	assert.Equal(t, domain.TradingStateFlattening, tradingController.GetState())
+}
+
+func TestTelegramCommandsNotificationChannels(t *testing.T) {
+	telegramCommands, usersService, _, _ := newTelegramCommandsTest()
+
+	assert.Equal(t, "Сначала подпишитесь командой /start", telegramCommands.Handle(telegramUserTest, "/channels"))
+	telegramCommands.Handle(telegramUserTest, "/start")
+	assert.Equal(t, "Каналы уведомлений: telegram", telegramCommands.Handle(telegramUserTest, "/channels"))
+
+	assert.Equal(t, "Неизвестный канал sms, доступны: telegram, webhook, email", telegramCommands.Handle(telegramUserTest, "/channels sms"))
+	assert.Equal(t, "Сначала задайте адрес почты командой /email", telegramCommands.Handle(telegramUserTest, "/channels email"))
+	assert.Equal(t, "Неверный адрес почты, например trader@example.com", telegramCommands.Handle(telegramUserTest, "/email trader"))
+	assert.Equal(t, "Адрес почты сохранен, включите канал командой /channels", telegramCommands.Handle(telegramUserTest, "/email trader@example.com"))
+	assert.Equal(t, "Неверный адрес вебхука, например https://example.com/hook", telegramCommands.Handle(telegramUserTest, "/webhook ftp://example.com"))
+	for _, webhookURL := range []string{"http://localhost:8080", "http://127.0.0.1/hook", "http://10.1.2.3/hook", "http://169.254.169.254/latest", "http://[::1]/hook"} {
+		assert.Equal(t, "Адрес вебхука должен быть доступен из интернета", telegramCommands.Handle(telegramUserTest, "/webhook "+webhookURL))
+	}
+	assert.Equal(t, "Адрес вебхука сохранен, включите канал командой /channels", telegramCommands.Handle(telegramUserTest, "/webhook https://example.com/hook"))
+
+	assert.Equal(t, "Уведомления отправляются в: email, webhook", telegramCommands.Handle(telegramUserTest, "/channels Email,webhook email"))
+	assert.Equal(t, []domain.User{{ChatID: telegramUserTest, Channels: "email,webhook", Email: "trader@example.com", WebhookURL: "https://example.com/hook"}}, usersService.GetUsers())
+
+	// Channels parked after failed deliveries are turned on again when they are set
+	user, _ := usersService.GetUser(telegramUserTest)
+	user.ParkedChannels = "webhook,email"
+	usersService.UpdateUser(user)
+	assert.Equal(t, "Каналы уведомлений: email, webhook\nОтключены после ошибок доставки: webhook, email", telegramCommands.Handle(telegramUserTest, "/channels"))
+	telegramCommands.Handle(telegramUserTest, "/webhook https://example.com/new")
+	user, _ = usersService.GetUser(telegramUserTest)
+	assert.Equal(t, "email", user.ParkedChannels)
+	telegramCommands.Handle(telegramUserTest, "/channels email")
+	user, _ = usersService.GetUser(telegramUserTest)
+	assert.Equal(t, "", user.ParkedChannels)
+}
+
+func TestTelegramCommandsLocale(t *testing.T) {
+	telegramCommands, usersService, _, _ := newTelegramCommandsTest()
+
+	assert.Equal(t, "Сначала подпишитесь командой /start", telegramCommands.Handle(telegramUserTest, "/language en"))
+	telegramCommands.Handle(telegramUserTest, "/start")
+
+	assert.Equal(t, "Язык уведомлений: ru", telegramCommands.Handle(telegramUserTest, "/language"))
+	assert.Equal(t, "Неизвестный язык, доступны: ru, en", telegramCommands.Handle(telegramUserTest, "/language de"))
+	// The answer and all later ones are in the new language
+	assert.Equal(t, "Notification language: en", telegramCommands.Handle(telegramUserTest, "/language EN"))
+
+	assert.Equal(t, "Notification time zone: Europe/Moscow", telegramCommands.Handle(telegramUserTest, "/timezone"))
+	assert.Equal(t, "Unknown time zone, e.g. Europe/London or UTC", telegramCommands.Handle(telegramUserTest, "/timezone Mars/Base"))
+	assert.Equal(t, "Unknown time zone, e.g. Europe/London or UTC", telegramCommands.Handle(telegramUserTest, "/timezone Local"))
+	assert.Equal(t, "Notification time zone: Asia/Tokyo", telegramCommands.Handle(telegramUserTest, "/timezone Asia/Tokyo"))
+
+	assert.Equal(t, "Usage: /orders [n]", telegramCommands.Handle(telegramUserTest, "/orders 1 2"))
+	assert.Equal(t, "2021-12-01T10:00:00.000Z buy PI_XBTUSD 1 at 50000.5, filled", telegramCommands.Handle(telegramUserTest, "/orders 1"))
+	assert.Equal(t, "The command is available to admins only ⛔", telegramCommands.Handle(telegramUserTest, "/pause"))
+	assert.Equal(t, "Unknown command, list of commands: /help", telegramCommands.Handle(telegramUserTest, "/unknown"))
+	assert.Contains(t, telegramCommands.Handle(telegramUserTest, "/help"), "Commands:\n/start - subscribe to the order notifications\n")
+	assert.Contains(t, telegramCommands.Handle(telegramUserTest, "/help"), "/orders [n] - last n orders, 5 by default")
+
+	assert.Equal(t, []domain.User{{ChatID: telegramUserTest, Language: domain.LanguageEnglish, Timezone: "Asia/Tokyo"}}, usersService.GetUsers())
+}
+
+func TestTelegramCommandsFilters(t *testing.T) {
+	telegramCommands, usersService, _, _ := newTelegramCommandsTest()
+
+	assert.Equal(t, "Сначала подпишитесь командой /start", telegramCommands.Handle(telegramUserTest, "/filters"))
+	telegramCommands.Handle(telegramUserTest, "/start")
+
+	assert.Equal(t, "Фильтры уведомлений:\nИнструменты: все\nСтороны: все\nМинимальный объем: нет\nТихие часы: нет\nКатегории: все", telegramCommands.Handle(telegramUserTest, "/filters"))
+
+	assert.Equal(t, "Неверный символ инструмента, например PI_XBTUSD", telegramCommands.Handle(telegramUserTest, "/filters instruments xbt"))
+	assert.Equal(t, "Использование: /filters sides <buy|sell|all>", telegramCommands.Handle(telegramUserTest, "/filters sides up"))
+	assert.Equal(t, "Минимальный объем должен быть неотрицательным числом", telegramCommands.Handle(telegramUserTest, "/filters notional -1"))
+	assert.Equal(t, "Использование: /filters quiet <from-to|off>, например /filters quiet 23-7", telegramCommands.Handle(telegramUserTest, "/filters quiet 23-24"))
+	assert.Equal(t, "Неизвестная категория, доступны: fills, risk, errors, summary", telegramCommands.Handle(telegramUserTest, "/filters categories news"))
+	assert.Equal(t, "Неизвестный фильтр, доступны: instruments, sides, notional, quiet, categories", telegramCommands.Handle(telegramUserTest, "/filters size 1"))
+
+	telegramCommands.Handle(telegramUserTest, "/filters instruments pi_xbtusd, PI_ETHUSD")
+	telegramCommands.Handle(telegramUserTest, "/filters sides SELL")
+	telegramCommands.Handle(telegramUserTest, "/filters notional 1000.5")
+	telegramCommands.Handle(telegramUserTest, "/filters categories fills,errors")
+	assert.Equal(t, "Фильтры уведомлений:\nИнструменты: PI_XBTUSD, PI_ETHUSD\nСтороны: sell\nМинимальный объем: 1000.5\nТихие часы: 23:00-07:00 (Europe/Moscow)\nКатегории: fills, errors", telegramCommands.Handle(telegramUserTest, "/filters quiet 23-7"))
+
+	users := usersService.GetUsers()
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, domain.User{ChatID: telegramUserTest, Instruments: "PI_XBTUSD,PI_ETHUSD", Sides: "sell", MinNotional: 1000.5, Categories: "fills,errors", QuietFrom: 23, QuietTo: 7}, users[0])
+	}
+
+	telegramCommands.Handle(telegramUserTest, "/filters instruments all")
+	telegramCommands.Handle(telegramUserTest, "/filters sides all")
+	telegramCommands.Handle(telegramUserTest, "/filters notional off")
+	telegramCommands.Handle(telegramUserTest, "/filters categories all")
+	assert.Equal(t, "Фильтры уведомлений:\nИнструменты: все\nСтороны: все\nМинимальный объем: нет\nТихие часы: нет\nКатегории: все", telegramCommands.Handle(telegramUserTest, "/filters quiet off"))
+}
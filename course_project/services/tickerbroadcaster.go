@@ -0,0 +1,34 @@
+package services
+
+import "github.com/legendiguess/kraken-trade-bot/domain"
+
+type tickerObserver interface {
+	UpdateTicker(ticker domain.Ticker)
+}
+
+// TickerBroadcaster passes tickers from the websocket client to its single consumer,
+// observers are updated synchronously before the consumer receives the ticker,
+// so orders made by the consumer always see the same market data as the consumer
+type TickerBroadcaster struct {
+	tickerChannel <-chan domain.Ticker
+}
+
+func NewTickerBroadcaster(websocketClientService websocketClientService, tickerObservers ...tickerObserver) *TickerBroadcaster {
+	tickerChannel := make(chan domain.Ticker)
+
+	go func() {
+		defer close(tickerChannel)
+		for ticker := range websocketClientService.GetTickerChannel() {
+			for _, tickerObserver := range tickerObservers {
+				tickerObserver.UpdateTicker(ticker)
+			}
+			tickerChannel <- ticker
+		}
+	}()
+
+	return &TickerBroadcaster{tickerChannel: tickerChannel}
+}
+
+func (tickerBroadcaster *TickerBroadcaster) GetTickerChannel() <-chan domain.Ticker {
+	return tickerBroadcaster.tickerChannel
+}
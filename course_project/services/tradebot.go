@@ -1,31 +1,55 @@
 package services
 
 import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
 	"github.com/legendiguess/kraken-trade-bot/domain"
 )
 
 type algorithmService interface {
-	GetActionChannel() <-chan domain.Action
+	GetDecisionChannel() <-chan domain.Decision
+	ResetStrategy(symbol string)
+}
+
+type accountEventService interface {
+	GetAccountEventChannel() <-chan domain.AccountEvent
 }
 
 type instrumentService interface {
-	GetInstrument() (domain.InstrumentConfig, bool)
+	GetInstrument(symbol string) (domain.InstrumentConfig, bool)
+}
+
+type riskService interface {
+	Check(symbol string, side domain.OrderSide, size uint64) error
+	RecordOrder(orderInfo *domain.OrderInfo)
+	SetPositions(positions []domain.Position)
+	GetState() domain.RiskState
+}
+
+type tradingControlService interface {
+	GetState() domain.TradingState
+	GetFlattenChannel() <-chan struct{}
+	FinishFlatten() error
 }
 
 type httpClientService interface {
-	Order(ticker string, side domain.OrderSide) (*domain.OrderInfo, error)
+	SendOrder(orderRequest domain.OrderRequest) (*domain.OrderInfo, error)
+	CancelOrder(orderID string) error
 }
 
 type orderInfosService interface {
 	NewOrderInfo(orderInfo *domain.OrderInfo)
+	NewBlockedOrder(blockedOrder *domain.BlockedOrder)
+	HasOrder(orderID string) bool
+	HasExecution(executionID string) bool
+	SetOrderStatus(orderID string, status domain.OrderStatus)
 }
 
-type telegramBotService interface {
-	SendOrderInfo(chatID int64, orderInfo *domain.OrderInfo)
-}
-
-type tradeBotUsersStorage interface {
-	GetUsers() []domain.User
+type notificationService interface {
+	Dispatch(notification domain.Notification)
 }
 
 type tradeBotLogger interface {
@@ -33,39 +57,326 @@ type tradeBotLogger interface {
 	Printf(format string, args ...interface{})
 }
 
+// TradeBot sends orders for the decisions of the algorithm and keeps the storage in sync with the account feeds,
+// so orders filled or cancelled outside the bot are reflected too
 type TradeBot struct {
+	algorithmService  algorithmService
+	instrumentService instrumentService
+	riskService       riskService
+	tradingControl    tradingControlService
+	httpClientService httpClientService
+	orderInfosService orderInfosService
+	notifications     notificationService
+	logger            tradeBotLogger
+
+	// Order ids of the protective stops by symbol
+	protectiveStops map[string]string
+	// Symbols of the protective stops closed by a fill by order id, until the fill comes
+	triggeredStops map[string]string
+	startedAt      time.Time
+
+	mutex          sync.Mutex
+	marginAccounts []domain.MarginAccount
 }
 
-func NewTradeBot(algorithmService algorithmService, instrumentService instrumentService, httpClientService httpClientService, orderInfosService orderInfosService, tradeBotUsersStorage tradeBotUsersStorage, telegramBot telegramBotService, tradeBotLogger tradeBotLogger) *TradeBot {
-	tradeBot := TradeBot{}
+func NewTradeBot(algorithmService algorithmService, accountEventService accountEventService, instrumentService instrumentService, riskService riskService, tradingControlService tradingControlService, httpClientService httpClientService, orderInfosService orderInfosService, notificationService notificationService, tradeBotLogger tradeBotLogger) *TradeBot {
+	tradeBot := TradeBot{
+		algorithmService:  algorithmService,
+		instrumentService: instrumentService,
+		riskService:       riskService,
+		tradingControl:    tradingControlService,
+		httpClientService: httpClientService,
+		orderInfosService: orderInfosService,
+		notifications:     notificationService,
+		logger:            tradeBotLogger,
+		protectiveStops:   make(map[string]string),
+		triggeredStops:    make(map[string]string),
+		startedAt:         time.Now(),
+	}
 
+	// Decisions and account events are handled one by one, so the fills of the bot orders
+	// are already stored when the same fills come from the feed
 	go func() {
-		for action := range algorithmService.GetActionChannel() {
-			if action == domain.ActionBuy || action == domain.ActionSell {
-				side := domain.OrderSideBuy
-				if action == domain.ActionSell {
-					side = domain.OrderSideSell
-				}
-
-				instrument, _ := instrumentService.GetInstrument()
+		decisions := algorithmService.GetDecisionChannel()
+		accountEvents := accountEventService.GetAccountEventChannel()
+		flattenRequests := tradingControlService.GetFlattenChannel()
 
-				orderInfo, err := httpClientService.Order(instrument.Symbol, side)
-				if err != nil {
-					tradeBotLogger.Panicf("%v", err)
+		for decisions != nil || accountEvents != nil {
+			select {
+			case decision, ok := <-decisions:
+				if !ok {
+					decisions = nil
+					continue
 				}
-				tradeBotLogger.Printf("Successfully send %s %s order", side, instrument.Symbol)
-
-				orderInfosService.NewOrderInfo(orderInfo)
-				if err != nil {
-					tradeBotLogger.Panicf("%v", err)
+				if decision.Action == domain.ActionBuy || decision.Action == domain.ActionSell {
+					tradeBot.execute(decision)
 				}
-
-				for _, user := range tradeBotUsersStorage.GetUsers() {
-					telegramBot.SendOrderInfo(user.ChatID, orderInfo)
+			case accountEvent, ok := <-accountEvents:
+				if !ok {
+					accountEvents = nil
+					continue
 				}
+				tradeBot.handleAccountEvent(accountEvent)
+			case <-flattenRequests:
+				tradeBot.flatten()
 			}
 		}
 	}()
 
 	return &tradeBot
 }
+
+// Last balances reported by the account feed
+func (tradeBot *TradeBot) GetMarginAccounts() []domain.MarginAccount {
+	tradeBot.mutex.Lock()
+	defer tradeBot.mutex.Unlock()
+
+	return append([]domain.MarginAccount(nil), tradeBot.marginAccounts...)
+}
+
+func (tradeBot *TradeBot) execute(decision domain.Decision) {
+	side := domain.OrderSideBuy
+	if decision.Action == domain.ActionSell {
+		side = domain.OrderSideSell
+	}
+
+	instrument, ok := tradeBot.instrumentService.GetInstrument(decision.Symbol)
+	if !ok || !instrument.Enabled {
+		return
+	}
+
+	if state := tradeBot.tradingControl.GetState(); state != domain.TradingStateRunning {
+		tradeBot.logger.Printf("Skipped %s %s order, trading is %s", side, instrument.Symbol, state)
+		return
+	}
+
+	orderRequest := domain.NewMarketOrderRequest(instrument.Symbol, side, instrument.OrderSize)
+	if decision.Plan.Size != 0 {
+		orderRequest.Size = decision.Plan.Size
+	}
+	orderRequest.ReduceOnly = decision.Plan.ReduceOnly
+
+	// Orders blocked by the risk engine are never sent to the exchange
+	if err := tradeBot.riskService.Check(orderRequest.Symbol, orderRequest.Side, orderRequest.Size); err != nil {
+		tradeBot.logger.Printf("Blocked %s %s order: %v", side, instrument.Symbol, err)
+
+		blockedOrder := domain.BlockedOrder{
+			Symbol:    orderRequest.Symbol,
+			Side:      orderRequest.Side,
+			Size:      orderRequest.Size,
+			Reason:    err.Error(),
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		}
+		tradeBot.orderInfosService.NewBlockedOrder(&blockedOrder)
+
+		tradeBot.notifications.Dispatch(domain.Notification{Kind: domain.NotificationKindBlockedOrder, BlockedOrder: &blockedOrder})
+		return
+	}
+
+	// The new order changes the position, so the stop protecting the old one is not needed
+	if stopOrderID, ok := tradeBot.protectiveStops[instrument.Symbol]; ok {
+		if err := tradeBot.httpClientService.CancelOrder(stopOrderID); err != nil {
+			tradeBot.logger.Printf("Can't cancel protective stop %s: %v", stopOrderID, err)
+		}
+		delete(tradeBot.protectiveStops, instrument.Symbol)
+	}
+
+	orderInfo, err := tradeBot.httpClientService.SendOrder(orderRequest)
+	if err != nil {
+		tradeBot.notifyError("Can't send %s %s order: %v", side, instrument.Symbol, err)
+		return
+	}
+	tradeBot.logger.Printf("Successfully send %s %s order", side, instrument.Symbol)
+
+	tradeBot.riskService.RecordOrder(orderInfo)
+	tradeBot.orderInfosService.NewOrderInfo(orderInfo)
+
+	tradeBot.notifications.Dispatch(domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: orderInfo})
+
+	if decision.Plan.StopPrice != 0 && orderInfo.Amount > 0 {
+		tradeBot.placeProtectiveStop(orderInfo, decision.Plan.StopPrice)
+	}
+}
+
+// Stop order closes the executed amount if the price goes against the position
+func (tradeBot *TradeBot) placeProtectiveStop(orderInfo *domain.OrderInfo, stopPrice float64) {
+	side := domain.OrderSideSell
+	if orderInfo.Side == domain.OrderSideSell {
+		side = domain.OrderSideBuy
+	}
+
+	stopInfo, err := tradeBot.httpClientService.SendOrder(domain.OrderRequest{
+		Symbol:     orderInfo.Symbol,
+		Side:       side,
+		OrderType:  domain.OrderTypeStop,
+		Size:       orderInfo.Amount,
+		StopPrice:  stopPrice,
+		ReduceOnly: true,
+	})
+	if err != nil {
+		tradeBot.notifyError("Can't place protective stop for %s: %v", orderInfo.Symbol, err)
+		return
+	}
+	tradeBot.logger.Printf("Placed protective stop for %s at %v", orderInfo.Symbol, stopPrice)
+
+	tradeBot.protectiveStops[orderInfo.Symbol] = stopInfo.OrderID
+	tradeBot.orderInfosService.NewOrderInfo(stopInfo)
+}
+
+// Protective stops are cancelled and open positions are closed with reduce-only market orders,
+// these orders are not checked by the risk engine. Trading is stopped even if some orders fail
+func (tradeBot *TradeBot) flatten() {
+	tradeBot.logger.Printf("Closing all positions")
+
+	for symbol, stopOrderID := range tradeBot.protectiveStops {
+		if err := tradeBot.httpClientService.CancelOrder(stopOrderID); err != nil {
+			tradeBot.logger.Printf("Can't cancel protective stop %s: %v", stopOrderID, err)
+		}
+		delete(tradeBot.protectiveStops, symbol)
+	}
+
+	for _, position := range tradeBot.riskService.GetState().Positions {
+		side := domain.OrderSideSell
+		size := position.Quantity
+		if position.Quantity < 0 {
+			side = domain.OrderSideBuy
+			size = -position.Quantity
+		}
+
+		orderRequest := domain.NewMarketOrderRequest(position.Symbol, side, uint64(math.Ceil(size)))
+		orderRequest.ReduceOnly = true
+
+		orderInfo, err := tradeBot.httpClientService.SendOrder(orderRequest)
+		if err != nil {
+			tradeBot.notifyError("Can't close %s position: %v", position.Symbol, err)
+			continue
+		}
+		tradeBot.logger.Printf("Closed %s position of %v", position.Symbol, position.Quantity)
+
+		tradeBot.riskService.RecordOrder(orderInfo)
+		tradeBot.orderInfosService.NewOrderInfo(orderInfo)
+
+		tradeBot.notifications.Dispatch(domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: orderInfo})
+	}
+
+	if err := tradeBot.tradingControl.FinishFlatten(); err != nil {
+		tradeBot.logger.Printf("Can't stop trading: %v", err)
+	}
+}
+
+// Log the error and send it to the subscribers
+func (tradeBot *TradeBot) notifyError(format string, args ...interface{}) {
+	tradeBot.logger.Printf(format, args...)
+	tradeBot.notifications.Dispatch(domain.Notification{Kind: domain.NotificationKindError, Error: fmt.Sprintf(format, args...)})
+}
+
+func (tradeBot *TradeBot) handleAccountEvent(accountEvent domain.AccountEvent) {
+	switch accountEvent.Type {
+	case domain.AccountEventFills:
+		for _, fill := range accountEvent.Fills {
+			tradeBot.handleFill(fill, accountEvent.Snapshot)
+		}
+	case domain.AccountEventOpenOrders:
+		for _, openOrder := range accountEvent.OpenOrders {
+			if tradeBot.orderInfosService.HasOrder(openOrder.OrderID) {
+				continue
+			}
+			tradeBot.logger.Printf("Order %s %s %s is placed outside the bot", openOrder.OrderID, openOrder.Side, openOrder.Symbol)
+
+			tradeBot.orderInfosService.NewOrderInfo(&domain.OrderInfo{
+				OrderID:       openOrder.OrderID,
+				ClientOrderID: openOrder.ClientOrderID,
+				Status:        domain.OrderStatusPlaced,
+				Type:          openOrder.Type,
+				Symbol:        openOrder.Symbol,
+				Side:          openOrder.Side,
+				Quantity:      uint64(openOrder.Quantity),
+				LimitPrice:    openOrder.LimitPrice,
+				StopPrice:     openOrder.StopPrice,
+				ReduceOnly:    openOrder.ReduceOnly,
+				Timestamp:     openOrder.Timestamp,
+			})
+		}
+	case domain.AccountEventOrderClosed:
+		status := domain.OrderStatusCancelled
+		if accountEvent.Reason == domain.OrderClosedFullFill {
+			status = domain.OrderStatusFilled
+		}
+		tradeBot.logger.Printf("Order %s is closed: %s", accountEvent.OrderID, accountEvent.Reason)
+
+		tradeBot.orderInfosService.SetOrderStatus(accountEvent.OrderID, status)
+
+		for symbol, stopOrderID := range tradeBot.protectiveStops {
+			if stopOrderID == accountEvent.OrderID {
+				delete(tradeBot.protectiveStops, symbol)
+				if status == domain.OrderStatusFilled {
+					tradeBot.triggeredStops[stopOrderID] = symbol
+				}
+			}
+		}
+	case domain.AccountEventPositions:
+		tradeBot.riskService.SetPositions(accountEvent.Positions)
+	case domain.AccountEventBalances:
+		tradeBot.mutex.Lock()
+		tradeBot.marginAccounts = accountEvent.MarginAccounts
+		tradeBot.mutex.Unlock()
+	}
+}
+
+// Fills which are not stored yet are made outside the bot or by its resting orders,
+// snapshot fills made before the start are history and are skipped
+func (tradeBot *TradeBot) handleFill(fill domain.Fill, snapshot bool) {
+	if snapshot {
+		fillTime, err := time.Parse(time.RFC3339, fill.Timestamp)
+		if err != nil || fillTime.Before(tradeBot.startedAt) {
+			return
+		}
+	}
+
+	if tradeBot.orderInfosService.HasExecution(fill.FillID) {
+		return
+	}
+	tradeBot.logger.Printf("Received fill %s of order %s", fill.FillID, fill.OrderID)
+
+	orderInfo := domain.OrderInfo{
+		OrderID:       fill.OrderID,
+		ExecutionID:   fill.FillID,
+		ClientOrderID: fill.ClientOrderID,
+		Status:        domain.OrderStatusFilled,
+		Price:         fill.Price,
+		Amount:        uint64(fill.Quantity),
+		Symbol:        fill.Symbol,
+		Side:          fill.Side,
+		Quantity:      uint64(fill.Quantity),
+		Fee:           fill.Fee,
+		Timestamp:     fill.Timestamp,
+	}
+
+	tradeBot.riskService.RecordOrder(&orderInfo)
+	tradeBot.orderInfosService.NewOrderInfo(&orderInfo)
+
+	tradeBot.notifications.Dispatch(domain.Notification{Kind: domain.NotificationKindOrder, OrderInfo: &orderInfo})
+
+	tradeBot.handleStopFill(fill.OrderID)
+}
+
+// Position is changed by the protective stop behind the strategy's back, so the strategy starts over
+// from the position left after the fill. The stop may be closed before or after its fills come
+func (tradeBot *TradeBot) handleStopFill(orderID string) {
+	symbol, ok := tradeBot.triggeredStops[orderID]
+	if ok {
+		delete(tradeBot.triggeredStops, orderID)
+	} else {
+		for stopSymbol, stopOrderID := range tradeBot.protectiveStops {
+			if stopOrderID == orderID {
+				symbol, ok = stopSymbol, true
+			}
+		}
+	}
+	if !ok {
+		return
+	}
+
+	tradeBot.logger.Printf("Protective stop %s of %s is filled, the strategy starts over", orderID, symbol)
+	tradeBot.algorithmService.ResetStrategy(symbol)
+}
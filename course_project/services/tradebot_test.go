@@ -0,0 +1,391 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type tradeBotChannelsTest struct {
+	decisions     chan domain.Decision
+	accountEvents chan domain.AccountEvent
+	resets        []string
+}
+
+func (tradeBotChannelsTest *tradeBotChannelsTest) GetDecisionChannel() <-chan domain.Decision {
+	return tradeBotChannelsTest.decisions
+}
+
+func (tradeBotChannelsTest *tradeBotChannelsTest) ResetStrategy(symbol string) {
+	tradeBotChannelsTest.resets = append(tradeBotChannelsTest.resets, symbol)
+}
+
+func (tradeBotChannelsTest *tradeBotChannelsTest) GetAccountEventChannel() <-chan domain.AccountEvent {
+	return tradeBotChannelsTest.accountEvents
+}
+
+type tradeBotRiskTest struct {
+	blocked   bool
+	recorded  []domain.OrderInfo
+	positions []domain.Position
+}
+
+func (tradeBotRiskTest *tradeBotRiskTest) Check(symbol string, side domain.OrderSide, size uint64) error {
+	if tradeBotRiskTest.blocked {
+		return errors.New("blocked")
+	}
+	return nil
+}
+
+func (tradeBotRiskTest *tradeBotRiskTest) RecordOrder(orderInfo *domain.OrderInfo) {
+	tradeBotRiskTest.recorded = append(tradeBotRiskTest.recorded, *orderInfo)
+}
+
+func (tradeBotRiskTest *tradeBotRiskTest) SetPositions(positions []domain.Position) {
+	tradeBotRiskTest.positions = positions
+}
+
+func (tradeBotRiskTest *tradeBotRiskTest) GetState() domain.RiskState {
+	return domain.RiskState{Positions: tradeBotRiskTest.positions}
+}
+
+type tradingControlTest struct {
+	mutex           sync.Mutex
+	state           domain.TradingState
+	flattenRequests chan struct{}
+}
+
+func (tradingControlTest *tradingControlTest) GetState() domain.TradingState {
+	tradingControlTest.mutex.Lock()
+	defer tradingControlTest.mutex.Unlock()
+
+	return tradingControlTest.state
+}
+
+func (tradingControlTest *tradingControlTest) setState(state domain.TradingState) {
+	tradingControlTest.mutex.Lock()
+	defer tradingControlTest.mutex.Unlock()
+
+	tradingControlTest.state = state
+}
+
+func (tradingControlTest *tradingControlTest) GetFlattenChannel() <-chan struct{} {
+	return tradingControlTest.flattenRequests
+}
+
+func (tradingControlTest *tradingControlTest) FinishFlatten() error {
+	tradingControlTest.setState(domain.TradingStateStopped)
+	return nil
+}
+
+type tradeBotExchangeTest struct {
+	requests  []domain.OrderRequest
+	cancelled []string
+	// Returned by SendOrder if set
+	err error
+}
+
+func (tradeBotExchangeTest *tradeBotExchangeTest) SendOrder(orderRequest domain.OrderRequest) (*domain.OrderInfo, error) {
+	tradeBotExchangeTest.requests = append(tradeBotExchangeTest.requests, orderRequest)
+	if tradeBotExchangeTest.err != nil {
+		return nil, tradeBotExchangeTest.err
+	}
+
+	orderInfo := domain.OrderInfo{OrderID: orderRequest.Symbol + string(orderRequest.OrderType), Symbol: orderRequest.Symbol, Side: orderRequest.Side, Quantity: orderRequest.Size}
+	if orderRequest.OrderType == domain.OrderTypeMarket {
+		orderInfo.Status = domain.OrderStatusFilled
+		orderInfo.ExecutionID = "execution"
+		orderInfo.Amount = orderRequest.Size
+		orderInfo.Price = 100
+	} else {
+		orderInfo.Status = domain.OrderStatusPlaced
+	}
+	return &orderInfo, nil
+}
+
+func (tradeBotExchangeTest *tradeBotExchangeTest) CancelOrder(orderID string) error {
+	tradeBotExchangeTest.cancelled = append(tradeBotExchangeTest.cancelled, orderID)
+	return nil
+}
+
+type orderInfosServiceTest struct {
+	mutex         sync.Mutex
+	orderInfos    []domain.OrderInfo
+	blockedOrders []domain.BlockedOrder
+	statuses      map[string]domain.OrderStatus
+}
+
+func (orderInfosServiceTest *orderInfosServiceTest) NewOrderInfo(orderInfo *domain.OrderInfo) {
+	orderInfosServiceTest.mutex.Lock()
+	defer orderInfosServiceTest.mutex.Unlock()
+
+	orderInfosServiceTest.orderInfos = append(orderInfosServiceTest.orderInfos, *orderInfo)
+}
+
+func (orderInfosServiceTest *orderInfosServiceTest) NewBlockedOrder(blockedOrder *domain.BlockedOrder) {
+	orderInfosServiceTest.mutex.Lock()
+	defer orderInfosServiceTest.mutex.Unlock()
+
+	orderInfosServiceTest.blockedOrders = append(orderInfosServiceTest.blockedOrders, *blockedOrder)
+}
+
+func (orderInfosServiceTest *orderInfosServiceTest) HasOrder(orderID string) bool {
+	for _, orderInfo := range orderInfosServiceTest.getOrderInfos() {
+		if orderInfo.OrderID == orderID {
+			return true
+		}
+	}
+	return false
+}
+
+func (orderInfosServiceTest *orderInfosServiceTest) HasExecution(executionID string) bool {
+	for _, orderInfo := range orderInfosServiceTest.getOrderInfos() {
+		if orderInfo.ExecutionID == executionID {
+			return true
+		}
+		for _, laterExecutionID := range strings.Split(orderInfo.LaterExecutionIDs, ",") {
+			if laterExecutionID == executionID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (orderInfosServiceTest *orderInfosServiceTest) SetOrderStatus(orderID string, status domain.OrderStatus) {
+	orderInfosServiceTest.mutex.Lock()
+	defer orderInfosServiceTest.mutex.Unlock()
+
+	orderInfosServiceTest.statuses[orderID] = status
+}
+
+func (orderInfosServiceTest *orderInfosServiceTest) getOrderInfos() []domain.OrderInfo {
+	orderInfosServiceTest.mutex.Lock()
+	defer orderInfosServiceTest.mutex.Unlock()
+
+	return append([]domain.OrderInfo(nil), orderInfosServiceTest.orderInfos...)
+}
+
+type tradeBotNotificationsTest struct {
+	mutex         sync.Mutex
+	messages      int
+	notifications []domain.Notification
+}
+
+func (tradeBotNotificationsTest *tradeBotNotificationsTest) Dispatch(notification domain.Notification) {
+	tradeBotNotificationsTest.mutex.Lock()
+	defer tradeBotNotificationsTest.mutex.Unlock()
+
+	tradeBotNotificationsTest.messages++
+	tradeBotNotificationsTest.notifications = append(tradeBotNotificationsTest.notifications, notification)
+}
+
+func (tradeBotNotificationsTest *tradeBotNotificationsTest) getNotifications() []domain.Notification {
+	tradeBotNotificationsTest.mutex.Lock()
+	defer tradeBotNotificationsTest.mutex.Unlock()
+
+	return append([]domain.Notification(nil), tradeBotNotificationsTest.notifications...)
+}
+
+func (tradeBotNotificationsTest *tradeBotNotificationsTest) getMessages() int {
+	tradeBotNotificationsTest.mutex.Lock()
+	defer tradeBotNotificationsTest.mutex.Unlock()
+
+	return tradeBotNotificationsTest.messages
+}
+
+type tradeBotLoggerTest struct{}
+
+func (tradeBotLoggerTest *tradeBotLoggerTest) Panicf(format string, args ...interface{}) {}
+func (tradeBotLoggerTest *tradeBotLoggerTest) Printf(format string, args ...interface{}) {}
+
+type tradeBotTest struct {
+	channels      tradeBotChannelsTest
+	risk          tradeBotRiskTest
+	control       tradingControlTest
+	exchange      tradeBotExchangeTest
+	orderInfos    orderInfosServiceTest
+	notifications tradeBotNotificationsTest
+	tradeBot      *services.TradeBot
+}
+
+func newTradeBotTest() *tradeBotTest {
+	test := tradeBotTest{
+		channels:   tradeBotChannelsTest{decisions: make(chan domain.Decision), accountEvents: make(chan domain.AccountEvent)},
+		control:    tradingControlTest{state: domain.TradingStateRunning, flattenRequests: make(chan struct{})},
+		orderInfos: orderInfosServiceTest{statuses: make(map[string]domain.OrderStatus)},
+	}
+	test.tradeBot = services.NewTradeBot(&test.channels, &test.channels, newAlgorithmInstrumentServiceTest("test"), &test.risk, &test.control, &test.exchange, &test.orderInfos, &test.notifications, &tradeBotLoggerTest{})
+	return &test
+}
+
+// Channels are unbuffered, so the previous message is handled when the next one is received
+func (test *tradeBotTest) sync() {
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionNothing}
+}
+
+func TestTradeBotProtectiveStop(t *testing.T) {
+	test := newTradeBotTest()
+	defer close(test.channels.decisions)
+	defer close(test.channels.accountEvents)
+
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy, Plan: domain.OrderPlan{Size: 3, StopPrice: 90}}
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionSell, Plan: domain.OrderPlan{ReduceOnly: true}}
+	test.sync()
+
+	assert.Equal(t, []domain.OrderRequest{
+		{Symbol: "test", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeMarket, Size: 3},
+		{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 3, StopPrice: 90, ReduceOnly: true},
+		{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeMarket, Size: 1, ReduceOnly: true},
+	}, test.exchange.requests)
+	assert.Equal(t, []string{"teststp"}, test.exchange.cancelled)
+	assert.Equal(t, 3, len(test.orderInfos.getOrderInfos()))
+	assert.Equal(t, 2, len(test.risk.recorded))
+	assert.Equal(t, 2, test.notifications.getMessages())
+
+	// Stop closed by the exchange is not cancelled again
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy, Plan: domain.OrderPlan{StopPrice: 90}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventOrderClosed, OrderID: "teststp", Reason: domain.OrderClosedFullFill}
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionSell}
+	test.sync()
+
+	assert.Equal(t, []string{"teststp"}, test.exchange.cancelled)
+	assert.Equal(t, domain.OrderStatusFilled, test.orderInfos.statuses["teststp"])
+	assert.Empty(t, test.channels.resets)
+}
+
+func TestTradeBotProtectiveStopFill(t *testing.T) {
+	test := newTradeBotTest()
+	defer close(test.channels.decisions)
+	defer close(test.channels.accountEvents)
+
+	stopFill := func(fillID string) domain.AccountEvent {
+		return domain.AccountEvent{Type: domain.AccountEventFills, Fills: []domain.Fill{{FillID: fillID, OrderID: "teststp", Symbol: "test", Side: domain.OrderSideSell, Price: 90, Quantity: 1}}}
+	}
+
+	// Fill of the open stop
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy, Plan: domain.OrderPlan{StopPrice: 90}}
+	test.channels.accountEvents <- stopFill("first")
+	test.sync()
+	assert.Equal(t, []string{"test"}, test.channels.resets)
+
+	// Fill of the stop which is already closed
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventOrderClosed, OrderID: "teststp", Reason: domain.OrderClosedFullFill}
+	test.channels.accountEvents <- stopFill("second")
+	test.sync()
+	assert.Equal(t, []string{"test", "test"}, test.channels.resets)
+
+	// Fills of other orders don't reset the strategy
+	test.channels.accountEvents <- stopFill("third")
+	test.sync()
+	assert.Equal(t, []string{"test", "test"}, test.channels.resets)
+	assert.Len(t, test.risk.recorded, 4)
+}
+
+func TestTradeBotBlockedOrder(t *testing.T) {
+	test := newTradeBotTest()
+	defer close(test.channels.decisions)
+	defer close(test.channels.accountEvents)
+
+	test.risk.blocked = true
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy}
+	test.channels.decisions <- domain.Decision{Symbol: "disabled", Action: domain.ActionBuy}
+	test.sync()
+
+	assert.Empty(t, test.exchange.requests)
+	assert.Equal(t, 1, len(test.orderInfos.blockedOrders))
+	assert.Equal(t, "blocked", test.orderInfos.blockedOrders[0].Reason)
+	assert.Equal(t, 1, test.notifications.getMessages())
+}
+
+func TestTradeBotSendError(t *testing.T) {
+	test := newTradeBotTest()
+	defer close(test.channels.decisions)
+	defer close(test.channels.accountEvents)
+
+	test.exchange.err = errors.New("unavailable")
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy}
+	test.sync()
+
+	assert.Empty(t, test.orderInfos.getOrderInfos())
+	assert.Equal(t, []domain.Notification{{Kind: domain.NotificationKindError, Error: "Can't send buy test order: unavailable"}}, test.notifications.getNotifications())
+}
+
+func TestTradeBotAccountEvents(t *testing.T) {
+	test := newTradeBotTest()
+	defer close(test.channels.decisions)
+	defer close(test.channels.accountEvents)
+
+	fill := domain.Fill{FillID: "fill", OrderID: "outside", Symbol: "test", Side: domain.OrderSideSell, Price: 100, Quantity: 2, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+	oldFill := domain.Fill{FillID: "old", OrderID: "old", Symbol: "test", Side: domain.OrderSideBuy, Price: 100, Quantity: 2, Timestamp: "2021-11-25T19:51:10.056Z"}
+	// The order sent by the bot was filled by two executions, the feed repeats both of them
+	test.orderInfos.NewOrderInfo(&domain.OrderInfo{OrderID: "sent", ExecutionID: "first", LaterExecutionIDs: "second", Status: domain.OrderStatusFilled, Amount: 3})
+	sentFills := []domain.Fill{
+		{FillID: "first", OrderID: "sent", Symbol: "test", Side: domain.OrderSideBuy, Price: 100, Quantity: 1, Timestamp: time.Now().UTC().Format(time.RFC3339)},
+		{FillID: "second", OrderID: "sent", Symbol: "test", Side: domain.OrderSideBuy, Price: 101, Quantity: 2, Timestamp: time.Now().UTC().Format(time.RFC3339)},
+	}
+
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventFills, Snapshot: true, Fills: []domain.Fill{oldFill}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventFills, Fills: []domain.Fill{fill}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventFills, Fills: sentFills}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventFills, Snapshot: true, Fills: []domain.Fill{oldFill, fill}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventOpenOrders, OpenOrders: []domain.OpenOrder{{OrderID: "resting", Symbol: "test", Side: domain.OrderSideBuy, Quantity: 1, LimitPrice: 90}}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventOpenOrders, OpenOrders: []domain.OpenOrder{{OrderID: "resting", Symbol: "test", Side: domain.OrderSideBuy, Quantity: 1, LimitPrice: 90}}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventPositions, Positions: []domain.Position{{Symbol: "test", Quantity: -2, AverageEntryPrice: 100}}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventBalances, MarginAccounts: []domain.MarginAccount{{Name: "flex", Balance: 1000}}}
+	test.sync()
+
+	orderInfos := test.orderInfos.getOrderInfos()[1:]
+	assert.Equal(t, 2, len(orderInfos))
+	assert.Equal(t, "fill", orderInfos[0].ExecutionID)
+	assert.Equal(t, domain.OrderStatusFilled, orderInfos[0].Status)
+	assert.Equal(t, uint64(2), orderInfos[0].Amount)
+	assert.Equal(t, "resting", orderInfos[1].OrderID)
+	assert.Equal(t, domain.OrderStatusPlaced, orderInfos[1].Status)
+
+	assert.Equal(t, 1, len(test.risk.recorded))
+	assert.Equal(t, []domain.Position{{Symbol: "test", Quantity: -2, AverageEntryPrice: 100}}, test.risk.positions)
+	assert.Equal(t, []domain.MarginAccount{{Name: "flex", Balance: 1000}}, test.tradeBot.GetMarginAccounts())
+	assert.Equal(t, 1, test.notifications.getMessages())
+}
+
+func TestTradeBotTradingState(t *testing.T) {
+	test := newTradeBotTest()
+	defer close(test.channels.decisions)
+	defer close(test.channels.accountEvents)
+
+	test.control.setState(domain.TradingStatePaused)
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy}
+	test.sync()
+	assert.Empty(t, test.exchange.requests)
+
+	test.control.setState(domain.TradingStateRunning)
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy, Plan: domain.OrderPlan{StopPrice: 90}}
+	test.channels.accountEvents <- domain.AccountEvent{Type: domain.AccountEventPositions, Positions: []domain.Position{{Symbol: "test", Quantity: 1}, {Symbol: "other", Quantity: -2}}}
+
+	// Positions are closed even with the blocking risk engine, then trading is stopped
+	test.risk.blocked = true
+	test.control.setState(domain.TradingStateFlattening)
+	test.control.flattenRequests <- struct{}{}
+	test.sync()
+
+	assert.Equal(t, []domain.OrderRequest{
+		{Symbol: "test", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeMarket, Size: 1},
+		{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 1, StopPrice: 90, ReduceOnly: true},
+		{Symbol: "test", Side: domain.OrderSideSell, OrderType: domain.OrderTypeMarket, Size: 1, ReduceOnly: true},
+		{Symbol: "other", Side: domain.OrderSideBuy, OrderType: domain.OrderTypeMarket, Size: 2, ReduceOnly: true},
+	}, test.exchange.requests)
+	assert.Equal(t, []string{"teststp"}, test.exchange.cancelled)
+	assert.Equal(t, domain.TradingStateStopped, test.control.GetState())
+
+	test.risk.blocked = false
+	test.channels.decisions <- domain.Decision{Symbol: "test", Action: domain.ActionBuy}
+	test.sync()
+	assert.Len(t, test.exchange.requests, 4)
+}
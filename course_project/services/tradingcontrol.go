@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Sources of the trading state changes
+const (
+	TradingSourceAPI      = "api"
+	TradingSourceTelegram = "telegram"
+	TradingSourceBot      = "bot"
+)
+
+type tradingControlStorage interface {
+	SaveTradingTransition(transition *domain.TradingTransition)
+	// Last transitions from the newest one
+	GetTradingTransitions(limit int) []domain.TradingTransition
+}
+
+// TradingStateError is returned when the trading state can't be changed from the current one
+type TradingStateError struct {
+	From domain.TradingState
+	To   domain.TradingState
+}
+
+func (tradingStateError *TradingStateError) Error() string {
+	return fmt.Sprintf("can't change trading state from %s to %s", tradingStateError.From, tradingStateError.To)
+}
+
+// States every state can be changed to, flattening is finished only by the bot
+var tradingTransitions = map[domain.TradingState][]domain.TradingState{
+	domain.TradingStateRunning:    {domain.TradingStatePaused, domain.TradingStateFlattening},
+	domain.TradingStatePaused:     {domain.TradingStateRunning, domain.TradingStateFlattening},
+	domain.TradingStateFlattening: {domain.TradingStateStopped},
+	domain.TradingStateStopped:    {domain.TradingStateRunning},
+}
+
+// TradingController is the trading state machine, every change is saved to the audit trail.
+// The state is restored from the last saved change, so the bot started again keeps being paused or stopped
+type TradingController struct {
+	storage tradingControlStorage
+
+	mutex sync.Mutex
+	state domain.TradingState
+	// Receives a value when positions must be closed
+	flattenChannel chan struct{}
+}
+
+// Trading is running if no changes are saved, interrupted flattening is requested again
+func NewTradingController(tradingControlStorage tradingControlStorage) *TradingController {
+	tradingController := TradingController{
+		storage:        tradingControlStorage,
+		state:          domain.TradingStateRunning,
+		flattenChannel: make(chan struct{}, 1),
+	}
+
+	if transitions := tradingControlStorage.GetTradingTransitions(1); len(transitions) > 0 {
+		tradingController.state = transitions[0].To
+	}
+	if tradingController.state == domain.TradingStateFlattening {
+		tradingController.flattenChannel <- struct{}{}
+	}
+
+	return &tradingController
+}
+
+func (tradingController *TradingController) GetState() domain.TradingState {
+	tradingController.mutex.Lock()
+	defer tradingController.mutex.Unlock()
+
+	return tradingController.state
+}
+
+// Start sending orders from the paused or stopped state
+func (tradingController *TradingController) Start(source string, actor string) error {
+	return tradingController.change(domain.TradingStateRunning, source, actor)
+}
+
+// Stop sending orders, market data is still received
+func (tradingController *TradingController) Pause(source string, actor string) error {
+	return tradingController.change(domain.TradingStatePaused, source, actor)
+}
+
+// Close open positions and stop trading, positions are closed by the trade bot which calls FinishFlatten
+func (tradingController *TradingController) Flatten(source string, actor string) error {
+	if err := tradingController.change(domain.TradingStateFlattening, source, actor); err != nil {
+		return err
+	}
+
+	select {
+	case tradingController.flattenChannel <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Called by the trade bot after the orders closing the positions are sent
+func (tradingController *TradingController) FinishFlatten() error {
+	return tradingController.change(domain.TradingStateStopped, TradingSourceBot, "")
+}
+
+func (tradingController *TradingController) GetFlattenChannel() <-chan struct{} {
+	return tradingController.flattenChannel
+}
+
+// Last changes of the state from the newest one
+func (tradingController *TradingController) GetTransitions(limit int) []domain.TradingTransition {
+	return tradingController.storage.GetTradingTransitions(limit)
+}
+
+func (tradingController *TradingController) change(state domain.TradingState, source string, actor string) error {
+	tradingController.mutex.Lock()
+	defer tradingController.mutex.Unlock()
+
+	allowed := false
+	for _, next := range tradingTransitions[tradingController.state] {
+		allowed = allowed || next == state
+	}
+	if !allowed {
+		return &TradingStateError{From: tradingController.state, To: state}
+	}
+
+	tradingController.storage.SaveTradingTransition(&domain.TradingTransition{
+		From:      tradingController.state,
+		To:        state,
+		Source:    source,
+		Actor:     actor,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	tradingController.state = state
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type tradingControlStorageTest struct {
+	transitions []domain.TradingTransition
+}
+
+func (tradingControlStorageTest *tradingControlStorageTest) SaveTradingTransition(transition *domain.TradingTransition) {
+	tradingControlStorageTest.transitions = append([]domain.TradingTransition{*transition}, tradingControlStorageTest.transitions...)
+}
+
+func (tradingControlStorageTest *tradingControlStorageTest) GetTradingTransitions(limit int) []domain.TradingTransition {
+	if limit < len(tradingControlStorageTest.transitions) {
+		return tradingControlStorageTest.transitions[:limit]
+	}
+	return tradingControlStorageTest.transitions
+}
+
+func TestTradingController(t *testing.T) {
+	storage := tradingControlStorageTest{}
+	tradingController := services.NewTradingController(&storage)
+	assert.Equal(t, domain.TradingStateRunning, tradingController.GetState())
+
+	assert.Nil(t, tradingController.Pause(services.TradingSourceAPI, "127.0.0.1"))
+	assert.Equal(t, &services.TradingStateError{From: domain.TradingStatePaused, To: domain.TradingStatePaused}, tradingController.Pause(services.TradingSourceAPI, ""))
+	assert.Nil(t, tradingController.Start(services.TradingSourceTelegram, "1"))
+
+	assert.Nil(t, tradingController.Flatten(services.TradingSourceAPI, "127.0.0.1"))
+	assert.Equal(t, domain.TradingStateFlattening, tradingController.GetState())
+	<-tradingController.GetFlattenChannel()
+
+	// Nothing can be done until positions are closed
+	assert.NotNil(t, tradingController.Start(services.TradingSourceAPI, ""))
+	assert.Nil(t, tradingController.FinishFlatten())
+	assert.Equal(t, domain.TradingStateStopped, tradingController.GetState())
+	assert.NotNil(t, tradingController.Pause(services.TradingSourceAPI, ""))
+
+	transitions := tradingController.GetTransitions(10)
+	if assert.Len(t, transitions, 4) {
+		assert.Equal(t, domain.TradingTransition{From: domain.TradingStateFlattening, To: domain.TradingStateStopped, Source: services.TradingSourceBot, Timestamp: transitions[0].Timestamp}, transitions[0])
+		assert.Equal(t, "1", transitions[2].Actor)
+		assert.Equal(t, services.TradingSourceTelegram, transitions[2].Source)
+	}
+
+	// State is restored after the restart
+	assert.Equal(t, domain.TradingStateStopped, services.NewTradingController(&storage).GetState())
+}
+
+func TestTradingControllerInterruptedFlatten(t *testing.T) {
+	storage := tradingControlStorageTest{transitions: []domain.TradingTransition{{From: domain.TradingStateRunning, To: domain.TradingStateFlattening}}}
+	tradingController := services.NewTradingController(&storage)
+
+	assert.Equal(t, domain.TradingStateFlattening, tradingController.GetState())
+	select {
+	case <-tradingController.GetFlattenChannel():
+	default:
+		t.Error("flatten is not requested again")
+	}
+}
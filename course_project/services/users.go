@@ -8,6 +8,12 @@ type usersStorage interface {
 	NewUser(newUser *domain.User)
 	GetUsers() []domain.User
 	FindUser(findUser *domain.User) (domain.User, bool)
+	UpdateUser(user domain.User)
+	DeleteUser(chatID int64) bool
+	SaveAdmin(admin domain.Admin)
+	DeleteAdmin(chatID int64) bool
+	GetAdmins() []domain.Admin
+	IsAdmin(chatID int64) bool
 }
 
 func NewUsersService(storage usersStorage) *UsersService {
@@ -30,3 +36,34 @@ func (usersService *UsersService) CheckAddUser(user *domain.User) {
 func (usersService *UsersService) GetUsers() []domain.User {
 	return usersService.storage.GetUsers()
 }
+
+// False if the chat is not subscribed
+func (usersService *UsersService) GetUser(chatID int64) (domain.User, bool) {
+	return usersService.storage.FindUser(&domain.User{ChatID: chatID})
+}
+
+// Save notification settings of the subscribed chat
+func (usersService *UsersService) UpdateUser(user domain.User) {
+	usersService.storage.UpdateUser(user)
+}
+
+// False if the chat is not subscribed
+func (usersService *UsersService) DeleteUser(chatID int64) bool {
+	return usersService.storage.DeleteUser(chatID)
+}
+
+func (usersService *UsersService) AddAdmin(chatID int64) {
+	usersService.storage.SaveAdmin(domain.Admin{ChatID: chatID})
+}
+
+func (usersService *UsersService) DeleteAdmin(chatID int64) bool {
+	return usersService.storage.DeleteAdmin(chatID)
+}
+
+func (usersService *UsersService) GetAdmins() []domain.Admin {
+	return usersService.storage.GetAdmins()
+}
+
+func (usersService *UsersService) IsAdmin(chatID int64) bool {
+	return usersService.storage.IsAdmin(chatID)
+}
@@ -9,7 +9,8 @@ import (
 )
 
 type testUsersStorage struct {
-	users []domain.User
+	users  []domain.User
+	admins []domain.Admin
 }
 
 func (testUsersStorage *testUsersStorage) NewUser(newUser *domain.User) {
@@ -30,6 +31,53 @@ func (testUsersStorage *testUsersStorage) FindUser(findUser *domain.User) (domai
 	return domain.User{}, false
 }
 
+func (testUsersStorage *testUsersStorage) UpdateUser(updateUser domain.User) {
+	for i, user := range testUsersStorage.users {
+		if user.ChatID == updateUser.ChatID {
+			testUsersStorage.users[i] = updateUser
+		}
+	}
+}
+
+func (testUsersStorage *testUsersStorage) DeleteUser(chatID int64) bool {
+	for i, user := range testUsersStorage.users {
+		if user.ChatID == chatID {
+			testUsersStorage.users = append(testUsersStorage.users[:i], testUsersStorage.users[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (testUsersStorage *testUsersStorage) SaveAdmin(admin domain.Admin) {
+	if !testUsersStorage.IsAdmin(admin.ChatID) {
+		testUsersStorage.admins = append(testUsersStorage.admins, admin)
+	}
+}
+
+func (testUsersStorage *testUsersStorage) DeleteAdmin(chatID int64) bool {
+	for i, admin := range testUsersStorage.admins {
+		if admin.ChatID == chatID {
+			testUsersStorage.admins = append(testUsersStorage.admins[:i], testUsersStorage.admins[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (testUsersStorage *testUsersStorage) GetAdmins() []domain.Admin {
+	return testUsersStorage.admins
+}
+
+func (testUsersStorage *testUsersStorage) IsAdmin(chatID int64) bool {
+	for _, admin := range testUsersStorage.admins {
+		if admin.ChatID == chatID {
+			return true
+		}
+	}
+	return false
+}
+
 func TestCheckAddUser(t *testing.T) {
 	testUsersStorage := testUsersStorage{}
 
@@ -54,3 +102,16 @@ func TestCheckAddUser(t *testing.T) {
 
 	assert.Equal(t, []domain.User{user1, user2}, userService.GetUsers())
 }
+
+func TestUsersServiceAdmins(t *testing.T) {
+	userService := services.NewUsersService(&testUsersStorage{})
+
+	userService.AddAdmin(1)
+	userService.AddAdmin(1)
+	assert.Equal(t, []domain.Admin{{ChatID: 1}}, userService.GetAdmins())
+	assert.Equal(t, true, userService.IsAdmin(1))
+	assert.Equal(t, false, userService.IsAdmin(2))
+
+	assert.Equal(t, true, userService.DeleteAdmin(1))
+	assert.Equal(t, false, userService.IsAdmin(1))
+}
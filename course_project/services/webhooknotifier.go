@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Body of the webhook request, the notification fields are inlined
+type webhookPayload struct {
+	domain.Notification
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// WebhookNotifier posts the notifications as JSON to the webhook url of the subscriber
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+// Without allowInternal the webhooks can't reach loopback, private and link-local addresses,
+// otherwise any subscriber could make the bot call the services of its own network.
+// The address is checked when it is dialed, so the host can't be resolved to another address later
+func NewWebhookNotifier(allowInternal bool) *WebhookNotifier {
+	dialer := net.Dialer{Timeout: webhookTimeout}
+	if !allowInternal {
+		dialer.Control = checkWebhookAddress
+	}
+
+	transport := http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: webhookTimeout}
+	return &WebhookNotifier{client: &http.Client{Timeout: webhookTimeout, Transport: &transport}}
+}
+
+func checkWebhookAddress(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// Addresses of the bot host and its network
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast()
+}
+
+func (webhookNotifier *WebhookNotifier) Channel() domain.NotificationChannel {
+	return domain.NotificationChannelWebhook
+}
+
+// Any answer status except 2xx is an error
+func (webhookNotifier *WebhookNotifier) Notify(user domain.User, notification domain.Notification) error {
+	if user.WebhookURL == "" {
+		return errors.New("webhook url is not set")
+	}
+
+	body, err := json.Marshal(webhookPayload{Notification: notification, ChatID: user.ChatID, Text: notificationText(notification, user)})
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookNotifier.client.Post(user.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
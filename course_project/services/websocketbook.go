@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"nhooyr.io/websocket"
+)
+
+type krakenBookLevel struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"qty"`
+}
+
+// Snapshot and update messages of the book feed, update changes a single price level
+type krakenBookMessage struct {
+	ProductID string            `json:"product_id"`
+	Sequence  uint64            `json:"seq"`
+	Timestamp int64             `json:"timestamp"`
+	Bids      []krakenBookLevel `json:"bids"`
+	Asks      []krakenBookLevel `json:"asks"`
+	Side      domain.OrderSide  `json:"side"`
+	Price     float64           `json:"price"`
+	Quantity  float64           `json:"qty"`
+}
+
+func (websocketClient *WebsocketClient) UnsubscribeFromBook(productIDs []string) {
+	websocketClient.updateSubscription("book", productIDs, false)
+
+	websocketClient.mutex.Lock()
+	for _, productID := range productIDs {
+		delete(websocketClient.orderBooks, strings.ToUpper(productID))
+	}
+	websocketClient.mutex.Unlock()
+
+	websocketClient.logger.Printf("Unsubscribed from %v book", productIDs)
+}
+
+// Book of every product is built from the snapshot sent by the exchange after the subscription
+func (websocketClient *WebsocketClient) SubscribeToBook(productIDs []string) {
+	websocketClient.updateSubscription("book", productIDs, true)
+
+	websocketClient.logger.Printf("Subscribed to %v book", productIDs)
+}
+
+// Copy of the local order book, false until the snapshot is received and while the book is resynchronized
+func (websocketClient *WebsocketClient) GetOrderBook(symbol string) (domain.OrderBook, bool) {
+	websocketClient.mutex.Lock()
+	defer websocketClient.mutex.Unlock()
+
+	orderBook, ok := websocketClient.orderBooks[strings.ToUpper(symbol)]
+	if !ok {
+		return domain.OrderBook{}, false
+	}
+	return orderBook.Copy(), true
+}
+
+// Apply book snapshot or update, the book is dropped and requested again if an update is missed
+func (websocketClient *WebsocketClient) updateOrderBook(connection *websocket.Conn, feed string, bytes []byte) {
+	var message krakenBookMessage
+	if err := json.Unmarshal(bytes, &message); err != nil || message.ProductID == "" {
+		websocketClient.logger.Printf("Skipped malformed %s message: %s", feed, string(bytes))
+		return
+	}
+	symbol := strings.ToUpper(message.ProductID)
+
+	websocketClient.mutex.Lock()
+	resync := websocketClient.applyBookMessage(feed, symbol, message)
+	websocketClient.mutex.Unlock()
+
+	for _, productID := range resync {
+		websocketClient.send(connection, "unsubscribe", "book", []string{productID})
+		websocketClient.send(connection, "subscribe", "book", []string{productID})
+	}
+}
+
+// Returns subscribed products of the book to resubscribe to after a missed update,
+// the exchange sends a new snapshot after the subscription. Must be called with locked mutex
+func (websocketClient *WebsocketClient) applyBookMessage(feed string, symbol string, message krakenBookMessage) []string {
+	if feed == "book_snapshot" {
+		orderBook := &domain.OrderBook{
+			OrderBookSnapshot: domain.OrderBookSnapshot{Symbol: symbol},
+			Sequence:          message.Sequence,
+			Time:              message.Timestamp,
+		}
+		for _, level := range message.Bids {
+			orderBook.Update(domain.OrderSideBuy, level.Price, level.Quantity)
+		}
+		for _, level := range message.Asks {
+			orderBook.Update(domain.OrderSideSell, level.Price, level.Quantity)
+		}
+		websocketClient.orderBooks[symbol] = orderBook
+		return nil
+	}
+
+	// Updates received before the snapshot or during the resync are not applicable
+	orderBook, ok := websocketClient.orderBooks[symbol]
+	if !ok || message.Sequence <= orderBook.Sequence {
+		return nil
+	}
+
+	if message.Sequence > orderBook.Sequence+1 {
+		websocketClient.logger.Printf("Missed %d %s book updates after %d, requesting a new snapshot", message.Sequence-orderBook.Sequence-1, symbol, orderBook.Sequence)
+
+		delete(websocketClient.orderBooks, symbol)
+		websocketClient.status.BookResyncs++
+
+		var resync []string
+		for productID := range websocketClient.subscriptions["book"] {
+			if strings.EqualFold(productID, symbol) {
+				resync = append(resync, productID)
+			}
+		}
+		return resync
+	}
+
+	orderBook.Update(message.Side, message.Price, message.Quantity)
+	orderBook.Sequence = message.Sequence
+	orderBook.Time = message.Timestamp
+	return nil
+}
@@ -3,14 +3,27 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/legendiguess/kraken-trade-bot/domain"
 	"nhooyr.io/websocket"
 )
 
+const (
+	websocketPingInterval  = 30 * time.Second
+	websocketPingTimeout   = 10 * time.Second
+	websocketMinBackoff    = time.Second
+	websocketMaxBackoff    = time.Minute
+	websocketBackoffFactor = 2
+)
+
 type websocketCredentials interface {
 	GetWebsocketURL() string
+	GetKrakenPublicKey() string
+	GetKrakenSecretKey() string
 }
 
 type websocketClientLogger interface {
@@ -19,113 +32,462 @@ type websocketClientLogger interface {
 	Printf(format string, args ...interface{})
 }
 
+// WebsocketClient keeps connection to the exchange alive, dropped connection is restored
+// with exponential backoff and all active subscriptions are sent again
 type WebsocketClient struct {
-	connection *websocket.Conn
-	context    context.Context
-	logger     websocketClientLogger
+	url           string
+	publicKey     string
+	secretKey     string
+	context       context.Context
+	logger        websocketClientLogger
+	tickers       chan domain.Ticker
+	accountEvents chan domain.AccountEvent
+	trades        chan domain.MarketTrade
+
+	mutex         sync.Mutex
+	connection    *websocket.Conn
+	subscriptions map[string]map[string]bool
+	private       bool
+	status        domain.ConnectionStatus
+
+	// Local order books by upper case product, a book is added when its snapshot is received
+	orderBooks map[string]*domain.OrderBook
+
+	// Last ticker sequence number by upper case product, reset on every connection and every (un)subscription of the product,
+	// because a new subscription starts its own sequence
+	sequences map[string]uint64
+	// Products (un)subscribed after their last ticker, tickers of the old subscription may still be on the way,
+	// so the first backwards jump of the sequence starts the new one
+	resubscribed map[string]bool
 }
 
 // Create connected websocket client
 func NewWebsocketClient(ctx context.Context, websocketCredentials websocketCredentials, websocketClientLogger websocketClientLogger) *WebsocketClient {
-	var websocketClient = WebsocketClient{logger: websocketClientLogger}
-	websocketClient.context = ctx
+	var websocketClient = WebsocketClient{
+		url:           websocketCredentials.GetWebsocketURL(),
+		publicKey:     websocketCredentials.GetKrakenPublicKey(),
+		secretKey:     websocketCredentials.GetKrakenSecretKey(),
+		context:       ctx,
+		logger:        websocketClientLogger,
+		tickers:       make(chan domain.Ticker),
+		accountEvents: make(chan domain.AccountEvent),
+		trades:        make(chan domain.MarketTrade),
+		subscriptions: make(map[string]map[string]bool),
+		orderBooks:    make(map[string]*domain.OrderBook),
+		sequences:     make(map[string]uint64),
+		resubscribed:  make(map[string]bool),
+	}
 
-	var err error
+	websocketClient.setState(domain.ConnectionStateConnecting)
+	if !websocketClient.connect() {
+		close(websocketClient.tickers)
+		close(websocketClient.accountEvents)
+		close(websocketClient.trades)
+		return &websocketClient
+	}
 
-	for {
-		websocketClient.connection, _, err = websocket.Dial(websocketClient.context, websocketCredentials.GetWebsocketURL(), nil)
-		if err != nil {
-			time.Sleep(1 * time.Second)
-			websocketClient.logger.Debugf("Attempting to establish a websocket connection...")
-			continue
+	go websocketClient.readLoop()
+	go websocketClient.pingLoop()
+
+	return &websocketClient
+}
+
+func (websocketClient *WebsocketClient) UnsubscribeFromTicker(productIDs []string) {
+	websocketClient.updateSubscription("ticker", productIDs, false)
+
+	websocketClient.logger.Printf("Unsubscribed from %v ticker", productIDs)
+}
+
+func (websocketClient *WebsocketClient) SubscribeToTicker(productIDs []string) {
+	websocketClient.updateSubscription("ticker", productIDs, true)
+
+	websocketClient.logger.Printf("Subscribed to %v ticker", productIDs)
+}
+
+// Keep ticker, book and trade subscriptions covering exactly the given products,
+// trade channel must be read when the trades are subscribed
+func (websocketClient *WebsocketClient) SetMarketSubscription(productIDs []string) {
+	if removed := websocketClient.removedProducts("ticker", productIDs); len(removed) > 0 {
+		websocketClient.UnsubscribeFromTicker(removed)
+	}
+	if removed := websocketClient.removedProducts("book", productIDs); len(removed) > 0 {
+		websocketClient.UnsubscribeFromBook(removed)
+	}
+	if removed := websocketClient.removedProducts("trade", productIDs); len(removed) > 0 {
+		websocketClient.UnsubscribeFromTrades(removed)
+	}
+
+	if len(productIDs) > 0 {
+		websocketClient.SubscribeToTicker(productIDs)
+		websocketClient.SubscribeToBook(productIDs)
+		websocketClient.SubscribeToTrades(productIDs)
+	}
+}
+
+// Subscribed products of the feed which are not in the given products
+func (websocketClient *WebsocketClient) removedProducts(feed string, productIDs []string) []string {
+	websocketClient.mutex.Lock()
+	defer websocketClient.mutex.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, productID := range productIDs {
+		wanted[productID] = true
+	}
+	var removed []string
+	for productID := range websocketClient.subscriptions[feed] {
+		if !wanted[productID] {
+			removed = append(removed, productID)
 		}
-		break
 	}
-	websocketClient.logger.Debugf("Websocket connection established")
+	return removed
+}
 
-	// Ping every 30 sec
-	go func() {
-		for {
-			select {
-			case <-websocketClient.context.Done():
-				return
-			default:
-				time.Sleep(time.Second * 30)
-				websocketClient.connection.Ping(websocketClient.context)
-			}
+// Subscribe to fills, open orders, positions and balances of the account,
+// every connection requests a new challenge and signs it with the secret key
+func (websocketClient *WebsocketClient) SubscribeToPrivateFeeds() {
+	websocketClient.mutex.Lock()
+	websocketClient.private = true
+	connection := websocketClient.connection
+	websocketClient.mutex.Unlock()
+
+	if connection != nil {
+		websocketClient.requestChallenge(connection)
+	}
+
+	websocketClient.logger.Printf("Subscribed to %v private feeds", privateFeeds)
+}
+
+// Channel is the same for every call, it is closed when the context is done
+func (websocketClient *WebsocketClient) GetTickerChannel() <-chan domain.Ticker {
+	return websocketClient.tickers
+}
+
+// Events of the private feeds, channel is closed when the context is done
+func (websocketClient *WebsocketClient) GetAccountEventChannel() <-chan domain.AccountEvent {
+	return websocketClient.accountEvents
+}
+
+func (websocketClient *WebsocketClient) GetConnectionStatus() domain.ConnectionStatus {
+	websocketClient.mutex.Lock()
+	defer websocketClient.mutex.Unlock()
+
+	status := websocketClient.status
+	status.Subscriptions = make(map[string][]string)
+	for feed, productIDs := range websocketClient.subscriptions {
+		for productID := range productIDs {
+			status.Subscriptions[feed] = append(status.Subscriptions[feed], productID)
 		}
-	}()
+		sort.Strings(status.Subscriptions[feed])
+	}
+	if websocketClient.private {
+		for _, feed := range privateFeeds {
+			status.Subscriptions[feed] = []string{}
+		}
+	}
 
-	return &websocketClient
+	return status
 }
 
-func (websocketClient *WebsocketClient) UnsubscribeFromTicker(productIDs []string) {
-	bytes, err := json.Marshal(map[string]interface{}{
-		"event":       "unsubscribe",
-		"feed":        "ticker",
-		"product_ids": productIDs,
-	})
+func (websocketClient *WebsocketClient) CloseConnection() {
+	websocketClient.mutex.Lock()
+	defer websocketClient.mutex.Unlock()
 
-	if err != nil {
-		websocketClient.logger.Panicf("%v", err)
+	if websocketClient.connection != nil {
+		websocketClient.connection.Close(websocket.StatusNormalClosure, "")
 	}
+}
 
-	websocketClient.connection.Write(websocketClient.context, websocket.MessageText, bytes)
+func (websocketClient *WebsocketClient) updateSubscription(feed string, productIDs []string, subscribe bool) {
+	websocketClient.mutex.Lock()
+	if _, ok := websocketClient.subscriptions[feed]; !ok {
+		websocketClient.subscriptions[feed] = make(map[string]bool)
+	}
+	for _, productID := range productIDs {
+		if subscribe {
+			websocketClient.subscriptions[feed][productID] = true
+		} else {
+			delete(websocketClient.subscriptions[feed], productID)
+		}
+		if _, ok := websocketClient.sequences[strings.ToUpper(productID)]; ok && feed == "ticker" {
+			delete(websocketClient.sequences, strings.ToUpper(productID))
+			websocketClient.resubscribed[strings.ToUpper(productID)] = true
+		}
+	}
+	connection := websocketClient.connection
+	websocketClient.mutex.Unlock()
+
+	event := "unsubscribe"
+	if subscribe {
+		event = "subscribe"
+	}
 
-	websocketClient.logger.Printf("Unsubscribed from %s ticker", productIDs[0])
+	// If the connection is broken the subscription is sent after reconnect
+	if connection != nil {
+		websocketClient.send(connection, event, feed, productIDs)
+	}
 }
 
-func (websocketClient *WebsocketClient) SubscribeToTicker(productIDs []string) {
-	bytes, err := json.Marshal(map[string]interface{}{
-		"event":       "subscribe",
-		"feed":        "ticker",
+func (websocketClient *WebsocketClient) send(connection *websocket.Conn, event string, feed string, productIDs []string) {
+	websocketClient.write(connection, map[string]interface{}{
+		"event":       event,
+		"feed":        feed,
 		"product_ids": productIDs,
 	})
+}
+
+func (websocketClient *WebsocketClient) requestChallenge(connection *websocket.Conn) {
+	websocketClient.write(connection, map[string]interface{}{
+		"event":   "challenge",
+		"api_key": websocketClient.publicKey,
+	})
+}
+
+// Subscribe to the private feeds with the challenge received from the connection
+func (websocketClient *WebsocketClient) subscribePrivate(connection *websocket.Conn, challenge string) {
+	signedChallenge := signMessage(challenge, websocketClient.secretKey)
+
+	for _, feed := range privateFeeds {
+		websocketClient.write(connection, map[string]interface{}{
+			"event":              "subscribe",
+			"feed":               feed,
+			"api_key":            websocketClient.publicKey,
+			"original_challenge": challenge,
+			"signed_challenge":   signedChallenge,
+		})
+	}
+}
+
+func (websocketClient *WebsocketClient) write(connection *websocket.Conn, message map[string]interface{}) {
+	bytes, err := json.Marshal(message)
 
 	if err != nil {
 		websocketClient.logger.Panicf("%v", err)
 	}
 
-	websocketClient.connection.Write(websocketClient.context, websocket.MessageText, bytes)
+	if err := connection.Write(websocketClient.context, websocket.MessageText, bytes); err != nil {
+		websocketClient.logger.Printf("Can't send %s event to %v feed: %v", message["event"], message["feed"], err)
+	}
+}
+
+// Dial until success or the context is done, active subscriptions are sent to the new connection
+func (websocketClient *WebsocketClient) connect() bool {
+	backoff := websocketMinBackoff
+
+	for {
+		connection, _, err := websocket.Dial(websocketClient.context, websocketClient.url, nil)
+		if err == nil {
+			websocketClient.mutex.Lock()
+			websocketClient.connection = connection
+			websocketClient.sequences = make(map[string]uint64)
+			websocketClient.resubscribed = make(map[string]bool)
+			// Books are built again from the snapshots of the new subscriptions
+			websocketClient.orderBooks = make(map[string]*domain.OrderBook)
+			subscriptions := make(map[string][]string)
+			for feed, productIDs := range websocketClient.subscriptions {
+				for productID := range productIDs {
+					subscriptions[feed] = append(subscriptions[feed], productID)
+				}
+			}
+			private := websocketClient.private
+			websocketClient.mutex.Unlock()
 
-	websocketClient.logger.Printf("Subscribed to %s ticker", productIDs[0])
+			for feed, productIDs := range subscriptions {
+				if len(productIDs) > 0 {
+					websocketClient.send(connection, "subscribe", feed, productIDs)
+				}
+			}
+			if private {
+				websocketClient.requestChallenge(connection)
+			}
+
+			websocketClient.setState(domain.ConnectionStateConnected)
+			return true
+		}
+
+		websocketClient.logger.Debugf("Attempting to establish a websocket connection in %v: %v", backoff, err)
+
+		select {
+		case <-websocketClient.context.Done():
+			websocketClient.setState(domain.ConnectionStateClosed)
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= websocketBackoffFactor
+		if backoff > websocketMaxBackoff {
+			backoff = websocketMaxBackoff
+		}
+	}
 }
 
-func (websocketClient WebsocketClient) GetTickerChannel() <-chan domain.Ticker {
-	tickers := make(chan domain.Ticker)
+func (websocketClient *WebsocketClient) readLoop() {
+	defer close(websocketClient.tickers)
+	defer close(websocketClient.accountEvents)
+	defer close(websocketClient.trades)
 
-	go func() {
-		defer close(tickers)
+	for {
+		websocketClient.mutex.Lock()
+		connection := websocketClient.connection
+		websocketClient.mutex.Unlock()
+
+		_, bytes, err := connection.Read(websocketClient.context)
+		if err != nil {
+			if websocketClient.context.Err() != nil {
+				websocketClient.setState(domain.ConnectionStateClosed)
+				return
+			}
+
+			websocketClient.logger.Printf("Websocket connection is lost: %v", err)
+			connection.Close(websocket.StatusGoingAway, "")
+
+			websocketClient.mutex.Lock()
+			websocketClient.connection = nil
+			websocketClient.status.Reconnects++
+			websocketClient.mutex.Unlock()
+
+			websocketClient.setState(domain.ConnectionStateReconnecting)
+			if !websocketClient.connect() {
+				return
+			}
+			continue
+		}
+
+		var message websocketMessage
+		if err := json.Unmarshal(bytes, &message); err != nil {
+			continue
+		}
+
+		switch {
+		case message.Event == "challenge":
+			websocketClient.subscribePrivate(connection, message.Message)
+		case message.Event == "alert" || message.Event == "error":
+			websocketClient.logger.Printf("Websocket %s: %s", message.Event, string(bytes))
+		case message.Event != "":
+			// Subscription acknowledgements and info
+		case message.Feed == "ticker":
+			newTicker, ok := websocketClient.parseTicker(bytes)
+			if !ok {
+				continue
+			}
 
-		for {
 			select {
+			case websocketClient.tickers <- newTicker:
 			case <-websocketClient.context.Done():
+				websocketClient.setState(domain.ConnectionStateClosed)
 				return
-			default:
-				_, bytes, err := websocketClient.connection.Read(websocketClient.context)
+			}
+		case message.Feed == "book_snapshot" || message.Feed == "book":
+			websocketClient.updateOrderBook(connection, message.Feed, bytes)
+		case message.Feed == "trade_snapshot":
+			// Recent trades are sent again after every subscription
+		case message.Feed == "trade":
+			trade, ok := parseTrade(bytes)
+			if !ok {
+				websocketClient.logger.Printf("Skipped malformed trade: %s", string(bytes))
+				continue
+			}
 
-				if err != nil {
+			select {
+			case websocketClient.trades <- trade:
+			case <-websocketClient.context.Done():
+				websocketClient.setState(domain.ConnectionStateClosed)
+				return
+			}
+		default:
+			if accountEvent, ok := parseAccountEvent(message.Feed, bytes); ok {
+				select {
+				case websocketClient.accountEvents <- accountEvent:
+				case <-websocketClient.context.Done():
+					websocketClient.setState(domain.ConnectionStateClosed)
 					return
 				}
+			}
+		}
+	}
+}
 
-				var newTicker domain.Ticker
-				err = json.Unmarshal(bytes, &newTicker)
+// Decode and validate the ticker message, malformed and stale tickers are skipped, sequence gaps are logged
+func (websocketClient *WebsocketClient) parseTicker(bytes []byte) (domain.Ticker, bool) {
+	var ticker domain.Ticker
+	err := json.Unmarshal(bytes, &ticker)
+	if err == nil {
+		err = ticker.Validate()
+	}
+	if err != nil {
+		websocketClient.logger.Printf("Skipped malformed ticker: %v", err)
 
-				if err != nil {
-					continue
-				}
+		websocketClient.mutex.Lock()
+		websocketClient.status.MalformedTickers++
+		websocketClient.mutex.Unlock()
+		return ticker, false
+	}
 
-				// Checking if it is real ticker
-				if _, ok := newTicker["product_id"]; ok {
-					tickers <- newTicker
-				}
-			}
+	// Tickers without sequence numbers are not checked
+	if ticker.Sequence == 0 {
+		return ticker, true
+	}
+
+	return ticker, websocketClient.checkSequence(ticker)
+}
+
+// False if the ticker is stale, gaps are counted
+func (websocketClient *WebsocketClient) checkSequence(ticker domain.Ticker) bool {
+	websocketClient.mutex.Lock()
+	defer websocketClient.mutex.Unlock()
+
+	symbol := strings.ToUpper(ticker.Symbol)
+	lastSequence, ok := websocketClient.sequences[symbol]
+	if ok && ticker.Sequence <= lastSequence && websocketClient.resubscribed[symbol] {
+		websocketClient.logger.Printf("New %s ticker sequence starts at %d, last was %d", ticker.Symbol, ticker.Sequence, lastSequence)
+		delete(websocketClient.resubscribed, symbol)
+		ok = false
+	}
+	if ok && ticker.Sequence <= lastSequence {
+		websocketClient.logger.Printf("Skipped stale %s ticker %d, last is %d", ticker.Symbol, ticker.Sequence, lastSequence)
+		return false
+	}
+	if ok && ticker.Sequence > lastSequence+1 {
+		websocketClient.logger.Printf("Missed %d %s tickers after %d", ticker.Sequence-lastSequence-1, ticker.Symbol, lastSequence)
+		websocketClient.status.SequenceGaps += int(ticker.Sequence - lastSequence - 1)
+	}
+	websocketClient.sequences[symbol] = ticker.Sequence
+
+	return true
+}
+
+// Failed ping closes the connection, so the read loop reconnects
+func (websocketClient *WebsocketClient) pingLoop() {
+	for {
+		select {
+		case <-websocketClient.context.Done():
+			return
+		case <-time.After(websocketPingInterval):
 		}
-	}()
 
-	return tickers
+		websocketClient.mutex.Lock()
+		connection := websocketClient.connection
+		websocketClient.mutex.Unlock()
+
+		if connection == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(websocketClient.context, websocketPingTimeout)
+		err := connection.Ping(ctx)
+		cancel()
+
+		if err != nil && websocketClient.context.Err() == nil {
+			websocketClient.logger.Printf("Websocket ping failed: %v", err)
+			connection.Close(websocket.StatusGoingAway, "ping failed")
+		}
+	}
 }
 
-func (websocketClient *WebsocketClient) CloseConnection() {
-	websocketClient.connection.Close(websocket.StatusNormalClosure, "")
+func (websocketClient *WebsocketClient) setState(state domain.ConnectionState) {
+	websocketClient.mutex.Lock()
+	websocketClient.status.State = state
+	websocketClient.status.Since = time.Now()
+	websocketClient.mutex.Unlock()
+
+	websocketClient.logger.Printf("Websocket connection is %s", state)
 }
@@ -0,0 +1,376 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/krakentest"
+	"github.com/legendiguess/kraken-trade-bot/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type websocketCredentialsTest struct {
+	url       string
+	secretKey string
+}
+
+func (websocketCredentialsTest *websocketCredentialsTest) GetWebsocketURL() string {
+	return websocketCredentialsTest.url
+}
+
+func (websocketCredentialsTest *websocketCredentialsTest) GetKrakenPublicKey() string {
+	return krakentest.PublicKey
+}
+
+func (websocketCredentialsTest *websocketCredentialsTest) GetKrakenSecretKey() string {
+	return websocketCredentialsTest.secretKey
+}
+
+type websocketClientLoggerTest struct{}
+
+func (websocketClientLoggerTest *websocketClientLoggerTest) Panicf(format string, args ...interface{}) {
+}
+func (websocketClientLoggerTest *websocketClientLoggerTest) Debugf(format string, args ...interface{}) {
+}
+func (websocketClientLoggerTest *websocketClientLoggerTest) Printf(format string, args ...interface{}) {
+}
+
+func TestWebsocketClientTicker(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL()}, &websocketClientLoggerTest{})
+	tickerChannel := websocketClient.GetTickerChannel()
+
+	websocketClient.SubscribeToTicker([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+
+	select {
+	case ticker := <-tickerChannel:
+		assert.Equal(t, "PI_XBTUSD", ticker.Symbol)
+		assert.Equal(t, 59010.0, ticker.Ask)
+		assert.Equal(t, 59000.0, ticker.Bid)
+	case <-time.After(time.Second):
+		t.Fatal("ticker is not received")
+	}
+
+	websocketClient.UnsubscribeFromTicker([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return !kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebsocketClientReconnect(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL()}, &websocketClientLoggerTest{})
+	tickerChannel := websocketClient.GetTickerChannel()
+
+	websocketClient.SubscribeToTicker([]string{"PI_XBTUSD", "PI_ETHUSD"})
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_ETHUSD") }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, domain.ConnectionStateConnected, websocketClient.GetConnectionStatus().State)
+
+	kraken.DisconnectWebsockets()
+
+	// Subscriptions are replayed on the new connection
+	assert.Eventually(t, func() bool {
+		return kraken.Subscribed("ticker", "PI_XBTUSD") && kraken.Subscribed("ticker", "PI_ETHUSD")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := websocketClient.GetConnectionStatus()
+	assert.Equal(t, domain.ConnectionStateConnected, status.State)
+	assert.Equal(t, 1, status.Reconnects)
+	assert.Equal(t, map[string][]string{"ticker": {"PI_ETHUSD", "PI_XBTUSD"}}, status.Subscriptions)
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_ETHUSD", "bid": 4000.0, "ask": 4001.0})
+
+	select {
+	case ticker := <-tickerChannel:
+		assert.Equal(t, "PI_ETHUSD", ticker.Symbol)
+	case <-time.After(time.Second):
+		t.Fatal("ticker is not received after reconnect")
+	}
+
+	cancel()
+	_, ok := <-tickerChannel
+	assert.False(t, ok)
+}
+
+// Wait for the next account event of the given type skipping the others
+func nextAccountEvent(t *testing.T, accountEvents <-chan domain.AccountEvent, eventType domain.AccountEventType) domain.AccountEvent {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case accountEvent := <-accountEvents:
+			if accountEvent.Type == eventType {
+				return accountEvent
+			}
+		case <-timeout:
+			t.Fatalf("%s event is not received", eventType)
+			return domain.AccountEvent{}
+		}
+	}
+}
+
+func TestWebsocketClientPrivateFeeds(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL(), secretKey: krakentest.SecretKey}, &websocketClientLoggerTest{})
+	accountEvents := websocketClient.GetAccountEventChannel()
+
+	websocketClient.SubscribeToPrivateFeeds()
+	assert.Eventually(t, func() bool {
+		return kraken.Subscribed("fills", "") && kraken.Subscribed("open_orders", "") && kraken.Subscribed("open_positions", "") && kraken.Subscribed("account_balances_and_margins", "")
+	}, time.Second, 10*time.Millisecond)
+
+	assert.True(t, nextAccountEvent(t, accountEvents, domain.AccountEventFills).Snapshot)
+
+	// Orders made outside the bot are reported by the feeds
+	httpClient := services.NewHTTPClient(&krakenCredentialsTest{url: kraken.HTTPUrl()})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+
+	orderInfo, err := httpClient.SendOrder(domain.NewMarketOrderRequest("pi_xbtusd", domain.OrderSideBuy, 2))
+	assert.Nil(t, err)
+
+	fills := nextAccountEvent(t, accountEvents, domain.AccountEventFills)
+	assert.False(t, fills.Snapshot)
+	assert.Equal(t, 1, len(fills.Fills))
+	assert.Equal(t, orderInfo.ExecutionID, fills.Fills[0].FillID)
+	assert.Equal(t, "PI_XBTUSD", fills.Fills[0].Symbol)
+	assert.Equal(t, domain.OrderSideBuy, fills.Fills[0].Side)
+	assert.Equal(t, 2.0, fills.Fills[0].Quantity)
+	assert.Equal(t, 59010.0, fills.Fills[0].Price)
+
+	positions := nextAccountEvent(t, accountEvents, domain.AccountEventPositions)
+	assert.Equal(t, []domain.Position{{Symbol: "PI_XBTUSD", Quantity: 2, AverageEntryPrice: 59010}}, positions.Positions)
+
+	balances := nextAccountEvent(t, accountEvents, domain.AccountEventBalances)
+	assert.Equal(t, krakentest.InitialBalance, balances.MarginAccounts[0].Balance)
+
+	stopInfo, err := httpClient.SendOrder(domain.OrderRequest{Symbol: "pi_xbtusd", Side: domain.OrderSideSell, OrderType: domain.OrderTypeStop, Size: 2, StopPrice: 58000, ClientOrderID: "stop"})
+	assert.Nil(t, err)
+
+	openOrders := nextAccountEvent(t, accountEvents, domain.AccountEventOpenOrders)
+	assert.Equal(t, stopInfo.OrderID, openOrders.OpenOrders[0].OrderID)
+	assert.Equal(t, "stop", openOrders.OpenOrders[0].ClientOrderID)
+	assert.Equal(t, domain.OrderSideSell, openOrders.OpenOrders[0].Side)
+	assert.Equal(t, 58000.0, openOrders.OpenOrders[0].StopPrice)
+
+	assert.Nil(t, httpClient.CancelOrder(stopInfo.OrderID))
+
+	closed := nextAccountEvent(t, accountEvents, domain.AccountEventOrderClosed)
+	assert.Equal(t, stopInfo.OrderID, closed.OrderID)
+	assert.Equal(t, "cancelled_by_user", closed.Reason)
+
+	// Private feeds are subscribed again after reconnect
+	kraken.DisconnectWebsockets()
+	assert.Eventually(t, func() bool { return kraken.Subscribed("fills", "") }, 5*time.Second, 10*time.Millisecond)
+
+	fills = nextAccountEvent(t, accountEvents, domain.AccountEventFills)
+	assert.True(t, fills.Snapshot)
+	assert.Equal(t, 1, len(fills.Fills))
+}
+
+func TestWebsocketClientPrivateFeedsWrongKey(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL(), secretKey: "d3Jvbmc="}, &websocketClientLoggerTest{})
+	websocketClient.SubscribeToPrivateFeeds()
+	websocketClient.SubscribeToTicker([]string{"PI_XBTUSD"})
+
+	// Subscriptions signed with a wrong secret are rejected, public feeds still work
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, kraken.Subscribed("fills", ""))
+}
+
+func TestWebsocketClientMalformedTickers(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL()}, &websocketClientLoggerTest{})
+	tickerChannel := websocketClient.GetTickerChannel()
+
+	websocketClient.SubscribeToTicker([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": nil, "ask": 59010.0})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": "59000", "ask": 59010.0})
+	// Two more tickers are lost, the next one is stale
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59001.0, "ask": 59010.0, "seq": 6})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59002.0, "ask": 59010.0, "seq": 5})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59003.0, "ask": 59010.0, "seq": 7})
+
+	var bids []float64
+	var sequences []uint64
+	for len(bids) < 3 {
+		select {
+		case ticker := <-tickerChannel:
+			bids = append(bids, ticker.Bid)
+			sequences = append(sequences, ticker.Sequence)
+		case <-time.After(time.Second):
+			t.Fatal("ticker is not received")
+		}
+	}
+
+	assert.Equal(t, []float64{59000, 59001, 59003}, bids)
+	assert.Equal(t, []uint64{1, 6, 7}, sequences)
+	assert.Eventually(t, func() bool { return websocketClient.GetConnectionStatus().MalformedTickers == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 4, websocketClient.GetConnectionStatus().SequenceGaps)
+}
+
+func TestWebsocketClientOrderBook(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kraken.SetOrderBook(domain.OrderBookSnapshot{
+		Symbol: "PI_XBTUSD",
+		Bids:   []domain.PriceLevel{{Price: 59000, Size: 10}, {Price: 58990, Size: 5}},
+		Asks:   []domain.PriceLevel{{Price: 59010, Size: 7}},
+	})
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL()}, &websocketClientLoggerTest{})
+
+	_, ok := websocketClient.GetOrderBook("pi_xbtusd")
+	assert.Equal(t, false, ok)
+
+	websocketClient.SubscribeToBook([]string{"pi_xbtusd"})
+	assert.Eventually(t, func() bool {
+		_, ok := websocketClient.GetOrderBook("pi_xbtusd")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	orderBook, _ := websocketClient.GetOrderBook("pi_xbtusd")
+	assert.Equal(t, "PI_XBTUSD", orderBook.Symbol)
+	assert.Equal(t, 15.0, orderBook.BidDepth(0))
+
+	kraken.PublishBookUpdate("PI_XBTUSD", domain.OrderSideSell, 59020, 3)
+	kraken.PublishBookUpdate("PI_XBTUSD", domain.OrderSideBuy, 59000, 0)
+	assert.Eventually(t, func() bool {
+		orderBook, _ := websocketClient.GetOrderBook("pi_xbtusd")
+		return orderBook.Sequence == 2
+	}, time.Second, 10*time.Millisecond)
+
+	orderBook, _ = websocketClient.GetOrderBook("pi_xbtusd")
+	assert.Equal(t, []domain.PriceLevel{{Price: 58990, Size: 5}}, orderBook.Bids)
+	assert.Equal(t, []domain.PriceLevel{{Price: 59010, Size: 7}, {Price: 59020, Size: 3}}, orderBook.Asks)
+
+	// Missed update drops the book until the new snapshot with all updates arrives
+	kraken.SkipBookUpdates("PI_XBTUSD", 1)
+	kraken.PublishBookUpdate("PI_XBTUSD", domain.OrderSideBuy, 58995, 1)
+	assert.Eventually(t, func() bool {
+		orderBook, ok := websocketClient.GetOrderBook("pi_xbtusd")
+		return ok && orderBook.Sequence == 4
+	}, time.Second, 10*time.Millisecond)
+
+	orderBook, _ = websocketClient.GetOrderBook("pi_xbtusd")
+	assert.Equal(t, []domain.PriceLevel{{Price: 58995, Size: 1}, {Price: 58990, Size: 5}}, orderBook.Bids)
+	assert.Equal(t, 1, websocketClient.GetConnectionStatus().BookResyncs)
+
+	websocketClient.UnsubscribeFromBook([]string{"pi_xbtusd"})
+	_, ok = websocketClient.GetOrderBook("pi_xbtusd")
+	assert.Equal(t, false, ok)
+	assert.Eventually(t, func() bool { return !kraken.Subscribed("book", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebsocketClientTrades(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL()}, &websocketClientLoggerTest{})
+	tradeChannel := websocketClient.GetTradeChannel()
+
+	websocketClient.SetMarketSubscription([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return kraken.Subscribed("trade", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+
+	at := time.Date(2021, 11, 25, 19, 51, 11, 0, time.UTC)
+	kraken.PublishTrade("pi_xbtusd", domain.OrderSideSell, 59000, 2, at)
+
+	select {
+	case trade := <-tradeChannel:
+		assert.Equal(t, "PI_XBTUSD", trade.Symbol)
+		assert.Equal(t, domain.OrderSideSell, trade.Side)
+		assert.Equal(t, 59000.0, trade.Price)
+		assert.Equal(t, 2.0, trade.Size)
+		assert.Equal(t, "2021-11-25T19:51:11.000Z", trade.Time)
+	case <-time.After(time.Second):
+		t.Fatal("trade is not received")
+	}
+
+	websocketClient.SetMarketSubscription(nil)
+	assert.Eventually(t, func() bool { return !kraken.Subscribed("trade", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, false, kraken.Subscribed("book", "PI_XBTUSD"))
+}
+
+func TestWebsocketClientResubscribedTickers(t *testing.T) {
+	kraken := krakentest.NewServer()
+	defer kraken.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	websocketClient := services.NewWebsocketClient(ctx, &websocketCredentialsTest{url: kraken.WebsocketURL()}, &websocketClientLoggerTest{})
+	tickerChannel := websocketClient.GetTickerChannel()
+
+	receive := func() uint64 {
+		select {
+		case ticker := <-tickerChannel:
+			return ticker.Sequence
+		case <-time.After(time.Second):
+			t.Fatal("ticker is not received")
+			return 0
+		}
+	}
+
+	websocketClient.SubscribeToTicker([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0, "seq": 10})
+	assert.Equal(t, uint64(10), receive())
+
+	// Every subscription starts its own sequence
+	websocketClient.UnsubscribeFromTicker([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return !kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+	websocketClient.SetMarketSubscription([]string{"PI_XBTUSD"})
+	assert.Eventually(t, func() bool { return kraken.Subscribed("ticker", "PI_XBTUSD") }, time.Second, 10*time.Millisecond)
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0, "seq": 1})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	assert.Equal(t, uint64(1), receive())
+	assert.Equal(t, uint64(2), receive())
+
+	// Ticker of the old subscription received after the new one is sent doesn't hold the new sequence back
+	websocketClient.SetMarketSubscription([]string{"PI_XBTUSD"})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0, "seq": 3})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0, "seq": 1})
+	kraken.PublishTicker(map[string]interface{}{"product_id": "PI_XBTUSD", "bid": 59000.0, "ask": 59010.0})
+	assert.Equal(t, uint64(3), receive())
+	assert.Equal(t, uint64(1), receive())
+	assert.Equal(t, uint64(2), receive())
+	assert.Equal(t, 0, websocketClient.GetConnectionStatus().SequenceGaps)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Private feeds require signed challenge in every subscription
+var privateFeeds = []string{"fills", "open_orders", "open_positions", "account_balances_and_margins"}
+
+type websocketMessage struct {
+	Event   string `json:"event"`
+	Feed    string `json:"feed"`
+	Message string `json:"message"`
+}
+
+type krakenFill struct {
+	Instrument    string  `json:"instrument"`
+	Time          float64 `json:"time"`
+	Price         float64 `json:"price"`
+	Buy           bool    `json:"buy"`
+	Quantity      float64 `json:"qty"`
+	OrderID       string  `json:"order_id"`
+	ClientOrderID string  `json:"cli_ord_id"`
+	FillID        string  `json:"fill_id"`
+	FillType      string  `json:"fill_type"`
+	FeePaid       float64 `json:"fee_paid"`
+}
+
+type krakenOpenOrder struct {
+	Instrument    string  `json:"instrument"`
+	Time          float64 `json:"time"`
+	Quantity      float64 `json:"qty"`
+	Filled        float64 `json:"filled"`
+	LimitPrice    float64 `json:"limit_price"`
+	StopPrice     float64 `json:"stop_price"`
+	Type          string  `json:"type"`
+	OrderID       string  `json:"order_id"`
+	ClientOrderID string  `json:"cli_ord_id"`
+	Direction     int     `json:"direction"`
+	ReduceOnly    bool    `json:"reduce_only"`
+}
+
+type krakenPosition struct {
+	Instrument string  `json:"instrument"`
+	Balance    float64 `json:"balance"`
+	EntryPrice float64 `json:"entry_price"`
+}
+
+type krakenMarginAccount struct {
+	Name              string  `json:"name"`
+	Balance           float64 `json:"balance"`
+	PnL               float64 `json:"pnl"`
+	PortfolioValue    float64 `json:"pv"`
+	AvailableMargin   float64 `json:"am"`
+	InitialMargin     float64 `json:"im"`
+	MaintenanceMargin float64 `json:"mm"`
+}
+
+type privateFeedMessage struct {
+	Feed           string                `json:"feed"`
+	Fills          []krakenFill          `json:"fills"`
+	Orders         []krakenOpenOrder     `json:"orders"`
+	Order          *krakenOpenOrder      `json:"order"`
+	IsCancel       bool                  `json:"is_cancel"`
+	Reason         string                `json:"reason"`
+	OrderID        string                `json:"order_id"`
+	ClientOrderID  string                `json:"cli_ord_id"`
+	Positions      []krakenPosition      `json:"positions"`
+	MarginAccounts []krakenMarginAccount `json:"margin_accounts"`
+}
+
+// Convert message of a private feed to the account event, false is returned for other messages
+func parseAccountEvent(feed string, bytes []byte) (domain.AccountEvent, bool) {
+	var message privateFeedMessage
+	if err := json.Unmarshal(bytes, &message); err != nil {
+		return domain.AccountEvent{}, false
+	}
+
+	switch feed {
+	case "fills", "fills_snapshot":
+		event := domain.AccountEvent{Type: domain.AccountEventFills, Snapshot: feed == "fills_snapshot", Fills: []domain.Fill{}}
+		for _, fill := range message.Fills {
+			side := domain.OrderSideSell
+			if fill.Buy {
+				side = domain.OrderSideBuy
+			}
+
+			event.Fills = append(event.Fills, domain.Fill{
+				FillID:        fill.FillID,
+				OrderID:       fill.OrderID,
+				ClientOrderID: fill.ClientOrderID,
+				Symbol:        fill.Instrument,
+				Side:          side,
+				Price:         fill.Price,
+				Quantity:      fill.Quantity,
+				Fee:           fill.FeePaid,
+				FillType:      fill.FillType,
+				Timestamp:     millisecondsToTimestamp(fill.Time),
+			})
+		}
+		return event, true
+	case "open_orders_snapshot":
+		event := domain.AccountEvent{Type: domain.AccountEventOpenOrders, Snapshot: true, OpenOrders: []domain.OpenOrder{}}
+		for _, order := range message.Orders {
+			event.OpenOrders = append(event.OpenOrders, order.toOpenOrder())
+		}
+		return event, true
+	case "open_orders":
+		if message.IsCancel {
+			event := domain.AccountEvent{Type: domain.AccountEventOrderClosed, OrderID: message.OrderID, ClientOrderID: message.ClientOrderID, Reason: message.Reason}
+			if message.Order != nil {
+				event.OrderID = message.Order.OrderID
+				event.ClientOrderID = message.Order.ClientOrderID
+			}
+			return event, true
+		}
+		if message.Order == nil {
+			return domain.AccountEvent{}, false
+		}
+		return domain.AccountEvent{Type: domain.AccountEventOpenOrders, OpenOrders: []domain.OpenOrder{message.Order.toOpenOrder()}, Reason: message.Reason}, true
+	case "open_positions":
+		event := domain.AccountEvent{Type: domain.AccountEventPositions, Snapshot: true, Positions: []domain.Position{}}
+		for _, position := range message.Positions {
+			event.Positions = append(event.Positions, domain.Position{Symbol: position.Instrument, Quantity: position.Balance, AverageEntryPrice: position.EntryPrice})
+		}
+		return event, true
+	case "account_balances_and_margins":
+		event := domain.AccountEvent{Type: domain.AccountEventBalances, Snapshot: true, MarginAccounts: []domain.MarginAccount{}}
+		for _, account := range message.MarginAccounts {
+			event.MarginAccounts = append(event.MarginAccounts, domain.MarginAccount{
+				Name:              account.Name,
+				Balance:           account.Balance,
+				PortfolioValue:    account.PortfolioValue,
+				AvailableMargin:   account.AvailableMargin,
+				InitialMargin:     account.InitialMargin,
+				MaintenanceMargin: account.MaintenanceMargin,
+				PnL:               account.PnL,
+			})
+		}
+		return event, true
+	}
+
+	return domain.AccountEvent{}, false
+}
+
+func (order *krakenOpenOrder) toOpenOrder() domain.OpenOrder {
+	side := domain.OrderSideBuy
+	if order.Direction == 1 {
+		side = domain.OrderSideSell
+	}
+
+	return domain.OpenOrder{
+		OrderID:       order.OrderID,
+		ClientOrderID: order.ClientOrderID,
+		Symbol:        order.Instrument,
+		Side:          side,
+		Type:          order.Type,
+		Quantity:      order.Quantity,
+		Filled:        order.Filled,
+		LimitPrice:    order.LimitPrice,
+		StopPrice:     order.StopPrice,
+		ReduceOnly:    order.ReduceOnly,
+		Timestamp:     millisecondsToTimestamp(order.Time),
+	}
+}
+
+// Format unix time in milliseconds the way the exchange formats timestamps
+func millisecondsToTimestamp(milliseconds float64) string {
+	return time.Unix(0, int64(milliseconds)*int64(time.Millisecond)).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+// Time format of the REST api
+const marketTimeFormat = "2006-01-02T15:04:05.000Z"
+
+type krakenTrade struct {
+	ProductID string           `json:"product_id"`
+	UID       string           `json:"uid"`
+	Side      domain.OrderSide `json:"side"`
+	Type      string           `json:"type"`
+	Sequence  uint64           `json:"seq"`
+	Time      int64            `json:"time"`
+	Quantity  float64          `json:"qty"`
+	Price     float64          `json:"price"`
+}
+
+func (websocketClient *WebsocketClient) UnsubscribeFromTrades(productIDs []string) {
+	websocketClient.updateSubscription("trade", productIDs, false)
+
+	websocketClient.logger.Printf("Unsubscribed from %v trades", productIDs)
+}
+
+// Recent trades sent by the exchange after the subscription are skipped, so only new trades are received
+func (websocketClient *WebsocketClient) SubscribeToTrades(productIDs []string) {
+	websocketClient.updateSubscription("trade", productIDs, true)
+
+	websocketClient.logger.Printf("Subscribed to %v trades", productIDs)
+}
+
+// Public trades of the subscribed products, channel is closed when the context is done
+func (websocketClient *WebsocketClient) GetTradeChannel() <-chan domain.MarketTrade {
+	return websocketClient.trades
+}
+
+// Time of the trade has the format of the history endpoint
+func parseTrade(bytes []byte) (domain.MarketTrade, bool) {
+	var trade krakenTrade
+	if err := json.Unmarshal(bytes, &trade); err != nil || trade.ProductID == "" || trade.Price <= 0 || trade.Quantity <= 0 {
+		return domain.MarketTrade{}, false
+	}
+
+	return domain.MarketTrade{
+		TradeID: trade.Sequence,
+		UID:     trade.UID,
+		Symbol:  strings.ToUpper(trade.ProductID),
+		Side:    trade.Side,
+		Price:   trade.Price,
+		Size:    trade.Quantity,
+		Type:    trade.Type,
+		Time:    time.Unix(0, trade.Time*int64(time.Millisecond)).UTC().Format(marketTimeFormat),
+	}, true
+}
@@ -0,0 +1,152 @@
+// Package smtptest provides a local stand-in for an SMTP server
+package smtptest
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message received by the server
+type Message struct {
+	From string
+	To   []string
+	// Headers and body as sent by the client
+	Data string
+	// Empty if the client didn't authenticate
+	Username string
+}
+
+type Server struct {
+	listener net.Listener
+
+	mutex    sync.Mutex
+	messages []Message
+}
+
+// Server listens on the loopback address, STARTTLS is not offered and AUTH PLAIN accepts any password
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	server := Server{listener: listener}
+	go server.accept()
+	return &server
+}
+
+// Address in the host:port form
+func (server *Server) Address() string {
+	return server.listener.Addr().String()
+}
+
+func (server *Server) Close() {
+	server.listener.Close()
+}
+
+// Messages received by the server
+func (server *Server) Messages() []Message {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]Message(nil), server.messages...)
+}
+
+func (server *Server) accept() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.serve(conn)
+	}
+}
+
+func (server *Server) serve(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	var message Message
+	reply := func(line string) bool {
+		return text.PrintfLine("%s", line) == nil
+	}
+
+	if !reply("220 localhost smtptest") {
+		return
+	}
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		argument := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+
+		switch command {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			// AUTH PLAIN base64("\x00username\x00password")
+			fields := strings.Fields(argument)
+			if len(fields) != 2 || strings.ToUpper(fields[0]) != "PLAIN" {
+				reply("504 unsupported authentication")
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			parts := strings.Split(string(decoded), "\x00")
+			if err != nil || len(parts) != 3 {
+				reply("501 malformed authentication")
+				continue
+			}
+			message.Username = parts[1]
+			reply("235 authenticated")
+		case "MAIL":
+			message.From = trimAddress(argument, "FROM:")
+			reply("250 ok")
+		case "RCPT":
+			message.To = append(message.To, trimAddress(argument, "TO:"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			message.Data = strings.Join(lines, "\n")
+
+			server.mutex.Lock()
+			server.messages = append(server.messages, message)
+			server.mutex.Unlock()
+
+			message = Message{Username: message.Username}
+			reply("250 ok")
+		case "RSET":
+			message = Message{Username: message.Username}
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// "FROM:<bot@example.com>" is "bot@example.com"
+func trimAddress(argument string, prefix string) string {
+	if len(argument) >= len(prefix) && strings.EqualFold(argument[:len(prefix)], prefix) {
+		argument = argument[len(prefix):]
+	}
+	address := strings.Fields(argument)
+	if len(address) == 0 {
+		return ""
+	}
+	return strings.Trim(address[0], "<>")
+}
@@ -1,6 +1,12 @@
 package storage
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
 
 type credentialsLogger interface {
 	Panicf(format string, args ...interface{})
@@ -13,19 +19,57 @@ type Credentials struct {
 	databaseDSN         string
 	websocketURL        string
 	httpUrl             string
+	telegramAPIEndpoint string
+	serverAddress       string
+	tradingMode         domain.TradingMode
+	candlePeriods       []domain.CandlePeriod
+	apiOperatorKey      string
+	telegramAdmins      []int64
+	smtpAddress         string
+	smtpFrom            string
+	smtpUsername        string
+	smtpPassword        string
 	logger              credentialsLogger
 }
 
 func NewCredentialsStorage(credentialsLogger credentialsLogger) *Credentials {
-	credentials := Credentials{}
+	credentials := Credentials{logger: credentialsLogger}
 
 	credentials.krakenPublicKey = credentials.getKeyFromEnv("KRAKEN_API_PUBLIC_KEY")
 	credentials.krakenSecretKey = credentials.getKeyFromEnv("KRAKEN_API_SECRET_KEY")
 	credentials.telegramBotAPIToken = credentials.getKeyFromEnv("TELEGRAM_BOT_API_TOKEN")
 	credentials.databaseDSN = credentials.getKeyFromEnv("DATABASE_DSN")
-	credentials.websocketURL = "wss://demo-futures.kraken.com/ws/v1"
-	credentials.httpUrl = "https://demo-futures.kraken.com/derivatives"
-	credentials.logger = credentialsLogger
+	credentials.websocketURL = credentials.getOptionalFromEnv("KRAKEN_WEBSOCKET_URL", "wss://demo-futures.kraken.com/ws/v1")
+	credentials.httpUrl = credentials.getOptionalFromEnv("KRAKEN_HTTP_URL", "https://demo-futures.kraken.com/derivatives")
+	credentials.telegramAPIEndpoint = credentials.getOptionalFromEnv("TELEGRAM_API_ENDPOINT", "https://api.telegram.org/bot%s/%s")
+	credentials.serverAddress = credentials.getOptionalFromEnv("SERVER_ADDRESS", ":5000")
+	credentials.apiOperatorKey = credentials.getOptionalFromEnv("API_OPERATOR_KEY", "")
+	credentials.smtpAddress = credentials.getOptionalFromEnv("SMTP_ADDRESS", "")
+	credentials.smtpFrom = credentials.getOptionalFromEnv("SMTP_FROM", "kraken-trade-bot@localhost")
+	credentials.smtpUsername = credentials.getOptionalFromEnv("SMTP_USERNAME", "")
+	credentials.smtpPassword = credentials.getOptionalFromEnv("SMTP_PASSWORD", "")
+	credentials.tradingMode = domain.TradingMode(credentials.getOptionalFromEnv("TRADING_MODE", string(domain.TradingModeLive)))
+
+	if credentials.tradingMode != domain.TradingModeLive && credentials.tradingMode != domain.TradingModePaper {
+		credentials.logger.Panicf("Unknown TRADING_MODE %q, use %q or %q", credentials.tradingMode, domain.TradingModeLive, domain.TradingModePaper)
+	}
+
+	candlePeriods, err := domain.ParseCandlePeriods(credentials.getOptionalFromEnv("CANDLE_PERIODS", "1m,5m,15m,1h"))
+	if err != nil {
+		credentials.logger.Panicf("Wrong CANDLE_PERIODS: %v", err)
+	}
+	credentials.candlePeriods = candlePeriods
+
+	for _, chatID := range strings.Split(credentials.getOptionalFromEnv("TELEGRAM_ADMIN_CHAT_IDS", ""), ",") {
+		if chatID = strings.TrimSpace(chatID); chatID == "" {
+			continue
+		}
+		admin, err := strconv.ParseInt(chatID, 10, 64)
+		if err != nil {
+			credentials.logger.Panicf("Wrong TELEGRAM_ADMIN_CHAT_IDS: %v", err)
+		}
+		credentials.telegramAdmins = append(credentials.telegramAdmins, admin)
+	}
 
 	return &credentials
 }
@@ -54,6 +98,51 @@ func (credentials *Credentials) GetHTTPUrl() string {
 	return credentials.httpUrl
 }
 
+// Endpoint template with token and method placeholders
+func (credentials *Credentials) GetTelegramAPIEndpoint() string {
+	return credentials.telegramAPIEndpoint
+}
+
+func (credentials *Credentials) GetServerAddress() string {
+	return credentials.serverAddress
+}
+
+func (credentials *Credentials) GetTradingMode() domain.TradingMode {
+	return credentials.tradingMode
+}
+
+func (credentials *Credentials) GetCandlePeriods() []domain.CandlePeriod {
+	return credentials.candlePeriods
+}
+
+// Operator key of the REST API saved at the start, empty if it is not set
+func (credentials *Credentials) GetAPIOperatorKey() string {
+	return credentials.apiOperatorKey
+}
+
+// Chats added to the telegram admin whitelist at the start
+func (credentials *Credentials) GetTelegramAdmins() []int64 {
+	return credentials.telegramAdmins
+}
+
+// Address of the SMTP server in the host:port form, empty if emails are not sent
+func (credentials *Credentials) GetSMTPAddress() string {
+	return credentials.smtpAddress
+}
+
+func (credentials *Credentials) GetSMTPFrom() string {
+	return credentials.smtpFrom
+}
+
+// Empty if the SMTP server doesn't need authentication
+func (credentials *Credentials) GetSMTPUsername() string {
+	return credentials.smtpUsername
+}
+
+func (credentials *Credentials) GetSMTPPassword() string {
+	return credentials.smtpPassword
+}
+
 func (credentials *Credentials) getKeyFromEnv(keyName string) string {
 	key := os.Getenv(keyName)
 	if key == "" {
@@ -61,3 +150,10 @@ func (credentials *Credentials) getKeyFromEnv(keyName string) string {
 	}
 	return key
 }
+
+func (credentials *Credentials) getOptionalFromEnv(keyName string, defaultValue string) string {
+	if key := os.Getenv(keyName); key != "" {
+		return key
+	}
+	return defaultValue
+}
@@ -1,66 +1,301 @@
 package storage
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/legendiguess/kraken-trade-bot/domain"
 	"github.com/stretchr/testify/assert"
 )
 
 type databaseCredentials struct {
+	dsn string
 }
 
 func (databaseCredentials *databaseCredentials) GetDatabaseDSN() string {
-	return `user=user password=user dbname=kraken-trade-bot-test port=5432 TimeZone=Europe/Moscow`
+	return databaseCredentials.dsn
 }
 
-type databaseLogger struct{}
+type databaseLogger struct {
+	t *testing.T
+}
 
 func (databaseLogger *databaseLogger) Panicf(format string, args ...interface{}) {
-
+	databaseLogger.t.Fatalf(format, args...)
 }
 
-func newTestStorage() *Storage {
-	storage := New(&databaseCredentials{}, &databaseLogger{})
-	storage.dataBase.Migrator().DropTable(&domain.InstrumentConfig{}, &domain.User{})
-	storage.dataBase.AutoMigrate(&domain.InstrumentConfig{}, &domain.User{})
+// Postgres is used if TEST_DATABASE_DSN is set, otherwise every test gets its own memory database
+func newTestStorage(t *testing.T) *Storage {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		dsn = "sqlite::memory:"
+	}
+
+	storage := New(&databaseCredentials{dsn: dsn}, &databaseLogger{t: t})
+	storage.dataBase.Migrator().DropTable(&domain.InstrumentConfig{}, &domain.User{}, &domain.RiskLimits{}, &domain.OrderInfo{}, &domain.Candle{}, &domain.TradingTransition{}, &domain.APIKey{}, &domain.Admin{}, &domain.OutboxMessage{})
+	storage.dataBase.AutoMigrate(&domain.InstrumentConfig{}, &domain.User{}, &domain.RiskLimits{}, &domain.OrderInfo{}, &domain.Candle{}, &domain.TradingTransition{}, &domain.APIKey{}, &domain.Admin{}, &domain.OutboxMessage{})
 	return storage
 }
 
-func TestSaveAndGetInstrument(t *testing.T) {
-	testStoage := newTestStorage()
+func TestSQLiteFile(t *testing.T) {
+	dsn := "sqlite:" + filepath.Join(t.TempDir(), "bot.db")
+
+	testStoage := New(&databaseCredentials{dsn: dsn}, &databaseLogger{t: t})
+	testStoage.SaveInstrument(domain.NewInstrumentConfig("test"))
+
+	// Data is kept after reopening
+	testStoage = New(&databaseCredentials{dsn: dsn}, &databaseLogger{t: t})
+	assert.Equal(t, []domain.InstrumentConfig{domain.NewInstrumentConfig("test")}, testStoage.GetInstruments())
+}
+
+func TestInstruments(t *testing.T) {
+	testStoage := newTestStorage(t)
 
-	_, ok := testStoage.GetInstrument()
+	assert.Equal(t, []domain.InstrumentConfig{}, testStoage.GetInstruments())
 
-	testStoage.SaveInstrument(domain.InstrumentConfig{Symbol: "test1"})
+	testInstrument1 := domain.NewInstrumentConfig("test1")
+	testInstrument2 := domain.InstrumentConfig{Symbol: "test2", OrderSize: 5}
 
-	testInstrument := domain.InstrumentConfig{}
-	testInstrument.Symbol = "test2"
+	testStoage.SaveInstrument(testInstrument2)
+	testStoage.SaveInstrument(testInstrument1)
 
-	testStoage.SaveInstrument(testInstrument)
+	testInstrument2.Enabled = true
+	testStoage.SaveInstrument(testInstrument2)
 
-	instrument, ok := testStoage.GetInstrument()
+	assert.Equal(t, []domain.InstrumentConfig{testInstrument1, testInstrument2}, testStoage.GetInstruments())
 
-	assert.Equal(t, true, ok)
+	assert.Equal(t, true, testStoage.DeleteInstrument("test1"))
+	assert.Equal(t, false, testStoage.DeleteInstrument("test1"))
 
-	assert.Equal(t, testInstrument, instrument)
+	assert.Equal(t, []domain.InstrumentConfig{testInstrument2}, testStoage.GetInstruments())
+}
+
+func TestRiskLimits(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	_, ok := testStoage.GetRiskLimits()
+	assert.Equal(t, false, ok)
+
+	testStoage.SaveRiskLimits(domain.RiskLimits{MaxPosition: 1})
+	testStoage.SaveRiskLimits(domain.RiskLimits{MaxNotional: 100, KillSwitch: true})
+
+	limits, ok := testStoage.GetRiskLimits()
+	assert.Equal(t, true, ok)
+	assert.Equal(t, domain.RiskLimits{ID: 1, MaxNotional: 100, KillSwitch: true}, limits)
 }
 
 func TestUsers(t *testing.T) {
-	testStoage := newTestStorage()
+	testStoage := newTestStorage(t)
 
 	assert.Equal(t, []domain.User{}, testStoage.GetUsers())
 
 	user1 := domain.User{ChatID: 1}
-	user2 := domain.User{ChatID: 1}
+	user2 := domain.User{ChatID: 2}
 
 	testStoage.NewUser(&user1)
 	testStoage.NewUser(&user2)
 
-	assert.Equal(t, []domain.User{user1, user1}, testStoage.GetUsers())
+	assert.Equal(t, []domain.User{user1, user2}, testStoage.GetUsers())
 
-	findedUser, ok := testStoage.FindUser(&user2)
+	findedUser, ok := testStoage.FindUser(&domain.User{ChatID: 2})
 
 	assert.Equal(t, true, ok)
 	assert.Equal(t, user2, findedUser)
+
+	_, ok = testStoage.FindUser(&domain.User{ChatID: 3})
+	assert.Equal(t, false, ok)
+
+	settings := domain.User{ChatID: 2, Channels: "telegram,email", Email: "trader@example.com", Language: domain.LanguageEnglish, Timezone: "Asia/Tokyo",
+		Instruments: "PI_XBTUSD", Sides: "buy", MinNotional: 100, Categories: "fills,errors", QuietFrom: 23, QuietTo: 7}
+	testStoage.UpdateUser(settings)
+	assert.Equal(t, []domain.User{user1, settings}, testStoage.GetUsers())
+
+	findedUser, ok = testStoage.FindUser(&domain.User{ChatID: 2})
+	assert.Equal(t, true, ok)
+	assert.Equal(t, settings, findedUser)
+
+	assert.Equal(t, true, testStoage.DeleteUser(1))
+	assert.Equal(t, false, testStoage.DeleteUser(1))
+	assert.Equal(t, []domain.User{settings}, testStoage.GetUsers())
+}
+
+func TestOrderInfos(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	testStoage.NewOrderInfo(&domain.OrderInfo{OrderID: "placed", Status: domain.OrderStatusPlaced, Timestamp: "2021-11-25T19:51:11.000Z"})
+	testStoage.NewOrderInfo(&domain.OrderInfo{OrderID: "filled", ExecutionID: "execution", LaterExecutionIDs: "second,third", Status: domain.OrderStatusFilled, Timestamp: "2021-11-25T19:51:10.000Z"})
+
+	assert.Equal(t, true, testStoage.HasOrder("placed"))
+	assert.Equal(t, false, testStoage.HasOrder("unknown"))
+	assert.Equal(t, true, testStoage.HasExecution("execution"))
+	assert.Equal(t, true, testStoage.HasExecution("second"))
+	assert.Equal(t, true, testStoage.HasExecution("third"))
+	assert.Equal(t, false, testStoage.HasExecution("thi"))
+	assert.Equal(t, false, testStoage.HasExecution("unknown"))
+
+	testStoage.SetOrderStatus("placed", domain.OrderStatusCancelled)
+	testStoage.SetOrderStatus("filled", domain.OrderStatusCancelled)
+
+	orderInfos := testStoage.GetOrderInfos()
+	if assert.Len(t, orderInfos, 2) {
+		assert.Equal(t, "filled", orderInfos[0].OrderID)
+		assert.Equal(t, domain.OrderStatusFilled, orderInfos[0].Status)
+		assert.Equal(t, domain.OrderStatusCancelled, orderInfos[1].Status)
+	}
+}
+
+func TestFindOrderInfos(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	testStoage.NewOrderInfo(&domain.OrderInfo{OrderID: "1", Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Timestamp: "2021-11-25T19:00:00.000Z"})
+	// Timestamps without milliseconds or in other time zones are stored in one format
+	testStoage.NewOrderInfo(&domain.OrderInfo{OrderID: "2", Symbol: "pi_xbtusd", Side: domain.OrderSideSell, Timestamp: "2021-11-25T20:00:00Z"})
+	testStoage.NewOrderInfo(&domain.OrderInfo{OrderID: "3", Symbol: "PI_ETHUSD", Side: domain.OrderSideBuy, Timestamp: "2021-11-26T00:00:00.5+03:00"})
+	testStoage.NewOrderInfo(&domain.OrderInfo{OrderID: "4", Symbol: "PI_XBTUSD", Side: domain.OrderSideBuy, Timestamp: "2021-11-25T22:00:00.000Z"})
+
+	orderIDs := func(orderInfos []domain.OrderInfo) []string {
+		ids := []string{}
+		for _, orderInfo := range orderInfos {
+			ids = append(ids, orderInfo.OrderID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"4", "2", "1"}, orderIDs(testStoage.FindOrderInfos(domain.OrderFilter{Symbol: "PI_XBTUSD"})))
+	assert.Equal(t, []string{"4", "3"}, orderIDs(testStoage.FindOrderInfos(domain.OrderFilter{Side: domain.OrderSideBuy, Limit: 2})))
+
+	from := time.Date(2021, 11, 25, 20, 0, 0, 0, time.UTC)
+	filter := domain.OrderFilter{From: from, To: from.Add(2 * time.Hour)}
+	assert.Equal(t, []string{"3", "2"}, orderIDs(testStoage.FindOrderInfos(filter)))
+	assert.Equal(t, "2021-11-25T21:00:00.500Z", testStoage.FindOrderInfos(filter)[0].Timestamp)
+
+	page := testStoage.FindOrderInfos(domain.OrderFilter{Limit: 2})
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, []string{"2", "1"}, orderIDs(testStoage.FindOrderInfos(domain.OrderFilter{Cursor: page[1].ID})))
+	}
+
+	// Orders stored before the timestamps were normalized
+	testStoage.dataBase.Create(&domain.OrderInfo{OrderID: "5", Timestamp: "2021-11-25T22:30:00+01:00"})
+	testStoage.normalizeOrderTimes()
+	assert.Equal(t, []string{"5", "3", "2"}, orderIDs(testStoage.FindOrderInfos(filter)))
+}
+
+func TestCandles(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	start := time.Date(2021, 11, 25, 19, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		candle := domain.NewCandle("PI_XBTUSD", domain.CandlePeriod1m, start.Add(time.Duration(i)*time.Minute), float64(100+i))
+		testStoage.SaveCandle(&candle)
+	}
+	other := domain.NewCandle("PI_XBTUSD", domain.CandlePeriod5m, start, 100)
+	testStoage.SaveCandle(&other)
+
+	candles := testStoage.GetCandles("PI_XBTUSD", domain.CandlePeriod1m, 2)
+	if assert.Len(t, candles, 2) {
+		assert.Equal(t, 101.0, candles[0].Open)
+		assert.Equal(t, 102.0, candles[1].Open)
+		assert.Equal(t, start.Add(2*time.Minute), candles[1].Start.UTC())
+	}
+
+	assert.Equal(t, []domain.Candle{}, testStoage.GetCandles("PI_ETHUSD", domain.CandlePeriod1m, 10))
+}
+
+func TestTradingTransitions(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	assert.Empty(t, testStoage.GetTradingTransitions(10))
+
+	testStoage.SaveTradingTransition(&domain.TradingTransition{From: domain.TradingStateRunning, To: domain.TradingStatePaused, Source: "api"})
+	testStoage.SaveTradingTransition(&domain.TradingTransition{From: domain.TradingStatePaused, To: domain.TradingStateRunning, Source: "telegram"})
+
+	transitions := testStoage.GetTradingTransitions(1)
+	if assert.Len(t, transitions, 1) {
+		assert.Equal(t, domain.TradingStateRunning, transitions[0].To)
+		assert.Equal(t, "telegram", transitions[0].Source)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	testStoage.NewAPIKey(&domain.APIKey{Name: "reader", KeyHash: "hash1", Role: domain.APIRoleReadOnly})
+	testStoage.NewAPIKey(&domain.APIKey{Name: "operator", KeyHash: "hash2", Role: domain.APIRoleOperator, SigningSecret: "secret"})
+
+	apiKey, ok := testStoage.FindAPIKey("hash2")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "operator", apiKey.Name)
+	assert.Equal(t, "secret", apiKey.SigningSecret)
+
+	_, ok = testStoage.FindAPIKey("unknown")
+	assert.Equal(t, false, ok)
+
+	apiKeys := testStoage.GetAPIKeys()
+	if assert.Len(t, apiKeys, 2) {
+		assert.Equal(t, "operator", apiKeys[0].Name)
+	}
+
+	assert.Equal(t, true, testStoage.DeleteAPIKey("reader"))
+	assert.Equal(t, false, testStoage.DeleteAPIKey("reader"))
+}
+
+func TestAdmins(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	testStoage.SaveAdmin(domain.Admin{ChatID: 2})
+	testStoage.SaveAdmin(domain.Admin{ChatID: 1})
+	testStoage.SaveAdmin(domain.Admin{ChatID: 2})
+
+	assert.Equal(t, []domain.Admin{{ChatID: 1}, {ChatID: 2}}, testStoage.GetAdmins())
+	assert.Equal(t, true, testStoage.IsAdmin(1))
+	assert.Equal(t, false, testStoage.IsAdmin(3))
+
+	assert.Equal(t, true, testStoage.DeleteAdmin(1))
+	assert.Equal(t, false, testStoage.DeleteAdmin(1))
+	assert.Equal(t, false, testStoage.IsAdmin(1))
+}
+
+func TestOutboxMessages(t *testing.T) {
+	testStoage := newTestStorage(t)
+
+	first := domain.OutboxMessage{ChatID: 1, Channel: domain.NotificationChannelTelegram, Status: domain.OutboxStatusPending, NextAttempt: "2021-12-01T10:00:00.000Z"}
+	later := domain.OutboxMessage{ChatID: 2, Channel: domain.NotificationChannelTelegram, Status: domain.OutboxStatusPending, NextAttempt: "2021-12-01T10:00:01.000Z"}
+	parked := domain.OutboxMessage{ChatID: 1, Channel: domain.NotificationChannelEmail, Status: domain.OutboxStatusParked, NextAttempt: "2021-12-01T09:00:00.000Z"}
+	// Waits for the first message of the chat
+	next := domain.OutboxMessage{ChatID: 1, Channel: domain.NotificationChannelTelegram, Status: domain.OutboxStatusPending, NextAttempt: "2021-12-01T10:00:00.000Z"}
+	webhook := domain.OutboxMessage{ChatID: 1, Channel: domain.NotificationChannelWebhook, Status: domain.OutboxStatusPending, NextAttempt: "2021-12-01T10:00:00.000Z"}
+	testStoage.NewOutboxMessage(&first)
+	testStoage.NewOutboxMessage(&later)
+	testStoage.NewOutboxMessage(&parked)
+	testStoage.NewOutboxMessage(&next)
+	testStoage.NewOutboxMessage(&webhook)
+
+	telegram := domain.NotificationChannelTelegram
+	assert.Equal(t, []domain.OutboxMessage{first}, testStoage.GetDueOutboxHeads(telegram, "2021-12-01T10:00:00.500Z", 10))
+	assert.Equal(t, []domain.OutboxMessage{first, later}, testStoage.GetDueOutboxHeads(telegram, "2021-12-01T10:00:01.000Z", 10))
+	assert.Equal(t, []domain.OutboxMessage{first}, testStoage.GetDueOutboxHeads(telegram, "2021-12-01T10:00:01.000Z", 1))
+	// Every channel has its own heads
+	assert.Equal(t, []domain.OutboxMessage{webhook}, testStoage.GetDueOutboxHeads(domain.NotificationChannelWebhook, "2021-12-01T10:00:00.500Z", 10))
+	assert.Empty(t, testStoage.GetDueOutboxHeads(domain.NotificationChannelEmail, "2021-12-01T10:00:01.000Z", 10))
+
+	// The retried head holds the later message of the chat back
+	first.Attempts = 1
+	first.NextAttempt = "2021-12-01T10:00:02.000Z"
+	testStoage.SaveOutboxMessage(&first)
+	testStoage.DeleteOutboxMessage(later.ID)
+	assert.Empty(t, testStoage.GetDueOutboxHeads(telegram, "2021-12-01T10:00:01.000Z", 10))
+	assert.Equal(t, []domain.OutboxMessage{first}, testStoage.GetDueOutboxHeads(telegram, "2021-12-01T10:00:02.000Z", 10))
+
+	testStoage.DeleteOutboxMessage(first.ID)
+	assert.Equal(t, []domain.OutboxMessage{next}, testStoage.GetDueOutboxHeads(telegram, "2021-12-01T10:00:02.000Z", 10))
+
+	testStoage.ParkOutboxMessages(1, domain.NotificationChannelWebhook, "unavailable")
+	assert.Empty(t, testStoage.GetDueOutboxHeads(domain.NotificationChannelWebhook, "2021-12-01T10:00:02.000Z", 10))
+
+	var parkedWebhook domain.OutboxMessage
+	testStoage.dataBase.Take(&parkedWebhook, webhook.ID)
+	assert.Equal(t, domain.OutboxStatusParked, parkedWebhook.Status)
+	assert.Equal(t, "unavailable", parkedWebhook.LastError)
 }
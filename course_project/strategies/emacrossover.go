@@ -0,0 +1,86 @@
+package strategies
+
+import (
+	"errors"
+	"math"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/indicators"
+)
+
+const EMACrossoverName = "ema_crossover"
+
+// EMACrossover buys when the fast EMA of the ticker prices crosses above the slow EMA
+// and sells the bought position when it crosses below
+type EMACrossover struct {
+	fast           *indicators.EMA
+	slow           *indicators.EMA
+	holding        bool
+	lastDifference float64
+	// The first difference after the warm-up is not a cross
+	hasDifference bool
+}
+
+// Params: "fast" - period of the fast EMA in tickers, 12 by default, "slow" - period of the slow EMA, 26 by default
+func NewEMACrossover(params Params) (Strategy, error) {
+	fastPeriod := params.Get("fast", 12)
+	slowPeriod := params.Get("slow", 26)
+	if fastPeriod != math.Trunc(fastPeriod) || slowPeriod != math.Trunc(slowPeriod) {
+		return nil, errors.New("fast and slow periods must be whole numbers")
+	}
+	if fastPeriod >= slowPeriod {
+		return nil, errors.New("fast period must be shorter than slow period")
+	}
+
+	fast, err := indicators.NewEMA(int(fastPeriod))
+	if err != nil {
+		return nil, err
+	}
+	slow, err := indicators.NewEMA(int(slowPeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EMACrossover{fast: fast, slow: slow}, nil
+}
+
+func (emaCrossover *EMACrossover) Decide(ticker domain.Ticker) domain.Action {
+	bar := indicators.FromTicker(ticker)
+	emaCrossover.fast.Update(bar)
+	emaCrossover.slow.Update(bar)
+	if !emaCrossover.slow.Ready() {
+		return domain.ActionNothing
+	}
+
+	difference := emaCrossover.fast.Value() - emaCrossover.slow.Value()
+	lastDifference, hasDifference := emaCrossover.lastDifference, emaCrossover.hasDifference
+	emaCrossover.lastDifference, emaCrossover.hasDifference = difference, true
+	if !hasDifference {
+		return domain.ActionNothing
+	}
+
+	switch {
+	case !emaCrossover.holding && lastDifference <= 0 && difference > 0:
+		emaCrossover.holding = true
+		return domain.ActionBuy
+	case emaCrossover.holding && lastDifference >= 0 && difference < 0:
+		emaCrossover.holding = false
+		return domain.ActionSell
+	}
+	return domain.ActionNothing
+}
+
+// Long position is sold on the next downward cross
+func (emaCrossover *EMACrossover) Resume(position domain.Position) {
+	emaCrossover.holding = position.Quantity > 0
+}
+
+// EMA values are reported after the warm-up
+func (emaCrossover *EMACrossover) State() map[string]interface{} {
+	state := map[string]interface{}{"holding": emaCrossover.holding, "ready": emaCrossover.slow.Ready()}
+	if emaCrossover.slow.Ready() {
+		state["fast_ema"] = emaCrossover.fast.Value()
+		state["slow_ema"] = emaCrossover.slow.Value()
+	}
+	return state
+}
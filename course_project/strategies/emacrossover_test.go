@@ -0,0 +1,49 @@
+package strategies_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEMACrossover(t *testing.T) {
+	strategy, err := strategies.NewEMACrossover(strategies.Params{"fast": 2, "slow": 3})
+	assert.Nil(t, err)
+
+	decide := func(last float64) domain.Action {
+		return strategy.Decide(domain.Ticker{Symbol: "test", Bid: last - 1, Ask: last + 1, Last: last})
+	}
+
+	// Falling prices during the warm-up, then the fast EMA crosses above the slow one and back
+	assert.Equal(t, domain.ActionNothing, decide(103))
+	assert.Equal(t, domain.ActionNothing, decide(102))
+	assert.Equal(t, domain.ActionNothing, decide(101))
+	assert.Equal(t, domain.ActionNothing, decide(100))
+	assert.Equal(t, domain.ActionBuy, decide(104))
+	assert.Equal(t, domain.ActionNothing, decide(106))
+	assert.Equal(t, domain.ActionSell, decide(98))
+	assert.Equal(t, domain.ActionNothing, decide(97))
+
+	_, err = strategies.NewEMACrossover(strategies.Params{"fast": 26, "slow": 12})
+	assert.NotNil(t, err)
+	_, err = strategies.NewEMACrossover(strategies.Params{"fast": 2.5})
+	assert.NotNil(t, err)
+	_, err = strategies.NewEMACrossover(strategies.Params{"fast": 0, "slow": 3})
+	assert.NotNil(t, err)
+}
+
+func TestEMACrossoverResume(t *testing.T) {
+	strategy, err := strategies.NewEMACrossover(strategies.Params{"fast": 1, "slow": 2})
+	assert.Nil(t, err)
+
+	strategy.(strategies.Resumer).Resume(domain.Position{Symbol: "test", Quantity: 2, AverageEntryPrice: 100})
+	assert.Equal(t, map[string]interface{}{"holding": true, "ready": false}, strategy.(strategies.Reporter).State())
+
+	// The held position is sold on the first downward cross instead of buying on the upward one
+	assert.Equal(t, domain.ActionNothing, strategy.Decide(domain.Ticker{Symbol: "test", Bid: 99, Ask: 101, Last: 100}))
+	assert.Equal(t, domain.ActionNothing, strategy.Decide(domain.Ticker{Symbol: "test", Bid: 101, Ask: 103, Last: 102}))
+	assert.Equal(t, domain.ActionSell, strategy.Decide(domain.Ticker{Symbol: "test", Bid: 97, Ask: 99, Last: 98}))
+	assert.Equal(t, false, strategy.(strategies.Reporter).State()["holding"])
+}
@@ -0,0 +1,101 @@
+package strategies
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+type Registry struct {
+	mutex     sync.RWMutex
+	factories map[string]Factory
+	active    domain.StrategyConfig
+	revision  uint64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// Create registry with all built-in strategies, take_profit is active by default
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+
+	registry.Register(TakeProfitName, NewTakeProfit)
+	registry.Register(EMACrossoverName, NewEMACrossover)
+
+	_ = registry.Select(domain.StrategyConfig{Name: TakeProfitName})
+
+	return registry
+}
+
+func (registry *Registry) Register(name string, factory Factory) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.factories[name] = factory
+}
+
+// Return sorted names of registered strategies
+func (registry *Registry) Names() []string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Make strategy active, config is validated by creating the strategy once
+func (registry *Registry) Select(config domain.StrategyConfig) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	factory, ok := registry.factories[config.Name]
+	if !ok {
+		return fmt.Errorf("unknown strategy %q", config.Name)
+	}
+
+	if _, err := factory(Params(config.Params)); err != nil {
+		return err
+	}
+
+	registry.active = config
+	registry.revision++
+
+	return nil
+}
+
+func (registry *Registry) GetStrategyConfig() domain.StrategyConfig {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.active
+}
+
+// Revision is changed on every successful Select
+func (registry *Registry) Revision() uint64 {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.revision
+}
+
+// Create new instance of the active strategy
+func (registry *Registry) NewStrategy() (Strategy, error) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	factory, ok := registry.factories[registry.active.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", registry.active.Name)
+	}
+
+	return factory(Params(registry.active.Params))
+}
@@ -0,0 +1,57 @@
+package strategies_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
+	"github.com/stretchr/testify/assert"
+)
+
+type strategyTest struct {
+	action domain.Action
+}
+
+func (strategyTest *strategyTest) Decide(ticker domain.Ticker) domain.Action {
+	return strategyTest.action
+}
+
+func newStrategyTest(params strategies.Params) (strategies.Strategy, error) {
+	if params.Get("fail", 0) != 0 {
+		return nil, errors.New("fail")
+	}
+	return &strategyTest{action: domain.Action(params.Get("action", float64(domain.ActionNothing)))}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	registry := strategies.NewRegistry()
+	registry.Register("test", newStrategyTest)
+	registry.Register("another", newStrategyTest)
+
+	assert.Equal(t, []string{"another", "test"}, registry.Names())
+
+	_, err := registry.NewStrategy()
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, registry.Select(domain.StrategyConfig{Name: "unknown"}))
+	assert.NotNil(t, registry.Select(domain.StrategyConfig{Name: "test", Params: map[string]float64{"fail": 1}}))
+	assert.Equal(t, uint64(0), registry.Revision())
+
+	config := domain.StrategyConfig{Name: "test", Params: map[string]float64{"action": float64(domain.ActionBuy)}}
+	assert.Nil(t, registry.Select(config))
+	assert.Equal(t, uint64(1), registry.Revision())
+	assert.Equal(t, config, registry.GetStrategyConfig())
+
+	strategy, err := registry.NewStrategy()
+	assert.Nil(t, err)
+	assert.Equal(t, domain.ActionBuy, strategy.Decide(domain.Ticker{}))
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	registry := strategies.NewDefaultRegistry()
+
+	assert.Equal(t, strategies.TakeProfitName, registry.GetStrategyConfig().Name)
+
+	assert.NotNil(t, registry.Select(domain.StrategyConfig{Name: strategies.TakeProfitName, Params: map[string]float64{"ratio": -1}}))
+}
@@ -0,0 +1,63 @@
+package strategies
+
+import "github.com/legendiguess/kraken-trade-bot/domain"
+
+// Strategy makes trading decisions for a single instrument.
+// A new strategy is created every time the traded instrument or the active strategy changes,
+// so implementations may keep their state in plain fields
+type Strategy interface {
+	Decide(ticker domain.Ticker) domain.Action
+}
+
+// Planner is optionally implemented by strategies that choose order size or protect positions with stop orders,
+// Plan is called for every buy or sell action right after Decide
+type Planner interface {
+	Plan(ticker domain.Ticker, action domain.Action) domain.OrderPlan
+}
+
+// Resumer is optionally implemented by strategies whose state depends on the held position,
+// Resume is called once right after the strategy is created when a position of its instrument is held
+type Resumer interface {
+	Resume(position domain.Position)
+}
+
+// OrderBooks gives read access to the local order books of the traded instruments
+type OrderBooks interface {
+	GetOrderBook(symbol string) (domain.OrderBook, bool)
+}
+
+// BookReader is optionally implemented by strategies that look at the order book,
+// SetOrderBooks is called once right after the strategy is created
+type BookReader interface {
+	SetOrderBooks(orderBooks OrderBooks)
+}
+
+// Candles gives read access to the closed candles of the traded instruments
+type Candles interface {
+	GetCandles(symbol string, period domain.CandlePeriod, count int) []domain.Candle
+}
+
+// CandleReader is optionally implemented by strategies that decide on candles,
+// SetCandles is called once right after the strategy is created
+type CandleReader interface {
+	SetCandles(candles Candles)
+}
+
+// Reporter is optionally implemented by strategies that expose their state over the api,
+// State is called after every decision and must return a new map
+type Reporter interface {
+	State() map[string]interface{}
+}
+
+type Params map[string]float64
+
+// Return parameter value or fallback if parameter is not set
+func (params Params) Get(name string, fallback float64) float64 {
+	if value, ok := params[name]; ok {
+		return value
+	}
+	return fallback
+}
+
+// Factory creates configured strategy, returns an error if params are invalid
+type Factory func(params Params) (Strategy, error)
@@ -0,0 +1,80 @@
+package strategies
+
+import (
+	"errors"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+)
+
+const TakeProfitName = "take_profit"
+
+// TakeProfit buys at the ask price and sells when the bid rises above the buy price by the given ratio
+type TakeProfit struct {
+	ratio               float64
+	stopLoss            float64
+	lastAction          domain.Action
+	previousActionPrice float64
+}
+
+// Params: "ratio" - required price growth before selling, 0.001 by default,
+// "stop_loss" - allowed price fall below the buy price before the protective stop sells, disabled by default
+func NewTakeProfit(params Params) (Strategy, error) {
+	ratio := params.Get("ratio", 0.001)
+	if ratio <= 0 {
+		return nil, errors.New("ratio must be positive")
+	}
+
+	stopLoss := params.Get("stop_loss", 0)
+	if stopLoss < 0 || stopLoss >= 1 {
+		return nil, errors.New("stop_loss must be between 0 and 1")
+	}
+
+	return &TakeProfit{ratio: ratio, stopLoss: stopLoss, lastAction: domain.ActionSell}, nil
+}
+
+func (takeProfit *TakeProfit) Decide(ticker domain.Ticker) domain.Action {
+	action := domain.ActionNothing
+
+	if takeProfit.lastAction == domain.ActionSell {
+		takeProfit.previousActionPrice = ticker.Ask
+		action = domain.ActionBuy
+	} else if takeProfit.lastAction == domain.ActionBuy {
+		if ticker.Bid-takeProfit.previousActionPrice >= takeProfit.previousActionPrice*takeProfit.ratio {
+			takeProfit.previousActionPrice = ticker.Bid
+			action = domain.ActionSell
+		}
+	}
+
+	if action != domain.ActionNothing {
+		takeProfit.lastAction = action
+	}
+
+	return action
+}
+
+// Long position is held as if it was bought at its average entry price
+func (takeProfit *TakeProfit) Resume(position domain.Position) {
+	if position.Quantity > 0 {
+		takeProfit.lastAction = domain.ActionBuy
+		takeProfit.previousActionPrice = position.AverageEntryPrice
+	}
+}
+
+// With stop loss the buy is protected by a stop order, so the sell only closes what is left of the position
+func (takeProfit *TakeProfit) Plan(ticker domain.Ticker, action domain.Action) domain.OrderPlan {
+	if takeProfit.stopLoss == 0 {
+		return domain.OrderPlan{}
+	}
+
+	if action == domain.ActionBuy {
+		return domain.OrderPlan{StopPrice: takeProfit.previousActionPrice * (1 - takeProfit.stopLoss)}
+	}
+	return domain.OrderPlan{ReduceOnly: true}
+}
+
+func (takeProfit *TakeProfit) State() map[string]interface{} {
+	return map[string]interface{}{
+		"holding":               takeProfit.lastAction == domain.ActionBuy,
+		"previous_action_price": takeProfit.previousActionPrice,
+	}
+}
@@ -0,0 +1,45 @@
+package strategies_test
+
+import (
+	"testing"
+
+	"github.com/legendiguess/kraken-trade-bot/domain"
+	"github.com/legendiguess/kraken-trade-bot/strategies"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeProfitStopLoss(t *testing.T) {
+	strategy, err := strategies.NewTakeProfit(strategies.Params{"ratio": 0.01, "stop_loss": 0.05})
+	assert.Nil(t, err)
+
+	planner, ok := strategy.(strategies.Planner)
+	assert.True(t, ok)
+
+	ticker := domain.Ticker{Symbol: "test", Ask: 100.0, Bid: 99.0}
+	assert.Equal(t, domain.ActionBuy, strategy.Decide(ticker))
+	assert.Equal(t, domain.OrderPlan{StopPrice: 95}, planner.Plan(ticker, domain.ActionBuy))
+
+	ticker = domain.Ticker{Symbol: "test", Ask: 102.0, Bid: 101.0}
+	assert.Equal(t, domain.ActionSell, strategy.Decide(ticker))
+	assert.Equal(t, domain.OrderPlan{ReduceOnly: true}, planner.Plan(ticker, domain.ActionSell))
+
+	_, err = strategies.NewTakeProfit(strategies.Params{"stop_loss": 1})
+	assert.NotNil(t, err)
+}
+
+func TestTakeProfitResume(t *testing.T) {
+	strategy, err := strategies.NewTakeProfit(strategies.Params{"ratio": 0.01})
+	assert.Nil(t, err)
+
+	resumer, ok := strategy.(strategies.Resumer)
+	assert.True(t, ok)
+
+	// Short position is not traded by the strategy, it starts by buying
+	resumer.Resume(domain.Position{Symbol: "test", Quantity: -1, AverageEntryPrice: 100})
+	assert.Equal(t, domain.ActionBuy, strategy.Decide(domain.Ticker{Symbol: "test", Ask: 100.0, Bid: 99.0}))
+
+	strategy, _ = strategies.NewTakeProfit(strategies.Params{"ratio": 0.01})
+	strategy.(strategies.Resumer).Resume(domain.Position{Symbol: "test", Quantity: 2, AverageEntryPrice: 100})
+	assert.Equal(t, domain.ActionNothing, strategy.Decide(domain.Ticker{Symbol: "test", Ask: 101.0, Bid: 100.5}))
+	assert.Equal(t, domain.ActionSell, strategy.Decide(domain.Ticker{Symbol: "test", Ask: 102.0, Bid: 101.0}))
+}
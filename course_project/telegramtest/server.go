@@ -0,0 +1,187 @@
+// Package telegramtest provides a local stand-in for the Telegram Bot API
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message sent by the bot
+type Message struct {
+	ChatID int64
+	Text   string
+}
+
+type Server struct {
+	httpServer *httptest.Server
+
+	mutex        sync.Mutex
+	updates      []map[string]interface{}
+	nextUpdateID int
+	nextID       int
+	messages     []Message
+	newUpdate    chan struct{}
+	// Chats which blocked the bot
+	blocked map[int64]bool
+	// Seconds to wait answered to the next message, zero if the next message is accepted
+	retryAfter int
+}
+
+func NewServer() *Server {
+	server := Server{nextUpdateID: 1, nextID: 1, newUpdate: make(chan struct{}, 1), blocked: make(map[int64]bool)}
+	server.httpServer = httptest.NewServer(http.HandlerFunc(server.handle))
+	return &server
+}
+
+// Endpoint template for tgbotapi.NewBotAPIWithAPIEndpoint
+func (server *Server) APIEndpoint() string {
+	return server.httpServer.URL + "/bot%s/%s"
+}
+
+func (server *Server) Close() {
+	server.httpServer.Close()
+}
+
+// Send text message from the user to the bot
+func (server *Server) SendUserMessage(chatID int64, text string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	message := map[string]interface{}{
+		"message_id": server.nextID,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+		"from":       map[string]interface{}{"id": chatID, "is_bot": false, "first_name": "test"},
+		"text":       text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message["entities"] = []map[string]interface{}{{"type": "bot_command", "offset": 0, "length": len(command)}}
+	}
+
+	server.updates = append(server.updates, map[string]interface{}{"update_id": server.nextUpdateID, "message": message})
+	server.nextUpdateID++
+	server.nextID++
+
+	select {
+	case server.newUpdate <- struct{}{}:
+	default:
+	}
+}
+
+// Messages to the chat are answered as if the user blocked the bot
+func (server *Server) BlockChat(chatID int64) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.blocked[chatID] = true
+}
+
+// The next message is answered with the flood control error
+func (server *Server) RateLimitNext(retryAfter int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.retryAfter = retryAfter
+}
+
+// Messages sent by the bot
+func (server *Server) Messages() []Message {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]Message(nil), server.messages...)
+}
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+
+	// Path is /bot<token>/<method>
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	method := parts[len(parts)-1]
+
+	switch method {
+	case "getMe":
+		writeResult(w, map[string]interface{}{"id": 1, "is_bot": true, "first_name": "test", "username": "test_bot"})
+	case "getUpdates":
+		writeResult(w, server.getUpdates(r))
+	case "sendMessage":
+		chatID, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+
+		server.mutex.Lock()
+		if server.blocked[chatID] {
+			server.mutex.Unlock()
+			writeError(w, http.StatusForbidden, "Forbidden: bot was blocked by the user", nil)
+			return
+		}
+		if retryAfter := server.retryAfter; retryAfter > 0 {
+			server.retryAfter = 0
+			server.mutex.Unlock()
+			writeError(w, http.StatusTooManyRequests, "Too Many Requests: retry after "+strconv.Itoa(retryAfter), map[string]interface{}{"retry_after": retryAfter})
+			return
+		}
+		server.messages = append(server.messages, Message{ChatID: chatID, Text: r.Form.Get("text")})
+		messageID := server.nextID
+		server.nextID++
+		server.mutex.Unlock()
+
+		writeResult(w, map[string]interface{}{
+			"message_id": messageID,
+			"date":       time.Now().Unix(),
+			"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+			"text":       r.Form.Get("text"),
+		})
+	default:
+		writeError(w, http.StatusNotFound, "Not Found", nil)
+	}
+}
+
+// Long polling is limited to one second to keep tests fast
+func (server *Server) getUpdates(r *http.Request) []map[string]interface{} {
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	deadline := time.After(time.Second)
+
+	for {
+		server.mutex.Lock()
+		updates := []map[string]interface{}{}
+		for _, update := range server.updates {
+			if update["update_id"].(int) >= offset {
+				updates = append(updates, update)
+			}
+		}
+		server.mutex.Unlock()
+
+		if len(updates) > 0 {
+			return updates
+		}
+
+		select {
+		case <-server.newUpdate:
+		case <-deadline:
+			return updates
+		case <-r.Context().Done():
+			return updates
+		}
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func writeError(w http.ResponseWriter, code int, description string, parameters map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	answer := map[string]interface{}{"ok": false, "error_code": code, "description": description}
+	if parameters != nil {
+		answer["parameters"] = parameters
+	}
+	_ = json.NewEncoder(w).Encode(answer)
+}